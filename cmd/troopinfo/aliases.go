@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rs/zerolog/log"
+)
+
+// defaultFieldAliases map the names the community uses for fields to the
+// field names. Users can add their own, or override these, in the aliases
+// section of the configuration file.
+var defaultFieldAliases = map[string]string{
+	"hp":            "default_unit_hp",
+	"unit hp":       "default_unit_hp",
+	"hp per level":  "unit_hp_lev_up",
+	"speed":         "move_speed",
+	"turn rate":     "rotate_rate",
+	"sight":         "sight_range",
+	"range":         "attack_range_max",
+	"min range":     "attack_range_min",
+	"attack":        "direct_attack",
+	"melee attack":  "direct_attack",
+	"ranged attack": "indirect_attack",
+	"def":           "defense",
+	"size":          "base_width",
+	"melee def":     "resist_melee",
+	"ranged def":    "resist_ranged",
+	"frontal def":   "resist_frontal",
+	"explosion def": "resist_explosion",
+	"fire def":      "resist_fire",
+	"ice def":       "resist_ice",
+	"lightning def": "resist_lightning",
+	"holy def":      "resist_holy",
+	"curse def":     "resist_curse",
+	"poison def":    "resist_poison",
+	"units x":       "default_unit_num_x",
+	"units y":       "default_unit_num_y",
+	"splash":        "damage_distribution",
+}
+
+// fieldAliases are the aliases in effect, keyed by normalized alias.
+var fieldAliases = normalizeAliases(defaultFieldAliases)
+
+// loadFieldAliases adds the aliases of the configuration file to
+// fieldAliases. Aliases of unknown fields are ignored with a warning.
+func loadFieldAliases() {
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Debug().
+			Err(err).
+			Msg(tr("Ignoring field aliases in the configuration"))
+		return
+	}
+
+	for alias, name := range normalizeAliases(cfg.Aliases) {
+		if _, ok := lookupFieldName(name); !ok {
+			log.Warn().Msg(tr("Ignoring alias %q of unknown field %q", alias, name))
+			continue
+		}
+
+		fieldAliases[alias] = name
+	}
+}
+
+func normalizeAliases(aliases map[string]string) map[string]string {
+	normalized := make(map[string]string, len(aliases))
+
+	for alias, name := range aliases {
+		normalized[normalizeAlias(alias)] = name
+	}
+
+	return normalized
+}
+
+// normalizeAlias makes aliases case and whitespace insensitive.
+func normalizeAlias(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
+
+// resolveFieldName returns the field name for name, which is either a field
+// name or an alias. Names that are neither are returned unchanged.
+func resolveFieldName(name string) string {
+	if name, ok := fieldAliases[normalizeAlias(name)]; ok {
+		return name
+	}
+
+	return name
+}
+
+func runAliases(args []string) error {
+	fs := newFlagSet("aliases")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	aliases := make([]string, 0, len(fieldAliases))
+	for alias := range fieldAliases {
+		aliases = append(aliases, alias)
+	}
+
+	sort.Strings(aliases)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	for _, alias := range aliases {
+		fmt.Fprintf(w, "%s\t%s\n", alias, fieldAliases[alias])
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+)
+
+// Balance risks, from least to most severe.
+const (
+	riskChanged  = "changed"
+	riskEnvelope = "outside vanilla range"
+)
+
+// balanceRisk is a field whose value moved enough to deserve a review.
+type balanceRisk struct {
+	Troop   int
+	Field   troopField
+	Vanilla float64
+	Value   float64
+	Percent float64 // relative change, NaN when vanilla is zero
+	Risk    string
+}
+
+// envelope is the range of a field's values across all vanilla troops.
+type envelope struct {
+	min, max float64
+}
+
+func fieldEnvelopes(tis troopInfoSOX) map[string]envelope {
+	envelopes := map[string]envelope{}
+
+	for _, f := range troopFields {
+		e := envelope{min: math.Inf(1), max: math.Inf(-1)}
+
+		for i := range tis.TroopInfos {
+			v := numericValue(f, &tis.TroopInfos[i])
+			e.min = math.Min(e.min, v)
+			e.max = math.Max(e.max, v)
+		}
+
+		envelopes[f.Name] = e
+	}
+
+	return envelopes
+}
+
+func numericValue(f troopField, ti *troopInfo) float64 {
+	v := f.value(ti)
+
+	if f.isFloat() {
+		return v.Float()
+	}
+
+	return float64(v.Int())
+}
+
+// analyzeBalance reports fields of tis that changed by more than threshold
+// percent relative to vanilla, or moved outside the range vanilla uses for
+// that field across all troops.
+func analyzeBalance(tis, vanilla troopInfoSOX, threshold float64) []balanceRisk {
+	var risks []balanceRisk
+
+	envelopes := fieldEnvelopes(vanilla)
+
+	refs := counterparts(&vanilla, tis)
+
+	// Troops added by mods have no vanilla record to compare with.
+	for i := range tis.TroopInfos {
+		if refs[i] == nil {
+			continue
+		}
+
+		for _, f := range troopFields {
+			value := numericValue(f, &tis.TroopInfos[i])
+			old := numericValue(f, refs[i])
+
+			if value == old {
+				continue
+			}
+
+			r := balanceRisk{Troop: i, Field: f, Vanilla: old, Value: value, Percent: math.NaN()}
+			if old != 0 {
+				r.Percent = (value - old) / math.Abs(old) * 100
+			}
+
+			switch e := envelopes[f.Name]; {
+			case value < e.min || value > e.max:
+				r.Risk = riskEnvelope
+			case math.IsNaN(r.Percent) || math.Abs(r.Percent) > threshold:
+				r.Risk = riskChanged
+			default:
+				continue
+			}
+
+			risks = append(risks, r)
+		}
+	}
+
+	return risks
+}
+
+func runAnalyze(args []string) error {
+	fs := newFlagSet("analyze")
+	against := fs.String("against", sourceVanilla, "Data to compare with: vanilla, current, or a SOX/YAML file")
+	threshold := fs.Float64("threshold", 25, "Report changes larger than this many percent")
+	noColor := fs.Bool("no-color", false, "Disables colored output")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	spec := sourceCurrent
+	if fs.NArg() > 0 {
+		spec = fs.Arg(0)
+	}
+
+	tis, err := loadTroopSource(spec)
+	if err != nil {
+		return err
+	}
+
+	vanilla, err := loadTroopSource(*against)
+	if err != nil {
+		return err
+	}
+
+	risks := analyzeBalance(tis, vanilla, *threshold)
+
+	t := newTable("troop", "field", *against, spec, "change", "risk")
+	t.labels = 2
+
+	var envelopeRisks int
+
+	for _, r := range risks {
+		color := colorNone
+		if r.Risk == riskEnvelope {
+			color = colorRed
+			envelopeRisks++
+		}
+
+		change := "new"
+		if !math.IsNaN(r.Percent) {
+			change = fmt.Sprintf("%+.1f%%", r.Percent)
+		}
+
+		t.addRow(
+			cell{text: troopName(r.Troop)},
+			cell{text: r.Field.Name},
+			cell{text: strconv.FormatFloat(r.Vanilla, 'g', -1, 32)},
+			cell{text: strconv.FormatFloat(r.Value, 'g', -1, 32)},
+			cell{text: change, color: color},
+			cell{text: r.Risk, color: color},
+		)
+	}
+
+	if len(risks) > 0 {
+		t.render(os.Stdout, detectTermStyle(*noColor))
+		fmt.Println()
+	}
+
+	fmt.Print(tr("Balance risk: %d changes above %.0f%%, %d outside the vanilla range\n", len(risks)-envelopeRisks, *threshold, envelopeRisks))
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/rdeusser/troopinfo/kuftc"
+	"github.com/rs/zerolog/log"
+)
+
+// maxTroopRecords is a sanity cap on the number of troop records.
+const maxTroopRecords = kuftc.MaxTroopCount
+
+var errExpertMode = errors.New("appending troop records requires -expert")
+
+func runAppend(args []string) error {
+	fs := newFlagSet("append")
+	expert := fs.Bool("expert", false, "Acknowledge that the game may not support the appended records")
+	from := fs.String("from", "", "Name of the troop whose record is copied into the new records")
+	n := fs.Int("n", 1, "Number of records to append")
+	typeID := fs.Int("type-id", -1, "Type ID of the first new record (defaults to its index); later records count up from it")
+	out := fs.String("o", troopInfoPath, "Path of the SOX file to write")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if !*expert {
+		return errExpertMode
+	}
+
+	if *from == "" {
+		return errors.New("-from is required")
+	}
+
+	data, err := ioutil.ReadFile(troopInfoPath)
+	if err != nil {
+		return err
+	}
+
+	tis, err := decodeTroopInfoSOX(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	i, err := troopRecord(tis, *from)
+	if err != nil {
+		return err
+	}
+
+	count := int(tis.Count)
+	if *n < 1 || count+*n > maxTroopRecords {
+		return fmt.Errorf("cannot append %d records to %d existing ones (max %d)", *n, count, maxTroopRecords)
+	}
+
+	if *typeID < 0 {
+		*typeID = count
+	}
+
+	records := make([]troopInfo, *n)
+	for j := range records {
+		records[j] = tis.TroopInfos[i]
+		records[j].TypeID = int32(*typeID + j)
+	}
+
+	appended, err := appendTroopRecords(data, count, records)
+	if err != nil {
+		return err
+	}
+
+	log.Warn().Msg(tr("The game only knows the %d retail troop types; appended records may be ignored or crash missions", len(defaultTroopNames)))
+	log.Warn().Msg(tr("Type IDs must match a troop type the engine defines (K2TroopDef.h)"))
+
+	if err := writeSOX(*out, appended); err != nil {
+		return err
+	}
+
+	log.Info().Msg(tr("Appended %d records to %s", *n, *out))
+
+	return nil
+}
+
+// appendTroopRecords inserts records after the count existing records of the
+// SOX file data and updates the count in its header. Everything after the
+// records, such as the trailer, is kept byte for byte.
+func appendTroopRecords(data []byte, count int, records []troopInfo) ([]byte, error) {
+	recordsEnd := 8 + count*binary.Size(troopInfo{})
+	if len(data) < recordsEnd {
+		return nil, errInvalidSOX
+	}
+
+	buf := &bytes.Buffer{}
+	buf.Write(data[:recordsEnd])
+
+	if err := binary.Write(buf, binary.LittleEndian, records); err != nil {
+		return nil, err
+	}
+
+	buf.Write(data[recordsEnd:])
+
+	out := buf.Bytes()
+	binary.LittleEndian.PutUint32(out[4:8], uint32(count+len(records)))
+
+	return out, nil
+}
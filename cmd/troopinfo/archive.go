@@ -0,0 +1,308 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// archiveFormat is bumped whenever the layout of data archives changes.
+const archiveFormat = 1
+
+// archiveIndexName is the entry of a data archive listing the others.
+const archiveIndexName = "index.yaml"
+
+var errArchiveDamaged = errors.New("archive is damaged")
+
+// A data archive is a zip file holding the decoded game data as canonical
+// YAML, one entry per data file, and an index of their hashes. The same data
+// always gives the same bytes, so archives can be compared by hash, and since
+// they are zip files every command reading workspaces takes them as sources,
+// e.g. diff kuftc-data.zip current. Archives carry no game files: extracting
+// one encodes its data on top of the user's own install.
+type archiveIndex struct {
+	Format int            `yaml:"format"`
+	Files  []archiveEntry `yaml:"files"`
+}
+
+type archiveEntry struct {
+	Name         string `yaml:"name"`
+	Source       string `yaml:"source"`
+	SourceSHA256 string `yaml:"source_sha256"`
+	SHA256       string `yaml:"sha256"`
+}
+
+func runArchive(args []string) error {
+	if len(args) == 0 {
+		return errors.New("expected create or extract")
+	}
+
+	switch args[0] {
+	case "create":
+		return runArchiveCreate(args[1:])
+	case "extract":
+		return runArchiveExtract(args[1:])
+	default:
+		return fmt.Errorf("unknown archive command %q", args[0])
+	}
+}
+
+func runArchiveCreate(args []string) error {
+	fs := newFlagSet("archive create")
+	dir := fs.String("dir", soxDir, "Game directory or workspace to archive")
+	out := fs.String("o", "kuftc-data.zip", "Path of the archive to write")
+	overlay := fs.Bool("yaml", false, "Archive the data with the directory's TroopInfo.yaml applied instead of its TroopInfo.sox as it is")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	st, err := openStorage(*dir)
+	if err != nil {
+		return err
+	}
+
+	data, err := createArchive(st, *overlay)
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(*out, data, 0600); err != nil {
+		return err
+	}
+
+	log.Info().Msg(tr("Wrote %s (%s)", *out, contentHash(data)))
+
+	return nil
+}
+
+// createArchive returns the data archive of the data files in st. With
+// overlay, the TroopInfo.yaml of st is applied first, and the source hash is
+// that of the data encoded back to SOX, so the index always describes what
+// the archive holds.
+func createArchive(st storage, overlay bool) ([]byte, error) {
+	var (
+		tis    troopInfoSOX
+		source []byte
+		err    error
+	)
+
+	if overlay {
+		if tis, err = loadTroopStorage(st); err != nil {
+			return nil, err
+		}
+
+		buf := &bytes.Buffer{}
+
+		if err := encodeTroopInfoSOX(buf, tis); err != nil {
+			return nil, err
+		}
+
+		source = buf.Bytes()
+	} else {
+		if source, err = st.ReadFile(troopInfoFile.Name); err != nil {
+			return nil, err
+		}
+
+		if err := troopInfoFile.checkData(troopInfoFile.Name, source); err != nil {
+			return nil, err
+		}
+
+		if tis, err = decodeTroopInfoSOX(bytes.NewReader(source)); err != nil {
+			return nil, err
+		}
+	}
+
+	doc, err := troopInfoDocument(tis)
+	if err != nil {
+		return nil, err
+	}
+
+	decoded, err := encodeYAMLNode(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSuffix(troopInfoFile.Name, filepath.Ext(troopInfoFile.Name)) + ".yaml"
+	index := archiveIndex{
+		Format: archiveFormat,
+		Files: []archiveEntry{{
+			Name:         name,
+			Source:       troopInfoFile.Name,
+			SourceSHA256: contentHash(source),
+			SHA256:       contentHash(decoded),
+		}},
+	}
+
+	indexData, err := yaml.Marshal(index)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+
+	// The index comes first and no entry has a modification time, which
+	// keeps archives of the same data identical.
+	for _, e := range []struct {
+		name string
+		data []byte
+	}{
+		{archiveIndexName, indexData},
+		{name, decoded},
+	} {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: e.name, Method: zip.Deflate})
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := w.Write(e.data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// readArchive opens a data archive and checks its entries against the index.
+func readArchive(path string) (*zipStorage, archiveIndex, error) {
+	var index archiveIndex
+
+	z, err := openZipStorage(path)
+	if err != nil {
+		return nil, index, err
+	}
+
+	data, err := z.ReadFile(archiveIndexName)
+	if err != nil {
+		return nil, index, fmt.Errorf("%s: not a data archive: %w", path, err)
+	}
+
+	if err := yaml.Unmarshal(data, &index); err != nil {
+		return nil, index, newYAMLError(path+":"+archiveIndexName, data, err)
+	}
+
+	if index.Format > archiveFormat {
+		return nil, index, fmt.Errorf("%s: archive format %d is newer than this tool supports (%d)", path, index.Format, archiveFormat)
+	}
+
+	for _, e := range index.Files {
+		if err := checkArchiveEntryName(e.Name); err != nil {
+			return nil, index, err
+		}
+
+		data, err := z.ReadFile(e.Name)
+		if err != nil {
+			return nil, index, fmt.Errorf("%w: %v", errArchiveDamaged, err)
+		}
+
+		if contentHash(data) != e.SHA256 {
+			return nil, index, fmt.Errorf("%w: %s doesn't match its hash", errArchiveDamaged, e.Name)
+		}
+	}
+
+	return z, index, nil
+}
+
+func runArchiveExtract(args []string) error {
+	fs := newFlagSet("archive extract")
+	base := fs.String("base", soxDir, "Game directory whose data files the archived data is written on top of")
+	out := fs.String("o", "", "Directory to extract the data files to")
+
+	if len(args) > 0 {
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+	}
+
+	if len(args) == 0 || *out == "" {
+		return errors.New("expected an archive and -o")
+	}
+
+	z, index, err := readArchive(args[0])
+	if err != nil {
+		return err
+	}
+
+	baseSt, err := openStorage(*base)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(*out, 0700); err != nil {
+		return err
+	}
+
+	for _, e := range index.Files {
+		if e.Source != troopInfoFile.Name {
+			log.Warn().Msg(tr("Skipping %s: unsupported data file %s", e.Name, e.Source))
+			continue
+		}
+
+		// Names come from the archive, so they are checked again right
+		// before they become paths.
+		if err := checkArchiveEntryName(e.Name); err != nil {
+			return err
+		}
+
+		installed, err := readTroopStorage(baseSt)
+		if err != nil {
+			return err
+		}
+
+		decoded, err := z.ReadFile(e.Name)
+		if err != nil {
+			return err
+		}
+
+		tis, err := decodeTroopInfoYAML(args[0]+":"+e.Name, decoded, installed)
+		if err != nil {
+			return err
+		}
+
+		buf := &bytes.Buffer{}
+
+		if err := encodeTroopInfoSOX(buf, tis); err != nil {
+			return err
+		}
+
+		// Extracting into the game's own directory installs the data, with
+		// the checks and backup of every other write to it.
+		path := filepath.Join(*out, e.Source)
+
+		if err := writeSOX(path, buf.Bytes()); err != nil {
+			return err
+		}
+
+		if err := ioutil.WriteFile(filepath.Join(*out, e.Name), decoded, 0600); err != nil {
+			return err
+		}
+
+		log.Info().Msg(tr("Wrote %s", path))
+	}
+
+	return nil
+}
+
+// checkArchiveEntryName refuses names of archive entries that aren't plain
+// file names, which extracting would turn into paths outside the target
+// directory.
+func checkArchiveEntryName(name string) error {
+	if name == "" || filepath.Base(name) != name || strings.ContainsAny(name, `/\:`) || strings.Contains(name, "..") {
+		return fmt.Errorf("%w: invalid entry name %q", errArchiveDamaged, name)
+	}
+
+	return nil
+}
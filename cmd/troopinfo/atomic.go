@@ -0,0 +1,14 @@
+package main
+
+import (
+	"os"
+
+	"github.com/rdeusser/troopinfo/kuftc"
+)
+
+// writeFileAtomic replaces the file at path with data without ever leaving it
+// half written, and checks that it reads back as written; see
+// kuftc.WriteFileAtomic.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	return kuftc.WriteFileAtomic(path, data, perm)
+}
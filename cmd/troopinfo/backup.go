@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// backupsDir holds the backup chain: timestamped copies of TroopInfo.sox,
+// optionally named, oldest first.
+var backupsDir = filepath.Join(soxDir, "backups")
+
+// backupTimeFormat is the timestamp backup IDs start with. It sorts
+// chronologically and is valid in file names on every platform.
+const backupTimeFormat = "2006-01-02T15-04-05"
+
+var errNoBackup = errors.New("no such backup")
+
+// autoBackupName names the backups taken before every write of the installed
+// TroopInfo.sox. Only these are pruned; named snapshots are kept until they
+// are deleted by hand.
+const autoBackupName = "auto"
+
+// defaultBackupKeep is how many automatic backups are kept unless the
+// configuration sets backup_keep.
+const defaultBackupKeep = 20
+
+// backupKeep is the number of automatic backups kept.
+var backupKeep = defaultBackupKeep
+
+// backup is a single entry of the backup chain.
+type backup struct {
+	ID   string // timestamp, plus "_<name>" for named snapshots
+	Time time.Time
+	Name string
+	Path string
+}
+
+func runBackup(args []string) error {
+	fs := newFlagSet("backup")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	switch fs.Arg(0) {
+	case "", "list":
+		return printBackups()
+	case "save":
+		b, err := saveBackup(troopInfoPath, fs.Arg(1))
+		if err != nil {
+			return err
+		}
+
+		log.Info().Msg(tr("Saved backup %s", b.ID))
+
+		return nil
+	case "prune":
+		return runBackupPrune(fs.Args()[1:])
+	case "verify":
+		ref := fs.Arg(1)
+		if ref == "" {
+			ref = "latest"
+		}
+
+		return runBackupVerify(ref)
+	case "restore":
+		if fs.NArg() < 2 {
+			return errors.New("expected a backup to restore, and optionally troops to restore from it")
+		}
+
+		return runBackupRestore(fs.Arg(1), fs.Args()[2:])
+	default:
+		return fmt.Errorf("unknown backup command %q", fs.Arg(0))
+	}
+}
+
+// saveBackup copies the SOX file at path into the backup chain, under name if
+// it isn't empty.
+func saveBackup(path, name string) (backup, error) {
+	if strings.ContainsAny(name, `/\:_`) {
+		return backup{}, fmt.Errorf("invalid backup name %q", name)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return backup{}, err
+	}
+
+	if err := os.MkdirAll(backupsDir, 0700); err != nil {
+		return backup{}, err
+	}
+
+	now := time.Now()
+
+	id := now.Format(backupTimeFormat)
+	if name != "" {
+		id += "_" + name
+	}
+
+	b := backup{
+		ID:   id,
+		Time: now,
+		Name: name,
+		Path: filepath.Join(backupsDir, id+".sox"),
+	}
+
+	if err := ioutil.WriteFile(b.Path, data, 0600); err != nil {
+		return backup{}, err
+	}
+
+	return b, writeBackupMeta(b, data)
+}
+
+// listBackups returns the backup chain, oldest first.
+func listBackups() ([]backup, error) {
+	entries, err := ioutil.ReadDir(backupsDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	var backups []backup
+
+	for _, e := range entries {
+		id := strings.TrimSuffix(e.Name(), ".sox")
+		if e.IsDir() || id == e.Name() {
+			continue
+		}
+
+		stamp, name := id, ""
+		if i := strings.Index(id, "_"); i >= 0 {
+			stamp, name = id[:i], id[i+1:]
+		}
+
+		t, err := time.ParseInLocation(backupTimeFormat, stamp, time.Local)
+		if err != nil {
+			continue
+		}
+
+		backups = append(backups, backup{
+			ID:   id,
+			Time: t,
+			Name: name,
+			Path: filepath.Join(backupsDir, e.Name()),
+		})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].ID < backups[j].ID
+	})
+
+	return backups, nil
+}
+
+// findBackup resolves ref to a backup. ref is "latest", a snapshot name, or
+// a prefix of a backup ID such as "2024-05-01", in which case the newest
+// matching backup wins.
+func findBackup(ref string) (backup, error) {
+	backups, err := listBackups()
+	if err != nil {
+		return backup{}, err
+	}
+
+	for i := len(backups) - 1; i >= 0; i-- {
+		b := backups[i]
+
+		if ref == "latest" || b.Name == ref || strings.HasPrefix(b.ID, ref) {
+			return b, nil
+		}
+	}
+
+	return backup{}, fmt.Errorf("%w: %q", errNoBackup, ref)
+}
+
+func printBackups() error {
+	backups, err := listBackups()
+	if err != nil {
+		return err
+	}
+
+	for _, b := range backups {
+		fmt.Println(b.ID)
+	}
+
+	return nil
+}
+
+// loadBackupSettings reads the retention of backups and of the history
+// database from the configuration file.
+func loadBackupSettings() {
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Debug().
+			Err(err).
+			Msg(tr("Ignoring the backup settings in the configuration"))
+		return
+	}
+
+	if cfg.BackupKeep > 0 {
+		backupKeep = cfg.BackupKeep
+	}
+
+	if cfg.HistoryKeep > 0 {
+		historyKeep = cfg.HistoryKeep
+	}
+}
+
+// installSOX replaces the installed TroopInfo.sox with data. The file it
+// replaces is saved to the backup chain first, and automatic backups beyond
+// the retention are pruned, so every write can be undone. The write itself
+// is atomic and verified, and refused while the game is running or while
+// data fails validation.
+func installSOX(data []byte) error {
+	if err := checkGameNotRunning(); err != nil {
+		return err
+	}
+
+	if err := checkValid(data); err != nil {
+		return err
+	}
+
+	current, err := ioutil.ReadFile(troopInfoPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if err == nil && !bytes.Equal(current, data) && !backedUpThisSecond() {
+		b, err := saveBackup(troopInfoPath, autoBackupName)
+		if err != nil {
+			return fmt.Errorf("couldn't back up %s before writing it: %w", troopInfoPath, err)
+		}
+
+		log.Info().Msg(tr("Saved backup %s", b.ID))
+
+		if _, err := pruneBackups(backupKeep); err != nil {
+			log.Warn().Err(err).Msg(tr("Couldn't prune old backups"))
+		}
+	}
+
+	if err := writeFileAtomic(troopInfoPath, data, 0600); err != nil {
+		return err
+	}
+
+	// Records may have moved or changed type, which keys and names follow.
+	rosterMu.Lock()
+	loadTroopRoster()
+	loadCustomTroopNames(soxDir)
+	rosterMu.Unlock()
+
+	return nil
+}
+
+// writeSOX writes data to the SOX file at path, through installSOX if path
+// is the installed TroopInfo.sox, so commands with an output flag get the
+// same checks and backups as every other write to it.
+func writeSOX(path string, data []byte) error {
+	if isInstalledSOX(path) {
+		return installSOX(data)
+	}
+
+	return writeFileAtomic(path, data, 0600)
+}
+
+// isInstalledSOX reports whether path names the installed TroopInfo.sox.
+func isInstalledSOX(path string) bool {
+	if filepath.Clean(path) == filepath.Clean(troopInfoPath) {
+		return true
+	}
+
+	a, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+
+	b, err := os.Stat(troopInfoPath)
+	if err != nil {
+		return false
+	}
+
+	return os.SameFile(a, b)
+}
+
+// backedUpThisSecond reports whether an automatic backup was already taken
+// in the current second. Backup IDs only resolve to seconds, and the first
+// backup holds the state from before the writes of a quick succession,
+// which is the one worth keeping.
+func backedUpThisSecond() bool {
+	id := time.Now().Format(backupTimeFormat) + "_" + autoBackupName
+	_, err := os.Stat(filepath.Join(backupsDir, id+".sox"))
+
+	return err == nil
+}
+
+// pruneBackups deletes the oldest automatic backups beyond the newest keep
+// and returns them.
+func pruneBackups(keep int) ([]backup, error) {
+	backups, err := listBackups()
+	if err != nil {
+		return nil, err
+	}
+
+	var auto []backup
+
+	for _, b := range backups {
+		if b.Name == autoBackupName {
+			auto = append(auto, b)
+		}
+	}
+
+	if len(auto) <= keep {
+		return nil, nil
+	}
+
+	pruned := auto[:len(auto)-keep]
+
+	for _, b := range pruned {
+		for _, path := range []string{b.Path, b.metaPath()} {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+		}
+	}
+
+	return pruned, nil
+}
+
+func runBackupPrune(args []string) error {
+	fs := newFlagSet("backup prune")
+	keep := fs.Int("keep", backupKeep, "Number of automatic backups to keep")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *keep < 0 {
+		return fmt.Errorf("invalid -keep %d", *keep)
+	}
+
+	pruned, err := pruneBackups(*keep)
+	if err != nil {
+		return err
+	}
+
+	for _, b := range pruned {
+		log.Info().Msg(tr("Deleted backup %s", b.ID))
+	}
+
+	return nil
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+var errBackupDamaged = errors.New("backup is damaged")
+
+// backupMeta is stored next to each backup as <id>.yaml. The hash of every
+// record lets restore and verify work record by record, so one damaged
+// record doesn't make the rest of a backup unusable.
+type backupMeta struct {
+	File    string       `yaml:"file"`
+	SHA256  string       `yaml:"sha256"`
+	Records []recordHash `yaml:"records"`
+}
+
+type recordHash struct {
+	Index  int    `yaml:"index"`
+	Troop  string `yaml:"troop"`
+	SHA256 string `yaml:"sha256"`
+}
+
+func (b backup) metaPath() string {
+	return strings.TrimSuffix(b.Path, ".sox") + ".yaml"
+}
+
+// newBackupMeta hashes the SOX data of a backup and each of its records.
+func newBackupMeta(data []byte) (backupMeta, error) {
+	meta := backupMeta{File: troopInfoFile.Name, SHA256: contentHash(data)}
+
+	if len(data) < 8 {
+		return backupMeta{}, errInvalidSOX
+	}
+
+	roster := dataRoster(data)
+
+	for i := 0; i < int(int32(binary.LittleEndian.Uint32(data[4:8]))); i++ {
+		rec, err := recordBytes(data, i)
+		if err != nil {
+			return backupMeta{}, err
+		}
+
+		meta.Records = append(meta.Records, recordHash{Index: i, Troop: roster.key(i), SHA256: contentHash(rec)})
+	}
+
+	return meta, nil
+}
+
+// dataRoster returns the roster of the SOX data, or that of the installed
+// TroopInfo.sox if data doesn't decode.
+func dataRoster(data []byte) troopRoster {
+	tis, err := decodeTroopInfoSOX(bytes.NewReader(data))
+	if err != nil {
+		return installedRoster
+	}
+
+	return newTroopRoster(tis)
+}
+
+func writeBackupMeta(b backup, data []byte) error {
+	meta, err := newBackupMeta(data)
+	if err != nil {
+		return err
+	}
+
+	out, err := yaml.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(b.metaPath(), out, 0600)
+}
+
+// readBackupMeta returns the metadata of b. Backups made before checksums
+// were stored have none and return an error satisfying os.IsNotExist.
+func readBackupMeta(b backup) (backupMeta, error) {
+	var meta backupMeta
+
+	data, err := ioutil.ReadFile(b.metaPath())
+	if err != nil {
+		return meta, err
+	}
+
+	if err := yaml.Unmarshal(data, &meta); err != nil {
+		return meta, newYAMLError(b.metaPath(), data, err)
+	}
+
+	return meta, nil
+}
+
+// recordBytes returns the bytes of record i of the TroopInfo.sox data, using
+// the layout of the file's version.
+func recordBytes(data []byte, i int) ([]byte, error) {
+	if len(data) < 4 {
+		return nil, errInvalidSOX
+	}
+
+	s := troopInfoFile.schemaFor(int32(binary.LittleEndian.Uint32(data[0:4])))
+	start := headerSize(s) + i*s.RecordSize
+
+	if start+s.RecordSize > len(data) {
+		return nil, errInvalidSOX
+	}
+
+	return data[start : start+s.RecordSize], nil
+}
+
+// damagedRecords returns the indexes of the records of data that don't match
+// their hash in meta.
+func damagedRecords(data []byte, meta backupMeta) []int {
+	var damaged []int
+
+	for _, r := range meta.Records {
+		rec, err := recordBytes(data, r.Index)
+		if err != nil || contentHash(rec) != r.SHA256 {
+			damaged = append(damaged, r.Index)
+		}
+	}
+
+	return damaged
+}
+
+// verifyBackup checks b against its checksums and returns its data and the
+// indexes of damaged records. Backups without checksums can't be verified
+// and are trusted with a warning.
+func verifyBackup(b backup) ([]byte, []int, error) {
+	data, err := ioutil.ReadFile(b.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	meta, err := readBackupMeta(b)
+	if os.IsNotExist(err) {
+		log.Warn().Msg(tr("Backup %s has no checksums and can't be verified", b.ID))
+		return data, nil, nil
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if contentHash(data) == meta.SHA256 {
+		return data, nil, nil
+	}
+
+	return data, damagedRecords(data, meta), nil
+}
+
+func runBackupVerify(ref string) error {
+	b, err := findBackup(ref)
+	if err != nil {
+		return err
+	}
+
+	_, damaged, err := verifyBackup(b)
+	if err != nil {
+		return err
+	}
+
+	for _, i := range damaged {
+		log.Error().Msg(tr("%s: record %d (%s) doesn't match its checksum", b.ID, i, troopName(i)))
+	}
+
+	if len(damaged) > 0 {
+		return fmt.Errorf("%w: %d records", errBackupDamaged, len(damaged))
+	}
+
+	log.Info().Msg(tr("Backup %s is intact", b.ID))
+
+	return nil
+}
+
+// runBackupRestore restores TroopInfo.sox from the backup ref: the whole file,
+// or only the records of the given troops. The current file is saved to the
+// backup chain first.
+func runBackupRestore(ref string, troops []string) error {
+	b, err := findBackup(ref)
+	if err != nil {
+		return err
+	}
+
+	data, damaged, err := verifyBackup(b)
+	if err != nil {
+		return err
+	}
+
+	current, err := ioutil.ReadFile(troopInfoPath)
+	if err != nil {
+		return err
+	}
+
+	out := data
+
+	if len(troops) > 0 {
+		out = append([]byte(nil), current...)
+
+		// Records may have moved since the backup, so troops are looked up
+		// in each file by their own roster.
+		from, to := dataRoster(data), dataRoster(current)
+
+		for _, name := range troops {
+			i, err := from.index(name)
+			if err != nil {
+				return fmt.Errorf("%s: %w", b.ID, err)
+			}
+
+			if containsInt(damaged, i) {
+				return fmt.Errorf("%w: record %d (%s) doesn't match its checksum", errBackupDamaged, i, name)
+			}
+
+			j, err := to.index(name)
+			if err != nil {
+				return fmt.Errorf("%s: %w", troopInfoPath, err)
+			}
+
+			src, err := recordBytes(data, i)
+			if err != nil {
+				return fmt.Errorf("%s: %w", b.ID, err)
+			}
+
+			dst, err := recordBytes(out, j)
+			if err != nil {
+				return fmt.Errorf("%s: %w", troopInfoPath, err)
+			}
+
+			if len(src) != len(dst) {
+				return fmt.Errorf("%s and %s have different record layouts", b.ID, troopInfoPath)
+			}
+
+			copy(dst, src)
+		}
+	} else if len(damaged) > 0 {
+		return fmt.Errorf("%w: %d records don't match their checksums; restore single troops instead", errBackupDamaged, len(damaged))
+	}
+
+	before, err := decodeTroopInfoSOX(bytes.NewReader(current))
+	if err != nil {
+		return err
+	}
+
+	after, err := decodeTroopInfoSOX(bytes.NewReader(out))
+	if err != nil {
+		return err
+	}
+
+	if err := checkGameNotRunning(); err != nil {
+		return err
+	}
+
+	safety, err := saveBackup(troopInfoPath, "pre-restore")
+	if err != nil {
+		return err
+	}
+
+	log.Info().Msg(tr("Saved backup %s", safety.ID))
+
+	if err := writeFileAtomic(troopInfoPath, out, 0600); err != nil {
+		return err
+	}
+
+	changes := diffRecords(troopRecords(before), troopRecords(after))
+
+	printChangeSummary(os.Stdout, changes, false)
+	recordHistory("backup restore "+b.ID, troopInfoFile.Name, changes, out)
+
+	log.Info().Msg(tr("Restored %s", b.ID))
+
+	return nil
+}
+
+func containsInt(values []int, v int) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Levers the balance wizard can pull to reach an intent.
+const (
+	leverAttack = "attack"
+	leverResist = "resist"
+)
+
+var errUnreachable = errors.New("the intent can't be reached with this lever")
+
+// balanceIntent is a high-level balance goal such as "archers deal 20% more
+// damage to cavalry".
+type balanceIntent struct {
+	Attacker int
+	Defender int
+	Attack   string  // attack type, see attackTypes
+	Percent  float64 // change of the damage per unit, e.g. 20 or -10
+	Lever    string  // leverAttack or leverResist
+}
+
+func (in balanceIntent) String() string {
+	verb := tr("stronger")
+	if in.Percent < 0 {
+		verb = tr("weaker")
+	}
+
+	return tr("%s %g%% %s against %s (%s)", troopName(in.Attacker), math.Abs(in.Percent), verb, troopName(in.Defender), in.Attack)
+}
+
+// balanceEdit is the field change proposed for an intent.
+type balanceEdit struct {
+	Troop int
+	Field troopField
+	Old   float64
+	New   float64
+}
+
+// planBalance turns the intent into a single field edit using the damage
+// model of calcDamage: the attacker's attack strength or the defender's
+// resistance is solved for the wanted damage per unit.
+func planBalance(tis troopInfoSOX, in balanceIntent) (balanceEdit, error) {
+	before, err := calcDamage(tis.TroopInfos[in.Attacker], tis.TroopInfos[in.Defender], in.Attack)
+	if err != nil {
+		return balanceEdit{}, err
+	}
+
+	if before.PerUnit <= 0 {
+		return balanceEdit{}, fmt.Errorf("%w: %s deals no damage to %s, so there is nothing to scale", errUnreachable, troopName(in.Attacker), troopName(in.Defender))
+	}
+
+	want := before.PerUnit * (1 + in.Percent/100)
+
+	switch in.Lever {
+	case leverAttack:
+		if before.Resist >= 1 {
+			return balanceEdit{}, fmt.Errorf("%w: %s is immune to %s attacks", errUnreachable, troopName(in.Defender), in.Attack)
+		}
+
+		f, _ := lookupField(attackTypes[in.Attack])
+
+		return balanceEdit{
+			Troop: in.Attacker,
+			Field: f,
+			Old:   before.Base,
+			New:   (want + before.Defense) / (1 - before.Resist),
+		}, nil
+	case leverResist:
+		resist := 1 - (want+before.Defense)/before.Base
+		if resist < 0 || resist > 1 {
+			return balanceEdit{}, fmt.Errorf("%w: it would need a resistance of %.2f", errUnreachable, resist)
+		}
+
+		f, _ := lookupField("resist_" + in.Attack)
+
+		return balanceEdit{
+			Troop: in.Defender,
+			Field: f,
+			Old:   before.Resist,
+			New:   resist,
+		}, nil
+	default:
+		return balanceEdit{}, fmt.Errorf("unknown lever %q (want %s or %s)", in.Lever, leverAttack, leverResist)
+	}
+}
+
+// apply returns a copy of tis with the edit made.
+func (e balanceEdit) apply(tis troopInfoSOX) (troopInfoSOX, error) {
+	value := strconv.FormatFloat(e.New, 'g', -1, 64)
+	if !e.Field.isFloat() {
+		value = strconv.FormatInt(int64(math.Round(e.New)), 10)
+	}
+
+	tis = tis.Clone()
+
+	if err := e.Field.Parse(&tis.TroopInfos[e.Troop], value); err != nil {
+		return tis, err
+	}
+
+	return tis, nil
+}
+
+// printBalancePreview compares the damage of the intent's matchup before and
+// after the edit, and lists the other matchups the edit changes as well.
+func printBalancePreview(w io.Writer, before, after troopInfoSOX, in balanceIntent, e balanceEdit) error {
+	fmt.Fprintln(w, in)
+	fmt.Fprintf(w, "\n%s.%s: %s -> %s\n\n", troopName(e.Troop), e.Field.Name, e.Field.Format(&before.TroopInfos[e.Troop]), e.Field.Format(&after.TroopInfos[e.Troop]))
+
+	a, err := calcDamage(before.TroopInfos[in.Attacker], before.TroopInfos[in.Defender], in.Attack)
+	if err != nil {
+		return err
+	}
+
+	b, err := calcDamage(after.TroopInfos[in.Attacker], after.TroopInfos[in.Defender], in.Attack)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "\tBEFORE\tAFTER")
+	fmt.Fprintf(tw, "damage per unit\t%.2f\t%.2f\n", a.PerUnit, b.PerUnit)
+	fmt.Fprintf(tw, "damage per troop\t%.2f\t%.2f\n", a.PerTroop, b.PerTroop)
+	fmt.Fprintf(tw, "hits to kill a unit\t%.0f\t%.0f\n", a.HitsToKill, b.HitsToKill)
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	var also []string
+
+	for i := range before.TroopInfos {
+		for _, attack := range attackTypeNames() {
+			attacker, defender := e.Troop, i
+			if in.Lever == leverResist {
+				attacker, defender = i, e.Troop
+			}
+
+			if attacker == in.Attacker && defender == in.Defender && attack == in.Attack {
+				continue
+			}
+
+			x, _ := calcDamage(before.TroopInfos[attacker], before.TroopInfos[defender], attack)
+			y, _ := calcDamage(after.TroopInfos[attacker], after.TroopInfos[defender], attack)
+
+			if x.PerUnit != y.PerUnit {
+				also = append(also, fmt.Sprintf("%s -> %s (%s)", troopName(attacker), troopName(defender), attack))
+			}
+		}
+	}
+
+	if len(also) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, tr("The edit also changes %d other matchups, e.g. %s", len(also), strings.Join(also[:minInt(3, len(also))], ", ")))
+	}
+
+	return nil
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+// wizardPrompt asks for a value, offering def when it isn't empty.
+func wizardPrompt(in *bufio.Reader, out io.Writer, question, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(out, "%s: ", question)
+	}
+
+	line, err := in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", fmt.Errorf("no answer to %q", question)
+	}
+
+	if answer := strings.TrimSpace(line); answer != "" {
+		return answer, nil
+	}
+
+	return def, nil
+}
+
+// runBalance is the guided balance wizard. Flags that aren't given are asked
+// for, so "balance" alone walks through an intent step by step, while
+// scripts pass everything and -yes.
+func runBalance(args []string) error {
+	fs := newFlagSet("balance")
+	attacker := fs.String("attacker", "", "Troop that should get stronger or weaker, e.g. Archer")
+	defender := fs.String("defender", "", "Troop it should be stronger or weaker against, e.g. Calvary")
+	attack := fs.String("attack", "", "Attack type: "+strings.Join(attackTypeNames(), ", "))
+	percent := fs.String("by", "", "Change of the damage per unit in percent, e.g. 20 or -10")
+	lever := fs.String("lever", "", "What to change: attack (the attacker's attack) or resist (the defender's resistance)")
+	out := fs.String("o", troopInfoYAMLPath, "YAML file to apply the edit to")
+	yes := fs.Bool("yes", false, "Applies the edit without asking for confirmation")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	base, err := readTroopInfoSOX(troopInfoPath)
+	if err != nil {
+		return err
+	}
+
+	tis := base
+
+	if _, err := os.Stat(*out); err == nil {
+		if tis, err = readTroopInfoYAML(*out, base); err != nil {
+			return err
+		}
+	}
+
+	in := bufio.NewReader(os.Stdin)
+
+	ask := func(value *string, question, def string) error {
+		if *value != "" {
+			return nil
+		}
+
+		answer, err := wizardPrompt(in, os.Stdout, question, def)
+		*value = answer
+
+		return err
+	}
+
+	for _, q := range []struct {
+		value    *string
+		question string
+		def      string
+	}{
+		{attacker, tr("Which troop should change?"), ""},
+		{defender, tr("Against which troop?"), ""},
+		{attack, tr("With which attack type (%s)?", strings.Join(attackTypeNames(), ", ")), "melee"},
+		{percent, tr("By how many percent (negative for weaker)?"), "20"},
+		{lever, tr("Change the attacker's attack or the defender's resistance (attack, resist)?"), leverAttack},
+	} {
+		if err := ask(q.value, q.question, q.def); err != nil {
+			return err
+		}
+	}
+
+	var intent balanceIntent
+
+	if intent.Attacker, err = troopRecord(tis, *attacker); err != nil {
+		return err
+	}
+
+	if intent.Defender, err = troopRecord(tis, *defender); err != nil {
+		return err
+	}
+
+	if intent.Percent, err = strconv.ParseFloat(strings.TrimSuffix(*percent, "%"), 64); err != nil {
+		return fmt.Errorf("invalid percentage %q", *percent)
+	}
+
+	intent.Attack, intent.Lever = *attack, *lever
+
+	edit, err := planBalance(tis, intent)
+	if err != nil {
+		return err
+	}
+
+	after, err := edit.apply(tis)
+	if err != nil {
+		return err
+	}
+
+	if err := printBalancePreview(os.Stdout, tis, after, intent, edit); err != nil {
+		return err
+	}
+
+	if !*yes {
+		answer, err := wizardPrompt(in, os.Stdout, "\n"+tr("Apply the edit to %s? (y/n)", *out), "n")
+		if err != nil {
+			return err
+		}
+
+		if !strings.EqualFold(answer, "y") && !strings.EqualFold(answer, "yes") {
+			log.Info().Msg(tr("Nothing was changed"))
+			return nil
+		}
+	}
+
+	if _, statErr := os.Stat(*out); statErr == nil {
+		err = patchTroopInfoYAML(*out, tis, after)
+	} else {
+		err = writeTroopInfoYAML(*out, after)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	warnUnitCaps(after)
+	recordHistory("balance", *out, diffRecords(troopRecords(tis), troopRecords(after)), nil)
+
+	log.Info().Msg(tr("Wrote %s", *out))
+
+	return nil
+}
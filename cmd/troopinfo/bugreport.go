@@ -0,0 +1,274 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// toolVersion is set by release builds with
+// -ldflags "-X main.toolVersion=v1.2.3".
+var toolVersion = "dev"
+
+// failureLogName is the file in the configuration directory that keeps the
+// log of the last failed command, for bug reports.
+const failureLogName = "last-failure.log"
+
+// The lines of the failure log naming the directories of the failed run,
+// which bug reports redact even if the game has moved since.
+const (
+	failureGameDirPrefix = "game_dir: "
+	failureSOXDirPrefix  = "sox_dir: "
+)
+
+// recordFailure saves the failed command and its error, overwriting the
+// previous failure. Errors are ignored since the command already failed.
+func recordFailure(err error, name string) {
+	dir, dirErr := configDir()
+	if dirErr != nil {
+		return
+	}
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "time: %s\n", time.Now().Format(time.RFC3339))
+	fmt.Fprintf(&b, "command: troopinfo %s\n", strings.Join(os.Args[1:], " "))
+	fmt.Fprintf(&b, "failed: %s\n", name)
+	fmt.Fprintf(&b, "%s%s\n", failureGameDirPrefix, installDir)
+	fmt.Fprintf(&b, "%s%s\n", failureSOXDirPrefix, soxDir)
+	fmt.Fprintf(&b, "error: %v\n", err)
+
+	var ye *yamlError
+	if errors.As(err, &ye) {
+		b.WriteString(ye.Context())
+	}
+
+	if os.MkdirAll(dir, 0700) == nil {
+		_ = ioutil.WriteFile(filepath.Join(dir, failureLogName), []byte(b.String()), 0600)
+	}
+}
+
+// bugReport describes the environment of a bug report.
+type bugReport struct {
+	Version  string   `yaml:"version"`
+	Go       string   `yaml:"go"`
+	Platform string   `yaml:"platform"`
+	Language string   `yaml:"language"`
+	GameDir  string   `yaml:"game_dir"`
+	Files    []string `yaml:"files"`
+}
+
+func runBugReport(args []string) error {
+	fs := newFlagSet("bugreport")
+	out := fs.String("o", "kuftc-bugreport.zip", "Path of the archive to write")
+	redact := fs.Bool("redact", false, "Replaces the game, configuration and home directories in every file with placeholders")
+	latest := fs.Int("n", 20, "Number of recent history entries to include")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	entries, err := bugReportEntries(*latest)
+	if err != nil {
+		return err
+	}
+
+	redactor := strings.NewReplacer()
+	if *redact {
+		redactor = bugReportRedactor(entries)
+	}
+
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+
+	for _, e := range entries {
+		w, err := zw.Create(e.name)
+		if err != nil {
+			return err
+		}
+
+		if _, err := w.Write([]byte(redactor.Replace(string(e.data)))); err != nil {
+			return err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(*out, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+
+	log.Info().Msg(tr("Wrote %s; check it for anything private before attaching it to an issue", *out))
+
+	return nil
+}
+
+// bugReportRedactor returns a replacer of every directory a bug report with
+// entries may name: the game directories of this run, of the configuration
+// and of the failure log, the configuration directory and the home
+// directory. Each is replaced as written and in the other forms it may take
+// in the files, with either slash and with backslashes escaped as in quoted
+// YAML.
+func bugReportRedactor(entries []bugReportEntry) *strings.Replacer {
+	dirs := map[string]string{
+		installDir:            "<game>",
+		soxDir:                "<game>",
+		os.Getenv(gameDirEnv): "<game>",
+	}
+
+	if cfg, err := loadConfig(); err == nil {
+		dirs[cfg.GameDir] = "<game>"
+	}
+
+	for _, e := range entries {
+		if e.name != failureLogName {
+			continue
+		}
+
+		for _, line := range strings.Split(string(e.data), "\n") {
+			for _, prefix := range []string{failureGameDirPrefix, failureSOXDirPrefix} {
+				if strings.HasPrefix(line, prefix) {
+					dirs[strings.TrimPrefix(line, prefix)] = "<game>"
+				}
+			}
+		}
+	}
+
+	if dir, err := configDir(); err == nil {
+		dirs[dir] = "<config>"
+	}
+
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs[home] = "<home>"
+	}
+
+	forms := map[string]string{}
+
+	for dir, placeholder := range dirs {
+		dir = strings.TrimRight(strings.TrimSpace(dir), `/\`)
+		if dir == "" || dir == "." {
+			continue
+		}
+
+		slashed := strings.ReplaceAll(dir, `\`, "/")
+		backslashed := strings.ReplaceAll(slashed, "/", `\`)
+
+		for _, form := range []string{dir, slashed, backslashed, strings.ReplaceAll(backslashed, `\`, `\\`)} {
+			forms[form] = placeholder
+		}
+	}
+
+	// Longer directories go first, so a directory inside another is
+	// replaced as a whole.
+	olds := make([]string, 0, len(forms))
+	for form := range forms {
+		olds = append(olds, form)
+	}
+
+	sort.Slice(olds, func(i, j int) bool {
+		if len(olds[i]) != len(olds[j]) {
+			return len(olds[i]) > len(olds[j])
+		}
+
+		return olds[i] < olds[j]
+	})
+
+	var pairs []string
+	for _, old := range olds {
+		pairs = append(pairs, old, forms[old])
+	}
+
+	return strings.NewReplacer(pairs...)
+}
+
+type bugReportEntry struct {
+	name string
+	data []byte
+}
+
+// bugReportEntries collects the files of a bug report. Parts that can't be
+// read are noted in the report instead of failing it, since broken setups
+// are what reports are for.
+func bugReportEntries(latest int) ([]bugReportEntry, error) {
+	report := bugReport{
+		Version:  toolVersion,
+		Go:       runtime.Version(),
+		Platform: runtime.GOOS + "/" + runtime.GOARCH,
+		Language: detectLanguage(),
+		GameDir:  soxDir,
+	}
+
+	var entries []bugReportEntry
+
+	var fingerprints strings.Builder
+
+	for _, df := range dataFiles {
+		hash, size, err := hashFile(filepath.Join(soxDir, df.Name))
+		if err != nil {
+			fmt.Fprintf(&fingerprints, "%s: %v\n", df.Name, err)
+			continue
+		}
+
+		fmt.Fprintf(&fingerprints, "%s: %s %d bytes", df.Name, hash, size)
+
+		if err := df.checkLayout(filepath.Join(soxDir, df.Name)); err != nil {
+			fmt.Fprintf(&fingerprints, " (%v)", err)
+		}
+
+		fingerprints.WriteString("\n")
+	}
+
+	entries = append(entries, bugReportEntry{"fingerprints.txt", []byte(fingerprints.String())})
+
+	if dir, err := configDir(); err == nil {
+		for _, name := range []string{"config.yaml", failureLogName} {
+			if data, err := ioutil.ReadFile(filepath.Join(dir, name)); err == nil {
+				entries = append(entries, bugReportEntry{name, data})
+			}
+		}
+	}
+
+	history, err := readHistory()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(history) > latest {
+		history = history[len(history)-latest:]
+	}
+
+	for i := range history {
+		history[i].Snapshot = nil
+	}
+
+	data, err := yaml.Marshal(history)
+	if err != nil {
+		return nil, err
+	}
+
+	entries = append(entries, bugReportEntry{"history.yaml", data})
+
+	for _, e := range entries {
+		report.Files = append(report.Files, e.name)
+	}
+
+	data, err = yaml.Marshal(report)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]bugReportEntry{{"report.yaml", data}}, entries...), nil
+}
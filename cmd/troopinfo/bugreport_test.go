@@ -0,0 +1,84 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBugReportRedactsDirectories(t *testing.T) {
+	game := newTestGame(t)
+
+	earlier, err := ioutil.TempDir("", "troopinfo-earlier")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { os.RemoveAll(earlier) })
+
+	dir, err := configDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	// The configuration names a Windows install, quoted as YAML written by
+	// hand would have it.
+	configured := `D:\Games\KUF Crusaders`
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "config.yaml"), []byte(`game_dir: "D:\\Games\\KUF Crusaders"`+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The last failure was in another install than the one of the report.
+	args := os.Args
+	os.Args = []string{"troopinfo", "-game-dir", earlier, "apply"}
+	setGameDir(earlier)
+	recordFailure(errors.New("apply failed in "+filepath.Join(earlier, "Data")), "apply")
+	os.Args = args
+	setGameDir(game)
+
+	out := filepath.Join(game, "report.zip")
+	runCommand(t, runBugReport, "-redact", "-o", out)
+
+	zr, err := zip.OpenReader(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+
+	var names []string
+
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := ioutil.ReadAll(r)
+		r.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, private := range []string{game, soxDir, earlier, dir, configured, `D:\\Games`, "D:/Games"} {
+			if strings.Contains(string(data), private) {
+				t.Errorf("%s names %s:\n%s", f.Name, private, data)
+			}
+		}
+	}
+
+	if got := strings.Join(names, " "); !strings.Contains(got, "config.yaml") || !strings.Contains(got, failureLogName) {
+		t.Errorf("the report holds %s, want the configuration and the failure log in it", got)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// attackTypes maps each attack type to the attack field it draws from. Every
+// type is resisted by the matching resist_<type> field.
+var attackTypes = map[string]string{
+	"melee":     "direct_attack",
+	"frontal":   "direct_attack",
+	"ranged":    "indirect_attack",
+	"explosion": "indirect_attack",
+	"fire":      "indirect_attack",
+	"ice":       "indirect_attack",
+	"lightning": "indirect_attack",
+	"holy":      "indirect_attack",
+	"curse":     "indirect_attack",
+	"poison":    "indirect_attack",
+}
+
+// damageBreakdown is the result of calcDamage, step by step.
+type damageBreakdown struct {
+	Base       float64 // attacker's attack strength for the attack type
+	Resist     float64 // defender's resistance to the attack type, 0-1
+	Resisted   float64 // damage removed by the resistance
+	Defense    float64 // defender's flat defense
+	PerUnit    float64 // damage one attacking unit deals to one defending unit
+	Units      int     // attacking units in the troop
+	PerTroop   float64 // damage the whole troop deals per attack
+	UnitHP     float64 // defender's HP per unit
+	HitsToKill float64 // attacks one unit needs to kill a defending unit
+}
+
+// calcDamage applies the community's working model of the damage formula:
+// the attack is reduced by the resistance as a fraction, then by the flat
+// defense, and never drops below zero. It is an approximation for comparing
+// balance changes, not a reimplementation of the engine.
+func calcDamage(attacker, defender troopInfo, attack string) (damageBreakdown, error) {
+	attackField, ok := attackTypes[attack]
+	if !ok {
+		return damageBreakdown{}, fmt.Errorf("unknown attack type %q (want one of %s)", attack, strings.Join(attackTypeNames(), ", "))
+	}
+
+	base := fieldFloat(&attacker, attackField)
+	resist := math.Max(0, math.Min(1, fieldFloat(&defender, "resist_"+attack)))
+
+	b := damageBreakdown{
+		Base:     base,
+		Resist:   resist,
+		Resisted: base * resist,
+		Defense:  float64(defender.Defense),
+		Units:    int(attacker.DefaultUnitNumX * attacker.DefaultUnitNumY),
+		UnitHP:   float64(defender.DefaultUnitHP),
+	}
+
+	b.PerUnit = math.Max(0, base-b.Resisted-b.Defense)
+	b.PerTroop = b.PerUnit * float64(b.Units)
+	b.HitsToKill = math.Inf(1)
+
+	if b.PerUnit > 0 {
+		b.HitsToKill = math.Ceil(b.UnitHP / b.PerUnit)
+	}
+
+	return b, nil
+}
+
+func fieldFloat(ti *troopInfo, name string) float64 {
+	f, _ := lookupField(name)
+
+	return f.value(ti).Float()
+}
+
+func attackTypeNames() []string {
+	names := make([]string, 0, len(attackTypes))
+	for name := range attackTypes {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+func runCalc(args []string) error {
+	if len(args) == 0 || args[0] != "damage" {
+		return errors.New("expected calc damage")
+	}
+
+	fs := newFlagSet("calc damage")
+	attackerName := fs.String("attacker", "", "Name of the attacking troop")
+	defenderName := fs.String("defender", "", "Name of the defending troop")
+	attack := fs.String("attack", "melee", "Attack type: "+strings.Join(attackTypeNames(), ", "))
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	tis, err := readTroopInfoSOX(troopInfoPath)
+	if err != nil {
+		return err
+	}
+
+	a, err := troopRecord(tis, *attackerName)
+	if err != nil {
+		return err
+	}
+
+	d, err := troopRecord(tis, *defenderName)
+	if err != nil {
+		return err
+	}
+
+	b, err := calcDamage(tis.TroopInfos[a], tis.TroopInfos[d], *attack)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s -> %s (%s)\n\n", troopName(a), troopName(d), *attack)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "base attack (%s)\t%10.2f\n", attackTypes[*attack], b.Base)
+	fmt.Fprintf(w, "resistance (%.1f%%)\t%10.2f\n", b.Resist*100, -b.Resisted)
+	fmt.Fprintf(w, "defense\t%10.2f\n", -b.Defense)
+	fmt.Fprintf(w, "damage per unit\t%10.2f\n", b.PerUnit)
+	fmt.Fprintf(w, "damage per troop (%d units)\t%10.2f\n", b.Units, b.PerTroop)
+	fmt.Fprintf(w, "hits to kill a unit (%.0f HP)\t%10.0f\n", b.UnitHP, b.HitsToKill)
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rdeusser/troopinfo/kuftc"
+)
+
+// capabilitiesVersion is bumped whenever the layout of the capability
+// manifest changes incompatibly.
+const capabilitiesVersion = 1
+
+// capabilities describe what this binary supports, so GUIs and mod managers
+// can feature-detect instead of parsing help text.
+type capabilities struct {
+	ManifestVersion int                `json:"manifest_version"`
+	Files           []fileSchema       `json:"files"`
+	Formats         []formatCapability `json:"formats"`
+	Storage         []string           `json:"storage"`
+	Sources         []string           `json:"sources"`
+	Commands        []commandInfo      `json:"commands"`
+	Languages       []string           `json:"languages"`
+}
+
+// formatCapability is a file format the tool reads or writes troop data in.
+type formatCapability struct {
+	Name       string   `json:"name"`
+	Extensions []string `json:"extensions"`
+	Read       bool     `json:"read"`
+	Write      bool     `json:"write"`
+	Layouts    []string `json:"layouts,omitempty"`
+}
+
+type commandInfo struct {
+	Name  string `json:"name"`
+	Usage string `json:"usage"`
+}
+
+// The capabilities command lists the other commands, so it can't be part of
+// the commands literal without an initialization cycle.
+func init() {
+	commands = append(commands, command{
+		name:  "capabilities",
+		usage: "Describes the supported files, formats and commands (capabilities -json for tools)",
+		run:   runCapabilities,
+	})
+}
+
+func currentCapabilities() capabilities {
+	c := capabilities{
+		ManifestVersion: capabilitiesVersion,
+		Formats: []formatCapability{
+			{Name: "sox", Extensions: []string{".sox"}, Read: true, Write: true},
+			{Name: "yaml", Extensions: []string{".yaml", ".yml"}, Read: true, Write: true},
+			{Name: "csv", Extensions: []string{".csv"}, Read: true, Write: true, Layouts: []string{layoutRows, layoutColumns}},
+			{Name: "json", Extensions: []string{".json"}, Read: true, Write: true},
+			{Name: "xlsx", Extensions: []string{".xlsx"}, Read: true, Write: true},
+		},
+		Storage:   []string{"directory", "zip"},
+		Sources:   []string{sourceCurrent, sourceVanilla, sourceStdin, "<file>", "<directory>", "<zip>", "@current", "@vanilla", "@backup:<id>", "@variant:<name>"},
+		Languages: []string{"en"},
+	}
+
+	// Every version the tool reads is listed, each with its own layout.
+	for _, df := range dataFiles {
+		for _, version := range kuftc.Versions {
+			c.Files = append(c.Files, df.schemaFor(version))
+		}
+	}
+
+	for _, cmd := range commands {
+		c.Commands = append(c.Commands, commandInfo{Name: cmd.name, Usage: cmd.usage})
+	}
+
+	for lang := range catalogs {
+		c.Languages = append(c.Languages, lang)
+	}
+
+	sort.Strings(c.Languages[1:])
+
+	return c
+}
+
+func runCapabilities(args []string) error {
+	fs := newFlagSet("capabilities")
+	asJSON := fs.Bool("json", false, "Print the manifest as JSON")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	c := currentCapabilities()
+
+	if *asJSON {
+		return printJSON(c)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	for _, f := range c.Files {
+		fmt.Fprintf(w, "file\t%s\tversion %d\n", f.File, f.Version)
+	}
+
+	for _, f := range c.Formats {
+		var modes []string
+		if f.Read {
+			modes = append(modes, "read")
+		}
+
+		if f.Write {
+			modes = append(modes, "write")
+		}
+
+		fmt.Fprintf(w, "format\t%s\t%s\n", f.Name, strings.Join(modes, ", "))
+	}
+
+	fmt.Fprintf(w, "storage\t%s\n", strings.Join(c.Storage, ", "))
+	fmt.Fprintf(w, "sources\t%s\n", strings.Join(c.Sources, ", "))
+	fmt.Fprintf(w, "languages\t%s\n", strings.Join(c.Languages, ", "))
+
+	for _, cmd := range c.Commands {
+		fmt.Fprintf(w, "command\t%s\t%s\n", cmd.Name, cmd.Usage)
+	}
+
+	return w.Flush()
+}
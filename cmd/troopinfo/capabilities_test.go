@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/rdeusser/troopinfo/kuftc"
+)
+
+func TestCapabilitiesManifest(t *testing.T) {
+	c := currentCapabilities()
+
+	// The formats the tool resolves from file extensions, and how.
+	resolve := map[string]func(path string) (string, error){
+		"sox":      nil,
+		formatYAML: func(path string) (string, error) { return dataFormat("", path) },
+		formatJSON: func(path string) (string, error) { return dataFormat("", path) },
+		formatCSV:  func(path string) (string, error) { return sheetFormat("", path) },
+		formatXLSX: func(path string) (string, error) { return sheetFormat("", path) },
+	}
+
+	listed := map[string]bool{}
+
+	for _, f := range c.Formats {
+		r, ok := resolve[f.Name]
+		if !ok {
+			t.Errorf("the manifest lists format %s, which the tool doesn't have", f.Name)
+			continue
+		}
+
+		listed[f.Name] = true
+
+		if !f.Read || !f.Write {
+			t.Errorf("the manifest has format %s read %v and write %v, want both", f.Name, f.Read, f.Write)
+		}
+
+		for _, ext := range f.Extensions {
+			if r == nil {
+				continue
+			}
+
+			if got, err := r("TroopInfo" + ext); err != nil || got != f.Name {
+				t.Errorf("the manifest lists %s for format %s, which resolves to %q, %v", ext, f.Name, got, err)
+			}
+		}
+	}
+
+	for name := range resolve {
+		if !listed[name] {
+			t.Errorf("the manifest doesn't list format %s", name)
+		}
+	}
+
+	for _, df := range dataFiles {
+		var versions []int32
+
+		for _, f := range c.Files {
+			if f.File == df.Name {
+				versions = append(versions, f.Version)
+			}
+		}
+
+		if len(versions) != len(kuftc.Versions) {
+			t.Errorf("the manifest lists versions %v of %s, want %v", versions, df.Name, kuftc.Versions)
+			continue
+		}
+
+		for i, v := range kuftc.Versions {
+			if versions[i] != v {
+				t.Errorf("the manifest lists versions %v of %s, want %v", versions, df.Name, kuftc.Versions)
+				break
+			}
+		}
+	}
+}
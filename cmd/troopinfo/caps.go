@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+)
+
+// unitCaps are the largest formation values the engine is known to handle.
+// Zero means unknown, and the value isn't checked.
+//
+// Nobody has mapped the engine's real limits yet, so by default the caps are
+// the largest values the retail data uses: every retail troop renders and
+// fights correctly, which is the only evidence there is. Users who have
+// measured higher limits can raise them in the unit_caps section of the
+// configuration file.
+type unitCaps struct {
+	UnitsX          int32   `yaml:"units_x"`          // default_unit_num_x
+	UnitsY          int32   `yaml:"units_y"`          // default_unit_num_y
+	Units           int32   `yaml:"units"`            // default_unit_num_x * default_unit_num_y
+	BaseWidth       float32 `yaml:"base_width"`       // base_width
+	FormationRandom int32   `yaml:"formation_random"` // formation_random
+}
+
+// capWarning is a troop whose formation exceeds a cap.
+type capWarning struct {
+	Troop string
+	Msg   string
+}
+
+func (w capWarning) String() string {
+	return w.Troop + ": " + w.Msg
+}
+
+// retailUnitCaps derives caps from the retail data in vanilla.
+func retailUnitCaps(vanilla troopInfoSOX) unitCaps {
+	var caps unitCaps
+
+	for _, ti := range vanilla.TroopInfos {
+		if ti.DefaultUnitNumX > caps.UnitsX {
+			caps.UnitsX = ti.DefaultUnitNumX
+		}
+
+		if ti.DefaultUnitNumY > caps.UnitsY {
+			caps.UnitsY = ti.DefaultUnitNumY
+		}
+
+		if n := ti.DefaultUnitNumX * ti.DefaultUnitNumY; n > caps.Units {
+			caps.Units = n
+		}
+
+		if ti.BaseWidth > caps.BaseWidth {
+			caps.BaseWidth = ti.BaseWidth
+		}
+
+		if ti.FormationRandom > caps.FormationRandom {
+			caps.FormationRandom = ti.FormationRandom
+		}
+	}
+
+	return caps
+}
+
+// merge returns caps with every non-zero value of override applied.
+func (caps unitCaps) merge(override unitCaps) unitCaps {
+	if override.UnitsX != 0 {
+		caps.UnitsX = override.UnitsX
+	}
+
+	if override.UnitsY != 0 {
+		caps.UnitsY = override.UnitsY
+	}
+
+	if override.Units != 0 {
+		caps.Units = override.Units
+	}
+
+	if override.BaseWidth != 0 {
+		caps.BaseWidth = override.BaseWidth
+	}
+
+	if override.FormationRandom != 0 {
+		caps.FormationRandom = override.FormationRandom
+	}
+
+	return caps
+}
+
+// checkUnitCaps returns a warning for every troop of tis whose formation
+// exceeds caps or is empty.
+func checkUnitCaps(tis troopInfoSOX, caps unitCaps) []capWarning {
+	var warnings []capWarning
+
+	for i, ti := range tis.TroopInfos {
+		warn := func(format string, args ...interface{}) {
+			warnings = append(warnings, capWarning{Troop: troopName(i), Msg: fmt.Sprintf(format, args...)})
+		}
+
+		if ti.DefaultUnitNumX < 1 || ti.DefaultUnitNumY < 1 {
+			warn("formation of %dx%d units has no units", ti.DefaultUnitNumX, ti.DefaultUnitNumY)
+		}
+
+		if caps.UnitsX != 0 && ti.DefaultUnitNumX > caps.UnitsX {
+			warn("default_unit_num_x %d exceeds %d", ti.DefaultUnitNumX, caps.UnitsX)
+		}
+
+		if caps.UnitsY != 0 && ti.DefaultUnitNumY > caps.UnitsY {
+			warn("default_unit_num_y %d exceeds %d", ti.DefaultUnitNumY, caps.UnitsY)
+		}
+
+		if n := ti.DefaultUnitNumX * ti.DefaultUnitNumY; caps.Units != 0 && n > caps.Units {
+			warn("%d units exceed %d", n, caps.Units)
+		}
+
+		if ti.BaseWidth <= 0 {
+			warn("base_width %g isn't positive", ti.BaseWidth)
+		} else if caps.BaseWidth != 0 && ti.BaseWidth > caps.BaseWidth {
+			warn("base_width %g exceeds %g", ti.BaseWidth, caps.BaseWidth)
+		}
+
+		if caps.FormationRandom != 0 && ti.FormationRandom > caps.FormationRandom {
+			warn("formation_random %d exceeds %d", ti.FormationRandom, caps.FormationRandom)
+		}
+	}
+
+	return warnings
+}
+
+// warnUnitCaps logs a warning for every troop of tis that may not render
+// correctly or may crash missions.
+func warnUnitCaps(tis troopInfoSOX) {
+	var caps unitCaps
+
+	if vanilla := readVanilla(); vanilla != nil {
+		caps = retailUnitCaps(*vanilla)
+	}
+
+	if cfg, err := loadConfig(); err == nil {
+		caps = caps.merge(cfg.UnitCaps)
+	}
+
+	for _, w := range checkUnitCaps(tis, caps) {
+		log.Warn().Msg(tr("%s; the engine may not render it and missions may crash", w))
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// command is a subcommand invoked as `troopinfo <name> [flags]`.
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{
+		name:  "dump",
+		usage: "Decodes the installed TroopInfo.sox into the workspace TroopInfo.yaml (or TroopInfo.json with -format json), or any SOX file described by a schema document (dump -schema <file.schema.yaml> [file.sox])",
+		run:   runDump,
+	},
+	{
+		name:  "apply",
+		usage: "Encodes the workspace TroopInfo.yaml or TroopInfo.json into the installed TroopInfo.sox, listing the changes (apply -dry-run only lists them), or layers several override files on top of it (apply -strategy error|last-wins|interactive a.yaml b.yaml)",
+		run:   runApply,
+	},
+	{
+		name:  "restore",
+		usage: "Restores the installed TroopInfo.sox from the backup taken before modding (TroopInfo.sox.bak, or the vanilla snapshot of setup), or from the backup chain (restore -at <timestamp>); restore -list shows what each backup differs in",
+		run:   runRestore,
+	},
+	{
+		name:  "show",
+		usage: "Prints a table of the installed troop data, highlighting changes from the backup",
+		run:   runShow,
+	},
+	{
+		name:  "export",
+		usage: "Exports TroopInfo.sox to a spreadsheet-friendly CSV file, one file per faction (-group faction), or an XLSX workbook with a sheet per data file (-format xlsx)",
+		run:   runExport,
+	},
+	{
+		name:  "import",
+		usage: "Imports a CSV file, a directory of grouped CSV files or an XLSX workbook produced by export into TroopInfo.yaml, optionally merging with local edits and applying the result to TroopInfo.sox (-apply)",
+		run:   runImport,
+	},
+	{
+		name:  "grep",
+		usage: "Searches troop names, field names and values in every supported data file",
+		run:   runGrep,
+	},
+	{
+		name:  "compare-installs",
+		usage: "Compares the data files of two game directories field by field",
+		run:   runCompareInstalls,
+	},
+	{
+		name:  "append",
+		usage: "Appends copies of a troop record to TroopInfo.sox (expert mode)",
+		run:   runAppend,
+	},
+	{
+		name:  "disable",
+		usage: "Stubs out troop records so the troops can't fight, without removing them",
+		run:   runDisable,
+	},
+	{
+		name:  "reorder",
+		usage: "Moves a troop record to a new index, fixing up files that refer to troops by index",
+		run:   runReorder,
+	},
+	{
+		name:  "variant",
+		usage: "Manages named variants of TroopInfo.yaml (e.g. per difficulty): list, save, switch, delete",
+		run:   runVariant,
+	},
+	{
+		name:  "calc",
+		usage: "Calculates the damage one troop deals to another (calc damage)",
+		run:   runCalc,
+	},
+	{
+		name:  "expcurve",
+		usage: "Generates and plots an experience table from a formula",
+		run:   runExpCurve,
+	},
+	{
+		name:  "analyze",
+		usage: "Reports balance risks: large stat changes and values outside the vanilla range",
+		run:   runAnalyze,
+	},
+	{
+		name:  "tierlist",
+		usage: "Ranks all troops into tiers using weighted damage, toughness, speed and range",
+		run:   runTierList,
+	},
+	{
+		name:  "heatmap",
+		usage: "Renders a color-coded grid of troops by fields, e.g. heatmap -field resist_*",
+		run:   runHeatmap,
+	},
+	{
+		name:  "serve",
+		usage: "Serves the game data as cacheable JSON for fan sites, with an optional session editing API (-sessions)",
+		run:   runServe,
+	},
+	{
+		name:  "site",
+		usage: "Builds a static unit database website (site build)",
+		run:   runSite,
+	},
+	{
+		name:  "fingerprint",
+		usage: "Identifies data file versions by hash; submit unknown ones and export/import the database",
+		run:   runFingerprint,
+	},
+	{
+		name:  "schema",
+		usage: "Prints the binary field layout of supported data files and checks files against them (schema list, show <file>, check), exports them and schema documents as Kaitai Struct or 010 Editor templates (schema export -format ksy|bt <file>), and writes JSON Schemas of the YAML files for editor completion and checks (schema json-schema [-o file] troopinfo|config|delta|manifest)",
+		run:   runSchema,
+	},
+	{
+		name:  "backup",
+		usage: "Saves TroopInfo.sox to the backup chain (backup save [name]), lists it, verifies a backup's checksums (backup verify <id>), restores it, optionally only some troops (backup restore <id> [troop...]), or deletes old automatic backups (backup prune -keep N); every write of TroopInfo.sox is backed up automatically",
+		run:   runBackup,
+	},
+	{
+		name:  "diff",
+		usage: "Lists the fields that differ between two sources, e.g. diff @backup:2024-05-01 @current; exits with status 1 if they differ and 2 on errors (-quiet prints nothing)",
+		run:   runDiff,
+	},
+	{
+		name:  "status",
+		usage: "Shows whether the workspace YAML, the installed game files and vanilla are in sync",
+		run:   runStatus,
+	},
+	{
+		name:  "patch",
+		usage: "Applies a patch document whose rules can target fields across every data file, or creates (patch create) and applies (patch apply) a delta of the fields a mod changes, to share instead of a whole SOX file",
+		run:   runPatch,
+	},
+	{
+		name:  "levelup",
+		usage: "Checks the level_up_data lists in TroopInfo.yaml (levelup check) or pads/truncates them to three entries (levelup fix)",
+		run:   runLevelUp,
+	},
+	{
+		name:  "aliases",
+		usage: "Lists the community names accepted in place of field names, including those from the configuration file",
+		run:   runAliases,
+	},
+	{
+		name:  "history",
+		usage: "Queries the history database of operations: history list [-op, -troop, -field, -since, -n], show <id>, snapshot <id> -o <file>, prune [-keep n, -keep-snapshots n]",
+		run:   runHistory,
+	},
+	{
+		name:  "roster",
+		usage: "Exports a high-level roster (faction, role, key stats) or regenerates troops from one (roster export, roster import)",
+		run:   runRoster,
+	},
+	{
+		name:  "setup",
+		usage: "Finds the game, writes a validated configuration file, snapshots the vanilla data and runs a self-test (setup -check only validates)",
+		run:   runSetup,
+	},
+	{
+		name:  "lint",
+		usage: "Warns about edits that revert the stat changes of official balance patches, e.g. in mods based on old dumps",
+		run:   runLint,
+	},
+	{
+		name:  "archive",
+		usage: "Packs the decoded game data into one canonical, hash-indexed archive, or extracts one on top of your own install (archive create, archive extract)",
+		run:   runArchive,
+	},
+	{
+		name:  "impact",
+		usage: "Lists the fields and data potentially affected by changing a field, e.g. impact attack_range_max",
+		run:   runImpact,
+	},
+	{
+		name:  "balance",
+		usage: "Guided wizard turning an intent such as \"archers 20% stronger against cavalry\" into a field edit, with a preview before applying it",
+		run:   runBalance,
+	},
+	{
+		name:  "bugreport",
+		usage: "Bundles the tool version, configuration, file fingerprints, recent history and the last failure into an archive to attach to issues",
+		run:   runBugReport,
+	},
+	{
+		name:  "infer",
+		usage: "Guesses the record layout of an unknown SOX file and prints it as a draft schema document for dump -schema (infer [-o file.schema.yaml] <file.sox>)",
+		run:   runInfer,
+	},
+	{
+		name:  "troop",
+		usage: "Adds a troop as a copy of an existing one to TroopInfo.sox and TroopInfo.yaml (troop add -clone <troop> -name <name>)",
+		run:   runTroop,
+	},
+	{
+		name:  "reset",
+		usage: "Reverts fields of the workspace TroopInfo.yaml to their vanilla values without restoring the whole file (reset \"Knight.move_speed\" [...], or reset -all)",
+		run:   runReset,
+	},
+	{
+		name:  "mod",
+		usage: "Packs a mod into a single .kufmod file with a manifest and YAML overrides (mod pack -name <name> [override.yaml...]) and manages installed mods: install, uninstall, list, order (load order, later mods win conflicts) and info",
+		run:   runMod,
+	},
+	{
+		name:  "validate",
+		usage: "Checks troop data for values that crash or break the game, e.g. resistances outside 0 to 1 or units without HP, and exits with an error if it finds any (validate [-from source] [-rules]); writes to TroopInfo.sox run the same checks",
+		run:   runValidate,
+	},
+	{
+		name:  "set",
+		usage: "Changes fields of the workspace TroopInfo.yaml with expressions instead of hand edits (set [-where \"job == JOB_INFANTRY\"] -expr \"move_speed = move_speed * 1.2; defense += 5\" [-dry-run]), or a single field of the installed TroopInfo.sox (set [-sync] troop_infos[Knight].defense 42)",
+		run:   runSet,
+	},
+	{
+		name:  "get",
+		usage: "Prints single fields of the installed TroopInfo.sox or another source (get [-from source] troop_infos[Knight].defense [...])",
+		run:   runGet,
+	},
+	{
+		name:  "edit",
+		usage: "Opens a terminal editor on the workspace TroopInfo.yaml with a troop list, the fields of the selected troop next to their vanilla values, inline editing, a diff of the unsaved changes and save (edit [-o file])",
+		run:   runEdit,
+	},
+	{
+		name:  "gui",
+		usage: "Opens a graphical editor for the installed TroopInfo.sox in the browser, with a troop table, vanilla values, undo, the pending changes and validation as you edit (gui [-addr localhost:8080] [-no-browser])",
+		run:   runGUI,
+	},
+	{
+		name:  "watch",
+		usage: "Applies the workspace TroopInfo.yaml to the installed TroopInfo.sox every time it is saved, validating it first and waiting for the game to exit (watch [-from file] [-delay 300ms])",
+		run:   runWatch,
+	},
+}
+
+func lookupCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+
+	return command{}, false
+}
+
+// newFlagSet returns a flag set for the named command that reports parse
+// errors instead of exiting.
+func newFlagSet(name string) *flag.FlagSet {
+	return flag.NewFlagSet(name, flag.ContinueOnError)
+}
+
+// printUsage lists the commands, followed by the deprecated mode flags.
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, tr("Usage: troopinfo <command> [flags]; troopinfo <command> -h lists the flags of a command"))
+	fmt.Fprintln(w, tr("Every command takes -game-dir <dir>, which overrides %s and game_dir in the configuration file", gameDirEnv))
+	fmt.Fprintln(w, tr("Commands refuse to write the game files while the game is running or the data fails validation; troopinfo -force <command> writes anyway"))
+	fmt.Fprintln(w)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.name, cmd.usage)
+	}
+
+	_ = tw.Flush()
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, tr("Deprecated flags:"))
+
+	flag.CommandLine.SetOutput(w)
+	flag.PrintDefaults()
+}
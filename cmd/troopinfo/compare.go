@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/rdeusser/troopinfo/kuftc"
+)
+
+// fieldChange is a field whose value differs between two versions of a
+// record.
+type fieldChange struct {
+	Record string `json:"record"`
+	Field  string `json:"field"`
+	Old    string `json:"old"`
+	New    string `json:"new"`
+}
+
+func (c fieldChange) String() string {
+	return fmt.Sprintf("%s.%s: %s -> %s", c.Record, c.Field, describeValue(c.Field, c.Old), describeValue(c.Field, c.New))
+}
+
+// diffRecords compares records field by field. Records with keys are
+// matched by key, so troops whose records moved are compared with
+// themselves; others are matched by position. Records only present on one
+// side are reported with empty values.
+func diffRecords(a, b []record) []fieldChange {
+	var changes []fieldChange
+
+	for _, p := range pairRecords(a, b) {
+		ra, rb := p[0], p[1]
+
+		name := rb.Name
+		if name == "" {
+			name = ra.Name
+		}
+
+		values := map[string]string{}
+		for _, f := range ra.Fields {
+			values[f.Name] = f.Value
+		}
+
+		for _, f := range rb.Fields {
+			if old, ok := values[f.Name]; !ok || old != f.Value {
+				changes = append(changes, fieldChange{Record: name, Field: f.Name, Old: old, New: f.Value})
+			}
+
+			delete(values, f.Name)
+		}
+
+		for _, f := range ra.Fields {
+			if old, ok := values[f.Name]; ok {
+				changes = append(changes, fieldChange{Record: name, Field: f.Name, Old: old})
+			}
+		}
+	}
+
+	return changes
+}
+
+// pairRecords pairs the records of a and b for diffRecords, in the order of
+// b followed by the records only a has. A missing side is an empty record.
+func pairRecords(a, b []record) [][2]record {
+	keyed := len(a) > 0 || len(b) > 0
+
+	for _, rs := range [][]record{a, b} {
+		for _, r := range rs {
+			keyed = keyed && r.Key != ""
+		}
+	}
+
+	var pairs [][2]record
+
+	if !keyed {
+		for i := 0; i < len(a) || i < len(b); i++ {
+			var p [2]record
+			if i < len(a) {
+				p[0] = a[i]
+			}
+
+			if i < len(b) {
+				p[1] = b[i]
+			}
+
+			pairs = append(pairs, p)
+		}
+
+		return pairs
+	}
+
+	index := map[string]int{}
+	for i, r := range a {
+		index[r.Key] = i
+	}
+
+	paired := make([]bool, len(a))
+
+	for _, r := range b {
+		p := [2]record{{}, r}
+
+		if i, ok := index[r.Key]; ok {
+			p[0] = a[i]
+			paired[i] = true
+		}
+
+		pairs = append(pairs, p)
+	}
+
+	for i, r := range a {
+		if !paired[i] {
+			pairs = append(pairs, [2]record{r, {}})
+		}
+	}
+
+	return pairs
+}
+
+// resolveSOXDir returns the SOX directory of dir, which may be a game
+// install, a copy of its Data folder, or a copy of the SOX directory itself.
+func resolveSOXDir(dir string) string {
+	return kuftc.SOXDir(dir)
+}
+
+func runCompareInstalls(args []string) error {
+	fs := newFlagSet("compare-installs")
+	summary := fs.Bool("summary", false, "Only print the number of differences per file")
+	showAll := fs.Bool("show-ignored", false, "Also lists the differences suppressed by the ignore rules of the configuration")
+	tol := fs.Float64("tolerance", floatTolerance, "Relative difference below which float values are reported as equivalent, e.g. 1e-6; 0 compares exactly")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 2 {
+		return errors.New("expected two game directories or zip archives")
+	}
+
+	stA, err := openStorage(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	stB, err := openStorage(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	for _, df := range dataFiles {
+		a, errA := df.readRecords(stA)
+		b, errB := df.readRecords(stB)
+
+		switch {
+		case os.IsNotExist(errA) && os.IsNotExist(errB):
+			continue
+		case os.IsNotExist(errA):
+			fmt.Printf("%s: only in %s\n", df.Name, fs.Arg(1))
+			continue
+		case os.IsNotExist(errB):
+			fmt.Printf("%s: only in %s\n", df.Name, fs.Arg(0))
+			continue
+		case errA != nil:
+			return fmt.Errorf("%s: %w", filepath.Join(stA.String(), df.Name), errA)
+		case errB != nil:
+			return fmt.Errorf("%s: %w", filepath.Join(stB.String(), df.Name), errB)
+		}
+
+		changes := diffRecords(a, b)
+
+		ignored := 0
+		if !*showAll {
+			changes, ignored = filterIgnored(df.Name, changes)
+		}
+
+		changes, same := filterEquivalent(changes, *tol)
+
+		if len(changes) == 0 {
+			if same > 0 {
+				fmt.Printf("%s: equivalent\n", df.Name)
+			} else {
+				fmt.Printf("%s: identical\n", df.Name)
+			}
+
+			printIgnoredNote(ignored)
+			printEquivalentNote(same, *tol)
+
+			continue
+		}
+
+		records := map[string]bool{}
+		for _, c := range changes {
+			records[c.Record] = true
+		}
+
+		fmt.Printf("%s: %d fields differ in %d records\n", df.Name, len(changes), len(records))
+
+		printIgnoredNote(ignored)
+		printEquivalentNote(same, *tol)
+
+		if *summary {
+			continue
+		}
+
+		for _, c := range changes {
+			fmt.Printf("  %s\n", formatChange(df.Name, c))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rdeusser/troopinfo/kuftc"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// config is the user configuration, read from <config dir>/kuftc/config.yaml.
+type config struct {
+	// GameDir is the game install to work on, if not the default Steam one.
+	GameDir string `yaml:"game_dir,omitempty"`
+
+	Hooks    []fieldHook `yaml:"hooks,omitempty"`
+	UnitCaps unitCaps    `yaml:"unit_caps,omitempty"`
+
+	// Aliases map community names of fields to field names.
+	Aliases map[string]string `yaml:"aliases,omitempty"`
+
+	// Units are the units values in TroopInfo.yaml may be annotated with.
+	Units map[string]unitConversion `yaml:"units,omitempty"`
+
+	// Ignore suppresses known-noisy differences in diff output.
+	Ignore []ignoreRule `yaml:"ignore,omitempty"`
+
+	// FloatTolerance is the relative difference below which float values
+	// are reported as equivalent in diffs, e.g. 1e-6.
+	FloatTolerance float64 `yaml:"float_tolerance,omitempty"`
+
+	// BackupKeep is the number of automatic backups of TroopInfo.sox kept
+	// before the oldest are deleted; 0 keeps the default of 20.
+	BackupKeep int `yaml:"backup_keep,omitempty"`
+
+	// HistoryKeep is the number of operations kept in the history
+	// database before the oldest are dropped; 0 keeps the default of 1000.
+	HistoryKeep int `yaml:"history_keep,omitempty"`
+
+	// Validation sets the severity of validation rules by name: error,
+	// warning or off.
+	Validation map[string]string `yaml:"validation,omitempty"`
+
+	// SkillNames name skill IDs in TroopInfo.yaml, e.g. FIRE_ARROW: 16.
+	SkillNames map[string]int32 `yaml:"skill_names,omitempty"`
+
+	// NumericIDs writes jobs, troop types and skills as numbers instead of
+	// their names.
+	NumericIDs bool `yaml:"numeric_ids,omitempty"`
+}
+
+// configDir returns the directory holding the configuration and the other
+// per-user files of the tool.
+func configDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "kuftc"), nil
+}
+
+func configPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "config.yaml"), nil
+}
+
+// loadConfig reads the configuration file. A missing file is an empty
+// configuration. Unknown keys are errors, so typos don't silently disable a
+// setting.
+func loadConfig() (config, error) {
+	var cfg config
+
+	path, err := configPath()
+	if err != nil {
+		return cfg, err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+
+	if err != nil {
+		return cfg, err
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+
+	if err := dec.Decode(&cfg); err != nil && err != io.EOF {
+		return cfg, newYAMLError(path, data, err)
+	}
+
+	return cfg, nil
+}
+
+// saveConfig validates cfg and writes it to the configuration file.
+func saveConfig(cfg config) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// validate checks the settings that decoding alone doesn't: that they refer
+// to things that exist and hold usable values. All problems are reported at
+// once.
+func (cfg config) validate() error {
+	var problems []string
+
+	if cfg.GameDir != "" {
+		if _, err := os.Stat(filepath.Join(resolveSOXDir(cfg.GameDir), troopInfoFile.Name)); err != nil {
+			problems = append(problems, fmt.Sprintf("game_dir: %s has no %s", cfg.GameDir, troopInfoFile.Name))
+		}
+	}
+
+	for i, h := range cfg.Hooks {
+		if len(h.Fields) == 0 {
+			problems = append(problems, fmt.Sprintf("hooks[%d]: no fields", i))
+		}
+
+		if h.Run == "" && h.Message == "" && !h.Confirm {
+			problems = append(problems, fmt.Sprintf("hooks[%d]: needs message, run or confirm", i))
+		}
+	}
+
+	for _, c := range []struct {
+		name  string
+		value float64
+	}{
+		{"units_x", float64(cfg.UnitCaps.UnitsX)},
+		{"units_y", float64(cfg.UnitCaps.UnitsY)},
+		{"units", float64(cfg.UnitCaps.Units)},
+		{"base_width", float64(cfg.UnitCaps.BaseWidth)},
+		{"formation_random", float64(cfg.UnitCaps.FormationRandom)},
+	} {
+		if c.value < 0 {
+			problems = append(problems, fmt.Sprintf("unit_caps.%s: negative cap %g", c.name, c.value))
+		}
+	}
+
+	for alias, field := range cfg.Aliases {
+		if _, ok := lookupFieldName(field); !ok {
+			problems = append(problems, fmt.Sprintf("aliases.%s: unknown field %q", alias, field))
+		}
+	}
+
+	for unit, c := range cfg.Units {
+		if c.Factor == 0 {
+			problems = append(problems, fmt.Sprintf("units.%s: no factor", unit))
+		}
+	}
+
+	if cfg.FloatTolerance < 0 || cfg.FloatTolerance >= 1 {
+		problems = append(problems, fmt.Sprintf("float_tolerance: %g is not between 0 and 1", cfg.FloatTolerance))
+	}
+
+	if cfg.BackupKeep < 0 {
+		problems = append(problems, fmt.Sprintf("backup_keep: %d is negative", cfg.BackupKeep))
+	}
+
+	if cfg.HistoryKeep < 0 {
+		problems = append(problems, fmt.Sprintf("history_keep: %d is negative", cfg.HistoryKeep))
+	}
+
+	for name := range cfg.SkillNames {
+		if _, err := strconv.Atoi(name); err == nil {
+			problems = append(problems, fmt.Sprintf("skill_names.%s: a name can't be a number", name))
+		}
+	}
+
+	for rule, severity := range cfg.Validation {
+		if _, ok := lookupValidationRule(rule); !ok {
+			problems = append(problems, fmt.Sprintf("validation.%s: unknown rule", rule))
+		} else if !validSeverity(severity) {
+			problems = append(problems, fmt.Sprintf("validation.%s: %q isn't error, warning or off", rule, severity))
+		}
+	}
+
+	for i, r := range cfg.Ignore {
+		for _, p := range r.validate() {
+			problems = append(problems, fmt.Sprintf("ignore[%d]: %s", i, p))
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return errors.New("invalid configuration:\n  " + strings.Join(problems, "\n  "))
+	}
+
+	return nil
+}
+
+// gameDirEnv overrides the game directory of the configuration file.
+const gameDirEnv = "KUFTC_GAME_DIR"
+
+// loadGameDir moves the game file paths to the first game directory given
+// by the -game-dir flag, the KUFTC_GAME_DIR environment variable or the
+// game_dir of the configuration file. Without any, the default Steam install
+// is used, or the first install found in the Steam libraries if it doesn't
+// exist.
+func loadGameDir(flagDir string) {
+	dir, from := flagDir, "-game-dir"
+
+	if dir == "" {
+		dir, from = os.Getenv(gameDirEnv), gameDirEnv
+	}
+
+	if dir == "" {
+		cfg, err := loadConfig()
+		if err != nil {
+			log.Debug().
+				Err(err).
+				Msg(tr("Ignoring the game directory in the configuration"))
+			return
+		}
+
+		dir, from = cfg.GameDir, "game_dir"
+	}
+
+	if dir == "" {
+		if isGameDir(defaultGameDir()) {
+			setGameDir(defaultGameDir())
+			return
+		}
+
+		found := detectGameDirs()
+		if len(found) == 0 {
+			return
+		}
+
+		dir, from = found[0], "Steam"
+		log.Debug().Msg(tr("Found the game in %s", dir))
+	}
+
+	if !isGameDir(dir) {
+		log.Warn().Msg(tr("%s (from %s) doesn't hold %s, directly or in Data/SOX", dir, from, troopInfoFile.Name))
+	}
+
+	setGameDir(dir)
+}
+
+// takeGameDirFlag removes the -game-dir flag, which every command accepts,
+// from args, and returns its value. Both -game-dir and --game-dir are
+// accepted, with the value after = or as the next argument.
+func takeGameDirFlag(args []string) (string, []string, error) {
+	var (
+		dir  string
+		rest []string
+	)
+
+	for i := 0; i < len(args); i++ {
+		name := strings.TrimPrefix(strings.TrimPrefix(args[i], "-"), "-")
+
+		switch {
+		case args[i] == "--":
+			return dir, append(rest, args[i:]...), nil
+		case name == "game-dir" && name != args[i]:
+			if i+1 == len(args) {
+				return "", nil, errors.New("-game-dir needs a directory")
+			}
+
+			i++
+			dir = args[i]
+		case strings.HasPrefix(name, "game-dir=") && name != args[i]:
+			dir = strings.TrimPrefix(name, "game-dir=")
+		default:
+			rest = append(rest, args[i])
+		}
+	}
+
+	return dir, rest, nil
+}
+
+// installDir is the game directory as it was given, which soxDir was
+// resolved from.
+var installDir = defaultGameDir()
+
+// setGameDir points the paths of the game files and the directories kept
+// next to them at the game install dir.
+func setGameDir(dir string) {
+	installDir = dir
+	soxDir = resolveSOXDir(dir)
+	troopInfoPath = kuftc.FindFold(soxDir, troopInfoFile.Name)
+	troopInfoYAMLPath = filepath.Join(soxDir, "TroopInfo.yaml")
+	troopInfoCSVPath = filepath.Join(soxDir, "TroopInfo.csv")
+	troopInfoJSONPath = filepath.Join(soxDir, "TroopInfo.json")
+	troopInfoBackupPath = troopInfoPath + ".bak"
+	backupsDir = filepath.Join(soxDir, "backups")
+	variantsDir = filepath.Join(soxDir, "variants")
+	modsDir = filepath.Join(soxDir, "mods")
+	syncStatePath = filepath.Join(soxDir, ".kuftc-sync.yaml")
+}
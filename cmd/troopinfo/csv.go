@@ -0,0 +1,573 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+var troopInfoCSVPath = filepath.Join(soxDir, "TroopInfo.csv")
+
+// CSV layouts. In the rows layout each troop is a row and each field a
+// column; the columns layout is transposed, which is how most balance
+// spreadsheets are organized.
+const (
+	layoutRows    = "rows"
+	layoutColumns = "columns"
+)
+
+// Header cells identifying each layout.
+const (
+	rowsHeader    = "troop"
+	columnsHeader = "field"
+)
+
+// formatCSV is the default spreadsheet format of export and import.
+const formatCSV = "csv"
+
+// sheetFormat returns the spreadsheet format of the file at path: format if
+// given, or else the one its extension names.
+func sheetFormat(format, path string) (string, error) {
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(path), ".")
+	}
+
+	switch f := strings.ToLower(format); f {
+	case formatXLSX:
+		return f, nil
+	case formatCSV, "":
+		return formatCSV, nil
+	default:
+		return "", fmt.Errorf("unknown format %q, expected %s or %s", format, formatCSV, formatXLSX)
+	}
+}
+
+// Export groupings. Grouped exports write one file per group into the output
+// directory.
+const groupFaction = "faction"
+
+var errUnknownLayout = errors.New("unknown layout")
+
+func runExport(args []string) error {
+	fs := newFlagSet("export")
+	format := fs.String("format", "", "Spreadsheet format to write: csv, or xlsx for a workbook with a sheet per data file (defaults to the extension of -o, or csv)")
+	layout := fs.String("layout", layoutRows, "CSV layout: rows (one troop per row) or columns (one troop per column)")
+	out := fs.String("o", troopInfoCSVPath, "Path of the CSV file to write")
+	from := fs.String("from", sourceCurrent, "Data to export: current, vanilla, a file, or a reference such as @backup:2024-05-01")
+	group := fs.String("group", "", "Write one file per group into the -o directory: faction")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	outSet := false
+	fs.Visit(func(f *flag.Flag) { outSet = outSet || f.Name == "o" })
+
+	sf, err := sheetFormat(*format, *out)
+	if err != nil {
+		return err
+	}
+
+	tis, err := loadTroopSource(*from)
+	if err != nil {
+		return err
+	}
+
+	if sf == formatXLSX {
+		if *group != "" {
+			return errors.New("-group isn't supported with -format xlsx, which already has a sheet per data file")
+		}
+
+		if !outSet {
+			*out = strings.TrimSuffix(troopInfoCSVPath, filepath.Ext(troopInfoCSVPath)) + ".xlsx"
+		}
+
+		sheets, err := workbookSheets(tis)
+		if err != nil {
+			return err
+		}
+
+		if err := writeXLSX(*out, sheets); err != nil {
+			return err
+		}
+
+		log.Info().Msg(tr("Exported %s", *out))
+
+		return nil
+	}
+
+	switch *group {
+	case "":
+		return exportCSV(*out, tis, *layout, allTroops(tis))
+	case groupFaction:
+		if err := os.MkdirAll(*out, 0700); err != nil {
+			return err
+		}
+
+		for _, g := range troopsByFaction(tis) {
+			if err := exportCSV(filepath.Join(*out, g.file+".csv"), tis, *layout, g.troops); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("unknown group %q, expected %s", *group, groupFaction)
+	}
+}
+
+// exportCSV writes the given troops of tis to the CSV file at path.
+func exportCSV(path string, tis troopInfoSOX, layout string, troops []int) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := writeCSV(file, tis, layout, troops); err != nil {
+		return err
+	}
+
+	log.Info().Msg(tr("Exported %s", path))
+
+	return file.Close()
+}
+
+// allTroops returns the indexes of every troop of tis.
+func allTroops(tis troopInfoSOX) []int {
+	troops := make([]int, len(tis.TroopInfos))
+	for i := range troops {
+		troops[i] = i
+	}
+
+	return troops
+}
+
+func runImport(args []string) error {
+	fs := newFlagSet("import")
+	format := fs.String("format", "", "Spreadsheet format to read: csv or xlsx (defaults to the file extension, or csv)")
+	layout := fs.String("layout", "", "CSV layout: rows or columns (detected from the header if empty)")
+	locale := fs.String("locale", localeAuto, "Locale of the numbers in the file, e.g. en or de-DE (detected from the data if auto)")
+	out := fs.String("o", troopInfoYAMLPath, "Path of the YAML file to write")
+	merge := fs.Bool("merge", false, "Apply only the changed cells to the existing YAML file, keeping its comments, instead of replacing it")
+	conflicts := fs.String("conflicts", resolvePrompt, "How to resolve fields changed in both the YAML and the CSV: prompt, ours, theirs, or fail")
+	details := fs.Bool("details", false, "List every changed value instead of a per-troop summary")
+	apply := fs.Bool("apply", false, "Also encode the imported data into the installed TroopInfo.sox")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		return errors.New("expected a single CSV file or directory, or a workbook to import")
+	}
+
+	sf, err := sheetFormat(*format, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	read := func(path string, tis *troopInfoSOX) error {
+		return readCSVFile(path, tis, *layout, *locale)
+	}
+
+	paths := []string{fs.Arg(0)}
+
+	if sf == formatXLSX {
+		read = func(path string, tis *troopInfoSOX) error {
+			return readXLSXFile(path, tis, *layout)
+		}
+	} else if paths, err = csvFiles(fs.Arg(0)); err != nil {
+		return err
+	}
+
+	// Start from the current SOX file so the header and trailer survive.
+	base, err := readTroopInfoSOX(troopInfoPath)
+	if err != nil {
+		return err
+	}
+
+	tis := base.Clone()
+
+	for _, path := range paths {
+		if err := read(path, &tis); err != nil {
+			return err
+		}
+	}
+
+	// Compare against what the YAML currently holds so hooks see the changes
+	// the import actually makes.
+	ours, err := readTroopInfoYAML(*out, base)
+	if os.IsNotExist(err) {
+		ours = base
+	} else if err != nil {
+		return err
+	}
+
+	merged := tis
+
+	if *merge {
+		resolve, err := newResolver(*conflicts, os.Stdin, os.Stdout)
+		if err != nil {
+			return err
+		}
+
+		merged, err = merge3(base, ours, tis, resolve)
+		if err != nil {
+			return err
+		}
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	changes := diffRecords(troopRecords(ours), troopRecords(merged))
+
+	if err := runHooks(cfg.Hooks, changes, os.Stdin, os.Stdout); err != nil {
+		return err
+	}
+
+	printChangeSummary(os.Stdout, changes, *details)
+	warnUnitCaps(merged)
+
+	// Check before writing anything so a failed apply leaves no half-done
+	// import behind.
+	if *apply {
+		if err := checkComplete(merged, false); err != nil {
+			return err
+		}
+	}
+
+	if *merge {
+		// Only touch the changed values so comments in the YAML survive.
+		if err := patchTroopInfoYAML(*out, ours, merged); err != nil {
+			return err
+		}
+	} else if err := writeTroopInfoYAML(*out, merged); err != nil {
+		return err
+	}
+
+	recordHistory("import", *out, changes, nil)
+
+	log.Info().Msg(tr("Imported %s into %s", fs.Arg(0), *out))
+
+	if *apply {
+		return applyImported(*out, merged)
+	}
+
+	return nil
+}
+
+// applyImported encodes tis, just imported into the YAML file at path, into
+// the installed TroopInfo.sox.
+func applyImported(path string, tis troopInfoSOX) error {
+	installed, err := readTroopInfoSOX(troopInfoPath)
+	if err != nil {
+		return err
+	}
+
+	buf := &bytes.Buffer{}
+
+	if err := encodeTroopInfoSOX(buf, tis); err != nil {
+		return err
+	}
+
+	if err := installSOX(buf.Bytes()); err != nil {
+		return err
+	}
+
+	if path == troopInfoYAMLPath {
+		if err := recordSync(troopInfoFile.Name); err != nil {
+			log.Warn().Err(err).Msg(tr("Couldn't record the sync state"))
+		}
+	}
+
+	recordHistory("apply", troopInfoFile.Name, diffRecords(troopRecords(installed), troopRecords(tis)), buf.Bytes())
+
+	log.Info().Msg(tr("Wrote %s", troopInfoPath))
+
+	return nil
+}
+
+// csvFiles returns path, or the CSV files in it if it is a directory such as
+// a grouped export.
+func csvFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(path, "*.csv"))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no CSV files in %s", path)
+	}
+
+	return paths, nil
+}
+
+func readCSVFile(path string, tis *troopInfoSOX, layout, locale string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := readCSV(file, tis, layout, locale); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	return nil
+}
+
+// writeCSV writes the given troops of tis in layout.
+func writeCSV(w io.Writer, tis troopInfoSOX, layout string, troops []int) error {
+	cw := csv.NewWriter(w)
+
+	switch layout {
+	case layoutRows:
+		header := []string{rowsHeader}
+		for _, f := range troopFields {
+			header = append(header, f.Name)
+		}
+
+		if err := cw.Write(header); err != nil {
+			return err
+		}
+
+		for _, i := range troops {
+			record := []string{troopName(i)}
+			for _, f := range troopFields {
+				record = append(record, f.Format(&tis.TroopInfos[i]))
+			}
+
+			if err := cw.Write(record); err != nil {
+				return err
+			}
+		}
+	case layoutColumns:
+		header := []string{columnsHeader}
+		for _, i := range troops {
+			header = append(header, troopName(i))
+		}
+
+		if err := cw.Write(header); err != nil {
+			return err
+		}
+
+		for _, f := range troopFields {
+			record := []string{f.Name}
+			for _, i := range troops {
+				record = append(record, f.Format(&tis.TroopInfos[i]))
+			}
+
+			if err := cw.Write(record); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("%w: %q", errUnknownLayout, layout)
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// readCSV overlays the values in r onto tis. Only the troops and fields present
+// in the file are changed. Numbers are parsed according to locale.
+func readCSV(r io.Reader, tis *troopInfoSOX, layout, locale string) error {
+	data, nf, err := readLocalized(r, locale)
+	if err != nil {
+		return err
+	}
+
+	cr := csv.NewReader(bytes.NewReader(data))
+	cr.Comma = nf.delimiter
+
+	records, err := cr.ReadAll()
+	if err != nil {
+		return err
+	}
+
+	if len(records) == 0 {
+		return errors.New("CSV file is empty")
+	}
+
+	return overlaySheet(records, tis, layout, nf)
+}
+
+// overlaySheet overlays the cells of a CSV file or workbook sheet onto tis,
+// detecting the layout from the header cell if it isn't given. Numbers are
+// written in nf.
+func overlaySheet(records [][]string, tis *troopInfoSOX, layout string, nf numberFormat) error {
+	if len(records) == 0 || len(records[0]) == 0 {
+		return errors.New("no header row")
+	}
+
+	header := records[0]
+
+	if layout == "" {
+		switch strings.TrimSpace(strings.ToLower(header[0])) {
+		case rowsHeader:
+			layout = layoutRows
+		case columnsHeader:
+			layout = layoutColumns
+		default:
+			return fmt.Errorf("cannot detect layout from header cell %q", header[0])
+		}
+	}
+
+	switch layout {
+	case layoutRows:
+		for _, record := range records[1:] {
+			i, err := troopRecord(*tis, record[0])
+			if err != nil {
+				return err
+			}
+
+			for j, name := range header[1:] {
+				if err := setField(&tis.TroopInfos[i], name, nf.normalize(record[j+1])); err != nil {
+					return fmt.Errorf("%s: %w", troopName(i), err)
+				}
+			}
+		}
+	case layoutColumns:
+		indexes := make([]int, len(header)-1)
+
+		for j, name := range header[1:] {
+			i, err := troopRecord(*tis, name)
+			if err != nil {
+				return err
+			}
+
+			indexes[j] = i
+		}
+
+		for _, record := range records[1:] {
+			for j, i := range indexes {
+				if err := setField(&tis.TroopInfos[i], record[0], nf.normalize(record[j+1])); err != nil {
+					return fmt.Errorf("%s: %w", troopName(i), err)
+				}
+			}
+		}
+	default:
+		return fmt.Errorf("%w: %q", errUnknownLayout, layout)
+	}
+
+	return nil
+}
+
+func setField(ti *troopInfo, name, value string) error {
+	f, ok := lookupField(strings.TrimSpace(name))
+	if !ok {
+		return fmt.Errorf("unknown field %q", name)
+	}
+
+	if id, ok := symbolValue(f.Name, value); ok {
+		value = strconv.Itoa(int(id))
+	}
+
+	return f.Parse(ti, value)
+}
+
+// troopName returns the display name of the troop at index i of the
+// installed TroopInfo.sox: its name in TroopNames.yaml, or else the name of
+// its troop type.
+func troopName(i int) string {
+	if name := customTroopNames[i]; name != "" {
+		return name
+	}
+
+	if t, ok := installedRoster.ownType(i); ok && t < len(troopNames) {
+		return troopNames[t]
+	}
+
+	return fmt.Sprintf("Troop %d", i)
+}
+
+// troopNameIn returns the display name of record i of a file with the given
+// roster: that of the installed record of the same troop, so a troop has the
+// same name in every file whatever the position of its record.
+func troopNameIn(r troopRoster, i int) string {
+	if t, ok := r.ownType(i); ok {
+		if j, ok := installedRoster.record(t); ok {
+			return troopName(j)
+		}
+
+		if t < len(troopNames) {
+			return troopNames[t]
+		}
+	}
+
+	return troopName(i)
+}
+
+// troopIndex returns the index of the troop with the given display name or
+// of the installed record with the given index. The names of
+// customTroopNamesFile are accepted as well as the built-in ones.
+func troopIndex(name string) (int, error) {
+	name = strings.TrimSpace(name)
+
+	if i, err := strconv.Atoi(name); err == nil {
+		return i, installedRoster.checkIndex(i)
+	}
+
+	for i, n := range customTroopNames {
+		if strings.EqualFold(n, name) {
+			return i, nil
+		}
+	}
+
+	for t, n := range troopNames {
+		if !strings.EqualFold(n, name) {
+			continue
+		}
+
+		if i, ok := installedRoster.record(t); ok {
+			return i, nil
+		}
+	}
+
+	// Troops without a name, such as those added by mods, go by the name
+	// troopName gives them.
+	var i int
+	if _, err := fmt.Sscanf(name, "Troop %d", &i); err == nil && i >= 0 && i < maxTroopRecords && troopName(i) == name {
+		return i, nil
+	}
+
+	return 0, fmt.Errorf("unknown troop %q", name)
+}
+
+// troopRecord returns the index of the record of tis identified by name, as
+// accepted by troopRoster.index, checking that tis has it.
+func troopRecord(tis troopInfoSOX, name string) (int, error) {
+	i, err := newTroopRoster(tis).index(name)
+	if err != nil {
+		return 0, err
+	}
+
+	if i >= len(tis.TroopInfos) {
+		return 0, fmt.Errorf("%s (index %d) isn't in a file with %d troops", troopName(i), i, len(tis.TroopInfos))
+	}
+
+	return i, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+)
+
+// dataFile is a game data file the tool knows how to decode.
+type dataFile struct {
+	Name   string       // file name inside the SOX directory
+	Record reflect.Type // layout of a single record, see schema
+	decode func(r io.Reader) ([]record, error)
+}
+
+// record is a decoded data file record flattened to name/value pairs, for
+// commands that work the same way across every supported file.
+type record struct {
+	Name   string        `json:"name"`
+	Fields []recordField `json:"fields"`
+
+	// Key identifies the record across files, for files whose records may
+	// move; see diffRecords.
+	Key string `json:"-"`
+}
+
+type recordField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+var troopInfoFile = dataFile{
+	Name:   "TroopInfo.sox",
+	Record: reflect.TypeOf(troopInfo{}),
+	decode: decodeTroopRecords,
+}
+
+var dataFiles = []dataFile{
+	troopInfoFile,
+}
+
+// readRecords decodes the data file df in st.
+func (df dataFile) readRecords(st storage) ([]record, error) {
+	data, err := st.ReadFile(df.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := df.checkData(df.Name, data); err != nil {
+		return nil, err
+	}
+
+	return df.decode(bytes.NewReader(data))
+}
+
+func decodeTroopRecords(r io.Reader) ([]record, error) {
+	tis, err := decodeTroopInfoSOX(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return troopRecords(tis), nil
+}
+
+// troopRecords flattens every troop in tis into a record, keyed and named
+// after its troop.
+func troopRecords(tis troopInfoSOX) []record {
+	records := make([]record, len(tis.TroopInfos))
+	roster := newTroopRoster(tis)
+
+	for i := range tis.TroopInfos {
+		records[i].Key = roster.key(i)
+		records[i].Name = troopNameIn(roster, i)
+
+		for _, f := range troopFields {
+			records[i].Fields = append(records[i].Fields, recordField{
+				Name:  f.Name,
+				Value: f.Format(&tis.TroopInfos[i]),
+			})
+		}
+	}
+
+	return records
+}
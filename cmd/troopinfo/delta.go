@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// deltaDocument is a mod distributed as the fields it changes rather than a
+// whole TroopInfo.sox, e.g.
+//
+//	file: TroopInfo.sox
+//	version: 2
+//	changes:
+//	  - record: knight
+//	    field: move_speed
+//	    from: 3.21
+//	    to: 3.5
+//
+// Records are troop keys and fields are field names, so a delta applies to
+// installs whose file differs in layout or in the fields the mod leaves alone.
+type deltaDocument struct {
+	File    string        `yaml:"file"`
+	Version int32         `yaml:"version"`
+	Changes []deltaChange `yaml:"changes"`
+}
+
+// deltaChange sets a field of a record to To. From is the value the mod was
+// made against, which tells an untouched field from one another mod changed.
+type deltaChange struct {
+	Record string `yaml:"record"`
+	Field  string `yaml:"field"`
+	From   string `yaml:"from"`
+	To     string `yaml:"to"`
+}
+
+func (c deltaChange) String() string {
+	return fmt.Sprintf("%s.%s", c.Record, c.Field)
+}
+
+// createDelta returns the changes that turn from into to, by troop whatever
+// the position of its records. Troops only to has can't be expressed as field
+// changes and are left out with a warning.
+func createDelta(from, to troopInfoSOX) deltaDocument {
+	doc := deltaDocument{File: troopInfoFile.Name, Version: to.Version}
+	roster := newTroopRoster(to)
+
+	for i, ref := range counterparts(&from, to) {
+		if ref == nil {
+			log.Warn().Msg(tr("Leaving out %s, which the original file doesn't have; add it with troop add", troopNameIn(roster, i)))
+			continue
+		}
+
+		for _, f := range troopFields {
+			a, b := f.Format(ref), f.Format(&to.TroopInfos[i])
+			if a == b {
+				continue
+			}
+
+			doc.Changes = append(doc.Changes, deltaChange{Record: roster.key(i), Field: f.Name, From: a, To: b})
+		}
+	}
+
+	return doc
+}
+
+// applyDelta returns a copy of tis with the changes of doc applied. Changes to
+// fields that hold neither the From nor the To value conflict with another
+// mod and are only applied with force; a description of each conflict is
+// returned.
+func applyDelta(tis troopInfoSOX, doc deltaDocument, force bool) (troopInfoSOX, []string, error) {
+	after := tis.Clone()
+
+	var conflicts []string
+
+	for _, c := range doc.Changes {
+		i, err := troopRecord(tis, c.Record)
+		if err != nil {
+			return troopInfoSOX{}, nil, fmt.Errorf("%s: %w", c, err)
+		}
+
+		f, ok := lookupFieldName(c.Field)
+		if !ok {
+			return troopInfoSOX{}, nil, fmt.Errorf("%s: unknown field %q", c, c.Field)
+		}
+
+		if current := f.Format(&tis.TroopInfos[i]); current != c.From && current != c.To {
+			conflicts = append(conflicts, tr("%s is %s, the patch expects %s", c, current, c.From))
+
+			if !force {
+				continue
+			}
+		}
+
+		if err := f.Parse(&after.TroopInfos[i], c.To); err != nil {
+			return troopInfoSOX{}, nil, fmt.Errorf("%s: %w", c, err)
+		}
+	}
+
+	return after, conflicts, nil
+}
+
+// runPatchCreate writes the fields that differ between two sources, by
+// default vanilla and the installed data, as a delta document.
+func runPatchCreate(args []string) error {
+	fs := newFlagSet("patch create")
+	from := fs.String("from", sourceVanilla, "Source the mod was made from")
+	out := fs.String("o", "", "Path of the delta file to write, e.g. mymod.delta.yaml (default stdout)")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() > 1 {
+		return errors.New("expected at most one source, the modded data (default current)")
+	}
+
+	to := sourceCurrent
+	if fs.NArg() == 1 {
+		to = fs.Arg(0)
+	}
+
+	a, err := loadTroopSource(*from)
+	if err != nil {
+		return err
+	}
+
+	b, err := loadTroopSource(to)
+	if err != nil {
+		return err
+	}
+
+	doc := createDelta(a, b)
+
+	data, err := yaml.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	if *out == "" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+
+	if err := ioutil.WriteFile(*out, data, 0644); err != nil {
+		return err
+	}
+
+	log.Info().Msg(tr("Wrote %s with %d changed fields", *out, len(doc.Changes)))
+
+	return nil
+}
+
+// runPatchApply applies a delta document to the installed TroopInfo.sox.
+func runPatchApply(args []string) error {
+	fs := newFlagSet("patch apply")
+	dryRun := fs.Bool("dry-run", false, "Print the changes without writing them")
+	force := fs.Bool("force", false, "Also changes fields that another mod has already changed")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		return errors.New("expected a delta file, as written by patch create")
+	}
+
+	data, err := ioutil.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	var doc deltaDocument
+
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return newYAMLError(fs.Arg(0), data, err)
+	}
+
+	if !strings.EqualFold(doc.File, troopInfoFile.Name) {
+		return fmt.Errorf("%s patches %q; only %s is supported", fs.Arg(0), doc.File, troopInfoFile.Name)
+	}
+
+	before, err := readTroopInfoSOX(troopInfoPath)
+	if err != nil {
+		return err
+	}
+
+	if doc.Version != before.Version {
+		log.Warn().Msg(tr("The patch was made for version %d of %s, the installed file is version %d", doc.Version, doc.File, before.Version))
+	}
+
+	after, conflicts, err := applyDelta(before, doc, *force)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range conflicts {
+		log.Warn().Msg(tr("Changed by another mod: %s", c))
+	}
+
+	if len(conflicts) > 0 && !*force {
+		return fmt.Errorf("another mod changed %d of the fields; restore them or apply with -force to overwrite them", len(conflicts))
+	}
+
+	changes := diffRecords(troopRecords(before), troopRecords(after))
+	printChangeSummary(os.Stdout, changes, true)
+
+	if *dryRun || len(changes) == 0 {
+		return nil
+	}
+
+	buf := &bytes.Buffer{}
+
+	if err := encodeTroopInfoSOX(buf, after); err != nil {
+		return err
+	}
+
+	if err := installSOX(buf.Bytes()); err != nil {
+		return err
+	}
+
+	recordHistory("patch apply", troopInfoFile.Name, changes, buf.Bytes())
+
+	log.Info().Msg(tr("Wrote %s", troopInfoPath))
+
+	return nil
+}
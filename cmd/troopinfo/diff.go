@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Output formats of diff.
+const (
+	renderText = "text"
+	renderPNG  = "png"
+)
+
+// errDifferent is returned by diff when the sources differ, so that it exits
+// with status 1 like diff(1) and scripts can tell identical data apart. Other
+// errors exit with status 2; see exitStatus.
+var errDifferent = errors.New("the sources differ")
+
+func runDiff(args []string) error {
+	fs := newFlagSet("diff")
+	showAll := fs.Bool("show-ignored", false, "Also lists the differences suppressed by the ignore rules of the configuration")
+	render := fs.String("render", renderText, "Output format: text, or png for a table image to share where long text diffs are unreadable")
+	out := fs.String("o", "diff.png", "Path of the image to write with -render png")
+	tol := fs.Float64("tolerance", floatTolerance, "Relative difference below which float values are reported as equivalent, e.g. 1e-6; 0 compares exactly")
+	againstVanilla := fs.Bool("against-vanilla", false, "Compares vanilla with the given source, by default the installed data, to list everything a mod changes")
+	quiet := fs.Bool("quiet", false, "Prints nothing; only the exit status tells whether the sources differ (1), don't (0) or couldn't be compared (2)")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	specA, specB := fs.Arg(0), sourceCurrent
+
+	switch {
+	case *againstVanilla && fs.NArg() > 1:
+		return errors.New("-against-vanilla takes at most one source to compare with vanilla")
+	case *againstVanilla:
+		specA = sourceVanilla
+
+		if fs.NArg() == 1 {
+			specB = fs.Arg(0)
+		}
+	case fs.NArg() < 1 || fs.NArg() > 2:
+		return errors.New("expected one or two sources, e.g. diff @backup:2024-05-01 @current")
+	case fs.NArg() == 2:
+		specB = fs.Arg(1)
+	}
+
+	if *render != renderText && *render != renderPNG {
+		return fmt.Errorf("unknown output format %q (want %s or %s)", *render, renderText, renderPNG)
+	}
+
+	a, err := loadTroopSource(specA)
+	if err != nil {
+		return err
+	}
+
+	b, err := loadTroopSource(specB)
+	if err != nil {
+		return err
+	}
+
+	changes := append(diffRecords(troopRecords(a), troopRecords(b)), trailerChanges(a, b)...)
+
+	ignored := 0
+	if !*showAll {
+		changes, ignored = filterIgnored(troopInfoFile.Name, changes)
+	}
+
+	changes, same := filterEquivalent(changes, *tol)
+
+	if *quiet {
+		return diffResult(changes)
+	}
+
+	if *render == renderPNG {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		if err := renderDiffPNG(file, fmt.Sprintf("%s -> %s", specA, specB), changes); err != nil {
+			return err
+		}
+
+		if err := file.Close(); err != nil {
+			return err
+		}
+
+		log.Info().Msg(tr("Wrote %s", *out))
+		printIgnoredNote(ignored)
+		printEquivalentNote(same, *tol)
+
+		return diffResult(changes)
+	}
+
+	for _, c := range changes {
+		fmt.Println(formatChange(troopInfoFile.Name, c))
+	}
+
+	printIgnoredNote(ignored)
+	printEquivalentNote(same, *tol)
+
+	return diffResult(changes)
+}
+
+// diffResult returns errDifferent if there are changes left to report.
+func diffResult(changes []fieldChange) error {
+	if len(changes) > 0 {
+		return errDifferent
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiffExitStatus(t *testing.T) {
+	game := newTestGame(t)
+
+	tis := readInstalled(t)
+	tis.TroopInfos[5].Defense++
+
+	buf := &bytes.Buffer{}
+
+	if err := encodeTroopInfoSOX(buf, tis); err != nil {
+		t.Fatal(err)
+	}
+
+	changed := filepath.Join(game, "changed.sox")
+
+	if err := ioutil.WriteFile(changed, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		args   []string
+		status int
+	}{
+		{[]string{"-quiet", "@current", "@current"}, 0},
+		{[]string{"-quiet", changed, "@current"}, 1},
+		{[]string{"-quiet", filepath.Join(game, "nosuch.sox"), "@current"}, 2},
+	} {
+		status := 0
+		if err := runDiff(tt.args); err != nil {
+			status = exitStatus(err)
+		}
+
+		if status != tt.status {
+			t.Errorf("diff %v exits with status %d, want %d", tt.args, status, tt.status)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Ways of disabling a troop record.
+const (
+	disableStub = "stub"
+	disableZero = "zero"
+)
+
+// stubTroop returns a copy of ti that can't fight or be seen. Identity,
+// movement, size and formation values are kept because the engine uses them
+// for pathing, formation layout and divisions, where zero is unsafe.
+func stubTroop(ti troopInfo) troopInfo {
+	stub := ti
+
+	stub.SightRange = 0
+	stub.AttackRangeMax = 0
+	stub.AttackRangeMin = 0
+	stub.AttackFrontRange = 0
+	stub.DirectAttack = 0
+	stub.IndirectAttack = 0
+	stub.Defense = 0
+	stub.UnitHPLevUp = 0
+	stub.DamageDistribution = 0
+
+	for i := range stub.LevelUpData {
+		stub.LevelUpData[i].SkillPerLevel = 0
+	}
+
+	// Keep at least one unit with some HP so the troop can still spawn.
+	if stub.DefaultUnitNumX < 1 {
+		stub.DefaultUnitNumX = 1
+	}
+
+	if stub.DefaultUnitNumY < 1 {
+		stub.DefaultUnitNumY = 1
+	}
+
+	if stub.DefaultUnitHP < 1 {
+		stub.DefaultUnitHP = 1
+	}
+
+	return stub
+}
+
+// zeroTroop returns a record with everything but its Job and TypeID zeroed.
+func zeroTroop(ti troopInfo) troopInfo {
+	return troopInfo{Job: ti.Job, TypeID: ti.TypeID}
+}
+
+func runDisable(args []string) error {
+	fs := newFlagSet("disable")
+	mode := fs.String("mode", disableStub, "How to disable the troop: stub (keep values the engine relies on) or zero (everything but job and type_id)")
+	out := fs.String("o", troopInfoPath, "Path of the SOX file to write")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		return errors.New("expected one or more troop names")
+	}
+
+	data, err := ioutil.ReadFile(troopInfoPath)
+	if err != nil {
+		return err
+	}
+
+	tis, err := decodeTroopInfoSOX(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	for _, name := range fs.Args() {
+		i, err := troopRecord(tis, name)
+		if err != nil {
+			return err
+		}
+
+		ti := tis.TroopInfos[i]
+
+		switch *mode {
+		case disableStub:
+			ti = stubTroop(ti)
+		case disableZero:
+			log.Warn().Msg(tr("Zeroed records may crash the game when %s is deployed", troopName(i)))
+			ti = zeroTroop(ti)
+		default:
+			return fmt.Errorf("unknown mode %q", *mode)
+		}
+
+		if err := putTroopRecord(data, i, ti); err != nil {
+			return err
+		}
+
+		log.Info().Msg(tr("Disabled %s", troopName(i)))
+	}
+
+	return writeSOX(*out, data)
+}
+
+// putTroopRecord overwrites the i-th troop record of the SOX file data in
+// place, leaving the header and trailer untouched.
+func putTroopRecord(data []byte, i int, ti troopInfo) error {
+	stride := binary.Size(troopInfo{})
+	offset := 8 + i*stride
+
+	if offset+stride > len(data) {
+		return errInvalidSOX
+	}
+
+	buf := &bytes.Buffer{}
+
+	if err := binary.Write(buf, binary.LittleEndian, &ti); err != nil {
+		return err
+	}
+
+	copy(data[offset:], buf.Bytes())
+
+	return nil
+}
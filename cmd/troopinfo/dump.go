@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+)
+
+// troopInfoBackupPath is the backup created by hand before modding and used
+// by restore. It doubles as the vanilla reference for comparisons, see
+// vanillaPath.
+var troopInfoBackupPath = troopInfoPath + ".bak"
+
+// vanillaPath returns the file holding the vanilla troop data: the backup
+// taken before modding or, once that is gone, the vanilla snapshot setup
+// keeps in the backup chain.
+func vanillaPath() string {
+	if _, err := os.Stat(troopInfoBackupPath); err == nil {
+		return troopInfoBackupPath
+	}
+
+	if b, err := findBackup("vanilla"); err == nil {
+		return b.Path
+	}
+
+	return troopInfoBackupPath
+}
+
+// errNoVanilla is returned when neither a backup nor a vanilla snapshot
+// exists. The retail values aren't built into the tool, so vanilla is only
+// known from the install itself.
+var errNoVanilla = errors.New("no vanilla data")
+
+// loadVanilla returns the vanilla troop data.
+func loadVanilla() (troopInfoSOX, error) {
+	path := vanillaPath()
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return troopInfoSOX{}, fmt.Errorf("%w: %s doesn't exist and setup took no vanilla snapshot; run setup on an unmodded install, or copy the retail %s there",
+			errNoVanilla, troopInfoBackupPath, troopInfoFile.Name)
+	}
+
+	return readTroopInfoSOX(path)
+}
+
+// readVanilla returns the vanilla troop data, or nil if no backup exists.
+func readVanilla() *troopInfoSOX {
+	tis, err := loadVanilla()
+	if err != nil {
+		return nil
+	}
+
+	return &tis
+}
+
+// writeTroopTable renders tis with fields as rows and troops as columns.
+// Values that differ from vanilla are color-coded and show their delta.
+func writeTroopTable(w io.Writer, tis troopInfoSOX, vanilla *troopInfoSOX, style termStyle) {
+	header := []string{"field"}
+	for i := range tis.TroopInfos {
+		header = append(header, troopName(i))
+	}
+
+	t := newTable(header...)
+	refs := counterparts(vanilla, tis)
+
+	for _, f := range troopFields {
+		row := []cell{{text: f.Name}}
+
+		for i := range tis.TroopInfos {
+			c := cell{text: f.Format(&tis.TroopInfos[i])}
+
+			if refs[i] != nil {
+				c = deltaCell(f.value(&tis.TroopInfos[i]), f.value(refs[i]), c.text)
+			}
+
+			row = append(row, c)
+		}
+
+		t.addRow(row...)
+	}
+
+	t.render(w, style)
+}
+
+// deltaCell returns a cell for value that shows its difference to vanilla,
+// green when it increased and red when it decreased.
+func deltaCell(value, vanilla reflect.Value, text string) cell {
+	var delta float64
+
+	switch value.Kind() {
+	case reflect.Float32:
+		delta = float64(float32(value.Float()) - float32(vanilla.Float()))
+	default:
+		delta = float64(value.Int() - vanilla.Int())
+	}
+
+	switch {
+	case delta > 0:
+		return cell{text: text + " (+" + formatDelta(delta) + ")", color: colorGreen}
+	case delta < 0:
+		return cell{text: text + " (" + formatDelta(delta) + ")", color: colorRed}
+	default:
+		return cell{text: text}
+	}
+}
+
+func formatDelta(delta float64) string {
+	return strconv.FormatFloat(delta, 'g', -1, 32)
+}
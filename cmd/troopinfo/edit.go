@@ -0,0 +1,510 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gdamore/tcell"
+	"github.com/mattn/go-runewidth"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Panes of the editor that take the arrow keys.
+const (
+	paneTroops = iota
+	paneFields
+)
+
+// editorHelp is the key help on the status line of the editor.
+const editorHelp = "↑↓ move  Tab switch pane  Enter edit  v vanilla value  d diff  s save  q quit"
+
+// editor is the state of the terminal UI of edit: a list of troops, a table
+// of the fields of the selected one next to their vanilla values, and a diff
+// of the unsaved changes on demand.
+type editor struct {
+	screen  tcell.Screen
+	path    string
+	exists  bool         // whether path existed when it was last read or saved
+	saved   troopInfoSOX // contents of path as of the last save
+	tis     troopInfoSOX // contents being edited
+	vanilla *troopInfoSOX
+	ctx     validationContext
+
+	focus              int
+	troop, field       int // selected rows
+	troopTop, fieldTop int // first visible rows
+
+	editing bool
+	input   []rune // value being typed while editing
+
+	diff    []string // lines of the diff view, nil while it isn't shown
+	diffTop int
+
+	status   string // message replacing the key help until the next key
+	quitting bool   // q was pressed once with unsaved changes
+	done     bool
+}
+
+// runEdit opens the terminal editor on the workspace TroopInfo.yaml, for
+// modders who would rather not edit YAML.
+func runEdit(args []string) error {
+	fs := newFlagSet("edit")
+	path := fs.String("o", troopInfoYAMLPath, "YAML file to edit; it is written from the installed TroopInfo.sox on the first save if it doesn't exist")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() > 0 {
+		return errors.New("edit takes no arguments")
+	}
+
+	e, err := newEditor(*path)
+	if err != nil {
+		return err
+	}
+
+	screen, err := tcell.NewScreen()
+	if err != nil {
+		return err
+	}
+
+	if err := screen.Init(); err != nil {
+		return err
+	}
+
+	// The log would draw over the editor, so it is held back until the
+	// screen is restored.
+	held := &bytes.Buffer{}
+	logger := log.Logger
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: held, NoColor: true})
+
+	defer func() {
+		screen.Fini()
+		log.Logger = logger
+		os.Stderr.Write(held.Bytes())
+	}()
+
+	e.screen = screen
+	e.run()
+
+	return nil
+}
+
+// newEditor reads the data to edit: the YAML file at path if it exists,
+// otherwise the installed TroopInfo.sox.
+func newEditor(path string) (*editor, error) {
+	base, err := readTroopInfoSOX(troopInfoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &editor{path: path, saved: base, vanilla: readVanilla(), ctx: newValidationContext()}
+
+	if _, err := os.Stat(path); err == nil {
+		if e.saved, err = readTroopInfoYAML(path, base); err != nil {
+			return nil, err
+		}
+
+		e.exists = true
+	}
+
+	if len(e.saved.TroopInfos) == 0 {
+		return nil, fmt.Errorf("%s has no troops to edit", path)
+	}
+
+	e.tis = e.saved.Clone()
+
+	return e, nil
+}
+
+func (e *editor) run() {
+	for !e.done {
+		e.draw()
+
+		switch ev := e.screen.PollEvent().(type) {
+		case *tcell.EventResize:
+			e.screen.Sync()
+		case *tcell.EventKey:
+			e.handleKey(ev)
+		}
+	}
+}
+
+// changes returns the unsaved changes.
+func (e *editor) changes() []fieldChange {
+	return diffRecords(troopRecords(e.saved), troopRecords(e.tis))
+}
+
+func (e *editor) handleKey(ev *tcell.EventKey) {
+	e.status = ""
+
+	switch {
+	case e.diff != nil:
+		e.handleDiffKey(ev)
+		return
+	case e.editing:
+		e.handleInputKey(ev)
+		return
+	}
+
+	quitting := e.quitting
+	e.quitting = false
+
+	switch ev.Key() {
+	case tcell.KeyUp:
+		e.move(-1)
+	case tcell.KeyDown:
+		e.move(1)
+	case tcell.KeyPgUp:
+		e.move(-e.pageSize())
+	case tcell.KeyPgDn:
+		e.move(e.pageSize())
+	case tcell.KeyHome:
+		e.move(-maxTroopRecords - len(troopFields))
+	case tcell.KeyEnd:
+		e.move(maxTroopRecords + len(troopFields))
+	case tcell.KeyTab, tcell.KeyBacktab, tcell.KeyLeft, tcell.KeyRight:
+		e.focus = 1 - e.focus
+	case tcell.KeyEnter:
+		if e.focus == paneTroops {
+			e.focus = paneFields
+			return
+		}
+
+		e.editing = true
+		e.input = []rune(e.display(&e.tis, e.field))
+	case tcell.KeyEscape, tcell.KeyCtrlC:
+		e.quit(quitting)
+	case tcell.KeyRune:
+		switch ev.Rune() {
+		case 'q':
+			e.quit(quitting)
+		case 's':
+			e.save()
+		case 'd':
+			e.showDiff()
+		case 'v':
+			e.revertField()
+		case 'k':
+			e.move(-1)
+		case 'j':
+			e.move(1)
+		}
+	}
+}
+
+func (e *editor) handleDiffKey(ev *tcell.EventKey) {
+	switch ev.Key() {
+	case tcell.KeyUp:
+		e.diffTop--
+	case tcell.KeyDown:
+		e.diffTop++
+	case tcell.KeyPgUp:
+		e.diffTop -= e.pageSize()
+	case tcell.KeyPgDn:
+		e.diffTop += e.pageSize()
+	default:
+		e.diff = nil
+		return
+	}
+
+	e.diffTop = maxInt(0, minInt(e.diffTop, len(e.diff)-1))
+}
+
+func (e *editor) handleInputKey(ev *tcell.EventKey) {
+	switch ev.Key() {
+	case tcell.KeyEnter:
+		e.editing = false
+		e.setField(strings.TrimSpace(string(e.input)))
+	case tcell.KeyEscape:
+		e.editing = false
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		if len(e.input) > 0 {
+			e.input = e.input[:len(e.input)-1]
+		}
+	case tcell.KeyCtrlU:
+		e.input = nil
+	case tcell.KeyRune:
+		e.input = append(e.input, ev.Rune())
+	}
+}
+
+func (e *editor) move(n int) {
+	if e.focus == paneTroops {
+		e.troop = maxInt(0, minInt(e.troop+n, len(e.tis.TroopInfos)-1))
+	} else {
+		e.field = maxInt(0, minInt(e.field+n, len(troopFields)-1))
+	}
+}
+
+func (e *editor) pageSize() int {
+	_, h := e.screen.Size()
+
+	if h > 6 {
+		return h - 4
+	}
+
+	return 1
+}
+
+func (e *editor) quit(confirmed bool) {
+	if n := len(e.changes()); n > 0 && !confirmed {
+		e.status = tr("Unsaved changes to %d fields; press q again to quit without saving, or s to save", n)
+		e.quitting = true
+
+		return
+	}
+
+	e.done = true
+}
+
+// setField parses value, which may be an ID name, into the selected field.
+func (e *editor) setField(value string) {
+	f := troopFields[e.field]
+
+	if id, ok := symbolValue(f.Name, value); ok {
+		value = strconv.Itoa(int(id))
+	}
+
+	if err := f.Parse(&e.tis.TroopInfos[e.troop], value); err != nil {
+		e.status = err.Error()
+	}
+}
+
+// revertField sets the selected field to its vanilla value.
+func (e *editor) revertField() {
+	vanilla := e.vanillaRecord()
+	if vanilla == nil {
+		e.status = tr("%s isn't a retail troop and has no vanilla values", troopName(e.troop))
+		return
+	}
+
+	f := troopFields[e.field]
+	e.setField(f.Format(vanilla))
+}
+
+func (e *editor) showDiff() {
+	changes := e.changes()
+	if len(changes) == 0 {
+		e.status = tr("No unsaved changes")
+		return
+	}
+
+	buf := &bytes.Buffer{}
+	printChangeSummary(buf, changes, true)
+
+	e.diff = strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	e.diffTop = 0
+}
+
+// save writes the changes to the YAML file, keeping its comments and
+// layout, and reports the validation errors the data would fail to apply
+// with.
+func (e *editor) save() {
+	changes := e.changes()
+	if len(changes) == 0 && e.exists {
+		e.status = tr("No unsaved changes")
+		return
+	}
+
+	var err error
+	if e.exists {
+		err = patchTroopInfoYAML(e.path, e.saved, e.tis)
+	} else {
+		err = writeTroopInfoYAML(e.path, e.tis)
+	}
+
+	if err != nil {
+		e.status = err.Error()
+		return
+	}
+
+	recordHistory("edit", e.path, changes, nil)
+
+	e.saved = e.tis.Clone()
+	e.exists = true
+	e.status = tr("Wrote %s", e.path)
+
+	var errs int
+
+	for _, f := range validateTroops(e.tis, e.ctx) {
+		if f.Severity == severityError {
+			errs++
+		}
+	}
+
+	if errs > 0 {
+		e.status = tr("Wrote %s; %d validation errors will stop apply, see troopinfo validate", e.path, errs)
+	}
+}
+
+// display returns the value of field i in tis as the editor shows it, with
+// IDs as their names.
+// vanillaRecord returns the vanilla record of the selected troop, or nil if
+// it has none.
+func (e *editor) vanillaRecord() *troopInfo {
+	return counterparts(e.vanilla, e.tis)[e.troop]
+}
+
+func (e *editor) display(tis *troopInfoSOX, i int) string {
+	f := troopFields[i]
+	return symbolName(f.Name, f.Format(&tis.TroopInfos[e.troop]))
+}
+
+func (e *editor) draw() {
+	s := e.screen
+	s.Clear()
+
+	w, h := s.Size()
+	if w < 40 || h < 6 {
+		drawText(s, 0, 0, w, tcell.StyleDefault, tr("The terminal is too small"))
+		s.Show()
+
+		return
+	}
+
+	title := "troopinfo edit  " + e.path
+	if len(e.changes()) > 0 {
+		title += "  [+]"
+	}
+
+	drawText(s, 0, 0, w, tcell.StyleDefault.Bold(true), title)
+
+	if e.diff != nil {
+		e.drawDiff(w, h)
+	} else {
+		e.drawTroops(h)
+		e.drawFields(w, h)
+	}
+
+	status := e.status
+	if status == "" {
+		status = tr(editorHelp)
+	}
+
+	drawText(s, 0, h-1, w, tcell.StyleDefault.Reverse(true), padRight(status, w))
+	s.Show()
+}
+
+// editorListWidth is the width of the troop list.
+const editorListWidth = 28
+
+func (e *editor) drawTroops(h int) {
+	rows := h - 2
+	e.troopTop = scrollTo(e.troopTop, e.troop, rows)
+
+	for row := 0; row < rows && e.troopTop+row < len(e.tis.TroopInfos); row++ {
+		i := e.troopTop + row
+
+		style := tcell.StyleDefault
+		if i == e.troop {
+			style = style.Reverse(e.focus == paneTroops).Bold(true)
+		}
+
+		drawText(e.screen, 0, row+1, editorListWidth-1, style, padRight(troopName(i), editorListWidth-1))
+	}
+
+	for y := 1; y < h-1; y++ {
+		e.screen.SetContent(editorListWidth-1, y, '│', nil, tcell.StyleDefault)
+	}
+}
+
+func (e *editor) drawFields(w, h int) {
+	const nameWidth, valueWidth = 34, 20
+
+	x := editorListWidth + 1
+	rows := h - 3
+	e.fieldTop = scrollTo(e.fieldTop, e.field, rows)
+
+	header := padRight(tr("Field"), nameWidth) + padRight(tr("Value"), valueWidth) + tr("Vanilla")
+	drawText(e.screen, x, 1, w-x, tcell.StyleDefault.Underline(true), header)
+
+	ref := e.vanillaRecord()
+
+	for row := 0; row < rows && e.fieldTop+row < len(troopFields); row++ {
+		i := e.fieldTop + row
+		y := row + 2
+
+		value := e.display(&e.tis, i)
+		vanilla := ""
+
+		if ref != nil {
+			vanilla = symbolName(troopFields[i].Name, troopFields[i].Format(ref))
+		}
+
+		// Unsaved values are green and saved changes from vanilla yellow.
+		valueStyle := tcell.StyleDefault
+		switch {
+		case value != e.display(&e.saved, i):
+			valueStyle = valueStyle.Foreground(tcell.ColorGreen).Bold(true)
+		case vanilla != "" && value != vanilla:
+			valueStyle = valueStyle.Foreground(tcell.ColorYellow)
+		}
+
+		nameStyle := tcell.StyleDefault
+		if i == e.field {
+			nameStyle = nameStyle.Reverse(e.focus == paneFields)
+			valueStyle = valueStyle.Reverse(e.focus == paneFields)
+		}
+
+		if i == e.field && e.editing {
+			value = string(e.input) + "_"
+			valueStyle = tcell.StyleDefault.Underline(true)
+		}
+
+		drawText(e.screen, x, y, nameWidth, nameStyle, padRight(troopFields[i].Name, nameWidth))
+		drawText(e.screen, x+nameWidth, y, valueWidth, valueStyle, padRight(value, valueWidth-1))
+		drawText(e.screen, x+nameWidth+valueWidth, y, w-x-nameWidth-valueWidth, tcell.StyleDefault.Dim(true), vanilla)
+	}
+}
+
+func (e *editor) drawDiff(w, h int) {
+	drawText(e.screen, 0, 1, w, tcell.StyleDefault.Underline(true), tr("Unsaved changes (any key returns)"))
+
+	for row := 0; row < h-3 && e.diffTop+row < len(e.diff); row++ {
+		drawText(e.screen, 0, row+2, w, tcell.StyleDefault, e.diff[e.diffTop+row])
+	}
+}
+
+// drawText draws s at x, y, cut to width columns.
+func drawText(s tcell.Screen, x, y, width int, style tcell.Style, text string) {
+	end := x + width
+
+	for _, r := range text {
+		rw := runewidth.RuneWidth(r)
+		if x+rw > end {
+			return
+		}
+
+		s.SetContent(x, y, r, nil, style)
+		x += rw
+	}
+}
+
+// padRight pads s with spaces to width columns.
+func padRight(s string, width int) string {
+	if n := runewidth.StringWidth(s); n < width {
+		return s + strings.Repeat(" ", width-n)
+	}
+
+	return s
+}
+
+// scrollTo returns the first visible row of a list showing rows rows, moved
+// as little as possible from top to show the selected row.
+func scrollTo(top, selected, rows int) int {
+	switch {
+	case selected < top:
+		return selected
+	case selected >= top+rows:
+		return selected - rows + 1
+	}
+
+	return top
+}
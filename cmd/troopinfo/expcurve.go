@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// expLevel is one row of an experience table.
+type expLevel struct {
+	Level int   `yaml:"level"`
+	Exp   int64 `yaml:"exp"`   // experience needed to reach the next level
+	Total int64 `yaml:"total"` // cumulative experience needed to reach this level
+}
+
+// expModels weight the experience needed at each level.
+var expModels = map[string]func(level int, growth float64) float64{
+	"linear": func(level int, growth float64) float64 {
+		return float64(level)
+	},
+	"quadratic": func(level int, growth float64) float64 {
+		return math.Pow(float64(level), 2)
+	},
+	"cubic": func(level int, growth float64) float64 {
+		return math.Pow(float64(level), 3)
+	},
+	"exponential": func(level int, growth float64) float64 {
+		return math.Pow(growth, float64(level))
+	},
+}
+
+// expCurve distributes total experience over the levels below levelCap
+// according to model. Every level needs at least 1 experience; the rest is
+// split by weight, rounded down, and the rounding remainder goes to the last
+// level so the sum is exactly total and no level needs less than 1.
+func expCurve(model string, levelCap int, total int64, growth float64) ([]expLevel, error) {
+	weight, ok := expModels[model]
+	if !ok {
+		return nil, fmt.Errorf("unknown model %q", model)
+	}
+
+	if levelCap < 2 {
+		return nil, fmt.Errorf("level cap must be at least 2")
+	}
+
+	if total < int64(levelCap-1) {
+		return nil, fmt.Errorf("total must be at least %d, 1 for every level below the cap", levelCap-1)
+	}
+
+	var sum float64
+	for l := 1; l < levelCap; l++ {
+		sum += weight(l, growth)
+	}
+
+	rest := total - int64(levelCap-1)
+	levels := make([]expLevel, 0, levelCap)
+
+	var cumulative int64
+
+	for l := 1; l < levelCap; l++ {
+		exp := 1 + int64(math.Floor(float64(rest)*weight(l, growth)/sum))
+
+		levels = append(levels, expLevel{Level: l, Exp: exp})
+		cumulative += exp
+	}
+
+	// Floating point error may round a share up; taking the difference
+	// off the largest levels keeps every level at 1 or more.
+	for i := len(levels) - 1; cumulative > total && i >= 0; i-- {
+		d := minInt64(cumulative-total, levels[i].Exp-1)
+		levels[i].Exp -= d
+		cumulative -= d
+	}
+
+	levels[len(levels)-1].Exp += total - cumulative
+
+	cumulative = 0
+	for i := range levels {
+		levels[i].Total = cumulative
+		cumulative += levels[i].Exp
+	}
+
+	return append(levels, expLevel{Level: levelCap, Total: total}), nil
+}
+
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+// plotExpCurve draws the cumulative experience per level as an ASCII chart.
+func plotExpCurve(w io.Writer, levels []expLevel, width, height int) {
+	max := float64(levels[len(levels)-1].Total)
+	if width > len(levels) {
+		width = len(levels)
+	}
+
+	rows := make([][]byte, height)
+	for i := range rows {
+		rows[i] = []byte(strings.Repeat(" ", width))
+	}
+
+	for x := 0; x < width; x++ {
+		l := levels[x*(len(levels)-1)/maxInt(width-1, 1)]
+		y := int(math.Round(float64(l.Total) / max * float64(height-1)))
+		y = maxInt(0, minInt(y, height-1))
+		rows[height-1-y][x] = '*'
+	}
+
+	for i, row := range rows {
+		label := ""
+		if i == 0 {
+			label = fmt.Sprint(int64(max))
+		} else if i == height-1 {
+			label = "0"
+		}
+
+		fmt.Fprintf(w, "%10s |%s\n", label, bytes.TrimRight(row, " "))
+	}
+
+	fmt.Fprintf(w, "%10s +%s\n", "", strings.Repeat("-", width))
+	fmt.Fprintf(w, "%10s  1%*d\n", "", width-1, levels[len(levels)-1].Level)
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
+
+func runExpCurve(args []string) error {
+	fs := newFlagSet("expcurve")
+	model := fs.String("model", "quadratic", "Curve model: linear, quadratic, cubic or exponential")
+	levelCap := fs.Int("level-cap", 99, "Highest reachable level")
+	total := fs.Int64("total", 1000000, "Experience needed to reach the level cap (1_000_000 style separators are allowed)")
+	growth := fs.Float64("growth", 1.1, "Per-level growth factor of the exponential model")
+	out := fs.String("o", "", "Write the table to this YAML file")
+	noPlot := fs.Bool("no-plot", false, "Don't plot the curve")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	levels, err := expCurve(*model, *levelCap, *total, *growth)
+	if err != nil {
+		return err
+	}
+
+	if !*noPlot {
+		plotExpCurve(os.Stdout, levels, detectTermStyle(true).width-12, 20)
+		fmt.Println()
+	}
+
+	for _, l := range levels {
+		if l.Level <= 5 || l.Level > len(levels)-5 {
+			fmt.Printf("level %3d: %12d total, %10d to next\n", l.Level, l.Total, l.Exp)
+		} else if l.Level == 6 {
+			fmt.Println("...")
+		}
+	}
+
+	if *out == "" {
+		return nil
+	}
+
+	data, err := yaml.Marshal(levels)
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(*out, data, 0600); err != nil {
+		return err
+	}
+
+	log.Info().Msg(tr("Wrote %s", *out))
+
+	return nil
+}
@@ -0,0 +1,630 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expressions select and change troops in bulk, e.g.
+//
+//	job == JOB_INFANTRY && default_unit_hp < 100
+//	move_speed = move_speed * 1.2; defense += 5
+//
+// Identifiers are the fields of a troop (or their aliases), name, key and
+// index of the troop, and the ID names of symbol tables such as JOB_KNIGHT.
+// Values are numbers, or strings for names and keys; conditions are true if
+// they aren't 0.
+
+// exprValue is the value of an expression.
+type exprValue struct {
+	Num   float64
+	Str   string
+	IsStr bool
+}
+
+func exprBool(b bool) exprValue {
+	if b {
+		return exprValue{Num: 1}
+	}
+
+	return exprValue{}
+}
+
+func (v exprValue) String() string {
+	if v.IsStr {
+		return strconv.Quote(v.Str)
+	}
+
+	return strconv.FormatFloat(v.Num, 'g', -1, 64)
+}
+
+// exprNode is a parsed expression, evaluated against the troop at index i.
+type exprNode interface {
+	eval(ti *troopInfo, i int) (exprValue, error)
+}
+
+type (
+	constNode exprValue
+	fieldNode troopField
+	attrNode  string // name, key or index
+
+	unaryNode struct {
+		Op string
+		X  exprNode
+	}
+
+	binaryNode struct {
+		Op   string
+		X, Y exprNode
+	}
+
+	callNode struct {
+		Name string
+		Args []exprNode
+	}
+)
+
+func (n constNode) eval(*troopInfo, int) (exprValue, error) {
+	return exprValue(n), nil
+}
+
+func (n fieldNode) eval(ti *troopInfo, _ int) (exprValue, error) {
+	v := troopField(n).value(ti)
+	if v.Kind() == reflect.Float32 {
+		return exprValue{Num: v.Float()}, nil
+	}
+
+	return exprValue{Num: float64(v.Int())}, nil
+}
+
+func (n attrNode) eval(_ *troopInfo, i int) (exprValue, error) {
+	switch n {
+	case "name":
+		return exprValue{Str: troopName(i), IsStr: true}, nil
+	case "key":
+		return exprValue{Str: troopKey(i), IsStr: true}, nil
+	default:
+		return exprValue{Num: float64(i)}, nil
+	}
+}
+
+func (n unaryNode) eval(ti *troopInfo, i int) (exprValue, error) {
+	x, err := n.X.eval(ti, i)
+	if err != nil {
+		return exprValue{}, err
+	}
+
+	if x.IsStr {
+		return exprValue{}, fmt.Errorf("%s can't be applied to the string %s", n.Op, x)
+	}
+
+	if n.Op == "!" {
+		return exprBool(x.Num == 0), nil
+	}
+
+	return exprValue{Num: -x.Num}, nil
+}
+
+func (n binaryNode) eval(ti *troopInfo, i int) (exprValue, error) {
+	x, err := n.X.eval(ti, i)
+	if err != nil {
+		return exprValue{}, err
+	}
+
+	// && and || don't evaluate the right-hand side if the left decides.
+	switch {
+	case n.Op == "&&" && !x.IsStr && x.Num == 0:
+		return exprBool(false), nil
+	case n.Op == "||" && !x.IsStr && x.Num != 0:
+		return exprBool(true), nil
+	}
+
+	y, err := n.Y.eval(ti, i)
+	if err != nil {
+		return exprValue{}, err
+	}
+
+	if x.IsStr || y.IsStr {
+		return compareStrings(n.Op, x, y)
+	}
+
+	switch n.Op {
+	case "+":
+		return exprValue{Num: x.Num + y.Num}, nil
+	case "-":
+		return exprValue{Num: x.Num - y.Num}, nil
+	case "*":
+		return exprValue{Num: x.Num * y.Num}, nil
+	case "/":
+		if y.Num == 0 {
+			return exprValue{}, fmt.Errorf("division of %s by zero", x)
+		}
+
+		return exprValue{Num: x.Num / y.Num}, nil
+	case "%":
+		if y.Num == 0 {
+			return exprValue{}, fmt.Errorf("division of %s by zero", x)
+		}
+
+		return exprValue{Num: math.Mod(x.Num, y.Num)}, nil
+	case "==":
+		return exprBool(x.Num == y.Num), nil
+	case "!=":
+		return exprBool(x.Num != y.Num), nil
+	case "<":
+		return exprBool(x.Num < y.Num), nil
+	case "<=":
+		return exprBool(x.Num <= y.Num), nil
+	case ">":
+		return exprBool(x.Num > y.Num), nil
+	case ">=":
+		return exprBool(x.Num >= y.Num), nil
+	case "&&", "||":
+		return exprBool(y.Num != 0), nil
+	}
+
+	return exprValue{}, fmt.Errorf("unknown operator %s", n.Op)
+}
+
+// compareStrings compares names and keys with == and !=, where the right
+// string is a pattern in which * matches any run of characters, e.g.
+// name == "Orc *".
+func compareStrings(op string, x, y exprValue) (exprValue, error) {
+	if !x.IsStr || !y.IsStr || (op != "==" && op != "!=") {
+		return exprValue{}, fmt.Errorf("%s %s %s: strings can only be compared with == and != to other strings", x, op, y)
+	}
+
+	match := matchPattern(y.Str, x.Str)
+	if op == "!=" {
+		match = !match
+	}
+
+	return exprBool(match), nil
+}
+
+// exprFuncs are the functions expressions can call, by name and number of
+// arguments.
+var exprFuncs = map[string]struct {
+	Args int
+	fn   func(args []float64) float64
+}{
+	"abs":   {1, func(a []float64) float64 { return math.Abs(a[0]) }},
+	"round": {1, func(a []float64) float64 { return math.Round(a[0]) }},
+	"floor": {1, func(a []float64) float64 { return math.Floor(a[0]) }},
+	"ceil":  {1, func(a []float64) float64 { return math.Ceil(a[0]) }},
+	"min":   {2, func(a []float64) float64 { return math.Min(a[0], a[1]) }},
+	"max":   {2, func(a []float64) float64 { return math.Max(a[0], a[1]) }},
+	"clamp": {3, func(a []float64) float64 { return math.Max(a[1], math.Min(a[2], a[0])) }},
+}
+
+func (n callNode) eval(ti *troopInfo, i int) (exprValue, error) {
+	args := make([]float64, len(n.Args))
+
+	for j, a := range n.Args {
+		v, err := a.eval(ti, i)
+		if err != nil {
+			return exprValue{}, err
+		}
+
+		if v.IsStr {
+			return exprValue{}, fmt.Errorf("%s expects numbers, not the string %s", n.Name, v)
+		}
+
+		args[j] = v.Num
+	}
+
+	return exprValue{Num: exprFuncs[n.Name].fn(args)}, nil
+}
+
+// exprToken is a lexical token of an expression.
+type exprToken struct {
+	Kind string // "num", "str", "ident", "end" or the operator itself
+	Text string
+	Pos  int
+}
+
+// exprOperators are the operators, longest first so "<=" isn't read as "<".
+var exprOperators = []string{
+	"==", "!=", "<=", ">=", "&&", "||", "+=", "-=", "*=", "/=",
+	"+", "-", "*", "/", "%", "<", ">", "!", "(", ")", ",", "=", ";",
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || r == '.' || r == '[' || r == ']' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func tokenizeExpr(src string) ([]exprToken, error) {
+	var tokens []exprToken
+
+	for pos := 0; pos < len(src); {
+		rest := src[pos:]
+		r := rune(rest[0])
+
+		switch {
+		case unicode.IsSpace(r):
+			pos++
+			continue
+		case unicode.IsDigit(r) || r == '.' && len(rest) > 1 && unicode.IsDigit(rune(rest[1])):
+			end := strings.IndexFunc(rest, func(r rune) bool { return !unicode.IsDigit(r) && r != '.' })
+			if end < 0 {
+				end = len(rest)
+			}
+
+			tokens = append(tokens, exprToken{Kind: "num", Text: rest[:end], Pos: pos})
+			pos += end
+
+			continue
+		case r == '"' || r == '\'':
+			end := strings.IndexRune(rest[1:], r)
+			if end < 0 {
+				return nil, exprSyntaxError(src, pos, "unterminated string")
+			}
+
+			tokens = append(tokens, exprToken{Kind: "str", Text: rest[1 : end+1], Pos: pos})
+			pos += end + 2
+
+			continue
+		case r == '_' || unicode.IsLetter(r):
+			end := strings.IndexFunc(rest, func(r rune) bool { return !isIdentRune(r) })
+			if end < 0 {
+				end = len(rest)
+			}
+
+			tokens = append(tokens, exprToken{Kind: "ident", Text: rest[:end], Pos: pos})
+			pos += end
+
+			continue
+		}
+
+		op := ""
+		for _, o := range exprOperators {
+			if strings.HasPrefix(rest, o) {
+				op = o
+				break
+			}
+		}
+
+		if op == "" {
+			return nil, exprSyntaxError(src, pos, fmt.Sprintf("unexpected %q", r))
+		}
+
+		tokens = append(tokens, exprToken{Kind: op, Text: op, Pos: pos})
+		pos += len(op)
+	}
+
+	return append(tokens, exprToken{Kind: "end", Pos: len(src)}), nil
+}
+
+func exprSyntaxError(src string, pos int, msg string) error {
+	return fmt.Errorf("invalid expression %q: %s at column %d", src, msg, pos+1)
+}
+
+// exprParser is a precedence-climbing parser over the tokens of src.
+type exprParser struct {
+	src    string
+	tokens []exprToken
+	pos    int
+}
+
+// exprPrecedence binds tighter for higher numbers.
+var exprPrecedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"==": 3, "!=": 3, "<": 3, "<=": 3, ">": 3, ">=": 3,
+	"+": 4, "-": 4,
+	"*": 5, "/": 5, "%": 5,
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	t := p.tokens[p.pos]
+	if t.Kind != "end" {
+		p.pos++
+	}
+
+	return t
+}
+
+func (p *exprParser) errorf(t exprToken, format string, args ...interface{}) error {
+	return exprSyntaxError(p.src, t.Pos, fmt.Sprintf(format, args...))
+}
+
+func (p *exprParser) expect(kind string) error {
+	if t := p.next(); t.Kind != kind {
+		return p.errorf(t, "expected %s, found %s", kind, describeToken(t))
+	}
+
+	return nil
+}
+
+func describeToken(t exprToken) string {
+	if t.Kind == "end" {
+		return "the end"
+	}
+
+	return strconv.Quote(t.Text)
+}
+
+// parseExpr parses a binary expression whose operators bind at least as
+// tightly as min.
+func (p *exprParser) parseExpr(min int) (exprNode, error) {
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op := p.peek().Kind
+
+		prec, ok := exprPrecedence[op]
+		if !ok || prec < min {
+			return x, nil
+		}
+
+		p.next()
+
+		y, err := p.parseExpr(prec + 1)
+		if err != nil {
+			return nil, err
+		}
+
+		x = binaryNode{Op: op, X: x, Y: y}
+	}
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if op := p.peek().Kind; op == "-" || op == "!" {
+		p.next()
+
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		return unaryNode{Op: op, X: x}, nil
+	}
+
+	return p.parseOperand()
+}
+
+func (p *exprParser) parseOperand() (exprNode, error) {
+	t := p.next()
+
+	switch t.Kind {
+	case "num":
+		n, err := strconv.ParseFloat(t.Text, 64)
+		if err != nil {
+			return nil, p.errorf(t, "invalid number %s", t.Text)
+		}
+
+		return constNode{Num: n}, nil
+	case "str":
+		return constNode{Str: t.Text, IsStr: true}, nil
+	case "(":
+		x, err := p.parseExpr(1)
+		if err != nil {
+			return nil, err
+		}
+
+		return x, p.expect(")")
+	case "ident":
+		if p.peek().Kind == "(" {
+			return p.parseCall(t)
+		}
+
+		return p.resolveIdent(t)
+	}
+
+	return nil, p.errorf(t, "expected a value, found %s", describeToken(t))
+}
+
+func (p *exprParser) parseCall(name exprToken) (exprNode, error) {
+	fn, ok := exprFuncs[name.Text]
+	if !ok {
+		return nil, p.errorf(name, "unknown function %s", name.Text)
+	}
+
+	p.next()
+
+	var args []exprNode
+
+	for p.peek().Kind != ")" {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+
+		arg, err := p.parseExpr(1)
+		if err != nil {
+			return nil, err
+		}
+
+		args = append(args, arg)
+	}
+
+	p.next()
+
+	if len(args) != fn.Args {
+		return nil, p.errorf(name, "%s takes %d arguments, not %d", name.Text, fn.Args, len(args))
+	}
+
+	return callNode{Name: name.Text, Args: args}, nil
+}
+
+// resolveIdent looks up an identifier: a field or its alias, an attribute
+// of the troop, or an ID name.
+func (p *exprParser) resolveIdent(t exprToken) (exprNode, error) {
+	if f, ok := lookupField(t.Text); ok {
+		return fieldNode(f), nil
+	}
+
+	switch t.Text {
+	case "name", "key", "index":
+		return attrNode(t.Text), nil
+	}
+
+	for _, table := range symbolTables {
+		if id, ok := table.values[strings.ToUpper(t.Text)]; ok {
+			return constNode{Num: float64(id)}, nil
+		}
+	}
+
+	return nil, p.errorf(t, "unknown field or name %s", t.Text)
+}
+
+// parseCondition parses an expression selecting troops, such as
+// job == JOB_INFANTRY.
+func parseCondition(src string) (exprNode, error) {
+	tokens, err := tokenizeExpr(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &exprParser{src: src, tokens: tokens}
+
+	x, err := p.parseExpr(1)
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.Kind != "end" {
+		return nil, p.errorf(t, "unexpected %s", describeToken(t))
+	}
+
+	return x, nil
+}
+
+// exprAssignment sets a field to the value of an expression.
+type exprAssignment struct {
+	Field troopField
+	Value exprNode
+}
+
+// parseAssignments parses assignments separated by semicolons, such as
+// move_speed = move_speed * 1.2; defense += 5.
+func parseAssignments(src string) ([]exprAssignment, error) {
+	tokens, err := tokenizeExpr(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &exprParser{src: src, tokens: tokens}
+
+	var assignments []exprAssignment
+
+	for {
+		t := p.next()
+		if t.Kind != "ident" {
+			return nil, p.errorf(t, "expected a field to assign to, found %s", describeToken(t))
+		}
+
+		f, ok := lookupField(t.Text)
+		if !ok {
+			return nil, p.errorf(t, "unknown field %s", t.Text)
+		}
+
+		op := p.next()
+
+		switch op.Kind {
+		case "=", "+=", "-=", "*=", "/=":
+		default:
+			return nil, p.errorf(op, "expected =, +=, -=, *= or /=, found %s", describeToken(op))
+		}
+
+		value, err := p.parseExpr(1)
+		if err != nil {
+			return nil, err
+		}
+
+		if op.Kind != "=" {
+			value = binaryNode{Op: op.Kind[:1], X: fieldNode(f), Y: value}
+		}
+
+		assignments = append(assignments, exprAssignment{Field: f, Value: value})
+
+		switch t := p.next(); t.Kind {
+		case ";":
+			if p.peek().Kind == "end" {
+				return assignments, nil
+			}
+		case "end":
+			return assignments, nil
+		default:
+			return nil, p.errorf(t, "expected ; or the end, found %s", describeToken(t))
+		}
+	}
+}
+
+// apply evaluates the assignment for the troop at index i of tis and stores
+// the value, rounded to the nearest integer for integer fields.
+func (a exprAssignment) apply(tis troopInfoSOX, i int) error {
+	ti := &tis.TroopInfos[i]
+
+	v, err := a.Value.eval(ti, i)
+	if err != nil {
+		return err
+	}
+
+	if v.IsStr {
+		return fmt.Errorf("%s is a number, not the string %s", a.Field.Name, v)
+	}
+
+	if math.IsNaN(v.Num) || math.IsInf(v.Num, 0) {
+		return fmt.Errorf("%s would be %s", a.Field.Name, v)
+	}
+
+	field := a.Field.value(ti)
+
+	if field.Kind() == reflect.Float32 {
+		field.SetFloat(v.Num)
+		return nil
+	}
+
+	n := math.Round(v.Num)
+	if n < math.MinInt32 || n > math.MaxInt32 {
+		return fmt.Errorf("%s would be %s, which doesn't fit a 32-bit integer", a.Field.Name, v)
+	}
+
+	field.SetInt(int64(n))
+
+	return nil
+}
+
+// evalTroops returns a copy of tis with the assignments applied, in order,
+// to every troop where is true of. A nil where selects every troop.
+func evalTroops(tis troopInfoSOX, where exprNode, assignments []exprAssignment) (troopInfoSOX, error) {
+	after := tis.Clone()
+
+	for i := range after.TroopInfos {
+		if where != nil {
+			v, err := where.eval(&tis.TroopInfos[i], i)
+			if err != nil {
+				return troopInfoSOX{}, fmt.Errorf("%s: %w", troopName(i), err)
+			}
+
+			if v.IsStr {
+				return troopInfoSOX{}, fmt.Errorf("the condition is the string %s, not true or false", v)
+			}
+
+			if v.Num == 0 {
+				continue
+			}
+		}
+
+		for _, a := range assignments {
+			if err := a.apply(after, i); err != nil {
+				return troopInfoSOX{}, fmt.Errorf("%s: %w", troopName(i), err)
+			}
+		}
+	}
+
+	return after, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import "strings"
+
+// Factions of the retail troops.
+const (
+	factionHuman      = "Human Alliance"
+	factionDarkLegion = "Dark Legion"
+	factionEncablossa = "Encablossa"
+)
+
+// Roles group troops that fight the same way. Each role has a template troop
+// that new troops of the role are generated from.
+const (
+	roleInfantry = "infantry"
+	roleRanged   = "ranged"
+	roleCavalry  = "cavalry"
+	roleSiege    = "siege"
+	roleFlying   = "flying"
+	roleSupport  = "support"
+	roleMonster  = "monster"
+)
+
+// troopArchetype is the faction and role of a retail troop.
+type troopArchetype struct {
+	Faction string
+	Role    string
+}
+
+// troopArchetypes are indexed like defaultTroopNames. The dark elves fight
+// for the Human Alliance in the Crusaders campaign.
+var troopArchetypes = []troopArchetype{
+	{factionHuman, roleRanged},        // Archer
+	{factionHuman, roleRanged},        // Longbows
+	{factionHuman, roleInfantry},      // Infantry
+	{factionHuman, roleInfantry},      // Spearman
+	{factionHuman, roleInfantry},      // Heavy Infantry
+	{factionHuman, roleInfantry},      // Knight
+	{factionHuman, roleInfantry},      // Paladin
+	{factionHuman, roleCavalry},       // Calvary
+	{factionHuman, roleCavalry},       // Heavy Calvary
+	{factionHuman, roleCavalry},       // Storm Riders
+	{factionHuman, roleSupport},       // Sappers
+	{factionHuman, roleRanged},        // Pyro Techs
+	{factionHuman, roleFlying},        // Bomber Wings
+	{factionHuman, roleSiege},         // Mortar
+	{factionHuman, roleSiege},         // Ballista
+	{factionHuman, roleSiege},         // Harpoon
+	{factionHuman, roleSiege},         // Catapult
+	{factionHuman, roleFlying},        // Battaloon
+	{factionHuman, roleRanged},        // Dark Elves Archer
+	{factionHuman, roleCavalry},       // Dark Elves Calvary Archers
+	{factionHuman, roleInfantry},      // Dark Elves Infantry
+	{factionHuman, roleInfantry},      // Dark Elves Knights
+	{factionHuman, roleCavalry},       // Dark Elves Calvary
+	{factionDarkLegion, roleInfantry}, // Orc Infantry
+	{factionDarkLegion, roleCavalry},  // Orc Riders
+	{factionDarkLegion, roleCavalry},  // Orc Heavy Riders
+	{factionDarkLegion, roleInfantry}, // Orc Axe Man
+	{factionDarkLegion, roleInfantry}, // Orc Heavy Infantry
+	{factionDarkLegion, roleSupport},  // Orc Sappers
+	{factionDarkLegion, roleSiege},    // Orc Scorpion
+	{factionDarkLegion, roleMonster},  // Orc Swamp Mammoth
+	{factionDarkLegion, roleFlying},   // Orc Dirigible
+	{factionDarkLegion, roleFlying},   // Orc Black Wyverns
+	{factionDarkLegion, roleInfantry}, // Orc Ghouls
+	{factionDarkLegion, roleFlying},   // Orc Bone Dragon
+	{factionHuman, roleRanged},        // Wall Archers (Humans)
+	{factionHuman, roleSupport},       // Scouts
+	{factionDarkLegion, roleSupport},  // Ghoul Selfdestruct
+	{factionEncablossa, roleMonster},  // Encablossa Monster (Melee)
+	{factionEncablossa, roleFlying},   // Encablossa Flying Monster
+	{factionEncablossa, roleMonster},  // Encablossa Monster (Ranged)
+	{factionHuman, roleRanged},        // Wall Archers (Elves)
+	{factionEncablossa, roleMonster},  // Encablossa Main
+}
+
+// roleTemplates maps each role to the index of its template troop.
+var roleTemplates = map[string]int{
+	roleInfantry: 2,  // Infantry
+	roleRanged:   0,  // Archer
+	roleCavalry:  7,  // Calvary
+	roleSiege:    16, // Catapult
+	roleFlying:   12, // Bomber Wings
+	roleSupport:  10, // Sappers
+	roleMonster:  38, // Encablossa Monster (Melee)
+}
+
+// troopArchetypeOf returns the archetype of the troop at index i.
+func troopArchetypeOf(i int) troopArchetype {
+	if i < len(troopArchetypes) {
+		return troopArchetypes[i]
+	}
+
+	return troopArchetype{}
+}
+
+// troopGroup is a set of troops exported to one file.
+type troopGroup struct {
+	file   string
+	troops []int
+}
+
+// troopsByFaction groups the troops of tis by faction, in the order the
+// factions first appear. Troops without a known faction are grouped as other.
+func troopsByFaction(tis troopInfoSOX) []troopGroup {
+	var groups []troopGroup
+
+	index := map[string]int{}
+
+	for i := range tis.TroopInfos {
+		faction := troopArchetypeOf(i).Faction
+		if faction == "" {
+			faction = "other"
+		}
+
+		j, ok := index[faction]
+		if !ok {
+			j = len(groups)
+			index[faction] = j
+			groups = append(groups, troopGroup{file: factionFile(faction)})
+		}
+
+		groups[j].troops = append(groups[j].troops, i)
+	}
+
+	return groups
+}
+
+// factionFile returns the file name, without extension, for faction.
+func factionFile(faction string) string {
+	return strings.ReplaceAll(strings.ToLower(faction), " ", "-")
+}
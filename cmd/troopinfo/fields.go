@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// troopField is a single scalar value inside a troopInfo record, addressed by
+// the path of struct field and array indexes leading to it.
+type troopField struct {
+	Name   string `json:"name"`            // e.g. "move_speed" or "level_up_data[1].skill_id"
+	Type   string `json:"type"`            // Go kind of the value, e.g. "int32"
+	Offset int    `json:"offset"`          // byte offset inside the record
+	Size   int    `json:"size"`            // size in bytes
+	Doc    string `json:"doc"`             // from the doc struct tag
+	Since  int32  `json:"since,omitempty"` // first file version with the field, from the since tag
+	Until  int32  `json:"until,omitempty"` // last file version with the field, from the until tag
+	path   []int
+}
+
+// troopFields lists every scalar field of troopInfo in file order.
+var troopFields = flattenFields(reflect.TypeOf(troopInfo{}), "", nil)
+
+func flattenFields(t reflect.Type, prefix string, path []int) []troopField {
+	return flattenLayout(t, prefix, path, 0, troopField{})
+}
+
+// flattenLayout flattens t, which starts at offset inside the record. Records
+// only hold 4-byte values, so the Go struct layout matches the packed file
+// layout of the newest version and reflect offsets can be used directly.
+// Tags on a struct field apply to every value inside it unless overridden;
+// inherited carries them down.
+func flattenLayout(t reflect.Type, prefix string, path []int, offset int, inherited troopField) []troopField {
+	var fields []troopField
+
+	switch t.Kind() {
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+
+			name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+
+			if prefix != "" {
+				name = prefix + "." + name
+			}
+
+			tags := inherited
+
+			if doc := f.Tag.Get("doc"); doc != "" {
+				tags.Doc = doc
+			}
+
+			if v, err := strconv.ParseInt(f.Tag.Get("since"), 10, 32); err == nil {
+				tags.Since = int32(v)
+			}
+
+			if v, err := strconv.ParseInt(f.Tag.Get("until"), 10, 32); err == nil {
+				tags.Until = int32(v)
+			}
+
+			fields = append(fields, flattenLayout(f.Type, name, appendPath(path, i), offset+int(f.Offset), tags)...)
+		}
+	case reflect.Array:
+		for i := 0; i < t.Len(); i++ {
+			name := fmt.Sprintf("%s[%d]", prefix, i)
+			fields = append(fields, flattenLayout(t.Elem(), name, appendPath(path, i), offset+i*int(t.Elem().Size()), inherited)...)
+		}
+	default:
+		f := inherited
+		f.Name = prefix
+		f.Type = t.Kind().String()
+		f.Offset = offset
+		f.Size = int(t.Size())
+		f.path = path
+
+		fields = append(fields, f)
+	}
+
+	return fields
+}
+
+// inVersion reports whether files of the given version hold f.
+func (f troopField) inVersion(version int32) bool {
+	return (f.Since == 0 || version >= f.Since) && (f.Until == 0 || version <= f.Until)
+}
+
+// fieldsForVersion returns the fields files of the given version hold, with
+// their offsets in that version's packed layout.
+func fieldsForVersion(fields []troopField, version int32) []troopField {
+	var (
+		out    []troopField
+		offset int
+	)
+
+	for _, f := range fields {
+		if !f.inVersion(version) {
+			continue
+		}
+
+		f.Offset = offset
+		offset += f.Size
+
+		out = append(out, f)
+	}
+
+	return out
+}
+
+func appendPath(path []int, i int) []int {
+	p := make([]int, len(path), len(path)+1)
+	copy(p, path)
+
+	return append(p, i)
+}
+
+// lookupField returns the field named name, which may be an alias.
+func lookupField(name string) (troopField, bool) {
+	return lookupFieldName(resolveFieldName(name))
+}
+
+// lookupFieldName returns the field named exactly name.
+func lookupFieldName(name string) (troopField, bool) {
+	for _, f := range troopFields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+
+	return troopField{}, false
+}
+
+func (f troopField) value(ti *troopInfo) reflect.Value {
+	v := reflect.ValueOf(ti).Elem()
+
+	for _, i := range f.path {
+		if v.Kind() == reflect.Array {
+			v = v.Index(i)
+		} else {
+			v = v.Field(i)
+		}
+	}
+
+	return v
+}
+
+func (f troopField) isFloat() bool {
+	return f.value(&troopInfo{}).Kind() == reflect.Float32
+}
+
+// Format returns the value of f in ti as a string.
+func (f troopField) Format(ti *troopInfo) string {
+	v := f.value(ti)
+
+	switch v.Kind() {
+	case reflect.Float32:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 32)
+	default:
+		return strconv.FormatInt(v.Int(), 10)
+	}
+}
+
+// Parse parses s and stores it as the value of f in ti.
+func (f troopField) Parse(ti *troopInfo, s string) error {
+	v := f.value(ti)
+	s = strings.TrimSpace(s)
+
+	switch v.Kind() {
+	case reflect.Float32:
+		n, err := strconv.ParseFloat(s, 32)
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		}
+
+		if math.IsNaN(n) || math.IsInf(n, 0) {
+			return fmt.Errorf("%s: %s is not a finite number", f.Name, s)
+		}
+
+		v.SetFloat(n)
+	default:
+		n, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		}
+
+		v.SetInt(n)
+	}
+
+	return nil
+}
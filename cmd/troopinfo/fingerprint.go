@@ -0,0 +1,221 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// fingerprint identifies one release of a game data file.
+type fingerprint struct {
+	File      string    `yaml:"file"`
+	SHA256    string    `yaml:"sha256"`
+	Size      int64     `yaml:"size"`
+	Version   string    `yaml:"version"`          // e.g. "Steam 1.0.2"
+	Region    string    `yaml:"region,omitempty"` // e.g. "KR" or "EU"
+	Notes     string    `yaml:"notes,omitempty"`
+	Submitted time.Time `yaml:"submitted"`
+}
+
+// fingerprintDB is the shareable fingerprint database format.
+type fingerprintDB struct {
+	Fingerprints []fingerprint `yaml:"fingerprints"`
+}
+
+// knownFingerprints ships with the tool. Community submissions confirmed by
+// more than one install get added here.
+var knownFingerprints []fingerprint
+
+func fingerprintDBPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "fingerprints.yaml"), nil
+}
+
+func readFingerprintDB(path string) (fingerprintDB, error) {
+	var db fingerprintDB
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return db, nil
+	}
+
+	if err != nil {
+		return db, err
+	}
+
+	return db, yaml.Unmarshal(data, &db)
+}
+
+func writeFingerprintDB(path string, db fingerprintDB) error {
+	sort.Slice(db.Fingerprints, func(i, j int) bool {
+		a, b := db.Fingerprints[i], db.Fingerprints[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+
+		return a.SHA256 < b.SHA256
+	})
+
+	data, err := yaml.Marshal(db)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// lookup returns the fingerprint matching hash, if any.
+func (db fingerprintDB) lookup(hash string) (fingerprint, bool) {
+	for _, fp := range db.Fingerprints {
+		if fp.SHA256 == hash {
+			return fp, true
+		}
+	}
+
+	return fingerprint{}, false
+}
+
+// hashFile returns the SHA-256 and size of the file at path.
+func hashFile(path string) (string, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+
+	n, err := io.Copy(h, file)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+func runFingerprint(args []string) error {
+	sub := "check"
+	if len(args) > 0 && (args[0] == "submit" || args[0] == "export" || args[0] == "import" || args[0] == "check") {
+		sub, args = args[0], args[1:]
+	}
+
+	fs := newFlagSet("fingerprint " + sub)
+	dir := fs.String("dir", soxDir, "Directory containing the SOX files")
+	version := fs.String("version", "", "Game version the files belong to (submit)")
+	region := fs.String("region", "", "Region or language of the install (submit)")
+	notes := fs.String("notes", "", "Free-form notes (submit)")
+	out := fs.String("o", "fingerprints.yaml", "File to export the database to (export)")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	dbPath, err := fingerprintDBPath()
+	if err != nil {
+		return err
+	}
+
+	db, err := readFingerprintDB(dbPath)
+	if err != nil {
+		return err
+	}
+
+	known := fingerprintDB{Fingerprints: append(append([]fingerprint(nil), knownFingerprints...), db.Fingerprints...)}
+
+	switch sub {
+	case "export":
+		if err := writeFingerprintDB(*out, db); err != nil {
+			return err
+		}
+
+		log.Info().Msg(tr("Exported %d fingerprints to %s", len(db.Fingerprints), *out))
+
+		return nil
+	case "import":
+		if fs.NArg() != 1 {
+			return errors.New("expected a fingerprint database to import")
+		}
+
+		other, err := readFingerprintDB(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+
+		var added int
+
+		for _, fp := range other.Fingerprints {
+			if _, ok := known.lookup(fp.SHA256); !ok {
+				db.Fingerprints = append(db.Fingerprints, fp)
+				known.Fingerprints = append(known.Fingerprints, fp)
+				added++
+			}
+		}
+
+		log.Info().Msg(tr("Imported %d new fingerprints", added))
+
+		return writeFingerprintDB(dbPath, db)
+	}
+
+	if sub == "submit" && *version == "" {
+		return errors.New("submit needs -version")
+	}
+
+	var submitted int
+
+	for _, df := range dataFiles {
+		hash, size, err := hashFile(filepath.Join(*dir, df.Name))
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if fp, ok := known.lookup(hash); ok {
+			fmt.Printf("%s: %s %s\n", df.Name, fp.Version, fp.Region)
+			continue
+		}
+
+		fmt.Printf("%s: unknown (%s)\n", df.Name, hash)
+
+		if sub == "submit" {
+			db.Fingerprints = append(db.Fingerprints, fingerprint{
+				File:      df.Name,
+				SHA256:    hash,
+				Size:      size,
+				Version:   *version,
+				Region:    *region,
+				Notes:     *notes,
+				Submitted: time.Now().UTC().Truncate(time.Second),
+			})
+			submitted++
+		}
+	}
+
+	if sub != "submit" {
+		return nil
+	}
+
+	log.Info().Msg(tr("Recorded %d fingerprints; share them with fingerprint export", submitted))
+
+	return writeFingerprintDB(dbPath, db)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// gameExecutables are the names the game runs under in the retail, Steam and
+// community releases. Executables in the game directory are checked too.
+var gameExecutables = []string{"kuf.exe", "kufc.exe", "crusaders.exe", "kuf crusaders.exe", "kuf_crusaders.exe"}
+
+var errGameRunning = errors.New("the game is running")
+
+// forceWrite writes the game files even while the game is running or the
+// data fails validation. It is set by -force before the command name.
+var forceWrite bool
+
+// takeForceFlag removes a -force flag given before the command name from args
+// and reports whether it was there. Commands have their own -force flags, so
+// only the leading position is global.
+func takeForceFlag(args []string) ([]string, bool) {
+	if len(args) > 0 && (args[0] == "-force" || args[0] == "--force") {
+		return args[1:], true
+	}
+
+	return args, false
+}
+
+// isGameExecutable reports whether the process image name, or the path it
+// was started from, belongs to the game. Paths may use either separator, as
+// they do under Wine.
+func isGameExecutable(image string, names map[string]bool) bool {
+	if i := strings.LastIndexAny(image, `/\`); i >= 0 {
+		image = image[i+1:]
+	}
+
+	return names[strings.ToLower(image)]
+}
+
+// gameExecutableNames returns the lowercased names of the known game
+// executables and of those in the game directory.
+func gameExecutableNames() map[string]bool {
+	names := map[string]bool{}
+
+	for _, name := range gameExecutables {
+		names[name] = true
+	}
+
+	exes, _ := filepath.Glob(filepath.Join(filepath.Dir(filepath.Dir(soxDir)), "*.exe"))
+	for _, exe := range exes {
+		names[strings.ToLower(filepath.Base(exe))] = true
+	}
+
+	return names
+}
+
+// checkGameNotRunning fails while the game is running, since it caches the
+// SOX files and may overwrite them or crash when they change mid-session.
+func checkGameNotRunning() error {
+	if forceWrite {
+		return nil
+	}
+
+	name, err := runningGame(gameExecutableNames())
+	if err != nil || name == "" {
+		return err
+	}
+
+	return fmt.Errorf("%w (%s); close it first, or run troopinfo -force <command> to write anyway", errGameRunning, name)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// runningGame returns the executable of a running process that is the game,
+// such as one started through Wine or Proton, or "" if there is none.
+func runningGame(names map[string]bool) (string, error) {
+	cmdlines, err := filepath.Glob("/proc/[0-9]*/cmdline")
+	if err != nil {
+		return "", err
+	}
+
+	for _, path := range cmdlines {
+		// Processes can exit while they are listed.
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		// Wine starts the game as "wine <exe>" or as the exe itself.
+		for _, arg := range bytes.SplitN(data, []byte{0}, 3) {
+			if isGameExecutable(string(arg), names) {
+				return string(arg), nil
+			}
+		}
+	}
+
+	return "", nil
+}
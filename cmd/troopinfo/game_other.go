@@ -0,0 +1,10 @@
+//go:build !windows && !linux
+// +build !windows,!linux
+
+package main
+
+// runningGame can't tell whether the game is running on this platform, where
+// it only runs through compatibility layers the tool doesn't know about.
+func runningGame(names map[string]bool) (string, error) {
+	return "", nil
+}
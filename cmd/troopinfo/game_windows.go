@@ -0,0 +1,27 @@
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// runningGame returns the image name of a running process that is the game,
+// or "" if there is none.
+func runningGame(names map[string]bool) (string, error) {
+	snapshot, err := syscall.CreateToolhelp32Snapshot(syscall.TH32CS_SNAPPROCESS, 0)
+	if err != nil {
+		return "", err
+	}
+	defer syscall.CloseHandle(snapshot)
+
+	var entry syscall.ProcessEntry32
+	entry.Size = uint32(unsafe.Sizeof(entry))
+
+	for err = syscall.Process32First(snapshot, &entry); err == nil; err = syscall.Process32Next(snapshot, &entry) {
+		if image := syscall.UTF16ToString(entry.ExeFile[:]); isGameExecutable(image, names) {
+			return image, nil
+		}
+	}
+
+	return "", nil
+}
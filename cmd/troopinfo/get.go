@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// fieldPath is a single field of a single troop, parsed from a path such as
+// troop_infos[Knight].defense, troops.knight.defense or Knight.defense.
+type fieldPath struct {
+	Troop string
+	Field troopField
+}
+
+func parseFieldPath(spec string) (fieldPath, error) {
+	invalid := fmt.Errorf("invalid path %q, expected e.g. troop_infos[Knight].defense or Knight.defense", spec)
+
+	s, troop, field := strings.TrimSpace(spec), "", ""
+
+	for _, prefix := range []string{legacyTroopsKey, troopsKey} {
+		if rest := strings.TrimPrefix(s, prefix); rest != s && (strings.HasPrefix(rest, "[") || strings.HasPrefix(rest, ".")) {
+			s = rest
+			break
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(s, "["):
+		end := strings.Index(s, "].")
+		if end < 0 {
+			return fieldPath{}, invalid
+		}
+
+		troop, field = s[1:end], s[end+2:]
+	default:
+		s = strings.TrimPrefix(s, ".")
+
+		i := strings.Index(s, ".")
+		if i < 0 {
+			return fieldPath{}, invalid
+		}
+
+		troop, field = s[:i], s[i+1:]
+	}
+
+	troop, field = strings.TrimSpace(troop), strings.TrimSpace(field)
+	if troop == "" || field == "" {
+		return fieldPath{}, invalid
+	}
+
+	f, ok := lookupField(field)
+	if !ok {
+		return fieldPath{}, fmt.Errorf("unknown field %q in %s", field, spec)
+	}
+
+	return fieldPath{Troop: troop, Field: f}, nil
+}
+
+// runGet prints single fields, one value per line, for quick checks and
+// scripts.
+func runGet(args []string) error {
+	fs := newFlagSet("get")
+	from := fs.String("from", sourceCurrent, "Data to read: current (the installed TroopInfo.sox), a YAML or SOX file, a workspace, or a reference such as @vanilla")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		return errors.New("expected paths such as troop_infos[Knight].defense")
+	}
+
+	var paths []fieldPath
+
+	for _, spec := range fs.Args() {
+		p, err := parseFieldPath(spec)
+		if err != nil {
+			return err
+		}
+
+		paths = append(paths, p)
+	}
+
+	tis, err := loadTroopSource(*from)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range paths {
+		i, err := troopRecord(tis, p.Troop)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(p.Field.Format(&tis.TroopInfos[i]))
+	}
+
+	return nil
+}
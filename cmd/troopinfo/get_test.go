@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestFieldPathByIndex(t *testing.T) {
+	newTestGame(t)
+
+	runCommand(t, runSet, "troop_infos[5].defense", "42")
+
+	if got := readInstalled(t).TroopInfos[5].Defense; got != 42 {
+		t.Errorf("record 5 has defense %g after setting troop_infos[5].defense, want 42", got)
+	}
+
+	count := len(readInstalled(t).TroopInfos)
+
+	for _, troop := range []string{strconv.Itoa(count), "-1"} {
+		err := runGet([]string{"troop_infos[" + troop + "].defense"})
+		if err == nil || !strings.Contains(err.Error(), "out of range") {
+			t.Errorf("getting troop_infos[%s].defense of %d troops returned %v, want an out of range error", troop, count, err)
+		}
+	}
+
+	if i, err := troopIndex("7"); err != nil || i != 7 {
+		t.Errorf("troopIndex(\"7\") = %d, %v, want 7", i, err)
+	}
+}
+
+func TestSetRejectsNonFiniteFloats(t *testing.T) {
+	newTestGame(t)
+
+	for _, value := range []string{"NaN", "Inf", "-Inf", "+Infinity"} {
+		if err := runSet([]string{"troop_infos[0].defense", value}); err == nil {
+			t.Errorf("setting defense to %s succeeded, want an error", value)
+		}
+	}
+
+	if got := readInstalled(t).TroopInfos[0].Defense; got != 10 {
+		t.Errorf("record 0 has defense %g after the refused sets, want 10", got)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/rs/zerolog/log"
+)
+
+func runGrep(args []string) error {
+	fs := newFlagSet("grep")
+	dir := fs.String("dir", soxDir, "Directory or zip archive containing the SOX files to search")
+	ignoreCase := fs.Bool("i", false, "Ignore case when matching")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		return errors.New("expected a single pattern")
+	}
+
+	pattern := fs.Arg(0)
+	if *ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+
+	st, err := openStorage(*dir)
+	if err != nil {
+		return err
+	}
+
+	for _, df := range dataFiles {
+		records, err := df.readRecords(st)
+		if os.IsNotExist(err) {
+			log.Debug().Msg(tr("Skipping missing %s", df.Name))
+			continue
+		}
+
+		if err != nil {
+			return fmt.Errorf("%s: %w", df.Name, err)
+		}
+
+		for _, r := range records {
+			grepRecord(df.Name, r, re)
+		}
+	}
+
+	return nil
+}
+
+// grepRecord prints the fields of r whose name or value match re. When only
+// the record name matches, the record itself is printed.
+func grepRecord(file string, r record, re *regexp.Regexp) {
+	var hits int
+
+	for _, f := range r.Fields {
+		if re.MatchString(f.Name) || re.MatchString(f.Value) {
+			fmt.Printf("%s:%s:%s: %s\n", file, r.Name, f.Name, f.Value)
+			hits++
+		}
+	}
+
+	if hits == 0 && re.MatchString(r.Name) {
+		fmt.Printf("%s:%s\n", file, r.Name)
+	}
+}
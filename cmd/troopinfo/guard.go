@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/rdeusser/troopinfo/kuftc"
+	"gopkg.in/yaml.v3"
+)
+
+var errIncomplete = errors.New("incomplete troop data")
+
+// checkComplete rejects troop data that would wipe the game's data: a bad
+// header or, unless allowZero is set, records that are all zeros, which is
+// what troops missing from a YAML file decode to.
+func checkComplete(tis troopInfoSOX, allowZero bool) error {
+	if !validSOX(tis.Version, tis.Count) {
+		return fmt.Errorf("%w: version %d with %d records, expected one of versions %v with 1 to %d records",
+			errIncomplete, tis.Version, tis.Count, kuftc.Versions, maxTroopRecords)
+	}
+
+	if allowZero {
+		return nil
+	}
+
+	for i, ti := range tis.TroopInfos {
+		if ti == (troopInfo{}) {
+			return fmt.Errorf("%w: %s (record %d) is all zeros; pass -allow-zero if that's intended",
+				errIncomplete, troopName(i), i)
+		}
+	}
+
+	return nil
+}
+
+// checkYAMLComplete checks that the YAML file at path has the header and
+// every troop its count says it has, so an empty, truncated or damaged file
+// isn't written as if it were a deliberate edit. Files marked partial (see
+// partialKey) only need one troop; the troops they leave out keep their
+// installed values.
+func checkYAMLComplete(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var doc yaml.Node
+
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return newYAMLError(path, data, err)
+	}
+
+	root := documentRoot(&doc)
+	if root.Kind != yaml.MappingNode {
+		return &yamlError{Path: path, Msg: "file is empty or not a mapping", Expected: "version, count and troops", source: data}
+	}
+
+	for _, key := range []string{"version", "count"} {
+		if mappingValue(root, key) == nil {
+			return &yamlError{Path: path, Line: root.Line, Column: root.Column, Msg: "missing " + key, source: data}
+		}
+	}
+
+	nodes, err := troopNodes(path, data, &doc)
+	if err != nil {
+		return err
+	}
+
+	if len(nodes) == 0 {
+		return &yamlError{Path: path, Line: root.Line, Column: root.Column, Msg: "no troops", Expected: troopsKey, source: data}
+	}
+
+	var partial bool
+
+	if n := mappingValue(root, partialKey); n != nil {
+		if err := n.Decode(&partial); err != nil {
+			return &yamlError{Path: path, Line: n.Line, Column: n.Column, Msg: "invalid " + partialKey, Value: n.Value, Expected: "true or false", source: data}
+		}
+	}
+
+	if partial {
+		return nil
+	}
+
+	count := mappingValue(root, "count")
+
+	var want int
+	if err := count.Decode(&want); err != nil {
+		return &yamlError{Path: path, Line: count.Line, Column: count.Column, Msg: "invalid count", Value: count.Value, Expected: "the number of troops", source: data}
+	}
+
+	troops := map[int]bool{}
+	for _, n := range nodes {
+		troops[n.Index] = true
+	}
+
+	if len(troops) != want {
+		return &yamlError{
+			Path:     path,
+			Line:     count.Line,
+			Column:   count.Column,
+			Msg:      fmt.Sprintf("%d troops, but count is %d", len(troops), want),
+			Expected: fmt.Sprintf("every troop, or %s: true if troops are left out on purpose", partialKey),
+			source:   data,
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestCheckYAMLComplete(t *testing.T) {
+	newTestGame(t)
+
+	runCommand(t, runDump)
+
+	data, err := ioutil.ReadFile(troopInfoYAMLPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkYAMLComplete(troopInfoYAMLPath); err != nil {
+		t.Fatalf("a full dump fails the check: %v", err)
+	}
+
+	// Cut the file off after the first troop, as a truncated write would.
+	cut := strings.Index(string(data), "# 1 -- ")
+	if cut < 0 {
+		t.Fatalf("no second troop in the dump:\n%s", data)
+	}
+
+	truncated := string(data[:cut])
+
+	for _, tt := range []struct {
+		name string
+		yaml string
+		ok   bool
+	}{
+		{"truncated", truncated, false},
+		{"partial", partialKey + ": true\n" + truncated, true},
+		{"partial: false", partialKey + ": false\n" + truncated, false},
+	} {
+		if err := ioutil.WriteFile(troopInfoYAMLPath, []byte(tt.yaml), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := checkYAMLComplete(troopInfoYAMLPath); (err == nil) != tt.ok {
+			t.Errorf("%s file: checkYAMLComplete returned %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net"
+	"net/http"
+	"os/exec"
+	"runtime"
+
+	"github.com/rs/zerolog/log"
+)
+
+// guiPage is the single page of the graphical editor. It edits the installed
+// TroopInfo.sox through the session API of serve: edits are checked by the
+// server as they are made, undone by setting the old value again, and
+// written on commit, which goes through the same checks and backups as
+// every other write. The page carries the token of the session API, which
+// other pages can't read.
+var guiPage = template.Must(template.New("gui").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>troopinfo</title>
+<style>
+body { font-family: sans-serif; margin: 0; display: flex; height: 100vh; }
+#troops { width: 16em; overflow-y: auto; border-right: 1px solid #ccc; margin: 0; padding: 0; list-style: none; }
+#troops li { padding: 4px 8px; cursor: pointer; }
+#troops li.selected { background: #36c; color: #fff; }
+#troops li.changed::after { content: " *"; }
+main { flex: 1; display: flex; flex-direction: column; }
+#toolbar { padding: 8px; border-bottom: 1px solid #ccc; }
+#status { margin-left: 1em; }
+#status.error { color: #c00; }
+#content { flex: 1; overflow-y: auto; padding: 8px; }
+table { border-collapse: collapse; }
+td, th { padding: 2px 8px; border-bottom: 1px solid #ddd; text-align: left; }
+td input { width: 10em; }
+.modded input { background: #ffd; }
+.unsaved input { background: #dfd; font-weight: bold; }
+#findings { color: #c00; }
+#findings .warning { color: #960; }
+</style>
+</head>
+<body>
+<ul id="troops"></ul>
+<main>
+<div id="toolbar">
+<button id="undo" title="Ctrl+Z">Undo</button>
+<button id="diff">Changes</button>
+<button id="write">Write to the game</button>
+<span id="status"></span>
+</div>
+<div id="content"></div>
+<ul id="findings"></ul>
+</main>
+<script>
+const data = {{.JSON}};
+const token = {{.Token}};
+const written = data.troops.map(t => t.values.slice());
+let session = null, troop = 0, undo = [], showDiff = false;
+
+function setStatus(msg, error) {
+  const s = document.getElementById("status");
+  s.textContent = msg;
+  s.className = error ? "error" : "";
+}
+
+function text(tag, s) {
+  const e = document.createElement(tag);
+  e.textContent = s;
+  return e;
+}
+
+async function checkout() {
+  const r = await fetch("/api/sessions", {method: "POST", headers: {"X-Troopinfo-Token": token}});
+  if (!r.ok) return setStatus(await r.text(), true);
+  const sess = await r.json();
+  session = sess.id;
+  showFindings(sess.findings);
+}
+
+function showFindings(findings) {
+  const list = document.getElementById("findings");
+  list.innerHTML = "";
+  for (const f of findings || []) {
+    const li = text("li", f.severity + ": " + f.troop + ": " + f.msg + " [" + f.rule + "]");
+    li.className = f.severity;
+    list.appendChild(li);
+  }
+}
+
+async function edit(t, f, value, record) {
+  const old = data.troops[t].values[f];
+  if (value === old) return;
+  const r = await fetch("/api/sessions/" + session, {
+    method: "PATCH",
+    headers: {"Content-Type": "application/json", "X-Troopinfo-Token": token},
+    body: JSON.stringify([{troop: String(t), field: data.fields[f], value: value}]),
+  });
+  if (!r.ok) {
+    setStatus(await r.text(), true);
+    render();
+    return;
+  }
+  data.troops[t].values[f] = value;
+  if (record) undo.push({t: t, f: f, old: old});
+  setStatus("");
+  showFindings((await r.json()).findings);
+  render();
+}
+
+function changes() {
+  const out = [];
+  data.troops.forEach((t, i) => t.values.forEach((v, f) => {
+    if (v !== written[i][f]) out.push({troop: t.name, field: data.fields[f], old: written[i][f], value: v});
+  }));
+  return out;
+}
+
+function render() {
+  const list = document.getElementById("troops");
+  list.innerHTML = "";
+  data.troops.forEach((t, i) => {
+    const li = text("li", t.name);
+    if (i === troop) li.classList.add("selected");
+    if (t.values.some((v, f) => v !== written[i][f])) li.classList.add("changed");
+    li.onclick = () => { troop = i; showDiff = false; render(); };
+    list.appendChild(li);
+  });
+
+  const content = document.getElementById("content");
+  content.innerHTML = "";
+  const table = document.createElement("table");
+  content.appendChild(table);
+
+  if (showDiff) {
+    const all = changes();
+    if (all.length === 0) content.appendChild(text("p", "No unsaved changes."));
+    else table.appendChild(row(["Troop", "Field", "Written", "New"], "th"));
+    for (const c of all) table.appendChild(row([c.troop, c.field, c.old, c.value], "td"));
+    return;
+  }
+
+  const t = data.troops[troop];
+  table.appendChild(row(["Field", "Value", "Vanilla"], "th"));
+  data.fields.forEach((name, f) => {
+    const input = document.createElement("input");
+    input.value = t.values[f];
+    input.onchange = () => edit(troop, f, input.value.trim(), true);
+    const vanilla = t.vanilla ? t.vanilla[f] : "";
+    const tr = row([name, "", vanilla], "td");
+    tr.children[1].appendChild(input);
+    if (t.values[f] !== written[troop][f]) tr.className = "unsaved";
+    else if (t.vanilla && t.values[f] !== vanilla) tr.className = "modded";
+    table.appendChild(tr);
+  });
+}
+
+function row(cells, tag) {
+  const tr = document.createElement("tr");
+  for (const c of cells) tr.appendChild(text(tag, c));
+  return tr;
+}
+
+async function undoEdit() {
+  const e = undo.pop();
+  if (!e) return setStatus("Nothing to undo");
+  troop = e.t;
+  await edit(e.t, e.f, e.old, false);
+}
+
+async function write() {
+  if (changes().length === 0) return setStatus("No unsaved changes");
+  const r = await fetch("/api/sessions/" + session + "/commit", {method: "POST", headers: {"X-Troopinfo-Token": token}});
+  if (!r.ok) return setStatus(await r.text(), true);
+  data.troops.forEach((t, i) => { written[i] = t.values.slice(); });
+  undo = [];
+  setStatus("Wrote TroopInfo.sox; the previous file was backed up");
+  await checkout();
+  render();
+}
+
+document.getElementById("undo").onclick = undoEdit;
+document.getElementById("diff").onclick = () => { showDiff = !showDiff; render(); };
+document.getElementById("write").onclick = write;
+document.addEventListener("keydown", e => {
+  if ((e.ctrlKey || e.metaKey) && e.key === "z" && e.target.tagName !== "INPUT") {
+    e.preventDefault();
+    undoEdit();
+  }
+});
+window.addEventListener("beforeunload", e => {
+  if (changes().length > 0) e.preventDefault();
+});
+
+checkout();
+render();
+</script>
+</body>
+</html>
+`))
+
+// guiData is what the editor page starts with: the installed troops and
+// their vanilla values, formatted as in TroopInfo.yaml.
+type guiData struct {
+	Fields []string   `json:"fields"`
+	Troops []guiTroop `json:"troops"`
+}
+
+type guiTroop struct {
+	Name    string   `json:"name"`
+	Values  []string `json:"values"`
+	Vanilla []string `json:"vanilla,omitempty"`
+}
+
+func newGUIData(tis troopInfoSOX, vanilla *troopInfoSOX) guiData {
+	d := guiData{Fields: make([]string, len(troopFields))}
+
+	for i, f := range troopFields {
+		d.Fields[i] = f.Name
+	}
+
+	format := func(ti *troopInfo) []string {
+		values := make([]string, len(troopFields))
+		for i, f := range troopFields {
+			values[i] = symbolName(f.Name, f.Format(ti))
+		}
+
+		return values
+	}
+
+	refs := counterparts(vanilla, tis)
+
+	for i := range tis.TroopInfos {
+		t := guiTroop{Name: troopName(i), Values: format(&tis.TroopInfos[i])}
+
+		if refs[i] != nil {
+			t.Vanilla = format(refs[i])
+		}
+
+		d.Troops = append(d.Troops, t)
+	}
+
+	return d
+}
+
+// runGUI serves the graphical editor on localhost and opens it in the
+// browser, for users who won't use the command line. It needs nothing
+// installed besides a browser.
+func runGUI(args []string) error {
+	fs := newFlagSet("gui")
+	addr := fs.String("addr", "localhost:0", "Address to listen on; the default picks a free port")
+	noBrowser := fs.Bool("no-browser", false, "Only prints the address instead of opening the browser")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() > 0 {
+		return errors.New("gui takes no arguments")
+	}
+
+	st, err := openStorage(soxDir)
+	if err != nil {
+		return err
+	}
+
+	token, err := newSessionToken()
+	if err != nil {
+		return err
+	}
+
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/", withSessions(newAPIHandler(st), st, false, token))
+	mux.Handle("/", readingRoster(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+
+		tis, err := readTroopStorage(st)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+
+		data, err := json.Marshal(newGUIData(tis, readVanilla()))
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+
+		page := struct {
+			JSON  template.JS
+			Token string
+		}{template.JS(data), token}
+
+		if err := guiPage.Execute(w, page); err != nil {
+			log.Debug().Err(err).Msg("write failed")
+		}
+	})))
+
+	url := "http://" + ln.Addr().String() + "/"
+
+	log.Info().Msg(tr("The editor is at %s; press Ctrl+C to stop it", url))
+
+	if !*noBrowser {
+		if err := openBrowser(url); err != nil {
+			log.Warn().Err(err).Msg(tr("Couldn't open the browser; open %s yourself", url))
+		}
+	}
+
+	return http.Serve(ln, localOnly(mux, ln.Addr(), *addr))
+}
+
+// openBrowser opens url in the default browser.
+func openBrowser(url string) error {
+	var cmd *exec.Cmd
+
+	switch runtime.GOOS {
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	case "darwin":
+		cmd = exec.Command("open", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+
+	return cmd.Start()
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// heatColors shade heatmap cells from the lowest value of a field (red) to
+// the highest (green), using the 256-color palette.
+var heatColors = []string{
+	"\x1b[38;5;196m",
+	"\x1b[38;5;208m",
+	"\x1b[38;5;226m",
+	"\x1b[38;5;154m",
+	"\x1b[38;5;46m",
+}
+
+func runHeatmap(args []string) error {
+	fs := newFlagSet("heatmap")
+	fields := fs.String("field", "resist_*", "Comma-separated fields or patterns to show, e.g. resist_* or hp,defense")
+	from := fs.String("from", sourceCurrent, "Data to show: current, vanilla, a file, or a reference such as @backup:latest")
+	noColor := fs.Bool("no-color", false, "Disables colored output")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	selected := selectFields(strings.Split(*fields, ","))
+	if len(selected) == 0 {
+		return errors.New("no fields match " + *fields)
+	}
+
+	tis, err := loadTroopSource(*from)
+	if err != nil {
+		return err
+	}
+
+	style := detectTermStyle(*noColor)
+
+	heatmapTable(tis, selected).render(os.Stdout, style)
+
+	if style.color {
+		var legend strings.Builder
+		for _, c := range heatColors {
+			legend.WriteString(c + "■" + colorReset)
+		}
+
+		fmt.Println()
+		fmt.Println(tr("lowest %s highest value of each field", legend.String()))
+	}
+
+	return nil
+}
+
+// selectFields returns the troop fields matching any of patterns, which may
+// be aliases, in schema order. Nested fields such as level_up_data are left
+// out since they aren't comparable across troops.
+func selectFields(patterns []string) []troopField {
+	var selected []troopField
+
+	for _, f := range troopFields {
+		if strings.Contains(f.Name, ".") {
+			continue
+		}
+
+		for _, p := range patterns {
+			if matchPattern(resolveFieldName(strings.TrimSpace(p)), f.Name) {
+				selected = append(selected, f)
+				break
+			}
+		}
+	}
+
+	return selected
+}
+
+// heatmapTable renders troops as rows and fields as columns, each cell
+// colored by where its value lies between the lowest and highest value of its
+// field.
+func heatmapTable(tis troopInfoSOX, fields []troopField) *table {
+	header := []string{"troop"}
+	for _, f := range fields {
+		header = append(header, f.Name)
+	}
+
+	t := newTable(header...)
+
+	lo := make([]float64, len(fields))
+	hi := make([]float64, len(fields))
+
+	for j, f := range fields {
+		for i := range tis.TroopInfos {
+			v := numericValue(f, &tis.TroopInfos[i])
+			if i == 0 || v < lo[j] {
+				lo[j] = v
+			}
+
+			if i == 0 || v > hi[j] {
+				hi[j] = v
+			}
+		}
+	}
+
+	for i := range tis.TroopInfos {
+		row := []cell{{text: troopName(i)}}
+
+		for j, f := range fields {
+			row = append(row, cell{
+				text:  f.Format(&tis.TroopInfos[i]),
+				color: heatColor(numericValue(f, &tis.TroopInfos[i]), lo[j], hi[j]),
+			})
+		}
+
+		t.addRow(row...)
+	}
+
+	return t
+}
+
+func heatColor(v, lo, hi float64) string {
+	if hi <= lo {
+		return heatColors[len(heatColors)/2]
+	}
+
+	i := int((v - lo) / (hi - lo) * float64(len(heatColors)))
+	if i >= len(heatColors) {
+		i = len(heatColors) - 1
+	}
+
+	return heatColors[i]
+}
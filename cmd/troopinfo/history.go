@@ -0,0 +1,513 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// The history database records every operation that changes game data or
+// the workspace, with the changes it made and, for writes to game files, a
+// snapshot of what was written. It is a JSON lines file in the configuration
+// directory rather than the bbolt or SQLite database first asked for: the
+// tool stays a single binary without a database driver, appends only seek to
+// the last entry, and a torn last line after a crash only loses that entry.
+// Queries read the whole file, which retention keeps small: only the latest
+// historyKeep operations are kept, and only the latest backupKeep of them
+// keep their snapshots, as older ones are in the backup chain if anywhere.
+
+// defaultHistoryKeep is how many operations the history database keeps
+// unless the configuration sets history_keep.
+const defaultHistoryKeep = 1000
+
+// historyKeep is the number of operations kept in the history database.
+var historyKeep = defaultHistoryKeep
+
+// historyPruneInterval is how many operations are appended between prunes
+// of the history database, which rewrite it.
+const historyPruneInterval = 50
+
+// historyTailChunk is how much of the end of the history database is read
+// at a time when looking for its last entry.
+const historyTailChunk = 64 << 10
+
+// historyEntry is one operation in the history database.
+type historyEntry struct {
+	ID       int           `json:"id"`
+	Time     time.Time     `json:"time"`
+	Op       string        `json:"op"`
+	Args     []string      `json:"args,omitempty"`
+	File     string        `json:"file"`
+	Changes  []fieldChange `json:"changes,omitempty"`
+	Snapshot []byte        `json:"snapshot,omitempty"`
+}
+
+func historyDBPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "history.jsonl"), nil
+}
+
+// readHistory returns the entries of the history database, oldest first. A
+// missing database is empty, and undecodable lines are skipped.
+func readHistory() ([]historyEntry, error) {
+	path, err := historyDBPath()
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []historyEntry
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 16<<20)
+
+	for scanner.Scan() {
+		var e historyEntry
+
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			log.Debug().Err(err).Msg(tr("Skipping damaged history entry"))
+			continue
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, scanner.Err()
+}
+
+// appendHistory adds e to the history database, numbering it after the last
+// entry, and prunes the database every historyPruneInterval entries.
+func appendHistory(e historyEntry) error {
+	path, err := historyDBPath()
+	if err != nil {
+		return err
+	}
+
+	last, torn, err := lastHistoryID(path)
+	if err != nil {
+		return err
+	}
+
+	e.ID = last + 1
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	// A torn last line is ended, so it doesn't swallow this entry.
+	if torn {
+		data = append([]byte{'\n'}, data...)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	if e.ID%historyPruneInterval == 0 {
+		if _, err := pruneHistory(historyKeep, backupKeep); err != nil {
+			log.Warn().Err(err).Msg(tr("Couldn't prune the history"))
+		}
+	}
+
+	return nil
+}
+
+// lastHistoryID returns the ID of the last entry of the history database at
+// path, reading back from its end, and whether its last line is missing its
+// line break. The whole database is only read if the last line is damaged.
+func lastHistoryID(path string) (int, bool, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, false, nil
+	}
+
+	if err != nil {
+		return 0, false, err
+	}
+	defer file.Close()
+
+	fi, err := file.Stat()
+	if err != nil {
+		return 0, false, err
+	}
+
+	var tail []byte
+
+	for off := fi.Size(); off > 0; {
+		n := int64(historyTailChunk)
+		if n > off {
+			n = off
+		}
+
+		off -= n
+
+		chunk := make([]byte, n)
+		if _, err := file.ReadAt(chunk, off); err != nil {
+			return 0, false, err
+		}
+
+		tail = append(chunk, tail...)
+		torn := tail[len(tail)-1] != '\n'
+
+		// The last line is complete once a line break precedes it.
+		line := bytes.TrimRight(tail, "\n")
+		i := bytes.LastIndexByte(line, '\n')
+
+		if i < 0 && off > 0 {
+			continue
+		}
+
+		var e struct {
+			ID int `json:"id"`
+		}
+
+		if err := json.Unmarshal(line[i+1:], &e); err == nil {
+			return e.ID, torn, nil
+		}
+
+		entries, err := readHistory()
+		if err != nil || len(entries) == 0 {
+			return 0, torn, err
+		}
+
+		return entries[len(entries)-1].ID, torn, nil
+	}
+
+	return 0, false, nil
+}
+
+// pruneHistory drops all but the latest keep entries of the history
+// database, and the snapshots of all but the latest keepSnapshots of them.
+// It returns the number of entries dropped.
+func pruneHistory(keep, keepSnapshots int) (int, error) {
+	path, err := historyDBPath()
+	if err != nil {
+		return 0, err
+	}
+
+	entries, err := readHistory()
+	if err != nil {
+		return 0, err
+	}
+
+	pruned := 0
+	if len(entries) > keep {
+		pruned = len(entries) - keep
+		entries = entries[pruned:]
+	}
+
+	buf := &bytes.Buffer{}
+	snapshots := 0
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		if len(entries[i].Snapshot) == 0 {
+			continue
+		}
+
+		if snapshots++; snapshots > keepSnapshots {
+			entries[i].Snapshot = nil
+		}
+	}
+
+	for _, e := range entries {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return 0, err
+		}
+
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	if len(entries) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return 0, err
+		}
+
+		return pruned, nil
+	}
+
+	return pruned, writeFileAtomic(path, buf.Bytes(), 0600)
+}
+
+// recordHistory records an operation, logging instead of failing since the
+// operation itself already succeeded.
+func recordHistory(op, file string, changes []fieldChange, snapshot []byte) {
+	e := historyEntry{
+		Op:       op,
+		Args:     os.Args[1:],
+		File:     file,
+		Changes:  changes,
+		Snapshot: snapshot,
+	}
+
+	if err := appendHistory(e); err != nil {
+		log.Warn().Err(err).Msg(tr("Couldn't record the operation in the history"))
+	}
+}
+
+func runHistory(args []string) error {
+	if len(args) == 0 {
+		return errors.New("expected list, show, snapshot or prune")
+	}
+
+	switch args[0] {
+	case "list":
+		return runHistoryList(args[1:])
+	case "show":
+		return runHistoryShow(args[1:])
+	case "snapshot":
+		return runHistorySnapshot(args[1:])
+	case "prune":
+		return runHistoryPrune(args[1:])
+	default:
+		return fmt.Errorf("unknown history command %q", args[0])
+	}
+}
+
+// historyFilter selects history entries.
+type historyFilter struct {
+	Op     string
+	Troop  string
+	Field  string
+	Since  time.Time
+	Latest int
+}
+
+func (f historyFilter) apply(entries []historyEntry) []historyEntry {
+	var out []historyEntry
+
+	for _, e := range entries {
+		if f.Op != "" && !matchPattern(f.Op, e.Op) {
+			continue
+		}
+
+		if !f.Since.IsZero() && e.Time.Before(f.Since) {
+			continue
+		}
+
+		if f.Troop != "" || f.Field != "" {
+			changes := f.changes(e.Changes)
+			if len(changes) == 0 {
+				continue
+			}
+
+			e.Changes = changes
+		}
+
+		out = append(out, e)
+	}
+
+	if f.Latest > 0 && len(out) > f.Latest {
+		out = out[len(out)-f.Latest:]
+	}
+
+	return out
+}
+
+// changes returns the changes matching the troop and field patterns.
+func (f historyFilter) changes(changes []fieldChange) []fieldChange {
+	var out []fieldChange
+
+	for _, c := range changes {
+		if matchPattern(f.Troop, c.Record) && matchPattern(resolveFieldName(f.Field), c.Field) {
+			out = append(out, c)
+		}
+	}
+
+	return out
+}
+
+func runHistoryList(args []string) error {
+	fs := newFlagSet("history list")
+	op := fs.String("op", "", "Only list operations matching this pattern, e.g. write or import")
+	troop := fs.String("troop", "", "Only list operations that changed troops matching this pattern")
+	field := fs.String("field", "", "Only list operations that changed fields matching this pattern")
+	since := fs.String("since", "", "Only list operations on or after this date (YYYY-MM-DD)")
+	latest := fs.Int("n", 0, "Only list the latest n operations")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	filter := historyFilter{Op: *op, Troop: *troop, Field: *field, Latest: *latest}
+
+	if *since != "" {
+		t, err := time.ParseInLocation("2006-01-02", *since, time.Local)
+		if err != nil {
+			return err
+		}
+
+		filter.Since = t
+	}
+
+	entries, err := readHistory()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTIME\tOP\tFILE\tCHANGES\tSNAPSHOT")
+
+	for _, e := range filter.apply(entries) {
+		snapshot := ""
+		if len(e.Snapshot) > 0 {
+			snapshot = "yes"
+		}
+
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%s\n", e.ID, e.Time.Format("2006-01-02 15:04:05"), e.Op, e.File, len(e.Changes), snapshot)
+	}
+
+	return w.Flush()
+}
+
+func runHistoryShow(args []string) error {
+	fs := newFlagSet("history show")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		return errors.New("expected a history entry ID")
+	}
+
+	e, err := findHistoryEntry(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d %s %s %s\n", e.ID, e.Time.Format(time.RFC3339), e.Op, e.File)
+
+	if len(e.Args) > 0 {
+		fmt.Printf("troopinfo %s\n", strings.Join(e.Args, " "))
+	}
+
+	fmt.Println()
+	printChangeSummary(os.Stdout, e.Changes, true)
+
+	return nil
+}
+
+func runHistorySnapshot(args []string) error {
+	fs := newFlagSet("history snapshot")
+	out := fs.String("o", "", "Path to write the snapshot to")
+
+	if len(args) > 0 {
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+	}
+
+	if len(args) == 0 || *out == "" {
+		return errors.New("expected a history entry ID and -o")
+	}
+
+	e, err := findHistoryEntry(args[0])
+	if err != nil {
+		return err
+	}
+
+	if len(e.Snapshot) == 0 {
+		return fmt.Errorf("history entry %d has no snapshot", e.ID)
+	}
+
+	if err := ioutil.WriteFile(*out, e.Snapshot, 0600); err != nil {
+		return err
+	}
+
+	log.Info().Msg(tr("Wrote %s", *out))
+
+	return nil
+}
+
+func runHistoryPrune(args []string) error {
+	fs := newFlagSet("history prune")
+	keep := fs.Int("keep", historyKeep, "Number of operations to keep")
+	keepSnapshots := fs.Int("keep-snapshots", backupKeep, "Number of the kept operations whose snapshots are kept")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *keep < 0 || *keepSnapshots < 0 {
+		return fmt.Errorf("invalid -keep %d or -keep-snapshots %d", *keep, *keepSnapshots)
+	}
+
+	pruned, err := pruneHistory(*keep, *keepSnapshots)
+	if err != nil {
+		return err
+	}
+
+	log.Info().Msg(tr("Dropped %d history entries", pruned))
+
+	return nil
+}
+
+// findHistoryEntry finds an entry by ID, or the latest one for "latest".
+func findHistoryEntry(ref string) (historyEntry, error) {
+	entries, err := readHistory()
+	if err != nil {
+		return historyEntry{}, err
+	}
+
+	if ref == "latest" && len(entries) > 0 {
+		return entries[len(entries)-1], nil
+	}
+
+	id, err := strconv.Atoi(ref)
+	if err != nil {
+		return historyEntry{}, fmt.Errorf("invalid history entry ID %q", ref)
+	}
+
+	for _, e := range entries {
+		if e.ID == id {
+			return e, nil
+		}
+	}
+
+	return historyEntry{}, fmt.Errorf("no history entry %d", id)
+}
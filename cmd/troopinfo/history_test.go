@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestHistoryAppendAndPrune(t *testing.T) {
+	newTestGame(t)
+
+	for i := 0; i < 3; i++ {
+		if err := appendHistory(historyEntry{Op: "write", Snapshot: []byte("data")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A crash may leave the last line half written.
+	path, err := historyDBPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := file.WriteString(`{"id":4,"ti`); err != nil {
+		t.Fatal(err)
+	}
+
+	file.Close()
+
+	if err := appendHistory(historyEntry{Op: "write", Snapshot: []byte("data")}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := readHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 4 || entries[3].ID != 4 {
+		t.Fatalf("history holds %d entries after a torn line, the last %+v, want 4 ending with ID 4", len(entries), entries[len(entries)-1])
+	}
+
+	pruned, err := pruneHistory(2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err = readHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pruned != 2 || len(entries) != 2 || entries[0].ID != 3 || entries[1].ID != 4 {
+		t.Fatalf("pruning to 2 entries dropped %d and kept %d, want entries 3 and 4", pruned, len(entries))
+	}
+
+	if len(entries[0].Snapshot) != 0 || len(entries[1].Snapshot) == 0 {
+		t.Errorf("pruning to 1 snapshot kept snapshots on entries 3 (%v) and 4 (%v), want only 4", len(entries[0].Snapshot) > 0, len(entries[1].Snapshot) > 0)
+	}
+
+	if err := appendHistory(historyEntry{Op: "write"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if id, _, err := lastHistoryID(path); err != nil || id != 5 {
+		t.Errorf("the entry after pruning has ID %d, %v, want 5", id, err)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// fieldHook is a policy that fires when an import changes one of its fields,
+// e.g.
+//
+//	hooks:
+//	  - fields: [job, type_id]
+//	    message: Job and type changes break the campaign scripts
+//	    confirm: true
+//	  - fields: ["level_up_data[*].skill_id"]
+//	    run: ./check-skills.sh
+//
+// Commands run through the shell with the changes in KUFTC_CHANGES, one per
+// line, and reject the import by exiting with a non-zero status.
+type fieldHook struct {
+	Fields  []string `yaml:"fields"` // field names, * matches any part of a name
+	Message string   `yaml:"message"`
+	Run     string   `yaml:"run"`
+	Confirm bool     `yaml:"confirm"`
+}
+
+var errHookRejected = errors.New("rejected by hook")
+
+// matches reports whether the hook watches the named field.
+func (h fieldHook) matches(name string) bool {
+	for _, pattern := range h.Fields {
+		if pattern != "" && matchPattern(pattern, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// runHooks fires every hook watching one of the changed fields. Confirmation
+// prompts read from in and write to out.
+func runHooks(hooks []fieldHook, changes []fieldChange, in io.Reader, out io.Writer) error {
+	reader := bufio.NewReader(in)
+
+	for _, h := range hooks {
+		var matched []string
+
+		for _, c := range changes {
+			if h.matches(c.Field) {
+				matched = append(matched, c.String())
+			}
+		}
+
+		if len(matched) == 0 {
+			continue
+		}
+
+		if h.Message != "" || h.Confirm {
+			fmt.Fprintln(out, h.Message)
+
+			for _, c := range matched {
+				fmt.Fprintf(out, "  %s\n", c)
+			}
+		}
+
+		if h.Run != "" {
+			if err := runHookCommand(h.Run, matched, out); err != nil {
+				return fmt.Errorf("%w: %s: %v", errHookRejected, h.Run, err)
+			}
+		}
+
+		if h.Confirm {
+			fmt.Fprint(out, tr("Apply these changes? [y/N] "))
+
+			line, _ := reader.ReadString('\n')
+			if answer := strings.ToLower(strings.TrimSpace(line)); answer != "y" && answer != "yes" {
+				return fmt.Errorf("%w: %s", errHookRejected, strings.Join(h.Fields, ", "))
+			}
+		}
+	}
+
+	return nil
+}
+
+func runHookCommand(command string, changes []string, out io.Writer) error {
+	var cmd *exec.Cmd
+
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+
+	cmd.Env = append(os.Environ(), "KUFTC_CHANGES="+strings.Join(changes, "\n"))
+	cmd.Stdout = out
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
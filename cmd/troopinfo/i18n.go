@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// Messages are looked up by their English text, gettext style, so a missing
+// translation falls back to English. Error messages stay in English so bug
+// reports are readable by everyone.
+
+// catalogs holds the built-in translations keyed by language code.
+var catalogs = map[string]map[string]string{
+	"ko": {
+		"%s failed":                  "%s 실패",
+		"Exported %s":                "%s 파일을 내보냈습니다",
+		"Imported %s into %s":        "%s 파일을 %s 파일로 가져왔습니다",
+		"Skipping missing %s":        "없는 파일 %s 건너뜀",
+		"Ignoring %s translations":   "%s 번역 무시",
+		"version: %d, count: %d\n\n": "버전: %d, 개수: %d\n\n",
+		"\nConflict in %s\n":         "\n%s 충돌\n",
+		"  base:   %s\n":             "  기준:   %s\n",
+		"  ours:   %s\n":             "  로컬:   %s\n",
+		"  theirs: %s\n":             "  가져옴: %s\n",
+		"Invalid value: %v\n":        "잘못된 값: %v\n",
+		"Appended %d records to %s":  "%d개의 레코드를 %s 파일에 추가했습니다",
+		"Type IDs must match a troop type the engine defines (K2TroopDef.h)":                               "타입 ID는 엔진에 정의된 부대 타입(K2TroopDef.h)과 일치해야 합니다",
+		"The game only knows the %d retail troop types; appended records may be ignored or crash missions": "게임은 %d개의 기본 부대 타입만 알고 있습니다. 추가된 레코드는 무시되거나 미션이 중단될 수 있습니다",
+		"Disabled %s": "%s 비활성화됨",
+		"Zeroed records may crash the game when %s is deployed": "%s 부대를 배치하면 0으로 채운 레코드 때문에 게임이 중단될 수 있습니다",
+		"Moved %s from %d to %d":                                "%s 부대를 %d에서 %d(으)로 이동했습니다",
+		"Saved variant %s":                                      "%s 변형을 저장했습니다",
+		"Installed variant %s":                                  "%s 변형을 설치했습니다",
+		"Wrote %s":                                              "%s 파일을 썼습니다",
+		"Balance risk: %d changes above %.0f%%, %d outside the vanilla range\n": "밸런스 위험: %.0[2]f%% 이상 변경 %[1]d개, 기본 범위 밖 %[3]d개\n",
+		"Serving %s on http://%s":                                      "%s 파일을 http://%s 에서 제공합니다",
+		"Session requests have to carry the header %s: %s":             "세션 요청에는 %s 헤더가 있어야 합니다: %s",
+		"Exported %d fingerprints to %s":                               "지문 %d개를 %s 파일로 내보냈습니다",
+		"Imported %d new fingerprints":                                 "새 지문 %d개를 가져왔습니다",
+		"Recorded %d fingerprints; share them with fingerprint export": "지문 %d개를 기록했습니다. fingerprint export로 공유하세요",
+		"Saved backup %s":                                              "%s 백업을 저장했습니다",
+		"Apply these changes? [y/N] ":                                  "이 변경 사항을 적용하시겠습니까? [y/N] ",
+		"Couldn't record the sync state":                               "동기화 상태를 기록할 수 없습니다",
+		"No changes":                                                   "변경 사항 없음",
+		"%s: 1 field changed":                                          "%s: 필드 1개 변경됨",
+		"%s: %d fields changed":                                        "%s: 필드 %d개 변경됨",
+		"Fixed %s":                                                     "수정됨: %s",
+		"%s; the engine may not render it and missions may crash":      "%s. 엔진이 제대로 표시하지 못하거나 미션이 중단될 수 있습니다",
+		"Ignoring field aliases in the configuration":                  "설정의 필드 별칭 무시",
+		"Ignoring alias %q of unknown field %q":                        "알 수 없는 필드 %[2]q의 별칭 %[1]q 무시",
+		"Checked out session %s":                                       "세션 %s 체크아웃",
+		"Committed session %s":                                         "세션 %s 커밋",
+		"Skipping damaged history entry":                               "손상된 기록 항목 건너뜀",
+		"Couldn't record the operation in the history":                 "작업을 기록하지 못했습니다",
+		"Ignoring unit conversions in the configuration":               "설정의 단위 변환 무시",
+		"Ignoring unit %q without a factor":                            "배율이 없는 단위 %q 무시",
+		"lowest %s highest value of each field":                        "각 필드의 최저값 %s 최고값",
+		"Backup %s has no checksums and can't be verified":             "%s 백업에 체크섬이 없어 검증할 수 없습니다",
+		"%s: record %d (%s) doesn't match its checksum":                "%s: 레코드 %d (%s)가 체크섬과 일치하지 않습니다",
+		"Backup %s is intact":                                          "%s 백업이 온전합니다",
+		"Restored %s":                                                  "%s 복원됨",
+		"Ignoring the game directory in the configuration":             "설정의 게임 디렉터리를 무시합니다",
+		"The configuration is valid":                                   "설정이 올바릅니다",
+		"Found the game at %s\nPress Enter to use it, or type another game directory: ": "%s에서 게임을 찾았습니다\n사용하려면 Enter를 누르거나 다른 게임 디렉터리를 입력하세요: ",
+		"Game directory (the folder holding Data\\SOX): ":                               "게임 디렉터리 (Data\\SOX가 있는 폴더): ",
+		"%s has no %s\n": "%s에 %s이(가) 없습니다\n",
+		"Ignoring the diff settings in the configuration":                                   "설정의 비교 설정을 무시합니다",
+		"1 float value is equivalent within a tolerance of %g (-tolerance 0 lists it)":      "실수 값 1개가 허용 오차 %g 안에서 같습니다 (-tolerance 0으로 표시)",
+		"%d float values are equivalent within a tolerance of %g (-tolerance 0 lists them)": "실수 값 %d개가 허용 오차 %g 안에서 같습니다 (-tolerance 0으로 표시)",
+		"(ignored)":     "(무시됨)",
+		"(ignored: %s)": "(무시됨: %s)",
+		"1 ignored difference (-show-ignored lists it)":                                                               "무시된 차이 1개 (-show-ignored로 표시)",
+		"%d ignored differences (-show-ignored lists them)":                                                           "무시된 차이 %d개 (-show-ignored로 표시)",
+		"No official patches are known; add them to the patches file in the configuration directory or pass -patches": "알려진 공식 패치가 없습니다. 설정 디렉터리의 패치 파일에 추가하거나 -patches를 지정하세요",
+		"No official balance fixes are reverted":                                                                      "되돌려진 공식 밸런스 수정이 없습니다",
+		"start":                                                                                                       "시작",
+		"Wrote %s (%s)":                                                                                               "%s 작성 완료 (%s)",
+		"Skipping %s: unsupported data file %s":                                                                       "%s 건너뜀: 지원하지 않는 데이터 파일 %s",
+		"Nothing known depends on %s":                                                                                 "%s에 의존하는 것으로 알려진 항목이 없습니다",
+		"stronger":                                                                                                    "강하게",
+		"weaker":                                                                                                      "약하게",
+		"%s %g%% %s against %s (%s)":                                                                                  "%[4]s 상대로 %[1]s %[2]g%% %[3]s (%[5]s)",
+		"The edit also changes %d other matchups, e.g. %s":                                                            "이 수정은 다른 대결 %d개도 바꿉니다. 예: %s",
+		"Which troop should change?":                                                                                  "어떤 부대를 바꿀까요?",
+		"Against which troop?":                                                                                        "어떤 부대를 상대로?",
+		"With which attack type (%s)?":                                                                                "어떤 공격 유형으로 (%s)?",
+		"By how many percent (negative for weaker)?":                                                                  "몇 퍼센트나 (약하게는 음수)?",
+		"Change the attacker's attack or the defender's resistance (attack, resist)?": "공격자의 공격력과 방어자의 저항 중 무엇을 바꿀까요 (attack, resist)?",
+		"Apply the edit to %s? (y/n)": "%s에 수정을 적용할까요? (y/n)",
+		"Nothing was changed":         "변경된 것이 없습니다",
+		"Wrote %s; check it for anything private before attaching it to an issue":                 "%s 작성 완료. 이슈에 첨부하기 전에 개인 정보가 없는지 확인하세요",
+		"-%s is deprecated; use troopinfo %s":                                                     "-%s 옵션은 더 이상 사용되지 않습니다. troopinfo %s를 사용하세요",
+		"Unknown command %q":                                                                      "알 수 없는 명령 %q",
+		"Usage: troopinfo <command> [flags]; troopinfo <command> -h lists the flags of a command": "사용법: troopinfo <명령> [옵션]. troopinfo <명령> -h로 명령의 옵션을 볼 수 있습니다",
+		"Deprecated flags:":   "더 이상 사용되지 않는 옵션:",
+		"Restored %s from %s": "%s를 %s에서 복원했습니다",
+		"%s (from %s) doesn't hold %s, directly or in Data/SOX":                                          "%s(%s에서 지정)에 %s 파일이 없습니다 (직접 또는 Data/SOX 안)",
+		"Every command takes -game-dir <dir>, which overrides %s and game_dir in the configuration file": "모든 명령은 -game-dir <디렉터리>를 받으며, %s와 설정 파일의 game_dir보다 우선합니다",
+		"Found the game in %s":                              "%s에서 게임을 찾았습니다",
+		"Ignoring %s":                                       "%s 무시",
+		"Added %s as troop %d, a copy of %s":                "%[3]s의 복사본으로 %[1]s을(를) %[2]d번 부대로 추가했습니다",
+		"%s isn't a retail troop and has no vanilla values": "%s은(는) 정식 부대가 아니어서 기본값이 없습니다",
+		"Leaving out %s, which the original file doesn't have; add it with troop add": "원본 파일에 없는 %s은(는) 제외합니다. troop add로 추가하세요",
+		"Wrote %s with %d changed fields":                                             "변경된 필드 %[2]d개를 %[1]s에 기록했습니다",
+		"The patch was made for version %d of %s, the installed file is version %d":   "패치는 %[2]s 버전 %[1]d용이지만 설치된 파일은 버전 %[3]d입니다",
+		"Changed by another mod: %s":                                                  "다른 모드가 변경함: %s",
+		"%s is %s, the patch expects %s":                                              "%s 값이 %s이지만 패치는 %s을(를) 기대합니다",
+		"%s %s was made for version %d of %s, the installed file is version %d":       "%s %s은(는) %[4]s 버전 %[3]d용이지만 설치된 파일은 버전 %[5]d입니다",
+		"Installed %s %s":           "%s %s 설치됨",
+		"Author: %s":                "제작자: %s",
+		"Made for version %d of %s": "%[2]s 버전 %[1]d용",
+		"Overrides: %s":             "덮어쓰는 파일: %s",
+		"%s and %s both change %s; %[2]s is loaded later and wins": "%s와(과) %s 모두 %s을(를) 변경합니다. 나중에 로드되는 %[2]s이(가) 우선합니다",
+		"No mods are installed":                             "설치된 모드가 없습니다",
+		"Uninstalled %s %s":                                 "%s %s 제거됨",
+		"\nours: %s, theirs: %s\n":                          "\n로컬: %s, 가져옴: %s\n",
+		"%s: %s of an earlier file is overridden with %s":   "%s: 앞 파일의 %s 값을 %s(으)로 덮어씁니다",
+		"Couldn't prune old backups":                        "오래된 백업을 정리하지 못했습니다",
+		"Deleted backup %s":                                 "백업 %s 삭제됨",
+		"Ignoring the backup settings in the configuration": "설정의 백업 설정을 무시합니다",
+		"Couldn't prune the history":                        "기록을 정리하지 못했습니다",
+		"Dropped %d history entries":                        "기록 항목 %d개를 삭제했습니다",
+		"No backups to restore":                             "복원할 백업이 없습니다",
+		"unreadable: %v":                                    "읽을 수 없음: %v",
+		"same as installed":                                 "설치된 파일과 같음",
+		"%d fields differ":                                  "필드 %d개 다름",
+		"1 field differs":                                   "필드 1개 다름",
+		"Commands refuse to write the game files while the game is running or the data fails validation; troopinfo -force <command> writes anyway": "게임이 실행 중이거나 데이터가 검증에 실패하면 게임 파일을 쓰지 않습니다. troopinfo -force <명령>으로 강제로 쓸 수 있습니다",
+		"Ignoring the validation settings in the configuration":        "설정 파일의 검증 설정을 무시합니다",
+		"Writing despite %d validation errors, since -force was given": "-force가 지정되어 검증 오류 %d개를 무시하고 씁니다",
+		"No validation errors": "검증 오류가 없습니다",
+		"Ignoring severity %q of validation rule %s; expected error, warning or off":                   "검증 규칙 %[2]s의 심각도 %[1]q를 무시합니다. error, warning 또는 off여야 합니다",
+		"Ignoring the ID names in the configuration":                                                   "설정 파일의 ID 이름을 무시합니다",
+		"Ignoring skill name %q, which is a number":                                                    "숫자인 스킬 이름 %q를 무시합니다",
+		"Ignoring %s entry %q, which names no troop; use a record index or a troop key such as knight": "부대를 가리키지 않는 %s 항목 %q를 무시합니다. 레코드 번호나 knight 같은 부대 키를 사용하세요",
+		"%s doesn't exist, so there is nothing to sync":                                                "%s 파일이 없어 동기화할 것이 없습니다",
+		"Unsaved changes to %d fields; press q again to quit without saving, or s to save":             "%d개 필드의 변경 사항이 저장되지 않았습니다. 저장하지 않고 종료하려면 q를 다시, 저장하려면 s를 누르세요",
+		"No unsaved changes": "저장하지 않은 변경 사항이 없습니다",
+		"Wrote %s; %d validation errors will stop apply, see troopinfo validate":        "%s 파일을 썼습니다. 검증 오류 %d개 때문에 apply가 중단됩니다. troopinfo validate를 확인하세요",
+		"↑↓ move  Tab switch pane  Enter edit  v vanilla value  d diff  s save  q quit": "↑↓ 이동  Tab 창 전환  Enter 편집  v 원본 값  d 차이  s 저장  q 종료",
+		"The terminal is too small":         "터미널이 너무 작습니다",
+		"Field":                             "필드",
+		"Value":                             "값",
+		"Vanilla":                           "원본",
+		"Unsaved changes (any key returns)": "저장하지 않은 변경 사항 (아무 키나 누르면 돌아갑니다)",
+		"The editor is at %s; press Ctrl+C to stop it":              "편집기 주소는 %s입니다. 중지하려면 Ctrl+C를 누르세요",
+		"Couldn't open the browser; open %s yourself":               "브라우저를 열 수 없습니다. %s 주소를 직접 여세요",
+		"Watching %s; press Ctrl+C to stop":                         "%s 파일을 지켜보는 중입니다. 중지하려면 Ctrl+C를 누르세요",
+		"The game is running; %s will be written once it exits":     "게임이 실행 중입니다. 게임이 종료되면 %s 파일을 씁니다",
+		"Not applied; fix %s and save it again":                     "적용하지 않았습니다. %s 파일을 고친 뒤 다시 저장하세요",
+		"Watching %s failed":                                        "%s 파일 감시에 실패했습니다",
+		"%s matches the installed %s":                               "%s 파일이 설치된 %s 파일과 같습니다",
+		"Keep [o]urs, take [t]heirs, use [b]ase, or type a value: ": "[o] 로컬 값 유지, [t] 가져온 값 사용, [b] 기준 값 사용, 또는 값 입력: ",
+	},
+}
+
+// catalog is the active translation, nil for English.
+var catalog map[string]string
+
+// tr returns the translation of the format string msg with args applied.
+func tr(msg string, args ...interface{}) string {
+	if t, ok := catalog[msg]; ok {
+		msg = t
+	}
+
+	if len(args) == 0 {
+		return msg
+	}
+
+	return fmt.Sprintf(msg, args...)
+}
+
+// setupLanguage selects the message language from KUFTC_LANG or the usual
+// locale environment variables. Community translations are read from
+// <config dir>/kuftc/locales/<lang>.yaml, a mapping of English messages to
+// their translation, and take precedence over the built-in ones.
+func setupLanguage() {
+	lang := detectLanguage()
+	if lang == "" || lang == "en" {
+		return
+	}
+
+	catalog = map[string]string{}
+
+	for k, v := range catalogs[lang] {
+		catalog[k] = v
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "kuftc", "locales", lang+".yaml"))
+	if os.IsNotExist(err) {
+		return
+	}
+
+	community := map[string]string{}
+
+	if err == nil {
+		err = yaml.Unmarshal(data, &community)
+	}
+
+	if err != nil {
+		log.Warn().
+			Err(err).
+			Msg(tr("Ignoring %s translations", lang))
+		return
+	}
+
+	for k, v := range community {
+		catalog[k] = v
+	}
+}
+
+// detectLanguage returns the two-letter language code of the user's locale.
+func detectLanguage() string {
+	for _, env := range []string{"KUFTC_LANG", "LC_ALL", "LC_MESSAGES", "LANG"} {
+		if value := os.Getenv(env); value != "" {
+			lang := strings.ToLower(value)
+			if i := strings.IndexAny(lang, "-_."); i >= 0 {
+				lang = lang[:i]
+			}
+
+			return lang
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// trailerField names the trailer of a SOX file in diffs and ignore rules.
+// It isn't a record field, so only diff reports it; see trailerChanges.
+const trailerField = "trailer"
+
+// ignoreRule suppresses known-noisy differences in diff output, e.g.
+//
+//	ignore:
+//	  - fields: [trailer]
+//	    reason: rewritten by the 1.02 patcher
+//	  - troops: ["Dark Elves *"]
+//	    fields: [sight_range]
+//	    reason: differs between the Korean and English releases
+//
+// Troops and Fields are patterns where * matches any part of a name; an empty
+// list matches everything, so each rule needs at least one of them. File
+// limits the rule to one data file.
+type ignoreRule struct {
+	File   string   `yaml:"file,omitempty"`
+	Troops []string `yaml:"troops,omitempty"`
+	Fields []string `yaml:"fields,omitempty"`
+	Reason string   `yaml:"reason,omitempty"`
+}
+
+// ignoreRules are the rules of the configuration file.
+var ignoreRules []ignoreRule
+
+// loadDiffSettings reads the ignore rules and float tolerance of the
+// configuration file.
+func loadDiffSettings() {
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Debug().
+			Err(err).
+			Msg(tr("Ignoring the diff settings in the configuration"))
+		return
+	}
+
+	ignoreRules = cfg.Ignore
+	floatTolerance = cfg.FloatTolerance
+}
+
+// matches reports whether the rule suppresses c, a change in the data file
+// named file.
+func (r ignoreRule) matches(file string, c fieldChange) bool {
+	if r.File != "" && !strings.EqualFold(strings.TrimSuffix(r.File, ".sox"), strings.TrimSuffix(file, ".sox")) {
+		return false
+	}
+
+	return matchAny(r.Troops, c.Record) && matchAny(r.Fields, c.Field)
+}
+
+func matchAny(patterns []string, name string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	for _, p := range patterns {
+		if matchPattern(resolveFieldName(p), name) || matchPattern(p, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ignoredBy returns the first rule suppressing c, if any.
+func ignoredBy(file string, c fieldChange) (ignoreRule, bool) {
+	for _, r := range ignoreRules {
+		if r.matches(file, c) {
+			return r, true
+		}
+	}
+
+	return ignoreRule{}, false
+}
+
+// filterIgnored splits changes into those to show and the number suppressed
+// by the ignore rules.
+func filterIgnored(file string, changes []fieldChange) ([]fieldChange, int) {
+	var kept []fieldChange
+
+	for _, c := range changes {
+		if _, ok := ignoredBy(file, c); !ok {
+			kept = append(kept, c)
+		}
+	}
+
+	return kept, len(changes) - len(kept)
+}
+
+// formatChange prints c, marking it if an ignore rule would have suppressed
+// it.
+func formatChange(file string, c fieldChange) string {
+	r, ok := ignoredBy(file, c)
+	if !ok {
+		return c.String()
+	}
+
+	if r.Reason == "" {
+		return c.String() + " " + tr("(ignored)")
+	}
+
+	return c.String() + " " + tr("(ignored: %s)", r.Reason)
+}
+
+func printIgnoredNote(n int) {
+	if n == 1 {
+		fmt.Println(tr("1 ignored difference (-show-ignored lists it)"))
+	} else if n > 1 {
+		fmt.Println(tr("%d ignored differences (-show-ignored lists them)", n))
+	}
+}
+
+// validate reports problems with the rule, for config.validate.
+func (r ignoreRule) validate() []string {
+	if len(r.Troops) == 0 && len(r.Fields) == 0 {
+		return []string{"needs troops or fields"}
+	}
+
+	var problems []string
+
+	for _, p := range r.Fields {
+		if p == trailerField {
+			continue
+		}
+
+		if !matchesAnyField(p) {
+			problems = append(problems, fmt.Sprintf("no field matches %q", p))
+		}
+	}
+
+	return problems
+}
+
+func matchesAnyField(pattern string) bool {
+	for _, f := range troopFields {
+		if matchPattern(resolveFieldName(pattern), f.Name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// trailerChanges reports a difference between the trailers of a and b as a
+// change of trailerField, with both trailers in hex.
+func trailerChanges(a, b troopInfoSOX) []fieldChange {
+	if a.TheEnd == b.TheEnd {
+		return nil
+	}
+
+	return []fieldChange{{
+		Record: troopInfoFile.Name,
+		Field:  trailerField,
+		Old:    hex.EncodeToString(a.TheEnd[:]),
+		New:    hex.EncodeToString(b.TheEnd[:]),
+	}}
+}
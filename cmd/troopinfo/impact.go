@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// fieldRelation is a known dependency between troop fields, or between
+// fields and data the tool doesn't edit: a change to a field matching Fields
+// may call for a change to each of Affects. Affects entries matching a field
+// are followed transitively by impact; anything else is named as is.
+type fieldRelation struct {
+	Fields  []string
+	Affects []string
+	Why     string
+}
+
+// fieldRelations are the relationships known to the community. They are
+// deliberately conservative: each one is either enforced by the engine or
+// used by one of the tool's models.
+var fieldRelations = []fieldRelation{
+	{
+		Fields:  []string{"attack_range_max"},
+		Affects: []string{"attack_range_min", "attack_front_range"},
+		Why:     "ranged and frontal ranges are expected to lie within the maximum attack range",
+	},
+	{
+		Fields:  []string{"attack_range_*"},
+		Affects: []string{"sight_range"},
+		Why:     "troops don't engage targets beyond their sight range",
+	},
+	{
+		Fields:  []string{"attack_range_*", "attack_front_range"},
+		Affects: []string{"projectile speeds in the projectile data (not decoded by this tool)"},
+		Why:     "projectiles have to reach the new range before they expire",
+	},
+	{
+		Fields:  []string{"move_speed"},
+		Affects: []string{"move_acceleration", "move_deceleration", "max_unit_speed_multiplier"},
+		Why:     "acceleration and unit speed scale with the troop's speed",
+	},
+	{
+		Fields:  []string{"default_unit_num_x", "default_unit_num_y", "base_width"},
+		Affects: []string{"formation_random", "unit caps of the configuration (unit_caps)"},
+		Why:     "the formation has to fit its units; the engine crashes past the retail caps",
+	},
+	{
+		Fields:  []string{"default_unit_num_x", "default_unit_num_y"},
+		Affects: []string{"damage model (calc, tierlist)"},
+		Why:     "troop damage and HP are per unit times the number of units",
+	},
+	{
+		Fields:  []string{"direct_attack", "indirect_attack", "defense", "resist_*", "default_unit_hp"},
+		Affects: []string{"damage model (calc, tierlist)"},
+		Why:     "used by the damage formula",
+	},
+	{
+		Fields:  []string{"default_unit_hp"},
+		Affects: []string{"unit_hp_lev_up"},
+		Why:     "HP gained per level is usually kept proportional to the base HP",
+	},
+	{
+		Fields:  []string{"level_up_data[*].skill_id"},
+		Affects: []string{"SkillInfo IDs referenced by the campaign"},
+		Why:     "skill IDs must exist in the skill table",
+	},
+	{
+		Fields:  []string{"job", "type_id"},
+		Affects: []string{"campaign scripts"},
+		Why:     "scripts refer to troops by job and type",
+	},
+}
+
+// impact is one thing potentially affected by changing a field.
+type impact struct {
+	Depth  int
+	Target string
+	Via    string // field whose relation led here
+	Why    string
+}
+
+// analyzeImpact follows fieldRelations from the fields matching pattern, up
+// to depth relations away. Each target is reported once, at its shortest
+// distance.
+func analyzeImpact(pattern string, depth int) ([]impact, error) {
+	var frontier []string
+
+	for _, f := range troopFields {
+		if matchPattern(resolveFieldName(pattern), f.Name) {
+			frontier = append(frontier, f.Name)
+		}
+	}
+
+	if len(frontier) == 0 {
+		return nil, fmt.Errorf("no field matches %q", pattern)
+	}
+
+	seen := map[string]bool{}
+	for _, name := range frontier {
+		seen[name] = true
+	}
+
+	var impacts []impact
+
+	for d := 1; d <= depth && len(frontier) > 0; d++ {
+		var next []string
+
+		for _, name := range frontier {
+			for _, r := range fieldRelations {
+				if !matchAny(r.Fields, name) {
+					continue
+				}
+
+				for _, target := range r.Affects {
+					for _, t := range expandTarget(target) {
+						if seen[t] {
+							continue
+						}
+
+						seen[t] = true
+						impacts = append(impacts, impact{Depth: d, Target: t, Via: name, Why: r.Why})
+
+						if _, ok := lookupFieldName(t); ok {
+							next = append(next, t)
+						}
+					}
+				}
+			}
+		}
+
+		frontier = next
+	}
+
+	return impacts, nil
+}
+
+// expandTarget returns the fields matching target, or target itself if it
+// isn't a field pattern.
+func expandTarget(target string) []string {
+	var fields []string
+
+	for _, f := range troopFields {
+		if matchPattern(target, f.Name) {
+			fields = append(fields, f.Name)
+		}
+	}
+
+	if len(fields) == 0 {
+		return []string{target}
+	}
+
+	return fields
+}
+
+func runImpact(args []string) error {
+	fs := newFlagSet("impact")
+	depth := fs.Int("depth", 2, "How many relations to follow from the changed field")
+
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+	} else if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return errors.New("expected a field, e.g. impact attack_range_max")
+	}
+
+	impacts, err := analyzeImpact(args[0], *depth)
+	if err != nil {
+		return err
+	}
+
+	if len(impacts) == 0 {
+		fmt.Println(tr("Nothing known depends on %s", args[0]))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DEPTH\tAFFECTS\tVIA\tWHY")
+
+	for _, i := range impacts {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", i.Depth, i.Target, i.Via, i.Why)
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// soxEndMarker starts the trailer of the retail SOX files.
+var soxEndMarker = []byte("THEEND")
+
+func runInfer(args []string) error {
+	fs := newFlagSet("infer")
+	out := fs.String("o", "", "Schema document to write instead of printing it")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		return errors.New("expected a SOX file, e.g. infer UnitInfo.sox")
+	}
+
+	path := fs.Arg(0)
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	s, err := inferSchema(filepath.Base(path), data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	buf := &bytes.Buffer{}
+
+	enc := yaml.NewEncoder(buf)
+	enc.SetIndent(yamlIndent)
+
+	if err := enc.Encode(s); err != nil {
+		return err
+	}
+
+	if err := enc.Close(); err != nil {
+		return err
+	}
+
+	if *out == "" {
+		_, err := os.Stdout.Write(buf.Bytes())
+		return err
+	}
+
+	if err := ioutil.WriteFile(*out, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+
+	log.Info().Msg(tr("Wrote %s", *out))
+
+	return nil
+}
+
+// inferSchema guesses the layout of the SOX file name holding data: the record
+// size follows from the count in the header and the trailer, and every 4-byte
+// column of the records is typed int32 or float32 depending on which reading
+// of its values looks more plausible. The result is a draft to be checked
+// against the game and renamed field by field, not a mapping.
+func inferSchema(name string, data []byte) (schemaDocument, error) {
+	var s schemaDocument
+
+	if len(data) < 8 {
+		return s, errInvalidSOX
+	}
+
+	count := int(int32(binary.LittleEndian.Uint32(data[4:8])))
+	if count <= 0 {
+		return s, fmt.Errorf("%w: the header claims %d records", errInvalidSOX, count)
+	}
+
+	trailer, ok := inferTrailerSize(data, count)
+	if !ok {
+		return s, fmt.Errorf("%w: %d bytes can't hold %d records and a trailer", errInvalidSOX, len(data), count)
+	}
+
+	size := (len(data) - 8 - trailer) / count
+	records := data[8 : len(data)-trailer]
+
+	s.File = name
+	s.Doc = fmt.Sprintf("Draft inferred from %s: %d records of %d bytes. Check every field against the game before relying on it.", name, count, size)
+
+	if trailer != soxTrailerSize {
+		s.Trailer = &trailer
+	}
+
+	offset := 0
+
+	for ; offset+4 <= size; offset += 4 {
+		typ := inferColumnType(records, size, offset)
+		s.Fields = append(s.Fields, schemaField{
+			Name: fmt.Sprintf("field_%02x", offset),
+			Type: typ,
+			Doc:  describeColumn(records, size, offset, typ),
+		})
+	}
+
+	for ; offset < size; offset++ {
+		s.Fields = append(s.Fields, schemaField{
+			Name: fmt.Sprintf("field_%02x", offset),
+			Type: "uint8",
+			Doc:  describeColumn(records, size, offset, "uint8"),
+		})
+	}
+
+	return s, nil
+}
+
+// inferTrailerSize returns the size of the trailer following count records in
+// data. The retail files end in a 64-byte trailer starting with THEEND, so the
+// marker is looked for first, then the usual size, then no trailer at all;
+// failing that, the smallest trailer leaving room for whole 4-byte aligned
+// records is assumed.
+func inferTrailerSize(data []byte, count int) (int, bool) {
+	payload := len(data) - 8
+
+	fits := func(trailer int) bool {
+		return trailer >= 0 && trailer < payload && (payload-trailer)%count == 0
+	}
+
+	if i := bytes.LastIndex(data, soxEndMarker); i >= 8 && fits(len(data)-i) {
+		return len(data) - i, true
+	}
+
+	for _, trailer := range []int{soxTrailerSize, 0} {
+		if fits(trailer) && (payload-trailer)/count%4 == 0 {
+			return trailer, true
+		}
+	}
+
+	for trailer := 0; trailer < payload; trailer++ {
+		if fits(trailer) && (payload-trailer)/count%4 == 0 {
+			return trailer, true
+		}
+	}
+
+	return 0, false
+}
+
+// inferColumnType votes on the type of the 4-byte column at offset of the
+// records: small integers like IDs, counts and flags read as tiny denormal
+// floats, while everyday floats read as integers in the hundreds of millions.
+// Columns that are all zero or look like neither stay int32.
+func inferColumnType(records []byte, size, offset int) string {
+	var ints, floats int
+
+	for i := offset; i+4 <= len(records); i += size {
+		bits := binary.LittleEndian.Uint32(records[i:])
+		if bits == 0 {
+			continue
+		}
+
+		if n := int32(bits); n > -1<<20 && n < 1<<20 {
+			ints++
+		}
+
+		f := math.Abs(float64(math.Float32frombits(bits)))
+		if !math.IsNaN(f) && !math.IsInf(f, 0) && f >= 1e-6 && f <= 1e9 {
+			floats++
+		}
+	}
+
+	if floats > ints {
+		return "float32"
+	}
+
+	return "int32"
+}
+
+// describeColumn summarizes the values of the column at offset of the records
+// read as typ, to help tell what the field is.
+func describeColumn(records []byte, size, offset int, typ string) string {
+	n := schemaTypes[typ]
+
+	var lo, hi float64
+	var loText, hiText string
+
+	for i := offset; i+n <= len(records); i += size {
+		b := records[i : i+n]
+
+		var v float64
+
+		switch typ {
+		case "float32":
+			v = float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+		case "int32":
+			v = float64(int32(binary.LittleEndian.Uint32(b)))
+		default:
+			v = float64(b[0])
+		}
+
+		if loText == "" || v < lo {
+			lo, loText = v, formatSchemaValue(typ, b)
+		}
+
+		if hiText == "" || v > hi {
+			hi, hiText = v, formatSchemaValue(typ, b)
+		}
+	}
+
+	if loText == hiText {
+		return "always " + loText
+	}
+
+	return loText + " to " + hiText
+}
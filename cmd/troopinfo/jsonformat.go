@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// TroopInfo.json holds the same document as TroopInfo.yaml, for web tools
+// and jq pipelines. Since YAML is a superset of JSON, it is read by the YAML
+// decoder once it has been checked to be valid JSON.
+const (
+	formatYAML = "yaml"
+	formatJSON = "json"
+)
+
+var troopInfoJSONPath = filepath.Join(soxDir, "TroopInfo.json")
+
+// dataFormat returns the format of the workspace file at path: format if
+// given, or else the one its extension names.
+func dataFormat(format, path string) (string, error) {
+	switch strings.ToLower(format) {
+	case formatYAML, "yml":
+		return formatYAML, nil
+	case formatJSON:
+		return formatJSON, nil
+	case "":
+		if strings.EqualFold(filepath.Ext(path), ".json") {
+			return formatJSON, nil
+		}
+
+		return formatYAML, nil
+	default:
+		return "", fmt.Errorf("unknown format %q, expected yaml or json", format)
+	}
+}
+
+// troopInfoJSON is the JSON form of a TroopInfo.yaml document.
+type troopInfoJSON struct {
+	Version int32      `json:"version"`
+	Count   int32      `json:"count"`
+	Troops  troopsJSON `json:"troops"`
+}
+
+// troopsJSON encodes the records as an object keyed by troop, in record
+// order.
+type troopsJSON []troopInfo
+
+func (t troopsJSON) MarshalJSON() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+
+	roster := newTroopRoster(troopInfoSOX{TroopInfos: t})
+
+	for i := range t {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		key, err := json.Marshal(roster.key(i))
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := json.Marshal(t[i])
+		if err != nil {
+			return nil, err
+		}
+
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+// writeTroopInfoJSON writes tis to path as JSON, keyed by troop.
+func writeTroopInfoJSON(path string, tis troopInfoSOX) error {
+	data, err := json.MarshalIndent(troopInfoJSON{
+		Version: tis.Version,
+		Count:   tis.Count,
+		Troops:  troopsJSON(tis.TroopInfos),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, append(data, '\n'), 0600)
+}
+
+// checkJSONFile reports syntax errors in the JSON file at path with their
+// line, which the YAML decoder reading it afterwards wouldn't.
+func checkJSONFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var v interface{}
+
+	err = json.Unmarshal(data, &v)
+
+	var se *json.SyntaxError
+	if errors.As(err, &se) {
+		return &yamlError{
+			Path:   path,
+			Line:   bytes.Count(data[:se.Offset], []byte("\n")) + 1,
+			Msg:    "invalid JSON: " + se.Error(),
+			source: data,
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	if _, ok := v.(map[string]interface{}); !ok {
+		return &yamlError{Path: path, Msg: "file is not a JSON object", Expected: "version, count and troops", source: data}
+	}
+
+	return nil
+}
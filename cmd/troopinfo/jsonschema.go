@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// jsonSchemaDraft is the JSON Schema version of the generated schemas, the
+// one editors such as VS Code's YAML language server support best.
+const jsonSchemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// jsonSchema is a JSON Schema, as far as the YAML files of the tool need
+// one.
+type jsonSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Ref                  string                 `json:"$ref,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Type                 interface{}            `json:"type,omitempty"` // a type name or a list of them
+	Enum                 []string               `json:"enum,omitempty"`
+	AnyOf                []*jsonSchema          `json:"anyOf,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+	Minimum              *float64               `json:"minimum,omitempty"`
+	Maximum              *float64               `json:"maximum,omitempty"`
+	Items                *jsonSchema            `json:"items,omitempty"`
+	MinItems             *int                   `json:"minItems,omitempty"`
+	MaxItems             *int                   `json:"maxItems,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	AdditionalProperties interface{}            `json:"additionalProperties,omitempty"` // false or a schema
+	Deprecated           bool                   `json:"deprecated,omitempty"`
+	Definitions          map[string]*jsonSchema `json:"definitions,omitempty"`
+}
+
+// yamlDocument is a kind of YAML file the tool reads, for which a JSON
+// Schema can be generated.
+type yamlDocument struct {
+	Name   string // e.g. "TroopInfo.yaml"
+	Alias  string // short name for the command line
+	schema func(version int32) *jsonSchema
+}
+
+var yamlDocuments = []yamlDocument{
+	{Name: "TroopInfo.yaml", Alias: "troopinfo", schema: troopInfoJSONSchema},
+	{Name: "config.yaml", Alias: "config", schema: func(int32) *jsonSchema { return reflectJSONSchema(reflect.TypeOf(config{}), false) }},
+	{Name: "delta.yaml", Alias: "delta", schema: deltaJSONSchema},
+	{Name: modManifestName, Alias: "manifest", schema: func(int32) *jsonSchema { return reflectJSONSchema(reflect.TypeOf(modManifest{}), false) }},
+}
+
+// lookupYAMLDocument finds a YAML document kind by its file name or alias,
+// ignoring case. Data file names such as TroopInfo.sox match the YAML file
+// they are dumped to.
+func lookupYAMLDocument(name string) (yamlDocument, bool) {
+	base := strings.TrimSuffix(name, ".sox")
+
+	for _, d := range yamlDocuments {
+		if strings.EqualFold(name, d.Name) || strings.EqualFold(base, d.Alias) {
+			return d, true
+		}
+	}
+
+	return yamlDocument{}, false
+}
+
+// troopInfoJSONSchema describes TroopInfo.yaml files of the given version:
+// the troops keyed by their troop keys, every field optional so partial
+// files and mod overrides validate too.
+func troopInfoJSONSchema(version int32) *jsonSchema {
+	held := map[string]bool{}
+	for _, f := range troopInfoFile.schemaFor(version).Fields {
+		held[strings.FieldsFunc(f.Name, func(r rune) bool { return r == '.' || r == '[' })[0]] = true
+	}
+
+	troop := reflectJSONSchema(troopInfoFile.Record, true)
+	for name := range troop.Properties {
+		if !held[name] {
+			delete(troop.Properties, name)
+		}
+	}
+
+	nameIDs(troop, "")
+
+	ref := "#/definitions/troop"
+
+	troops := &jsonSchema{
+		Type:                 "object",
+		Description:          "troops keyed by their troop key; other troops, such as added ones, are keyed troop_<index>",
+		Properties:           map[string]*jsonSchema{},
+		AdditionalProperties: &jsonSchema{Ref: ref},
+	}
+
+	for i := range defaultTroopNames {
+		troops.Properties[troopKey(i)] = &jsonSchema{Ref: ref, Description: troopName(i)}
+	}
+
+	s := reflectJSONSchema(reflect.TypeOf(troopInfoSOX{}), false)
+	s.Title = fmt.Sprintf("TroopInfo.yaml version %d", version)
+	s.Properties[troopsKey] = troops
+	s.Properties[legacyTroopsKey] = &jsonSchema{
+		Type:        "array",
+		Description: "troops by index, as written before troops were keyed",
+		Items:       &jsonSchema{Ref: ref},
+		Deprecated:  true,
+	}
+	s.Properties[partialKey] = &jsonSchema{
+		Type:        "boolean",
+		Description: "the file leaves troops out on purpose; those keep their installed values",
+	}
+	s.AdditionalProperties = false
+	s.Definitions = map[string]*jsonSchema{"troop": troop}
+
+	return s
+}
+
+// nameIDs lets the properties of s with a symbol table, such as job, hold
+// either a number or one of their names. prefix is the field name of s.
+func nameIDs(s *jsonSchema, prefix string) {
+	for name, p := range s.Properties {
+		field := prefix + name
+
+		if p.Items != nil && p.Items.Properties != nil {
+			nameIDs(p.Items, field+"[0].")
+			continue
+		}
+
+		t, ok := lookupSymbolTable(field)
+		if !ok || len(t.names) == 0 {
+			continue
+		}
+
+		number := *p
+		number.Type, number.Pattern, number.Description = "integer", "", ""
+
+		s.Properties[name] = &jsonSchema{
+			Description: p.Description,
+			AnyOf:       []*jsonSchema{&number, {Type: "string", Enum: t.Names()}},
+		}
+	}
+}
+
+// deltaJSONSchema describes delta files. The from and to values are field
+// values written as YAML numbers, which decode into the strings of a change.
+func deltaJSONSchema(int32) *jsonSchema {
+	s := reflectJSONSchema(reflect.TypeOf(deltaDocument{}), false)
+
+	change := s.Properties["changes"].Items
+	for _, name := range []string{"from", "to"} {
+		change.Properties[name].Type = []string{"number", "string"}
+	}
+
+	return s
+}
+
+// reflectJSONSchema describes values of t as decoded from YAML, using the
+// yaml tags for property names and the doc tags for descriptions. With
+// annotated, numbers may also be strings with a unit such as "75 %".
+func reflectJSONSchema(t reflect.Type, annotated bool) *jsonSchema {
+	s := &jsonSchema{}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		s.Type = "object"
+		s.Properties = map[string]*jsonSchema{}
+		s.AdditionalProperties = false
+
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+
+			name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+			if name == "-" || f.PkgPath != "" {
+				continue
+			}
+
+			if name == "" {
+				name = strings.ToLower(f.Name)
+			}
+
+			p := reflectJSONSchema(f.Type, annotated)
+			p.Description = f.Tag.Get("doc")
+			s.Properties[name] = p
+		}
+	case reflect.Array:
+		n := t.Len()
+		s.Type = "array"
+		s.Items = reflectJSONSchema(t.Elem(), annotated)
+		s.MinItems, s.MaxItems = &n, &n
+	case reflect.Slice:
+		s.Type = "array"
+		s.Items = reflectJSONSchema(t.Elem(), annotated)
+	case reflect.Map:
+		s.Type = "object"
+		s.AdditionalProperties = reflectJSONSchema(t.Elem(), annotated)
+	case reflect.String:
+		s.Type = "string"
+	case reflect.Bool:
+		s.Type = "boolean"
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
+		s.Type = "integer"
+
+		if bits := t.Bits(); bits < 64 {
+			min, max := -math.Pow(2, float64(bits-1)), math.Pow(2, float64(bits-1))-1
+			s.Minimum, s.Maximum = &min, &max
+		}
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uint:
+		s.Type = "integer"
+
+		min := 0.0
+		s.Minimum = &min
+
+		if bits := t.Bits(); bits < 64 {
+			max := math.Pow(2, float64(bits)) - 1
+			s.Maximum = &max
+		}
+	case reflect.Float32, reflect.Float64:
+		s.Type = "number"
+	}
+
+	if annotated && (s.Type == "integer" || s.Type == "number") {
+		s.Type = []string{s.Type.(string), "string"}
+		s.Pattern = annotatedValue.String()
+	}
+
+	return s
+}
+
+// exportJSONSchema writes the JSON Schema of a YAML document kind, for
+// editors to complete, check and document the files while they are edited.
+func exportJSONSchema(name string, version int32, out string) error {
+	d, ok := lookupYAMLDocument(name)
+	if !ok {
+		names := make([]string, len(yamlDocuments))
+		for i, d := range yamlDocuments {
+			names[i] = d.Alias
+		}
+
+		return fmt.Errorf("no JSON Schema for %q, expected one of %s", name, strings.Join(names, ", "))
+	}
+
+	s := d.schema(version)
+	s.Schema = jsonSchemaDraft
+
+	if s.Title == "" {
+		s.Title = d.Name
+	}
+
+	buf := &bytes.Buffer{}
+
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode(d.schema(version)); err != nil {
+		return err
+	}
+
+	data := buf.Bytes()
+
+	if out == "" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+
+	if err := ioutil.WriteFile(out, data, 0644); err != nil {
+		return err
+	}
+
+	log.Info().Msg(tr("Wrote %s", out))
+
+	return nil
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// levelUpEntries is the number of LevelUpData entries every troop has.
+var levelUpEntries = len(troopInfo{}.LevelUpData)
+
+var errLevelUpData = errors.New("invalid level_up_data")
+
+// levelUpProblem is a problem with the level_up_data of a troop. Problems
+// that fix can repair are marked fixable.
+type levelUpProblem struct {
+	yamlError
+	warning bool
+	fixable bool
+}
+
+func runLevelUp(args []string) error {
+	if len(args) == 0 || args[0] != "check" && args[0] != "fix" {
+		return errors.New("expected check or fix")
+	}
+
+	fs := newFlagSet("levelup " + args[0])
+	path := fs.String("f", troopInfoYAMLPath, "YAML file to check")
+	against := fs.String("against", sourceVanilla, "Data whose skill IDs are known to be valid")
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(*path)
+	if err != nil {
+		return err
+	}
+
+	var doc yaml.Node
+
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return newYAMLError(*path, data, err)
+	}
+
+	nodes, err := troopNodes(*path, data, &doc)
+	if err != nil {
+		return err
+	}
+
+	// Skill IDs the reference data uses are known to exist; anything else is
+	// only a warning since the SkillInfo table isn't decoded yet.
+	known := map[int64]bool{}
+
+	if ref, err := loadTroopSource(*against); err == nil {
+		for _, ti := range ref.TroopInfos {
+			for _, lud := range ti.LevelUpData {
+				known[int64(lud.SkillID)] = true
+			}
+		}
+	}
+
+	problems := checkLevelUpData(*path, data, nodes, known)
+
+	fix := args[0] == "fix"
+	if fix {
+		// Missing entries are filled in from the installed data, which is
+		// usually what a hand edit accidentally dropped.
+		base, _ := readTroopInfoSOX(troopInfoPath)
+
+		if err := fixLevelUpData(nodes, base); err != nil {
+			return err
+		}
+
+		out, err := encodeYAMLNode(&doc)
+		if err != nil {
+			return err
+		}
+
+		if err := ioutil.WriteFile(*path, out, 0600); err != nil {
+			return err
+		}
+	}
+
+	var errs int
+
+	for _, p := range problems {
+		switch {
+		case fix && p.fixable:
+			log.Info().Msg(tr("Fixed %s", p.Error()))
+		case p.warning:
+			log.Warn().Msg(p.Error())
+		default:
+			log.Error().Msg(p.Error())
+			errs++
+		}
+	}
+
+	if errs > 0 {
+		return fmt.Errorf("%w: %d problems", errLevelUpData, errs)
+	}
+
+	return nil
+}
+
+// checkLevelUpData checks that every troop has exactly three level_up_data
+// entries with non-negative skill IDs, known ones if known isn't empty, and
+// finite, non-negative skill_per_level values.
+func checkLevelUpData(path string, source []byte, nodes []troopNode, known map[int64]bool) []levelUpProblem {
+	var problems []levelUpProblem
+
+	problem := func(node *yaml.Node, msg, value, expected string) *levelUpProblem {
+		problems = append(problems, levelUpProblem{yamlError: yamlError{
+			Path:     path,
+			Line:     node.Line,
+			Column:   node.Column,
+			Msg:      msg,
+			Value:    value,
+			Expected: expected,
+			source:   source,
+		}})
+
+		return &problems[len(problems)-1]
+	}
+
+	for _, n := range nodes {
+		item := n.Value
+		name := troopName(n.Index)
+
+		entries := mappingValue(item, "level_up_data")
+		if entries == nil && n.Key != nil {
+			// Troops in the keyed layout may leave fields out to keep their
+			// installed values.
+			continue
+		}
+
+		if entries == nil || entries.Kind != yaml.SequenceNode {
+			problem(item, name+" has no level_up_data list", "", fmt.Sprintf("%d entries", levelUpEntries)).fixable = true
+			continue
+		}
+
+		if n := len(entries.Content); n != levelUpEntries {
+			problem(entries, fmt.Sprintf("%s.level_up_data has %d entries", name, n), "", fmt.Sprintf("%d", levelUpEntries)).fixable = true
+		}
+
+		for j, entry := range entries.Content {
+			if j >= levelUpEntries {
+				break
+			}
+
+			field := fmt.Sprintf("%s.level_up_data[%d]", name, j)
+
+			if node := mappingValue(entry, "skill_id"); node != nil {
+				id, err := strconv.ParseInt(node.Value, 10, 32)
+				if v, ok := symbolValue(fmt.Sprintf("level_up_data[%d].skill_id", j), node.Value); ok {
+					id, err = int64(v), nil
+				}
+
+				switch {
+				case err != nil || id < 0:
+					problem(node, "invalid "+field+".skill_id", node.Value, "a non-negative whole number or a skill name")
+				case len(known) > 0 && !known[id]:
+					problem(node, field+".skill_id isn't used by any reference troop", node.Value, "").warning = true
+				}
+			}
+
+			if node := mappingValue(entry, "skill_per_level"); node != nil {
+				v, err := strconv.ParseFloat(node.Value, 32)
+				if err != nil || v < 0 || math.IsInf(v, 0) || math.IsNaN(v) {
+					problem(node, "invalid "+field+".skill_per_level", node.Value, "a finite, non-negative number")
+				}
+			}
+		}
+	}
+
+	return problems
+}
+
+// fixLevelUpData pads or truncates every level_up_data list to three entries.
+// Padding is taken from base, or zeros for troops base doesn't have.
+func fixLevelUpData(nodes []troopNode, base troopInfoSOX) error {
+	for _, n := range nodes {
+		i, item := n.Index, n.Value
+		if item.Kind != yaml.MappingNode {
+			continue
+		}
+
+		var ref troopInfo
+		if i < len(base.TroopInfos) {
+			ref = base.TroopInfos[i]
+		}
+
+		entries := mappingValue(item, "level_up_data")
+		if entries == nil && n.Key != nil {
+			continue
+		}
+
+		if entries == nil || entries.Kind != yaml.SequenceNode {
+			replacement, err := valueNode(ref.LevelUpData)
+			if err != nil {
+				return err
+			}
+
+			if entries == nil {
+				key := &yaml.Node{Kind: yaml.ScalarNode, Value: "level_up_data"}
+				item.Content = append(item.Content, key, replacement)
+			} else {
+				*entries = *replacement
+			}
+
+			continue
+		}
+
+		if len(entries.Content) > levelUpEntries {
+			entries.Content = entries.Content[:levelUpEntries]
+		}
+
+		for j := len(entries.Content); j < levelUpEntries; j++ {
+			entry, err := valueNode(ref.LevelUpData[j])
+			if err != nil {
+				return err
+			}
+
+			entries.Content = append(entries.Content, entry)
+		}
+	}
+
+	return nil
+}
+
+// valueNode returns v as a YAML node that can be spliced into a document.
+func valueNode(v interface{}) (*yaml.Node, error) {
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc yaml.Node
+
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	return documentRoot(&doc), nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+var errRevertedFixes = errors.New("edits revert official balance fixes")
+
+// balancePatch is the stat changes of one official game patch. Mods based on
+// dumps from before a patch silently undo its fixes, which lint catches.
+type balancePatch struct {
+	Version string       `yaml:"version"` // e.g. "Steam 1.0.2"
+	Notes   string       `yaml:"notes,omitempty"`
+	Changes []balanceFix `yaml:"changes"`
+}
+
+// balanceFix is a single value changed by a patch.
+type balanceFix struct {
+	Troop string `yaml:"troop"` // troop key, see troopKey
+	Field string `yaml:"field"`
+	Old   string `yaml:"old"`
+	New   string `yaml:"new"`
+}
+
+// balancePatchDB is the format of patch files.
+type balancePatchDB struct {
+	Patches []balancePatch `yaml:"patches"`
+}
+
+// officialPatches ships with the tool. Patches whose changes were confirmed
+// by comparing the files of both releases get added here.
+var officialPatches []balancePatch
+
+func balancePatchDBPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "patches.yaml"), nil
+}
+
+func readBalancePatchDB(path string) (balancePatchDB, error) {
+	var db balancePatchDB
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return db, err
+	}
+
+	if err := yaml.Unmarshal(data, &db); err != nil {
+		return db, newYAMLError(path, data, err)
+	}
+
+	return db, nil
+}
+
+// knownBalancePatches returns the shipped patches, followed by those of the
+// patch file in the configuration directory and of extra, if given.
+func knownBalancePatches(extra string) ([]balancePatch, error) {
+	patches := append([]balancePatch(nil), officialPatches...)
+
+	path, err := balancePatchDBPath()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range []string{path, extra} {
+		if p == "" {
+			continue
+		}
+
+		db, err := readBalancePatchDB(p)
+		if os.IsNotExist(err) && p == path {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		patches = append(patches, db.Patches...)
+	}
+
+	return patches, nil
+}
+
+// revertedFix is a value that is back to what it was before a patch.
+type revertedFix struct {
+	Patch balancePatch
+	Fix   balanceFix
+	Value string
+}
+
+func (r revertedFix) String() string {
+	return fmt.Sprintf("%s.%s is %s, which reverts %s (%s -> %s)", r.Fix.Troop, r.Fix.Field, r.Value, r.Patch.Version, r.Fix.Old, r.Fix.New)
+}
+
+// findRevertedFixes returns the values of tis that an official patch changed
+// and that are back at their value from before the patch.
+func findRevertedFixes(tis troopInfoSOX, patches []balancePatch) ([]revertedFix, error) {
+	var reverted []revertedFix
+
+	for _, p := range patches {
+		for _, fix := range p.Changes {
+			i, err := newTroopRoster(tis).index(fix.Troop)
+			if err != nil {
+				return nil, fmt.Errorf("patch %s: %w", p.Version, err)
+			}
+
+			f, ok := lookupField(fix.Field)
+			if !ok {
+				return nil, fmt.Errorf("patch %s: unknown field %q", p.Version, fix.Field)
+			}
+
+			if i >= len(tis.TroopInfos) {
+				continue
+			}
+
+			value := f.Format(&tis.TroopInfos[i])
+
+			if sameValue(value, fix.Old) && !sameValue(value, fix.New) {
+				reverted = append(reverted, revertedFix{Patch: p, Fix: fix, Value: value})
+			}
+		}
+	}
+
+	return reverted, nil
+}
+
+// sameValue compares two formatted values, numerically if both are numbers
+// so "3.2" and "3.20" are the same.
+func sameValue(a, b string) bool {
+	x, errX := strconv.ParseFloat(a, 64)
+	y, errY := strconv.ParseFloat(b, 64)
+
+	if errX != nil || errY != nil {
+		return a == b
+	}
+
+	return math.Abs(x-y) <= 1e-6*math.Max(1, math.Abs(y))
+}
+
+func runLint(args []string) error {
+	fs := newFlagSet("lint")
+	from := fs.String("from", troopInfoYAMLPath, "Data to check: a YAML or SOX file, a workspace, current, or a reference such as @variant:hard")
+	patchFile := fs.String("patches", "", "Additional file of official patches to check against")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	patches, err := knownBalancePatches(*patchFile)
+	if err != nil {
+		return err
+	}
+
+	if len(patches) == 0 {
+		log.Warn().Msg(tr("No official patches are known; add them to the patches file in the configuration directory or pass -patches"))
+		return nil
+	}
+
+	tis, err := loadTroopSource(*from)
+	if err != nil {
+		return err
+	}
+
+	reverted, err := findRevertedFixes(tis, patches)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range reverted {
+		fmt.Println(r)
+
+		if r.Patch.Notes != "" {
+			fmt.Printf("  %s\n", r.Patch.Notes)
+		}
+	}
+
+	if len(reverted) > 0 {
+		return fmt.Errorf("%w: %d values", errRevertedFixes, len(reverted))
+	}
+
+	log.Info().Msg(tr("No official balance fixes are reverted"))
+
+	return nil
+}
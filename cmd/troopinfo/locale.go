@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+// localeAuto detects the number format from the contents of the file.
+const localeAuto = "auto"
+
+// numberFormat describes how a locale writes decimal numbers.
+type numberFormat struct {
+	decimal   string
+	group     string
+	delimiter rune // CSV field delimiter of the file being read
+}
+
+var (
+	pointFormat = numberFormat{decimal: ".", group: ","}
+	commaFormat = numberFormat{decimal: ",", group: "."}
+	spaceFormat = numberFormat{decimal: ",", group: " "}
+)
+
+// numberFormats maps language codes to their number format. Languages that
+// aren't listed use pointFormat.
+var numberFormats = map[string]numberFormat{
+	"en": pointFormat,
+	"ko": pointFormat,
+	"ja": pointFormat,
+	"zh": pointFormat,
+	"de": commaFormat,
+	"es": commaFormat,
+	"it": commaFormat,
+	"nl": commaFormat,
+	"pt": commaFormat,
+	"da": commaFormat,
+	"tr": commaFormat,
+	"id": commaFormat,
+	"fr": spaceFormat,
+	"ru": spaceFormat,
+	"pl": spaceFormat,
+	"cs": spaceFormat,
+	"sv": spaceFormat,
+	"fi": spaceFormat,
+	"nb": spaceFormat,
+	"uk": spaceFormat,
+}
+
+// lookupNumberFormat returns the number format for a locale such as "de",
+// "de-DE" or "de_DE.UTF-8".
+func lookupNumberFormat(locale string) (numberFormat, error) {
+	lang := strings.ToLower(locale)
+	if i := strings.IndexAny(lang, "-_."); i >= 0 {
+		lang = lang[:i]
+	}
+
+	if lang == "c" || lang == "posix" {
+		return pointFormat, nil
+	}
+
+	nf, ok := numberFormats[lang]
+	if !ok {
+		return numberFormat{}, fmt.Errorf("unsupported locale %q", locale)
+	}
+
+	return nf, nil
+}
+
+var (
+	commaDecimal = regexp.MustCompile(`^-?\d{1,3}(\.\d{3})*,\d+$|^-?\d+,\d+$`)
+	pointDecimal = regexp.MustCompile(`^-?\d{1,3}(,\d{3})*\.\d+$|^-?\d+\.\d+$`)
+)
+
+// detectDelimiter returns the CSV field delimiter used by data. Spreadsheets
+// in comma-decimal locales export with semicolons.
+func detectDelimiter(data []byte) rune {
+	firstLine, _ := bufio.NewReader(bytes.NewReader(data)).ReadString('\n')
+
+	if strings.Count(firstLine, ";") > strings.Count(firstLine, ",") {
+		return ';'
+	}
+
+	return ','
+}
+
+// detectNumberFormat guesses the number format of CSV data. Files whose
+// numbers only ever use a decimal comma are treated as comma-decimal.
+func detectNumberFormat(data []byte) numberFormat {
+	var commas, points int
+
+	delimiter := detectDelimiter(data)
+
+	for _, cell := range splitCells(data, delimiter) {
+		cell = strings.TrimSpace(cell)
+
+		switch {
+		case pointDecimal.MatchString(cell):
+			points++
+		case commaDecimal.MatchString(cell):
+			commas++
+		}
+	}
+
+	nf := pointFormat
+	if commas > 0 && points == 0 {
+		nf = commaFormat
+	}
+
+	nf.delimiter = delimiter
+
+	return nf
+}
+
+// splitCells roughly splits CSV data into cells, honoring quotes. It only
+// needs to be good enough to find numbers for detection.
+func splitCells(data []byte, delimiter rune) []string {
+	var (
+		cells  []string
+		cell   strings.Builder
+		quoted bool
+	)
+
+	for _, r := range string(data) {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case !quoted && (r == delimiter || r == '\n' || r == '\r'):
+			cells = append(cells, cell.String())
+			cell.Reset()
+		default:
+			cell.WriteRune(r)
+		}
+	}
+
+	return append(cells, cell.String())
+}
+
+// normalize rewrites a number written in nf as a Go-parseable number. Group
+// separators are only removed when they actually group digits in threes, so
+// "1,5" is never silently read as 15.
+func (nf numberFormat) normalize(s string) string {
+	s = strings.TrimSpace(s)
+
+	whole, frac := s, ""
+	if i := strings.LastIndex(s, nf.decimal); i >= 0 {
+		whole, frac = s[:i], s[i+len(nf.decimal):]
+	}
+
+	if nf.group == " " {
+		whole = strings.NewReplacer("\u00a0", " ", "\u202f", " ").Replace(whole)
+	}
+
+	if groups := strings.Split(whole, nf.group); nf.group != "" && len(groups) > 1 {
+		grouped := len(strings.TrimPrefix(groups[0], "-")) <= 3
+
+		for _, g := range groups[1:] {
+			grouped = grouped && len(g) == 3
+		}
+
+		if grouped {
+			whole = strings.Join(groups, "")
+		}
+	}
+
+	if frac == "" && !strings.HasSuffix(s, nf.decimal) {
+		return whole
+	}
+
+	return whole + "." + frac
+}
+
+// readLocalized reads all of r and resolves the number format to use for it,
+// either from locale or, when locale is "auto", from the data itself.
+func readLocalized(r io.Reader, locale string) ([]byte, numberFormat, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, numberFormat{}, err
+	}
+
+	if locale == "" || locale == localeAuto {
+		return data, detectNumberFormat(data), nil
+	}
+
+	nf, err := lookupNumberFormat(locale)
+	if err != nil {
+		return nil, numberFormat{}, err
+	}
+
+	nf.delimiter = detectDelimiter(data)
+
+	return data, nf, nil
+}
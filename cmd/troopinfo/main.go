@@ -2,416 +2,310 @@ package main
 
 import (
 	"bytes"
-	"encoding/binary"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 
-	"github.com/davecgh/go-spew/spew"
-	"github.com/google/go-cmp/cmp"
+	"github.com/rdeusser/troopinfo/kuftc"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"gopkg.in/yaml.v3"
 )
 
-const (
-	troopInfoPath     = "C:\\Program Files (x86)\\Steam\\steamapps\\common\\KUF Crusader\\Data\\SOX\\TroopInfo.sox"
-	troopInfoYAMLPath = "C:\\Program Files (x86)\\Steam\\steamapps\\common\\KUF Crusader\\Data\\SOX\\TroopInfo.yaml"
+// The paths of the game files default to the Steam install of the platform
+// and are moved by setGameDir.
+var (
+	soxDir            = filepath.Join(defaultGameDir(), "Data", "SOX")
+	troopInfoPath     = filepath.Join(soxDir, "TroopInfo.sox")
+	troopInfoYAMLPath = filepath.Join(soxDir, "TroopInfo.yaml")
 )
 
-const defaultLength = 4
+// soxVersion is the file version of the retail SOX files.
+const soxVersion = kuftc.Version
 
-var errInvalidSOX = errors.New("not a valid SOX file")
+var errInvalidSOX = kuftc.ErrInvalidSOX
 
+// The flags of the modes that preceded the workspace commands. They still
+// work, but each maps to a command; see legacyCommand.
 var (
-	restore = flag.Bool("restore", false, "Restores TroopInfo.sox file using a backup")
-	debug   = flag.Bool("debug", false, "Pretty-prints struct info to stdout")
-	diff    = flag.Bool("diff", false, "Prints out a diff of what would be written and the current SOX file")
-	write   = flag.Bool("write", false, "Writes TroopInfo.sox back to the source game directory")
-	update  = flag.Bool("update", false, "Updates TroopInfo.yaml")
+	restore     = flag.Bool("restore", false, "Deprecated: use the restore command")
+	debug       = flag.Bool("debug", false, "Deprecated: use the show command")
+	diff        = flag.Bool("diff", false, "Deprecated: use diff current TroopInfo.yaml")
+	write       = flag.Bool("write", false, "Deprecated: use the apply command")
+	update      = flag.Bool("update", false, "Deprecated: use the dump command")
+	noColor     = flag.Bool("no-color", false, "Deprecated: use show -no-color")
+	details     = flag.Bool("details", false, "Deprecated: use apply -details")
+	allowZero   = flag.Bool("allow-zero", false, "Deprecated: use apply -allow-zero")
+	showIgnored = flag.Bool("show-ignored", false, "Deprecated: use diff -show-ignored")
 )
 
-type levelUpData struct {
-	SkillID       int32   `yaml:"skill_id"`
-	SkillPerLevel float32 `yaml:"skill_per_level"`
-}
-
-type troopInfo struct {
-	Job    int32 `yaml:"job"`     // troop Job type (defined in K2JobDef.h)
-	TypeID int32 `yaml:"type_id"` // troop type ID (defined in K2TroopDef.h)
-
-	MoveSpeed        float32 `yaml:"move_speed"`        // max move speed
-	RotateRate       float32 `yaml:"rotate_rate"`       // max rotate rate
-	MoveAcceleration float32 `yaml:"move_acceleration"` // move acceleration
-	MoveDeceleration float32 `yaml:"move_deceleration"` // move deceleration
-
-	SightRange float32 `yaml:"sight_range"` // visible range
-
-	AttackRangeMax   float32 `yaml:"attack_range_max"`
-	AttackRangeMin   float32 `yaml:"attack_range_min"`   // ranged attack range (0 if troop lacks ranged attack)
-	AttackFrontRange float32 `yaml:"attack_front_range"` // frontal attack range (0 if troop lacks frontal attack)
-
-	DirectAttack   float32 `yaml:"direct_attack"`   // direct attack strength (melee/frontal)
-	IndirectAttack float32 `yaml:"indirect_attack"` // indirect attack strength (ranged)
-	Defense        float32 `yaml:"defense"`         // defense strength
-
-	BaseWidth float32 `yaml:"base_width"` // base troop size
-
-	// resistance to attack types
-	ResistMelee     float32 `yaml:"resist_melee"`
-	ResistRanged    float32 `yaml:"resist_ranged"`
-	ResistFrontal   float32 `yaml:"resist_frontal"`
-	ResistExplosion float32 `yaml:"resist_explosion"`
-	ResistFire      float32 `yaml:"resist_fire"`
-	ResistIce       float32 `yaml:"resist_ice"`
-	ResistLightning float32 `yaml:"resist_lightning"`
-	ResistHoly      float32 `yaml:"resist_holy"`
-	ResistCurse     float32 `yaml:"resist_curse"`
-	ResistPoison    float32 `yaml:"resist_poison"`
-
-	MaxUnitSpeedMultiplier float32 `yaml:"max_unit_speed_multiplier"`
-	DefaultUnitHP          float32 `yaml:"default_unit_hp"`
-	FormationRandom        int32   `yaml:"formation_random"`
-	DefaultUnitNumX        int32   `yaml:"default_unit_num_x"`
-	DefaultUnitNumY        int32   `yaml:"default_unit_num_y"`
-
-	UnitHPLevUp float32 `yaml:"unit_hp_lev_up"`
-
-	LevelUpData [3]levelUpData `yaml:"level_up_data"` // needs to be set to a length of 3
-
-	DamageDistribution float32 `yaml:"damage_distribution"`
-}
-
-type troopInfoSOX struct {
-	Version int32 `yaml:"version"`
-	Count   int32 `yaml:"count"`
+// The troop data model and its codec live in the kuftc package, the public
+// API of the tool.
+type (
+	levelUpData  = kuftc.LevelUp
+	troopInfo    = kuftc.TroopInfo
+	troopInfoSOX = kuftc.TroopInfoFile
+)
 
-	TroopInfos [43]troopInfo `yaml:"troop_infos"`
+// defaultTroopNames are the English troop names of the retail game.
+var defaultTroopNames = kuftc.TroopNames
 
-	TheEnd [64]byte `yaml:"-"`
-}
+// troopNames are the display names of the troop types, indexed by type ID;
+// see troopName for the names of records.
+var troopNames = defaultTroopNames
 
 func main() {
-	flag.Parse()
-
 	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
 
-	troopNames := []string{
-		"Archer",
-		"Longbows",
-		"Infantry",
-		"Spearman",
-		"Heavy Infantry",
-		"Knight",
-		"Paladin",
-		"Calvary",
-		"Heavy Calvary",
-		"Storm Riders",
-		"Sappers",
-		"Pyro Techs",
-		"Bomber Wings",
-		"Mortar",
-		"Ballista",
-		"Harpoon",
-		"Catapult",
-		"Battaloon",
-		"Dark Elves Archer",
-		"Dark Elves Calvary Archers",
-		"Dark Elves Infantry",
-		"Dark Elves Knights",
-		"Dark Elves Calvary",
-		"Orc Infantry",
-		"Orc Riders",
-		"Orc Heavy Riders",
-		"Orc Axe Man",
-		"Orc Heavy Infantry",
-		"Orc Sappers",
-		"Orc Scorpion",
-		"Orc Swamp Mammoth",
-		"Orc Dirigible",
-		"Orc Black Wyverns",
-		"Orc Ghouls",
-		"Orc Bone Dragon",
-		"Wall Archers (Humans)",
-		"Scouts",
-		"Ghoul Selfdestruct",
-		"Encablossa Monster (Melee)",
-		"Encablossa Flying Monster",
-		"Encablossa Monster (Ranged)",
-		"Wall Archers (Elves)",
-		"Encablossa Main",
-	}
+	setupLanguage()
 
-	file, err := os.Open(troopInfoPath)
+	gameDir, args, err := takeGameDirFlag(os.Args[1:])
 	if err != nil {
-		log.Fatal().Err(err)
+		exitWithError(err, "troopinfo")
 	}
-	defer file.Close()
-
-	version := readInt32(file)
-	count := readInt32(file)
 
-	if !validSOX(version, count) {
-		log.Fatal().Err(errInvalidSOX)
+	args, forceWrite = takeForceFlag(args)
+
+	loadGameDir(gameDir)
+	loadTroopRoster()
+	loadCustomTroopNames(soxDir)
+	loadFieldAliases()
+	loadUnitConversions()
+	loadSymbolSettings()
+	loadDiffSettings()
+	loadBackupSettings()
+	loadValidationSettings()
+
+	if len(args) > 0 {
+		if cmd, ok := lookupCommand(args[0]); ok {
+			err := cmd.run(args[1:])
+			if err != nil && !errors.Is(err, flag.ErrHelp) {
+				exitWithError(err, cmd.name)
+			}
+
+			os.Exit(0)
+		}
 	}
 
-	troopInfos := [43]troopInfo{}
+	flag.Usage = func() { printUsage(os.Stderr) }
+	_ = flag.CommandLine.Parse(args)
 
-	tis := troopInfoSOX{
-		Version:    version,
-		Count:      count,
-		TroopInfos: troopInfos,
+	name, args, err := legacyCommand()
+	if err != nil {
+		exitWithError(err, "troopinfo")
 	}
 
-	for i := range troopNames {
-		ti := troopInfo{
-			Job:    readInt32(file),
-			TypeID: readInt32(file),
-
-			MoveSpeed:        readFloat32(file),
-			RotateRate:       readFloat32(file),
-			MoveAcceleration: readFloat32(file),
-			MoveDeceleration: readFloat32(file),
-
-			SightRange: readFloat32(file),
-
-			AttackRangeMax:   readFloat32(file),
-			AttackRangeMin:   readFloat32(file),
-			AttackFrontRange: readFloat32(file),
-
-			DirectAttack:   readFloat32(file),
-			IndirectAttack: readFloat32(file),
-			Defense:        readFloat32(file),
-
-			BaseWidth: readFloat32(file),
-
-			ResistMelee:     readFloat32(file),
-			ResistRanged:    readFloat32(file),
-			ResistFrontal:   readFloat32(file),
-			ResistExplosion: readFloat32(file),
-			ResistFire:      readFloat32(file),
-			ResistIce:       readFloat32(file),
-			ResistLightning: readFloat32(file),
-			ResistHoly:      readFloat32(file),
-			ResistCurse:     readFloat32(file),
-			ResistPoison:    readFloat32(file),
-
-			MaxUnitSpeedMultiplier: readFloat32(file),
-			DefaultUnitHP:          readFloat32(file),
-			FormationRandom:        readInt32(file),
-			DefaultUnitNumX:        readInt32(file),
-			DefaultUnitNumY:        readInt32(file),
-
-			UnitHPLevUp: readFloat32(file),
-
-			LevelUpData: [3]levelUpData{
-				{
-					SkillID:       readInt32(file),
-					SkillPerLevel: readFloat32(file),
-				},
-				{
-					SkillID:       readInt32(file),
-					SkillPerLevel: readFloat32(file),
-				},
-				{
-					SkillID:       readInt32(file),
-					SkillPerLevel: readFloat32(file),
-				},
-			},
-
-			DamageDistribution: readFloat32(file),
+	cmd, ok := lookupCommand(name)
+	if !ok {
+		if flag.NArg() > 0 {
+			fmt.Fprintln(os.Stderr, tr("Unknown command %q", flag.Arg(0)))
+			fmt.Fprintln(os.Stderr)
 		}
 
-		tis.TroopInfos[i] = ti
+		printUsage(os.Stderr)
+		os.Exit(2)
 	}
 
-	buf := &bytes.Buffer{}
-
-	// Read the rest of the file.
-	for {
-		data := make([]byte, defaultLength)
-
-		_, err := file.Read(data)
-		if err == io.EOF {
-			break
-		}
-
-		if err != nil {
-			log.Fatal().Err(err)
-		}
-
-		var chars []byte
-
-		reader := bytes.NewReader(data)
-
-		if err := binary.Read(reader, binary.LittleEndian, &chars); err != nil {
-			log.Fatal().Err(err)
-		}
-
-		buf.Write(chars)
+	if err := cmd.run(args); err != nil {
+		exitWithError(err, cmd.name)
 	}
+}
 
-	copy(tis.TheEnd[:], buf.Bytes())
-
-	buf.Reset()
-
-	if err := binary.Write(buf, binary.LittleEndian, &tis); err != nil {
-		log.Fatal().Err(err)
+// legacyCommand returns the command and arguments the mode flags given on the
+// command line map to, or "" if none were given. Modes used to run one after
+// another when combined, which made combinations like -write -diff
+// ambiguous, so only one is accepted now.
+func legacyCommand() (string, []string, error) {
+	modes := []struct {
+		flag string
+		set  bool
+		name string
+		args []string
+	}{
+		{"restore", *restore, "restore", nil},
+		{"debug", *debug, "show", boolArgs("no-color", *noColor)},
+		{"update", *update, "dump", nil},
+		{"diff", *diff, "diff", append(boolArgs("show-ignored", *showIgnored), sourceCurrent, troopInfoYAMLPath)},
+		{"write", *write, "apply", append(boolArgs("details", *details), boolArgs("allow-zero", *allowZero)...)},
 	}
 
-	if *restore {
-		data, err := ioutil.ReadFile(troopInfoPath + ".bak")
-		if err != nil {
-			log.Fatal().Err(err)
-		}
+	var given []string
 
-		if err := ioutil.WriteFile(troopInfoPath, data, 0600); err != nil {
-			log.Fatal().Err(err)
+	name, args := "", []string(nil)
+
+	for _, m := range modes {
+		if !m.set {
+			continue
 		}
 
-		log.Info().Msg("Success!")
+		given = append(given, "-"+m.flag)
+		name, args = m.name, m.args
 
-		os.Exit(0)
+		log.Warn().Msg(tr("-%s is deprecated; use troopinfo %s", m.flag, m.name))
 	}
 
-	if *debug {
-		spew.Dump(tis)
-		os.Exit(0)
+	if len(given) > 1 {
+		return "", nil, fmt.Errorf("%s can't be combined; run the commands one at a time", strings.Join(given, " and "))
 	}
 
-	if *update {
-		buf.Reset()
+	return name, args, nil
+}
 
-		for i, name := range troopNames {
-			buf.WriteString(fmt.Sprintf("# %d -- %s\n", i, name))
-		}
+// boolArgs returns the flag for a boolean option that is set.
+func boolArgs(name string, set bool) []string {
+	if set {
+		return []string{"-" + name}
+	}
 
-		data, err := yaml.Marshal(tis)
-		if err != nil {
-			log.Fatal().Err(err)
-		}
+	return nil
+}
 
-		buf.Write(data)
+// exitWithError logs that the named action failed with err and exits with
+// the status exitStatus gives it. YAML errors are followed by the offending
+// lines. A diff that found differences exits without logging anything.
+func exitWithError(err error, name string) {
+	if errors.Is(err, errDifferent) {
+		os.Exit(exitStatus(err))
+	}
 
-		if err := ioutil.WriteFile(troopInfoYAMLPath, buf.Bytes(), 0600); err != nil {
-			log.Fatal().Err(err)
-		}
+	log.Error().
+		Err(err).
+		Msg(tr("%s failed", name))
 
-		log.Info().Msg("Success!")
+	var ye *yamlError
+	if errors.As(err, &ye) {
+		fmt.Fprint(os.Stderr, ye.Context())
 	}
 
-	if *diff {
-		tis = troopInfoSOX{}
+	recordFailure(err, name)
 
-		data, err := binaryData(tis)
-		if err != nil {
-			log.Fatal().Err(err)
-		}
-
-		if diff := cmp.Diff(data, buf.Bytes()); diff != "" {
-			fmt.Printf("binary data mismatch (-want +got):\n%s", diff)
-		}
+	os.Exit(exitStatus(err))
+}
 
-		os.Exit(0)
+// exitStatus returns the status to exit with after err. As with diff(1), it
+// is 1 if sources differ and 2 for every other error, so scripts can tell a
+// difference from a failure.
+func exitStatus(err error) int {
+	if errors.Is(err, errDifferent) {
+		return 1
 	}
 
-	if *write {
-		tis = troopInfoSOX{}
+	return 2
+}
 
-		data, err := binaryData(tis)
-		if err != nil {
-			log.Fatal().Err(err)
-		}
+// readTroopInfoSOX decodes the TroopInfo.sox file at path.
+func readTroopInfoSOX(path string) (troopInfoSOX, error) {
+	if err := troopInfoFile.checkLayout(path); err != nil {
+		return troopInfoSOX{}, err
+	}
 
-		if err := ioutil.WriteFile(troopInfoPath, data, 0600); err != nil {
-			log.Fatal().Err(err)
-		}
+	file, err := os.Open(path)
+	if err != nil {
+		return troopInfoSOX{}, err
+	}
+	defer file.Close()
 
-		log.Info().Msg("Success!")
+	return decodeTroopInfoSOX(file)
+}
 
-		os.Exit(0)
-	}
+// decodeTroopInfoSOX decodes TroopInfo.sox data from r.
+func decodeTroopInfoSOX(r io.Reader) (troopInfoSOX, error) {
+	return kuftc.Decode(r)
 }
 
-func binaryData(sox troopInfoSOX) ([]byte, error) {
-	buf := &bytes.Buffer{}
+// encodeTroopInfoSOX writes tis to w in the layout of its version.
+func encodeTroopInfoSOX(w io.Writer, tis troopInfoSOX) error {
+	return kuftc.Encode(w, tis)
+}
 
-	yamlData, err := ioutil.ReadFile(troopInfoYAMLPath)
+// writeTroopInfoYAML writes tis to path as YAML, keyed by troop.
+func writeTroopInfoYAML(path string, tis troopInfoSOX) error {
+	doc, err := troopInfoDocument(tis)
 	if err != nil {
-		return buf.Bytes(), err
+		return err
 	}
 
-	if err := yaml.Unmarshal(yamlData, &sox); err != nil {
-		return buf.Bytes(), err
-	}
-
-	if err := binary.Write(buf, binary.LittleEndian, &sox); err != nil {
-		return buf.Bytes(), err
+	data, err := encodeYAMLNode(doc)
+	if err != nil {
+		return err
 	}
 
-	return buf.Bytes(), nil
+	return ioutil.WriteFile(path, data, 0600)
 }
 
-func validSOX(version, count int32) bool {
-	if version != 100 || count != 43 {
-		return false
+// readTroopInfoYAML decodes the YAML file at path on top of base, so values
+// the YAML doesn't carry, such as the trailer or troops left out of a partial
+// file, are kept.
+func readTroopInfoYAML(path string, base troopInfoSOX) (troopInfoSOX, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return troopInfoSOX{}, err
 	}
 
-	return true
+	return decodeTroopInfoYAML(path, data, base)
 }
 
-func readInt32(file io.Reader) int32 {
-	data := readBytes(file)
+// decodeTroopInfoYAML is readTroopInfoYAML for YAML that is already in
+// memory. path is only used in errors.
+func decodeTroopInfoYAML(path string, data []byte, base troopInfoSOX) (troopInfoSOX, error) {
+	var doc yaml.Node
 
-	return int32FromBytes(data)
-}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return troopInfoSOX{}, newYAMLError(path, data, err)
+	}
 
-func readFloat32(file io.Reader) float32 {
-	data := readBytes(file)
+	if err := resolveSymbols(path, data, &doc); err != nil {
+		return troopInfoSOX{}, err
+	}
 
-	return float32FromBytes(data)
-}
+	if err := convertUnits(path, data, &doc); err != nil {
+		return troopInfoSOX{}, err
+	}
 
-func int32FromBytes(data []byte) int32 {
-	var i32 int32
+	if err := checkTroopInfoYAML(path, data, &doc); err != nil {
+		return troopInfoSOX{}, err
+	}
 
-	buf := bytes.NewReader(data)
+	// The records are decoded onto a copy so the caller's base is left as
+	// it was.
+	base = base.Clone()
 
-	err := binary.Read(buf, binary.LittleEndian, &i32)
-	if err != nil {
-		log.Fatal().
-			Err(err).
-			Msg("binary.Read failed")
+	if err := doc.Decode(&base); err != nil {
+		return troopInfoSOX{}, newYAMLError(path, data, err)
 	}
 
-	return i32
+	if err := decodeTroopNodes(path, data, &doc, &base); err != nil {
+		return troopInfoSOX{}, err
+	}
+
+	return base, nil
 }
 
-func float32FromBytes(data []byte) float32 {
-	var f32 float32
+// binaryData encodes the YAML file at path on top of sox.
+func binaryData(path string, sox troopInfoSOX) ([]byte, error) {
+	buf := &bytes.Buffer{}
 
-	buf := bytes.NewReader(data)
+	if err := checkYAMLComplete(path); err != nil {
+		return buf.Bytes(), err
+	}
 
-	err := binary.Read(buf, binary.LittleEndian, &f32)
+	sox, err := readTroopInfoYAML(path, sox)
 	if err != nil {
-		log.Fatal().
-			Err(err).
-			Msg("binary.Read failed")
+		return buf.Bytes(), err
 	}
 
-	return f32
-}
-
-func readBytes(file io.Reader) []byte {
-	data := make([]byte, defaultLength)
-
-	_, err := file.Read(data)
-	if err != nil && err != io.EOF {
-		log.Fatal().Err(err)
+	if err := encodeTroopInfoSOX(buf, sox); err != nil {
+		return buf.Bytes(), err
 	}
 
-	return data
+	return buf.Bytes(), nil
+}
+
+func validSOX(version, count int32) bool {
+	return kuftc.ValidHeader(version, count)
 }
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rdeusser/troopinfo/kuftc"
+)
+
+// newTestGame points the tool at a fresh game directory holding a retail
+// sized TroopInfo.sox, with the configuration in a directory of its own, and
+// returns the game directory. Record i is of troop type i and has a defense
+// of 10+i, so records can be told apart.
+func newTestGame(t *testing.T) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "troopinfo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	config := filepath.Join(dir, "config")
+	sox := filepath.Join(dir, "Data", "SOX")
+
+	if err := os.MkdirAll(sox, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, env := range []string{"XDG_CONFIG_HOME", "HOME", "APPDATA"} {
+		old, ok := os.LookupEnv(env)
+		os.Setenv(env, config)
+
+		t.Cleanup(func() {
+			if ok {
+				os.Setenv(env, old)
+			} else {
+				os.Unsetenv(env)
+			}
+		})
+	}
+
+	tis := troopInfoSOX{Version: kuftc.Version, Count: int32(len(defaultTroopNames))}
+
+	for i := range defaultTroopNames {
+		ti := troopInfo{
+			Job:             1,
+			TypeID:          int32(i),
+			MoveSpeed:       3,
+			SightRange:      300,
+			Defense:         float32(10 + i),
+			BaseWidth:       2,
+			ResistMelee:     0.5,
+			DefaultUnitHP:   100,
+			DefaultUnitNumX: 4,
+			DefaultUnitNumY: 4,
+		}
+
+		tis.TroopInfos = append(tis.TroopInfos, ti)
+	}
+
+	buf := &bytes.Buffer{}
+
+	if err := encodeTroopInfoSOX(buf, tis); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(sox, troopInfoFile.Name), buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	setGameDir(dir)
+	loadTroopRoster()
+
+	troopNames = defaultTroopNames
+	customTroopNames = map[int]string{}
+
+	return dir
+}
+
+// runCommand runs a command with args, failing the test if it fails.
+func runCommand(t *testing.T, run func([]string) error, args ...string) {
+	t.Helper()
+
+	if err := run(args); err != nil {
+		t.Fatalf("%v: %v", args, err)
+	}
+}
+
+// readInstalled returns the installed TroopInfo.sox.
+func readInstalled(t *testing.T) troopInfoSOX {
+	t.Helper()
+
+	tis, err := readTroopInfoSOX(troopInfoPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tis
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Conflict resolution strategies.
+const (
+	resolvePrompt = "prompt"
+	resolveOurs   = "ours"
+	resolveTheirs = "theirs"
+	resolveFail   = "fail"
+)
+
+// layerStrategies map the conflict strategies of apply with several files to
+// the resolvers they use: the files applied so far are ours, and the file
+// being applied is theirs.
+var layerStrategies = map[string]string{
+	"error":       resolveFail,
+	"last-wins":   resolveTheirs,
+	"interactive": resolvePrompt,
+}
+
+var errConflicts = errors.New("unresolved conflicts")
+
+// conflict is a field changed differently by both sides of a merge.
+type conflict struct {
+	Troop int
+	Field troopField
+	Base  string
+	Ours  string
+	Their string
+}
+
+func (c conflict) String() string {
+	return fmt.Sprintf("%s.%s", troopName(c.Troop), c.Field.Name)
+}
+
+// resolver picks the value to use for a conflicting field.
+type resolver func(c conflict) (string, error)
+
+func newResolver(strategy string, in io.Reader, out io.Writer) (resolver, error) {
+	switch strategy {
+	case resolvePrompt:
+		return promptResolver(bufio.NewReader(in), out), nil
+	case resolveOurs:
+		return func(c conflict) (string, error) { return c.Ours, nil }, nil
+	case resolveTheirs:
+		return func(c conflict) (string, error) { return c.Their, nil }, nil
+	case resolveFail:
+		return func(c conflict) (string, error) {
+			return "", fmt.Errorf("%w: %s (base %s, ours %s, theirs %s)", errConflicts, c, c.Base, c.Ours, c.Their)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown conflict strategy %q", strategy)
+	}
+}
+
+// promptResolver asks the user to resolve each conflict, showing the base,
+// ours and theirs values side by side.
+func promptResolver(in *bufio.Reader, out io.Writer) resolver {
+	return func(c conflict) (string, error) {
+		fmt.Fprint(out, tr("\nConflict in %s\n", c))
+		fmt.Fprint(out, tr("  base:   %s\n", c.Base))
+		fmt.Fprint(out, tr("  ours:   %s\n", c.Ours))
+		fmt.Fprint(out, tr("  theirs: %s\n", c.Their))
+
+		for {
+			fmt.Fprint(out, tr("Keep [o]urs, take [t]heirs, use [b]ase, or type a value: "))
+
+			line, err := in.ReadString('\n')
+			if err != nil && (err != io.EOF || line == "") {
+				return "", fmt.Errorf("%w: %s", errConflicts, c)
+			}
+
+			switch answer := strings.TrimSpace(line); strings.ToLower(answer) {
+			case "o", "ours":
+				return c.Ours, nil
+			case "t", "theirs":
+				return c.Their, nil
+			case "b", "base":
+				return c.Base, nil
+			case "":
+				continue
+			default:
+				// Validate typed values before accepting them.
+				var ti troopInfo
+				if err := c.Field.Parse(&ti, answer); err != nil {
+					fmt.Fprint(out, tr("Invalid value: %v\n", err))
+					continue
+				}
+
+				return c.Field.Format(&ti), nil
+			}
+		}
+	}
+}
+
+// merge3 applies the changes theirs made relative to base onto ours. Fields
+// both sides changed to different values are passed to resolve.
+func merge3(base, ours, theirs troopInfoSOX, resolve resolver) (troopInfoSOX, error) {
+	merged := ours.Clone()
+
+	// Troops only theirs has were added by them.
+	for i := len(merged.TroopInfos); i < len(theirs.TroopInfos); i++ {
+		merged.TroopInfos = append(merged.TroopInfos, theirs.TroopInfos[i])
+	}
+
+	for i := range merged.TroopInfos {
+		if i >= len(theirs.TroopInfos) {
+			break
+		}
+
+		for _, f := range troopFields {
+			// A troop base doesn't have was added on both sides, so any
+			// difference between them is a conflict.
+			var b string
+			if i < len(base.TroopInfos) {
+				b = f.Format(&base.TroopInfos[i])
+			}
+
+			o := f.Format(&ours.TroopInfos[i])
+			t := f.Format(&theirs.TroopInfos[i])
+
+			value := o
+
+			switch {
+			case t == b || t == o:
+			case o == b:
+				value = t
+			default:
+				v, err := resolve(conflict{Troop: i, Field: f, Base: b, Ours: o, Their: t})
+				if err != nil {
+					return troopInfoSOX{}, err
+				}
+
+				value = v
+			}
+
+			if err := f.Parse(&merged.TroopInfos[i], value); err != nil {
+				return troopInfoSOX{}, err
+			}
+		}
+	}
+
+	return merged, nil
+}
+
+// mergeLayers applies the changes each file at paths makes to installed in
+// order, so later files override earlier ones. Fields that a file changes to
+// another value than the files before it did are passed to resolve.
+func mergeLayers(installed troopInfoSOX, paths []string, format string, resolve resolver, out io.Writer) (troopInfoSOX, error) {
+	merged := installed
+
+	for i, path := range paths {
+		f, err := dataFormat(format, path)
+		if err != nil {
+			return troopInfoSOX{}, err
+		}
+
+		if f == formatJSON {
+			if err := checkJSONFile(path); err != nil {
+				return troopInfoSOX{}, err
+			}
+		}
+
+		layer, err := readTroopInfoYAML(path, installed)
+		if err != nil {
+			return troopInfoSOX{}, err
+		}
+
+		announced := false
+
+		merged, err = merge3(installed, merged, layer, func(c conflict) (string, error) {
+			if !announced {
+				fmt.Fprint(out, tr("\nours: %s, theirs: %s\n", strings.Join(paths[:i], ", "), path))
+				announced = true
+			}
+
+			return resolve(c)
+		})
+		if err != nil {
+			return troopInfoSOX{}, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	return merged, nil
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// modFormat is bumped whenever the layout of mod packages changes.
+const modFormat = 1
+
+// modManifestName is the entry of a mod package describing it.
+const modManifestName = "manifest.yaml"
+
+// modExt is the extension of mod packages.
+const modExt = ".kufmod"
+
+// A mod package is a zip file holding a manifest and YAML overrides of
+// TroopInfo.sox. Overrides only list the fields the mod changes, in the
+// layout of TroopInfo.yaml, e.g.
+//
+//	troops:
+//	  knight:
+//	    move_speed: 3.5
+//
+// so installing a mod keeps everything else of the user's data, including
+// the changes of other mods.
+type modManifest struct {
+	Format      int      `yaml:"format"`
+	Name        string   `yaml:"name"`
+	Version     string   `yaml:"version"`
+	Author      string   `yaml:"author,omitempty"`
+	Description string   `yaml:"description,omitempty"`
+	GameVersion int32    `yaml:"game_version"`
+	Overrides   []string `yaml:"overrides"`
+}
+
+var nonFileNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+func runMod(args []string) error {
+	if len(args) == 0 {
+		return errors.New("expected pack, install, uninstall, list, order or info")
+	}
+
+	switch args[0] {
+	case "pack":
+		return runModPack(args[1:])
+	case "install":
+		return runModInstall(args[1:])
+	case "uninstall":
+		return runModUninstall(args[1:])
+	case "list":
+		return listMods()
+	case "order":
+		return runModOrder(args[1:])
+	case "info":
+		return runModInfo(args[1:])
+	default:
+		return fmt.Errorf("unknown mod command %q", args[0])
+	}
+}
+
+// runModPack packages overrides into a mod. Without override files, the
+// fields the installed data changes from vanilla become the override.
+func runModPack(args []string) error {
+	fs := newFlagSet("mod pack")
+	name := fs.String("name", "", "Name of the mod")
+	version := fs.String("version", "1.0.0", "Version of the mod")
+	author := fs.String("author", "", "Author of the mod")
+	description := fs.String("description", "", "One-line description of the mod")
+	from := fs.String("from", sourceVanilla, "Source the mod was made from, when no override files are given")
+	to := fs.String("to", sourceCurrent, "Modded source, when no override files are given")
+	out := fs.String("o", "", "Path of the package to write (default <name>-<version>.kufmod)")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *name == "" {
+		return errors.New("-name is required, e.g. mod pack -name \"Faster Knights\"")
+	}
+
+	installed, err := readTroopInfoSOX(troopInfoPath)
+	if err != nil {
+		return err
+	}
+
+	manifest := modManifest{
+		Format:      modFormat,
+		Name:        *name,
+		Version:     *version,
+		Author:      *author,
+		Description: *description,
+		GameVersion: installed.Version,
+	}
+
+	overrides := map[string][]byte{}
+
+	if fs.NArg() == 0 {
+		a, err := loadTroopSource(*from)
+		if err != nil {
+			return err
+		}
+
+		b, err := loadTroopSource(*to)
+		if err != nil {
+			return err
+		}
+
+		data, err := troopOverride(a, b)
+		if err != nil {
+			return err
+		}
+
+		manifest.GameVersion = b.Version
+		manifest.Overrides = []string{"TroopInfo.yaml"}
+		overrides["TroopInfo.yaml"] = data
+	}
+
+	for _, path := range fs.Args() {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		if _, err := decodeTroopInfoYAML(path, data, installed); err != nil {
+			return err
+		}
+
+		entry := filepath.Base(path)
+		if _, ok := overrides[entry]; ok {
+			return fmt.Errorf("two overrides are named %s", entry)
+		}
+
+		manifest.Overrides = append(manifest.Overrides, entry)
+		overrides[entry] = data
+	}
+
+	data, err := createModPackage(manifest, overrides)
+	if err != nil {
+		return err
+	}
+
+	if *out == "" {
+		*out = nonFileNameChars.ReplaceAllString(manifest.Name+"-"+manifest.Version, "_") + modExt
+	}
+
+	if err := ioutil.WriteFile(*out, data, 0644); err != nil {
+		return err
+	}
+
+	log.Info().Msg(tr("Wrote %s", *out))
+
+	return nil
+}
+
+// createModPackage returns the package of manifest and its overrides.
+func createModPackage(manifest modManifest, overrides map[string][]byte) ([]byte, error) {
+	manifestData, err := yaml.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+
+	entries := []string{modManifestName}
+	entries = append(entries, manifest.Overrides...)
+
+	for _, name := range entries {
+		data := overrides[name]
+		if name == modManifestName {
+			data = manifestData
+		}
+
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// troopOverride returns the TroopInfo.yaml override holding the fields that
+// differ between from and to.
+func troopOverride(from, to troopInfoSOX) ([]byte, error) {
+	troops := &yaml.Node{Kind: yaml.MappingNode}
+	roster := newTroopRoster(to)
+
+	for i, ref := range counterparts(&from, to) {
+		if ref == nil {
+			log.Warn().Msg(tr("Leaving out %s, which the original file doesn't have; add it with troop add", troopNameIn(roster, i)))
+			continue
+		}
+
+		a, err := valueNode(*ref)
+		if err != nil {
+			return nil, err
+		}
+
+		b, err := valueNode(to.TroopInfos[i])
+		if err != nil {
+			return nil, err
+		}
+
+		if changed := changedNodes(a, b); changed != nil {
+			troops.Content = append(troops.Content, &yaml.Node{
+				Kind:        yaml.ScalarNode,
+				Value:       roster.key(i),
+				HeadComment: troopNameIn(roster, i),
+			}, changed)
+		}
+	}
+
+	if len(troops.Content) == 0 {
+		return nil, errors.New("the mod doesn't change anything")
+	}
+
+	return encodeYAMLNode(&yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{
+		Kind:    yaml.MappingNode,
+		Content: []*yaml.Node{{Kind: yaml.ScalarNode, Value: troopsKey}, troops},
+	}}})
+}
+
+// changedNodes returns the parts of b that differ from a, or nil if they are
+// the same. Mappings are reduced to their changed keys; sequences are kept
+// whole since arrays such as level_up_data decode from all their elements.
+func changedNodes(a, b *yaml.Node) *yaml.Node {
+	if a.Kind != yaml.MappingNode || b.Kind != yaml.MappingNode {
+		if sameNodes(a, b) {
+			return nil
+		}
+
+		return b
+	}
+
+	out := &yaml.Node{Kind: yaml.MappingNode}
+
+	for i := 0; i+1 < len(b.Content); i += 2 {
+		key, value := b.Content[i], b.Content[i+1]
+
+		if old := mappingValue(a, key.Value); old != nil {
+			value = changedNodes(old, value)
+		}
+
+		if value != nil {
+			out.Content = append(out.Content, key, value)
+		}
+	}
+
+	if len(out.Content) == 0 {
+		return nil
+	}
+
+	return out
+}
+
+func sameNodes(a, b *yaml.Node) bool {
+	if a.Kind != b.Kind || a.Value != b.Value || len(a.Content) != len(b.Content) {
+		return false
+	}
+
+	for i := range a.Content {
+		if !sameNodes(a.Content[i], b.Content[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// readModPackage opens a mod package and reads its manifest.
+func readModPackage(path string) (*zipStorage, modManifest, error) {
+	var manifest modManifest
+
+	z, err := openZipStorage(path)
+	if err != nil {
+		return nil, manifest, err
+	}
+
+	data, err := z.ReadFile(modManifestName)
+	if err != nil {
+		return nil, manifest, fmt.Errorf("%s: not a mod package: %w", path, err)
+	}
+
+	if err := yaml.Unmarshal(data, &manifest); err != nil {
+		return nil, manifest, newYAMLError(path+":"+modManifestName, data, err)
+	}
+
+	if manifest.Format > modFormat {
+		return nil, manifest, fmt.Errorf("%s: mod format %d is newer than this tool supports (%d)", path, manifest.Format, modFormat)
+	}
+
+	return z, manifest, nil
+}
+
+// runModInstall adds a mod package to the end of the load order, or
+// replaces an installed version of it in place, and rebuilds the installed
+// TroopInfo.sox.
+func runModInstall(args []string) error {
+	fs := newFlagSet("mod install")
+	dryRun := fs.Bool("dry-run", false, "Print the changes without writing them")
+	force := fs.Bool("force", false, "Installs a mod made for another version of TroopInfo.sox")
+	discard := fs.Bool("discard", false, "Discards changes of the installed TroopInfo.sox that no mod made")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		return errors.New("expected a mod package, e.g. mod install faster-knights-1.0.0.kufmod")
+	}
+
+	path := fs.Arg(0)
+
+	_, manifest, err := readModPackage(path)
+	if err != nil {
+		return err
+	}
+
+	installed, err := readTroopInfoSOX(troopInfoPath)
+	if err != nil {
+		return err
+	}
+
+	if manifest.GameVersion != installed.Version {
+		if !*force {
+			return fmt.Errorf("%s %s was made for version %d of %s, the installed file is version %d; install it with -force anyway", manifest.Name, manifest.Version, manifest.GameVersion, troopInfoFile.Name, installed.Version)
+		}
+
+		log.Warn().Msg(tr("%s %s was made for version %d of %s, the installed file is version %d", manifest.Name, manifest.Version, manifest.GameVersion, troopInfoFile.Name, installed.Version))
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	mods, err := readLoadOrder()
+	if err != nil {
+		return err
+	}
+
+	m := installedMod{
+		Name:    manifest.Name,
+		Version: manifest.Version,
+		File:    nonFileNameChars.ReplaceAllString(manifest.Name+"-"+manifest.Version, "_") + modExt,
+	}
+
+	// A dry run builds from the package where it is, since nothing may be
+	// copied into the mods directory.
+	if *dryRun {
+		if m.File, err = filepath.Abs(path); err != nil {
+			return err
+		}
+	}
+
+	var replaced string
+
+	if i, err := findMod(mods, m.Name); err == nil {
+		replaced = mods[i].File
+		mods[i] = m
+	} else {
+		mods = append(mods, m)
+	}
+
+	if !*dryRun {
+		if err := os.MkdirAll(modsDir, 0700); err != nil {
+			return err
+		}
+
+		if err := ioutil.WriteFile(filepath.Join(modsDir, m.File), data, 0600); err != nil {
+			return err
+		}
+	}
+
+	if err := rebuildMods("mod install", mods, *discard, *dryRun); err != nil {
+		return err
+	}
+
+	if *dryRun {
+		return nil
+	}
+
+	if replaced != "" && replaced != m.File {
+		if err := os.Remove(filepath.Join(modsDir, replaced)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	log.Info().Msg(tr("Installed %s %s", manifest.Name, manifest.Version))
+
+	return nil
+}
+
+// runModInfo prints the manifest of a mod package.
+func runModInfo(args []string) error {
+	fs := newFlagSet("mod info")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		return errors.New("expected a mod package")
+	}
+
+	_, manifest, err := readModPackage(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s %s\n", manifest.Name, manifest.Version)
+
+	if manifest.Author != "" {
+		fmt.Println(tr("Author: %s", manifest.Author))
+	}
+
+	if manifest.Description != "" {
+		fmt.Println(manifest.Description)
+	}
+
+	fmt.Println(tr("Made for version %d of %s", manifest.GameVersion, troopInfoFile.Name))
+	fmt.Println(tr("Overrides: %s", strings.Join(manifest.Overrides, ", ")))
+
+	return nil
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// modsDir holds the installed mod packages and their load order. The
+// installed TroopInfo.sox is always vanilla with the mods applied on top in
+// that order, so any of them can be removed or reordered by rebuilding it.
+var modsDir = filepath.Join(soxDir, "mods")
+
+// modOrderFile lists the installed mods in load order.
+const modOrderFile = "load-order.yaml"
+
+var errNoMod = errors.New("no such mod")
+
+// installedMod is an entry of the load order. File is the package in
+// modsDir.
+type installedMod struct {
+	Name    string `yaml:"name"`
+	Version string `yaml:"version"`
+	File    string `yaml:"file"`
+}
+
+// path returns where the package of m is.
+func (m installedMod) path() string {
+	if filepath.IsAbs(m.File) {
+		return m.File
+	}
+
+	return filepath.Join(modsDir, m.File)
+}
+
+// modConflict is a field changed by two mods, of which the later one wins.
+type modConflict struct {
+	Field  string
+	First  string
+	Second string
+}
+
+func (c modConflict) String() string {
+	return tr("%s and %s both change %s; %[2]s is loaded later and wins", c.First, c.Second, c.Field)
+}
+
+// readLoadOrder returns the installed mods in load order.
+func readLoadOrder() ([]installedMod, error) {
+	data, err := ioutil.ReadFile(filepath.Join(modsDir, modOrderFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var mods []installedMod
+
+	if err := yaml.Unmarshal(data, &mods); err != nil {
+		return nil, newYAMLError(filepath.Join(modsDir, modOrderFile), data, err)
+	}
+
+	return mods, nil
+}
+
+func writeLoadOrder(mods []installedMod) error {
+	if err := os.MkdirAll(modsDir, 0700); err != nil {
+		return err
+	}
+
+	data, err := yaml.Marshal(mods)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(modsDir, modOrderFile), data, 0600)
+}
+
+// findMod returns the position of the mod named name in the load order.
+func findMod(mods []installedMod, name string) (int, error) {
+	for i, m := range mods {
+		if strings.EqualFold(m.Name, name) {
+			return i, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w %q", errNoMod, name)
+}
+
+// applyMod returns tis with the overrides of the mod package at path applied.
+func applyMod(path string, tis troopInfoSOX) (troopInfoSOX, error) {
+	z, manifest, err := readModPackage(path)
+	if err != nil {
+		return troopInfoSOX{}, err
+	}
+
+	for _, name := range manifest.Overrides {
+		data, err := z.ReadFile(name)
+		if err != nil {
+			return troopInfoSOX{}, fmt.Errorf("%s: %w", path, err)
+		}
+
+		if tis, err = decodeTroopInfoYAML(path+":"+name, data, tis); err != nil {
+			return troopInfoSOX{}, err
+		}
+	}
+
+	return tis, nil
+}
+
+// buildMods applies mods to vanilla in load order and reports the fields
+// more than one of them changes.
+func buildMods(vanilla troopInfoSOX, mods []installedMod) (troopInfoSOX, []modConflict, error) {
+	var conflicts []modConflict
+
+	owners := map[string]string{}
+	tis := vanilla
+
+	for _, m := range mods {
+		path := m.path()
+
+		alone, err := applyMod(path, vanilla)
+		if err != nil {
+			return troopInfoSOX{}, nil, err
+		}
+
+		for _, c := range diffRecords(troopRecords(vanilla), troopRecords(alone)) {
+			field := c.Record + "." + c.Field
+
+			if owner, ok := owners[field]; ok {
+				conflicts = append(conflicts, modConflict{Field: field, First: owner, Second: m.Name})
+			}
+
+			owners[field] = m.Name
+		}
+
+		if tis, err = applyMod(path, tis); err != nil {
+			return troopInfoSOX{}, nil, err
+		}
+	}
+
+	return tis, conflicts, nil
+}
+
+// rebuildMods writes vanilla with mods applied to the installed
+// TroopInfo.sox and saves mods as the load order. Changes of the installed
+// file that the previous load order doesn't explain would be lost, so they
+// are an error unless discard is set.
+func rebuildMods(op string, mods []installedMod, discard, dryRun bool) error {
+	vanilla, err := loadVanilla()
+	if err != nil {
+		return fmt.Errorf("mods are applied on top of vanilla, which is missing: %w", err)
+	}
+
+	installed, err := readTroopInfoSOX(troopInfoPath)
+	if err != nil {
+		return err
+	}
+
+	previous, err := readLoadOrder()
+	if err != nil {
+		return err
+	}
+
+	expected, _, err := buildMods(vanilla, previous)
+	if err != nil {
+		return err
+	}
+
+	if unmanaged := diffRecords(troopRecords(expected), troopRecords(installed)); len(unmanaged) > 0 && !discard {
+		return fmt.Errorf("%s has changes to %d fields that no installed mod made, which rebuilding it would lose; pack them as a mod with mod pack, or pass -discard", troopInfoFile.Name, len(unmanaged))
+	}
+
+	after, conflicts, err := buildMods(vanilla, mods)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range conflicts {
+		log.Warn().Msg(c.String())
+	}
+
+	changes := diffRecords(troopRecords(installed), troopRecords(after))
+	printChangeSummary(os.Stdout, changes, true)
+
+	if dryRun {
+		return nil
+	}
+
+	// The load order is only saved once the installed file matches it, or
+	// a refused write would leave it listing mods that aren't applied.
+	if len(changes) == 0 {
+		return writeLoadOrder(mods)
+	}
+
+	buf := &bytes.Buffer{}
+
+	if err := encodeTroopInfoSOX(buf, after); err != nil {
+		return err
+	}
+
+	if err := installSOX(buf.Bytes()); err != nil {
+		return err
+	}
+
+	if err := writeLoadOrder(mods); err != nil {
+		return err
+	}
+
+	recordHistory(op, troopInfoFile.Name, changes, buf.Bytes())
+
+	log.Info().Msg(tr("Wrote %s", troopInfoPath))
+
+	return nil
+}
+
+// listMods prints the installed mods in load order and the fields they
+// fight over.
+func listMods() error {
+	mods, err := readLoadOrder()
+	if err != nil {
+		return err
+	}
+
+	if len(mods) == 0 {
+		fmt.Println(tr("No mods are installed"))
+		return nil
+	}
+
+	for i, m := range mods {
+		fmt.Printf("%d. %s %s\n", i+1, m.Name, m.Version)
+	}
+
+	vanilla, err := loadVanilla()
+	if err != nil {
+		return err
+	}
+
+	_, conflicts, err := buildMods(vanilla, mods)
+	if err != nil {
+		return err
+	}
+
+	if len(conflicts) > 0 {
+		fmt.Println()
+	}
+
+	for _, c := range conflicts {
+		fmt.Println(c)
+	}
+
+	return nil
+}
+
+// runModUninstall removes a mod and rebuilds the installed file from
+// vanilla and the remaining mods.
+func runModUninstall(args []string) error {
+	fs := newFlagSet("mod uninstall")
+	discard := fs.Bool("discard", false, "Discards changes of the installed TroopInfo.sox that no mod made")
+	dryRun := fs.Bool("dry-run", false, "Print the changes without writing them")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		return errors.New("expected the name of an installed mod")
+	}
+
+	mods, err := readLoadOrder()
+	if err != nil {
+		return err
+	}
+
+	i, err := findMod(mods, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	removed := mods[i]
+	remaining := append(append([]installedMod(nil), mods[:i]...), mods[i+1:]...)
+
+	if err := rebuildMods("mod uninstall", remaining, *discard, *dryRun); err != nil {
+		return err
+	}
+
+	if *dryRun {
+		return nil
+	}
+
+	if err := os.Remove(removed.path()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	log.Info().Msg(tr("Uninstalled %s %s", removed.Name, removed.Version))
+
+	return nil
+}
+
+// runModOrder changes the load order: the named mods are loaded last, in the
+// order given, so they win the conflicts with the others.
+func runModOrder(args []string) error {
+	fs := newFlagSet("mod order")
+	discard := fs.Bool("discard", false, "Discards changes of the installed TroopInfo.sox that no mod made")
+	dryRun := fs.Bool("dry-run", false, "Print the changes without writing them")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		return errors.New("expected the mods to load last, in order")
+	}
+
+	mods, err := readLoadOrder()
+	if err != nil {
+		return err
+	}
+
+	position := map[string]int{}
+
+	for i, name := range fs.Args() {
+		j, err := findMod(mods, name)
+		if err != nil {
+			return err
+		}
+
+		position[mods[j].Name] = i + 1
+	}
+
+	ordered := append([]installedMod(nil), mods...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return position[ordered[i].Name] < position[ordered[j].Name]
+	})
+
+	if err := rebuildMods("mod order", ordered, *discard, *dryRun); err != nil {
+		return err
+	}
+
+	if *dryRun {
+		return nil
+	}
+
+	return listMods()
+}
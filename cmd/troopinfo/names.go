@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// loadCustomTroopNames reads customTroopNames from customTroopNamesFile in
+// dir. Its entries are resolved against installedRoster, so it is read
+// again whenever that changes.
+func loadCustomTroopNames(dir string) {
+	custom, err := readCustomTroopNames(dir)
+	if err != nil {
+		log.Warn().Err(err).Msg(tr("Ignoring %s", customTroopNamesFile))
+		return
+	}
+
+	customTroopNames = custom
+}
+
+// valueName returns the display name of the value of an ID field, such as
+// the troop a type_id stands for, or "" if it has none.
+func valueName(field, value string) string {
+	id, err := strconv.ParseInt(value, 10, 32)
+	if err != nil {
+		return ""
+	}
+
+	if field != "type_id" || id < 0 || int(id) >= len(troopNames) {
+		return ""
+	}
+
+	// The record of the type may have a name of its own.
+	if i, ok := installedRoster.record(int(id)); ok {
+		return troopName(i)
+	}
+
+	return troopNames[id]
+}
+
+// describeValue returns value followed by its display name, if it has one,
+// e.g. "5 (Knight)".
+func describeValue(field, value string) string {
+	if name := valueName(field, value); name != "" {
+		return fmt.Sprintf("%s (%s)", value, name)
+	}
+
+	return value
+}
+
+// customTroopNames are the names of customTroopNamesFile by record index of
+// the installed TroopInfo.sox.
+var customTroopNames = map[int]string{}
+
+// customTroopNamesFile names troops by record index or troop key, e.g.
+//
+//	knight: Holy Knight
+//	43: Elven Rangers
+//
+// renaming retail troops and naming the troops added with troop add. It lives
+// in the SOX directory next to TroopInfo.yaml.
+const customTroopNamesFile = "TroopNames.yaml"
+
+// readCustomTroopNames returns the names of customTroopNamesFile by record
+// index. Entries naming no troop are skipped with a warning.
+func readCustomTroopNames(dir string) (map[int]string, error) {
+	entries, err := readCustomTroopNameEntries(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	names := map[int]string{}
+
+	for key, name := range entries {
+		i, err := strconv.Atoi(key)
+		if err != nil {
+			i, err = troopKeyIndex(key)
+		}
+
+		if err != nil || i < 0 || i >= maxTroopRecords {
+			log.Warn().Msg(tr("Ignoring %s entry %q, which names no troop; use a record index or a troop key such as knight", customTroopNamesFile, key))
+			continue
+		}
+
+		names[i] = name
+	}
+
+	return names, nil
+}
+
+// readCustomTroopNameEntries returns the entries of customTroopNamesFile as
+// written.
+func readCustomTroopNameEntries(dir string) (map[string]string, error) {
+	entries := map[string]string{}
+
+	path := filepath.Join(dir, customTroopNamesFile)
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := yaml.Unmarshal(data, &entries); err != nil {
+		return nil, newYAMLError(path, data, err)
+	}
+
+	return entries, nil
+}
+
+// addCustomTroopName records name as the name of the troop at index i and
+// makes it the troop's display name.
+func addCustomTroopName(dir string, i int, name string) error {
+	entries, err := readCustomTroopNameEntries(dir)
+	if err != nil {
+		return err
+	}
+
+	delete(entries, strconv.Itoa(i))
+	entries[troopKey(i)] = name
+
+	data, err := yaml.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, customTroopNamesFile), data, 0600); err != nil {
+		return err
+	}
+
+	loadCustomTroopNames(dir)
+
+	return nil
+}
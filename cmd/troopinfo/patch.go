@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rdeusser/troopinfo/kuftc"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// patchDocument is a set of rules applied to the data files, e.g.
+//
+//	rules:
+//	  # 10% more HP in every table
+//	  - file: "*"
+//	    field: "*_hp*"
+//	    multiply: 1.1
+//	  - file: TroopInfo
+//	    record: "Orc *"
+//	    field: defense
+//	    add: 5
+//
+// Targets are resolved against the schema registry, so a single rule can
+// reach every file that has a matching field.
+type patchDocument struct {
+	Rules []patchRule `yaml:"rules"`
+}
+
+// patchRule changes every field matched by its file, record and field
+// patterns; see kuftc.Rule. Record patterns match display names here, and
+// field patterns may use aliases.
+type patchRule kuftc.Rule
+
+// matchPattern reports whether name matches pattern, in which * matches any
+// run of characters and everything else is literal.
+func matchPattern(pattern, name string) bool {
+	return kuftc.Match(pattern, name)
+}
+
+// matchesFile reports whether the rule targets df.
+func (r patchRule) matchesFile(df dataFile) bool {
+	return kuftc.Rule(r).MatchesFile(df.Name)
+}
+
+func (r patchRule) validate() error {
+	return kuftc.Rule(r).Validate()
+}
+
+func (r patchRule) String() string {
+	target := fmt.Sprintf("%s %s %s", orAny(r.File), orAny(r.Record), orAny(r.Field))
+
+	switch {
+	case r.Set != nil:
+		return fmt.Sprintf("%s = %g", target, *r.Set)
+	case r.Add != nil:
+		return fmt.Sprintf("%s + %g", target, *r.Add)
+	default:
+		return fmt.Sprintf("%s * %g", target, *r.Multiply)
+	}
+}
+
+func orAny(pattern string) string {
+	if pattern == "" {
+		return "*"
+	}
+
+	return pattern
+}
+
+func (r patchRule) apply(v float64) float64 {
+	return kuftc.Rule(r).Apply(v)
+}
+
+func runPatch(args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "create":
+			return runPatchCreate(args[1:])
+		case "apply":
+			return runPatchApply(args[1:])
+		}
+	}
+
+	fs := newFlagSet("patch")
+	dir := fs.String("dir", soxDir, "Directory or zip archive of the data files to patch")
+	dryRun := fs.Bool("dry-run", false, "Print the changes without writing them")
+	details := fs.Bool("details", false, "List every changed value instead of a per-record summary")
+	trace := fs.String("trace", "", "Comma-separated fields or patterns whose value to show after each rule, to find the rule behind a final value")
+	traceRecords := fs.String("trace-record", "", "Only trace records matching this pattern, e.g. \"Orc *\"")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		return errors.New("expected a patch document")
+	}
+
+	data, err := ioutil.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	var doc patchDocument
+
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return newYAMLError(fs.Arg(0), data, err)
+	}
+
+	for _, r := range doc.Rules {
+		if err := r.validate(); err != nil {
+			return err
+		}
+	}
+
+	st, err := openStorage(*dir)
+	if err != nil {
+		return err
+	}
+
+	for _, df := range dataFiles {
+		before, err := st.ReadFile(df.Name)
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err := df.checkData(df.Name, before); err != nil {
+			return err
+		}
+
+		after, err := patchDataFile(df, before, doc.Rules)
+		if err != nil {
+			return fmt.Errorf("%s: %w", df.Name, err)
+		}
+
+		if *trace != "" {
+			if err := printPatchTrace(os.Stdout, df, before, doc.Rules, strings.Split(*trace, ","), *traceRecords); err != nil {
+				return fmt.Errorf("%s: %w", df.Name, err)
+			}
+		}
+
+		a, err := df.decode(bytes.NewReader(before))
+		if err != nil {
+			return err
+		}
+
+		b, err := df.decode(bytes.NewReader(after))
+		if err != nil {
+			return err
+		}
+
+		changes := diffRecords(a, b)
+		if len(changes) == 0 {
+			continue
+		}
+
+		fmt.Println(df.Name)
+		printChangeSummary(os.Stdout, changes, *details)
+
+		if *dryRun {
+			continue
+		}
+
+		if err := st.WriteFile(df.Name, after); err != nil {
+			return err
+		}
+
+		recordHistory("patch", filepath.Join(st.String(), df.Name), changes, after)
+
+		log.Info().Msg(tr("Wrote %s", filepath.Join(st.String(), df.Name)))
+	}
+
+	return nil
+}
+
+// patchDataFile applies rules to a copy of the data file contents, using the
+// schema of df to find each field.
+func patchDataFile(df dataFile, data []byte, rules []patchRule) ([]byte, error) {
+	records, err := df.decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	s := df.schemaFor(int32(binary.LittleEndian.Uint32(data[0:4])))
+	out := append([]byte(nil), data...)
+
+	for _, r := range rules {
+		if !r.matchesFile(df) {
+			continue
+		}
+
+		for i, rec := range records {
+			if !matchPattern(r.Record, rec.Name) {
+				continue
+			}
+
+			for _, f := range s.Fields {
+				if !matchPattern(resolveFieldName(r.Field), f.Name) {
+					continue
+				}
+
+				offset := headerSize(s) + i*s.RecordSize + f.Offset
+				if offset+f.Size > len(out) {
+					return nil, errInvalidSOX
+				}
+
+				patchValue(out[offset:offset+f.Size], f.Type, r)
+			}
+		}
+	}
+
+	return out, nil
+}
+
+// patchValue applies r to the little-endian value of the given type in b.
+// Integer results are rounded to the nearest whole number.
+func patchValue(b []byte, typ string, r patchRule) {
+	switch typ {
+	case "float32":
+		v := math.Float32frombits(binary.LittleEndian.Uint32(b))
+		binary.LittleEndian.PutUint32(b, math.Float32bits(float32(r.apply(float64(v)))))
+	case "int32":
+		v := int32(binary.LittleEndian.Uint32(b))
+		binary.LittleEndian.PutUint32(b, uint32(int32(math.Round(r.apply(float64(v))))))
+	}
+}
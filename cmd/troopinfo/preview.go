@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// printChangeSummary prints how many fields changed per record, in record
+// order. With details, every change is listed with its old and new value.
+func printChangeSummary(w io.Writer, changes []fieldChange, details bool) {
+	if len(changes) == 0 {
+		fmt.Fprintln(w, tr("No changes"))
+		return
+	}
+
+	var (
+		order   []string
+		records = map[string][]fieldChange{}
+	)
+
+	for _, c := range changes {
+		if _, ok := records[c.Record]; !ok {
+			order = append(order, c.Record)
+		}
+
+		records[c.Record] = append(records[c.Record], c)
+	}
+
+	for _, name := range order {
+		if n := len(records[name]); n == 1 {
+			fmt.Fprintln(w, tr("%s: 1 field changed", name))
+		} else {
+			fmt.Fprintln(w, tr("%s: %d fields changed", name, n))
+		}
+
+		if !details {
+			continue
+		}
+
+		for _, c := range records[name] {
+			fmt.Fprintf(w, "  %s: %s -> %s\n", c.Field, describeValue(c.Field, c.Old), describeValue(c.Field, c.New))
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"strconv"
+	"unicode/utf8"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// Colors of rendered diffs, a dark theme that reads well in chat apps.
+var (
+	renderBackground = color.RGBA{0x2b, 0x2d, 0x31, 0xff}
+	renderStripe     = color.RGBA{0x31, 0x33, 0x38, 0xff}
+	renderHeader     = color.RGBA{0x1e, 0x1f, 0x22, 0xff}
+	renderFg         = color.RGBA{0xdb, 0xde, 0xe1, 0xff}
+	renderDim        = color.RGBA{0x94, 0x9b, 0xa4, 0xff}
+	renderOld        = color.RGBA{0xf2, 0x3f, 0x43, 0xff}
+	renderNew        = color.RGBA{0x23, 0xa5, 0x59, 0xff}
+)
+
+const (
+	renderPadding = 8
+	renderRow     = 18
+)
+
+// renderDiffPNG draws changes as a table image, one change per row with the
+// old value in red, the new one in green and the numeric delta. The built-in
+// font only covers ASCII, so names in other scripts lose their other
+// characters.
+func renderDiffPNG(w io.Writer, title string, changes []fieldChange) error {
+	face := basicfont.Face7x13
+
+	header := []string{"TROOP", "FIELD", "OLD", "NEW", "DELTA"}
+	rows := make([][]string, len(changes))
+
+	for i, c := range changes {
+		rows[i] = []string{c.Record, c.Field, c.Old, c.New, changeDelta(c)}
+	}
+
+	widths := make([]int, len(header))
+	for j, h := range header {
+		widths[j] = utf8.RuneCountInString(h)
+	}
+
+	for _, row := range rows {
+		for j, v := range row {
+			if n := utf8.RuneCountInString(v); n > widths[j] {
+				widths[j] = n
+			}
+		}
+	}
+
+	width := renderPadding
+	for _, n := range widths {
+		width += n*face.Advance + 2*renderPadding
+	}
+
+	if n := utf8.RuneCountInString(title)*face.Advance + 2*renderPadding; n > width {
+		width = n
+	}
+
+	height := (len(rows)+2)*renderRow + 2*renderPadding
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: renderBackground}, image.Point{}, draw.Src)
+
+	text := func(x, y int, c color.Color, s string) {
+		d := font.Drawer{
+			Dst:  img,
+			Src:  &image.Uniform{C: c},
+			Face: face,
+			Dot:  fixed.P(x, y+face.Ascent+(renderRow-face.Height)/2),
+		}
+		d.DrawString(s)
+	}
+
+	fill := func(y int, c color.Color) {
+		draw.Draw(img, image.Rect(0, y, width, y+renderRow), &image.Uniform{C: c}, image.Point{}, draw.Src)
+	}
+
+	y := renderPadding
+	text(renderPadding, y, renderFg, title)
+	y += renderRow
+
+	drawRow := func(cells []string, colors []color.Color) {
+		x := renderPadding
+		for j, v := range cells {
+			text(x+renderPadding, y, colors[j], v)
+			x += widths[j]*face.Advance + 2*renderPadding
+		}
+
+		y += renderRow
+	}
+
+	fill(y, renderHeader)
+	drawRow(header, []color.Color{renderDim, renderDim, renderDim, renderDim, renderDim})
+
+	for i, row := range rows {
+		if i%2 == 1 {
+			fill(y, renderStripe)
+		}
+
+		drawRow(row, []color.Color{renderFg, renderFg, renderOld, renderNew, renderDim})
+	}
+
+	return png.Encode(w, img)
+}
+
+// changeDelta returns the signed difference of a numeric change, or "" if
+// either value isn't a number.
+func changeDelta(c fieldChange) string {
+	a, errA := strconv.ParseFloat(c.Old, 64)
+	b, errB := strconv.ParseFloat(c.New, 64)
+
+	if errA != nil || errB != nil {
+		return ""
+	}
+
+	d := float64(float32(b - a))
+	if d > 0 {
+		return "+" + strconv.FormatFloat(d, 'g', -1, 32)
+	}
+
+	return strconv.FormatFloat(d, 'g', -1, 32)
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// indexReference is a set of files that refer to troops by their record
+// index and have to be rewritten when records move. perm maps new indexes to
+// old ones, and old is the roster from before the move. Troop keys of retail
+// types name the troop type rather than the index, so only files in the
+// legacy list layout and the troop_<index> keys of other troops change.
+type indexReference struct {
+	Name string
+	fix  func(perm []int, old troopRoster) error
+}
+
+// troopIndexReferences are fixed up by reorder, in order. The names come
+// first, since the YAML files note them in comments.
+var troopIndexReferences = []indexReference{
+	{
+		Name: customTroopNamesFile,
+		fix:  reorderCustomTroopNames,
+	},
+	{
+		Name: "TroopInfo.yaml",
+		fix: func(perm []int, old troopRoster) error {
+			return reorderTroopInfoYAML(troopInfoYAMLPath, perm, old)
+		},
+	},
+	{
+		Name: "variants",
+		fix:  reorderVariants,
+	},
+}
+
+func runReorder(args []string) error {
+	fs := newFlagSet("reorder")
+	dryRun := fs.Bool("dry-run", false, "Print the new order without writing anything")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 2 {
+		return errors.New("expected a troop name and its new index")
+	}
+
+	data, err := ioutil.ReadFile(troopInfoPath)
+	if err != nil {
+		return err
+	}
+
+	tis, err := decodeTroopInfoSOX(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	from, err := troopRecord(tis, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	to, err := strconv.Atoi(fs.Arg(1))
+	if err != nil || to < 0 || to >= len(tis.TroopInfos) {
+		return fmt.Errorf("new index must be between 0 and %d", len(tis.TroopInfos)-1)
+	}
+
+	perm := movePermutation(len(tis.TroopInfos), from, to)
+
+	if *dryRun {
+		for i, old := range perm {
+			fmt.Printf("%d: %s\n", i, troopName(old))
+		}
+
+		return nil
+	}
+
+	for i, old := range perm {
+		if err := putTroopRecord(data, i, tis.TroopInfos[old]); err != nil {
+			return err
+		}
+	}
+
+	name := troopName(from)
+	old := newTroopRoster(tis)
+
+	if err := installSOX(data); err != nil {
+		return err
+	}
+
+	for _, ref := range troopIndexReferences {
+		if err := ref.fix(perm, old); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("%s: %w", ref.Name, err)
+		}
+	}
+
+	log.Info().Msg(tr("Moved %s from %d to %d", name, from, to))
+
+	return nil
+}
+
+// movePermutation returns the order of n records after moving the record at
+// from to to, as a slice of old indexes.
+func movePermutation(n, from, to int) []int {
+	perm := make([]int, 0, n)
+
+	for i := 0; i < n; i++ {
+		if i != from {
+			perm = append(perm, i)
+		}
+	}
+
+	perm = append(perm[:to], append([]int{from}, perm[to:]...)...)
+
+	return perm
+}
+
+// newIndexes inverts perm, mapping old indexes to new ones.
+func newIndexes(perm []int) map[int]int {
+	moved := make(map[int]int, len(perm))
+	for i, old := range perm {
+		moved[old] = i
+	}
+
+	return moved
+}
+
+// reorderTroopInfoYAML moves the troops of the YAML file at path along with
+// their records, keeping their comments. In the keyed layout the troops are
+// sorted by their new indexes and keyed for them; in the legacy layout the
+// list is reordered.
+func reorderTroopInfoYAML(path string, perm []int, old troopRoster) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var doc yaml.Node
+
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	if troops := mappingValue(documentRoot(&doc), troopsKey); troops != nil {
+		nodes, err := troopNodesIn(path, data, &doc, old)
+		if err != nil {
+			return err
+		}
+
+		moved := newIndexes(perm)
+
+		for j := range nodes {
+			if i, ok := moved[nodes[j].Index]; ok {
+				nodes[j].Index = i
+			}
+		}
+
+		sort.SliceStable(nodes, func(a, b int) bool { return nodes[a].Index < nodes[b].Index })
+
+		troops.Content = nil
+
+		for _, n := range nodes {
+			n.Key.Value = troopKey(n.Index)
+			n.Key.HeadComment = fmt.Sprintf("%d -- %s", n.Index, troopName(n.Index))
+
+			troops.Content = append(troops.Content, n.Key, n.Value)
+		}
+	} else {
+		seq := mappingValue(documentRoot(&doc), legacyTroopsKey)
+		if seq == nil || seq.Kind != yaml.SequenceNode || len(seq.Content) != len(perm) {
+			return errors.New("troop_infos doesn't match the SOX file")
+		}
+
+		items := make([]*yaml.Node, len(perm))
+		for i, old := range perm {
+			items[i] = seq.Content[old]
+		}
+
+		seq.Content = items
+	}
+
+	out, err := encodeYAMLNode(&doc)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, out, 0600)
+}
+
+// reorderVariants moves the troops of every saved variant along with their
+// records, like the workspace TroopInfo.yaml.
+func reorderVariants(perm []int, old troopRoster) error {
+	entries, err := ioutil.ReadDir(variantsDir)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+
+		if err := reorderTroopInfoYAML(variantPath(e.Name()), perm, old); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("%s: %w", e.Name(), err)
+		}
+	}
+
+	return nil
+}
+
+// reorderCustomTroopNames moves the entries of customTroopNamesFile that
+// name troops by index along with their records.
+func reorderCustomTroopNames(perm []int, old troopRoster) error {
+	entries, err := readCustomTroopNameEntries(soxDir)
+	if err != nil {
+		return err
+	}
+
+	moved := newIndexes(perm)
+	fixed := make(map[string]string, len(entries))
+	changed := false
+
+	for key, name := range entries {
+		i, err := strconv.Atoi(key)
+		if err != nil {
+			if i, err = old.index(key); err != nil {
+				fixed[key] = name
+				continue
+			}
+		}
+
+		n, ok := moved[i]
+		if !ok {
+			fixed[key] = name
+			continue
+		}
+
+		// Numbers stay numbers; keys are whatever the troop goes by now.
+		newKey := troopKey(n)
+		if _, err := strconv.Atoi(key); err == nil {
+			newKey = strconv.Itoa(n)
+		}
+
+		changed = changed || newKey != key
+		fixed[newKey] = name
+	}
+
+	if !changed {
+		return nil
+	}
+
+	data, err := yaml.Marshal(fixed)
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(soxDir, customTroopNamesFile), data, 0600); err != nil {
+		return err
+	}
+
+	loadCustomTroopNames(soxDir)
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReorderKeepsVariantsWithTheirTroops(t *testing.T) {
+	newTestGame(t)
+
+	knight, err := troopKeyIndex("knight")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archer, err := troopKeyIndex("archer")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runCommand(t, runDump)
+	runCommand(t, runSet, "-where", `key == "knight"`, "-expr", "defense = 77")
+	runCommand(t, runVariant, "save", "strong-knights")
+	runCommand(t, runReorder, "Knight", "0")
+
+	tis := readInstalled(t)
+
+	if got := tis.TroopInfos[0].TypeID; got != int32(knight) {
+		t.Fatalf("record 0 is of type %d after the reorder, want %d", got, knight)
+	}
+
+	data, err := ioutil.ReadFile(troopInfoYAMLPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if i := strings.Index(string(data), "knight:"); i < 0 || i > strings.Index(string(data), "archer:") {
+		t.Errorf("knight isn't the first troop of TroopInfo.yaml after the reorder:\n%s", data)
+	}
+
+	runCommand(t, runVariant, "switch", "strong-knights")
+
+	tis = readInstalled(t)
+
+	if got := tis.TroopInfos[0]; got.TypeID != int32(knight) || got.Defense != 77 {
+		t.Errorf("record 0 is of type %d with defense %g, want the knight with the defense of the variant, 77", got.TypeID, got.Defense)
+	}
+
+	if got := tis.TroopInfos[archer+1]; got.TypeID != int32(archer) || got.Defense != float32(10+archer) {
+		t.Errorf("record %d is of type %d with defense %g, want the archer with its own defense, %d", archer+1, got.TypeID, got.Defense, 10+archer)
+	}
+}
+
+func TestReorderMovesIndexedNames(t *testing.T) {
+	game := newTestGame(t)
+
+	names := filepath.Join(soxDir, customTroopNamesFile)
+
+	if err := ioutil.WriteFile(names, []byte("knight: Holy Knight\n\"0\": First\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	loadCustomTroopNames(soxDir)
+
+	runCommand(t, runReorder, "Holy Knight", "0")
+
+	if got := troopName(0); got != "Holy Knight" {
+		t.Errorf("record 0 is named %q, want Holy Knight (in %s)", got, game)
+	}
+
+	if got := troopName(1); got != "First" {
+		t.Errorf("record 1 is named %q, want First, the name of the record that moved there", got)
+	}
+}
+
+func TestReorderLeavesNoDifferences(t *testing.T) {
+	newTestGame(t)
+
+	data, err := ioutil.ReadFile(troopInfoPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(troopInfoBackupPath, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	runCommand(t, runReorder, "Knight", "0")
+
+	vanilla, err := loadVanilla()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	installed := readInstalled(t)
+
+	if changes := diffRecords(troopRecords(vanilla), troopRecords(installed)); len(changes) > 0 {
+		t.Errorf("the reordered file differs from vanilla in %d fields, e.g. %s", len(changes), changes[0])
+	}
+
+	if err := runDiff([]string{"-quiet", "-against-vanilla"}); err != nil {
+		t.Errorf("diff -against-vanilla after a reorder: %v", err)
+	}
+
+	if doc := createDelta(vanilla, installed); len(doc.Changes) > 0 {
+		t.Errorf("the delta of the reordered file has %d changes, e.g. %s", len(doc.Changes), doc.Changes[0])
+	}
+
+	installed.TroopInfos[0].Defense++
+
+	changes := diffRecords(troopRecords(vanilla), troopRecords(installed))
+	if len(changes) != 1 || changes[0].Record != "Knight" || changes[0].Field != "defense" {
+		t.Errorf("changing the defense of the moved Knight gives the changes %v, want Knight.defense", changes)
+	}
+}
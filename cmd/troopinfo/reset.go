@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// resetTarget is a troop and field pattern to revert, parsed from a spec
+// such as "Knight.move_speed", "Knight" or "*.resist_*".
+type resetTarget struct {
+	Troop string
+	Field string
+}
+
+func parseResetTarget(spec string) (resetTarget, error) {
+	troop, field := spec, ""
+	if i := strings.Index(spec, "."); i >= 0 {
+		troop, field = spec[:i], spec[i+1:]
+	}
+
+	troop, field = strings.TrimSpace(troop), strings.TrimSpace(field)
+	if troop == "" {
+		return resetTarget{}, fmt.Errorf("invalid field %q, expected <troop>.<field>, e.g. Knight.move_speed", spec)
+	}
+
+	return resetTarget{Troop: troop, Field: resolveFieldName(field)}, nil
+}
+
+// troops returns the indexes of the records of tis the target names.
+func (t resetTarget) troops(tis troopInfoSOX) ([]int, error) {
+	if !strings.Contains(t.Troop, "*") {
+		i, err := troopRecord(tis, t.Troop)
+		if err != nil {
+			return nil, err
+		}
+
+		return []int{i}, nil
+	}
+
+	var indexes []int
+
+	for i := range tis.TroopInfos {
+		if matchPattern(t.Troop, troopName(i)) || matchPattern(t.Troop, troopKey(i)) {
+			indexes = append(indexes, i)
+		}
+	}
+
+	if len(indexes) == 0 {
+		return nil, fmt.Errorf("no troop matches %q", t.Troop)
+	}
+
+	return indexes, nil
+}
+
+// fields returns the fields the target names: all of them without a field,
+// and every element of a group such as level_up_data.
+func (t resetTarget) fields() ([]troopField, error) {
+	var fields []troopField
+
+	for _, f := range troopFields {
+		if t.Field == "" || matchPattern(t.Field, f.Name) || strings.HasPrefix(f.Name, t.Field+"[") || strings.HasPrefix(f.Name, t.Field+".") {
+			fields = append(fields, f)
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("unknown field %q", t.Field)
+	}
+
+	return fields, nil
+}
+
+// resetFields returns a copy of tis with the fields named by targets set to
+// their vanilla values. Troops vanilla doesn't have are left alone.
+func resetFields(tis, vanilla troopInfoSOX, targets []resetTarget) (troopInfoSOX, error) {
+	after := tis.Clone()
+	refs := counterparts(&vanilla, tis)
+
+	for _, t := range targets {
+		troops, err := t.troops(tis)
+		if err != nil {
+			return troopInfoSOX{}, err
+		}
+
+		fields, err := t.fields()
+		if err != nil {
+			return troopInfoSOX{}, err
+		}
+
+		for _, i := range troops {
+			if refs[i] == nil {
+				log.Warn().Msg(tr("%s isn't a retail troop and has no vanilla values", troopName(i)))
+				continue
+			}
+
+			for _, f := range fields {
+				if err := f.Parse(&after.TroopInfos[i], f.Format(refs[i])); err != nil {
+					return troopInfoSOX{}, err
+				}
+			}
+		}
+	}
+
+	return after, nil
+}
+
+// runReset reverts single fields of the workspace TroopInfo.yaml to their
+// vanilla values, without restoring the whole file.
+func runReset(args []string) error {
+	fs := newFlagSet("reset")
+	all := fs.Bool("all", false, "Resets every field of every retail troop")
+	out := fs.String("o", troopInfoYAMLPath, "YAML file to reset the fields in")
+	dryRun := fs.Bool("dry-run", false, "Lists the fields that would be reset without writing anything")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *all == (fs.NArg() > 0) {
+		return errors.New("expected fields such as \"Knight.move_speed\", or -all")
+	}
+
+	vanilla, err := loadVanilla()
+	if err != nil {
+		return err
+	}
+
+	base, err := readTroopInfoSOX(troopInfoPath)
+	if err != nil {
+		return err
+	}
+
+	tis := base
+
+	_, statErr := os.Stat(*out)
+	if statErr == nil {
+		if tis, err = readTroopInfoYAML(*out, base); err != nil {
+			return err
+		}
+	}
+
+	targets := []resetTarget{{Troop: "*"}}
+
+	if !*all {
+		targets = nil
+
+		for _, spec := range fs.Args() {
+			t, err := parseResetTarget(spec)
+			if err != nil {
+				return err
+			}
+
+			targets = append(targets, t)
+		}
+	}
+
+	after, err := resetFields(tis, vanilla, targets)
+	if err != nil {
+		return err
+	}
+
+	changes := diffRecords(troopRecords(tis), troopRecords(after))
+	printChangeSummary(os.Stdout, changes, true)
+
+	if *dryRun || len(changes) == 0 {
+		return nil
+	}
+
+	if statErr == nil {
+		err = patchTroopInfoYAML(*out, tis, after)
+	} else {
+		err = writeTroopInfoYAML(*out, after)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	recordHistory("reset", *out, changes, nil)
+
+	log.Info().Msg(tr("Wrote %s", *out))
+
+	return nil
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// roster is a high-level description of the troops, for total conversions
+// that design troops by role and a few key stats rather than raw fields.
+type roster struct {
+	Troops []rosterTroop `yaml:"troops"`
+}
+
+// rosterTroop describes the troop in record Index. On import the record is
+// generated from the template troop of Role, or from Template if given, and
+// then the stats are applied. Faction is informational: the game decides
+// which side fields a troop.
+type rosterTroop struct {
+	Index    int         `yaml:"index"`
+	Name     string      `yaml:"name"`
+	Faction  string      `yaml:"faction,omitempty"`
+	Role     string      `yaml:"role"`
+	Template string      `yaml:"template,omitempty"`
+	Stats    rosterStats `yaml:"stats"`
+}
+
+// rosterStats are the key stats of a troop. Stats left out keep the value of
+// the template.
+type rosterStats struct {
+	HP           *float32 `yaml:"hp,omitempty"`
+	Attack       *float32 `yaml:"attack,omitempty"`
+	RangedAttack *float32 `yaml:"ranged_attack,omitempty"`
+	Defense      *float32 `yaml:"defense,omitempty"`
+	Speed        *float32 `yaml:"speed,omitempty"`
+	Range        *float32 `yaml:"range,omitempty"`
+	UnitsX       *int32   `yaml:"units_x,omitempty"`
+	UnitsY       *int32   `yaml:"units_y,omitempty"`
+}
+
+func runRoster(args []string) error {
+	if len(args) == 0 {
+		return errors.New("expected export or import")
+	}
+
+	switch args[0] {
+	case "export":
+		return runRosterExport(args[1:])
+	case "import":
+		return runRosterImport(args[1:])
+	default:
+		return fmt.Errorf("unknown roster command %q", args[0])
+	}
+}
+
+func runRosterExport(args []string) error {
+	fs := newFlagSet("roster export")
+	from := fs.String("from", sourceCurrent, "Data to export: current, vanilla, a file, or a reference such as @backup:latest")
+	out := fs.String("o", "roster.yaml", "Path of the roster file to write")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	tis, err := loadTroopSource(*from)
+	if err != nil {
+		return err
+	}
+
+	data, err := yaml.Marshal(rosterOf(tis))
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(*out, data, 0600); err != nil {
+		return err
+	}
+
+	log.Info().Msg(tr("Exported %s", *out))
+
+	return nil
+}
+
+func runRosterImport(args []string) error {
+	fs := newFlagSet("roster import")
+	from := fs.String("from", sourceVanilla, "Data the role templates are taken from")
+	out := fs.String("o", troopInfoYAMLPath, "Path of the YAML file to write")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		return errors.New("expected a roster file")
+	}
+
+	data, err := ioutil.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	var r roster
+
+	if err := yaml.Unmarshal(data, &r); err != nil {
+		return newYAMLError(fs.Arg(0), data, err)
+	}
+
+	templates, err := loadTroopSource(*from)
+	if err != nil {
+		return err
+	}
+
+	// Troops the roster doesn't mention keep their current records.
+	tis, err := readTroopInfoSOX(troopInfoPath)
+	if err != nil {
+		return err
+	}
+
+	before := tis.Clone()
+
+	if err := applyRoster(&tis, templates, r); err != nil {
+		return err
+	}
+
+	changes := diffRecords(troopRecords(before), troopRecords(tis))
+
+	printChangeSummary(os.Stdout, changes, false)
+	warnUnitCaps(tis)
+
+	if err := writeTroopInfoYAML(*out, tis); err != nil {
+		return err
+	}
+
+	recordHistory("roster import", *out, changes, nil)
+
+	log.Info().Msg(tr("Imported %s into %s", fs.Arg(0), *out))
+
+	return nil
+}
+
+// rosterOf describes every troop of tis.
+func rosterOf(tis troopInfoSOX) roster {
+	var r roster
+
+	for i := range tis.TroopInfos {
+		ti := tis.TroopInfos[i]
+		arch := troopArchetypeOf(i)
+
+		r.Troops = append(r.Troops, rosterTroop{
+			Index:   i,
+			Name:    troopName(i),
+			Faction: arch.Faction,
+			Role:    arch.Role,
+			Stats: rosterStats{
+				HP:           &ti.DefaultUnitHP,
+				Attack:       &ti.DirectAttack,
+				RangedAttack: &ti.IndirectAttack,
+				Defense:      &ti.Defense,
+				Speed:        &ti.MoveSpeed,
+				Range:        &ti.AttackRangeMax,
+				UnitsX:       &ti.DefaultUnitNumX,
+				UnitsY:       &ti.DefaultUnitNumY,
+			},
+		})
+	}
+
+	return r
+}
+
+// applyRoster regenerates the records of the troops in r from templates. The
+// type ID of each record is kept since the engine identifies troops by it.
+func applyRoster(tis *troopInfoSOX, templates troopInfoSOX, r roster) error {
+	for _, t := range r.Troops {
+		if t.Index < 0 || t.Index >= len(tis.TroopInfos) {
+			return fmt.Errorf("%s: index %d out of range", t.Name, t.Index)
+		}
+
+		template, err := rosterTemplate(t)
+		if err != nil {
+			return err
+		}
+
+		if template >= len(templates.TroopInfos) {
+			return fmt.Errorf("%s: template troop %s isn't in the vanilla data", t.Name, troopName(template))
+		}
+
+		ti := templates.TroopInfos[template]
+		ti.TypeID = tis.TroopInfos[t.Index].TypeID
+
+		s := t.Stats
+
+		for _, stat := range []struct {
+			value *float32
+			field *float32
+		}{
+			{s.HP, &ti.DefaultUnitHP},
+			{s.Attack, &ti.DirectAttack},
+			{s.RangedAttack, &ti.IndirectAttack},
+			{s.Defense, &ti.Defense},
+			{s.Speed, &ti.MoveSpeed},
+			{s.Range, &ti.AttackRangeMax},
+		} {
+			if stat.value != nil {
+				*stat.field = *stat.value
+			}
+		}
+
+		if s.UnitsX != nil {
+			ti.DefaultUnitNumX = *s.UnitsX
+		}
+
+		if s.UnitsY != nil {
+			ti.DefaultUnitNumY = *s.UnitsY
+		}
+
+		tis.TroopInfos[t.Index] = ti
+	}
+
+	return nil
+}
+
+// rosterTemplate returns the index of the troop t is generated from.
+func rosterTemplate(t rosterTroop) (int, error) {
+	if t.Template != "" {
+		return troopIndex(t.Template)
+	}
+
+	i, ok := roleTemplates[strings.ToLower(t.Role)]
+	if !ok {
+		roles := make([]string, 0, len(roleTemplates))
+		for role := range roleTemplates {
+			roles = append(roles, role)
+		}
+
+		sort.Strings(roles)
+
+		return 0, fmt.Errorf("%s: unknown role %q, expected one of %s", t.Name, t.Role, strings.Join(roles, ", "))
+	}
+
+	return i, nil
+}
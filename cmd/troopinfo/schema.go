@@ -0,0 +1,306 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rdeusser/troopinfo/kuftc"
+)
+
+// fileSchema is the binary layout of a supported data file, generated from
+// the same struct definitions the codecs use so the two can't drift apart.
+type fileSchema struct {
+	File        string       `json:"file"`
+	Version     int32        `json:"version"`
+	Header      []troopField `json:"header"`
+	RecordSize  int          `json:"record_size"`
+	Fields      []troopField `json:"fields"`
+	TrailerSize int          `json:"trailer_size"`
+}
+
+// soxHeaderFields are the little-endian int32 values every SOX file starts
+// with, ahead of its records.
+var soxHeaderFields = headerFields(reflect.TypeOf(troopInfoSOX{}))
+
+// soxTrailerSize is the size of the opaque block following the records.
+var soxTrailerSize = len(troopInfoSOX{}.TheEnd)
+
+func headerFields(t reflect.Type) []troopField {
+	var fields []troopField
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Type.Kind() != reflect.Int32 {
+			break
+		}
+
+		fields = append(fields, troopField{
+			Name:   f.Tag.Get("yaml"),
+			Type:   f.Type.Kind().String(),
+			Offset: int(f.Offset),
+			Size:   int(f.Type.Size()),
+			Doc:    f.Tag.Get("doc"),
+		})
+	}
+
+	return fields
+}
+
+// schema returns the layout of df in the current file version.
+func (df dataFile) schema() fileSchema {
+	return df.schemaFor(soxVersion)
+}
+
+// schemaFor returns the layout of df in files of the given version. Fields
+// tagged with since or until are left out of the versions that lack them.
+func (df dataFile) schemaFor(version int32) fileSchema {
+	fields := fieldsForVersion(flattenFields(df.Record, "", nil), version)
+
+	var size int
+	for _, f := range fields {
+		size += f.Size
+	}
+
+	return fileSchema{
+		File:        df.Name,
+		Version:     version,
+		Header:      soxHeaderFields,
+		RecordSize:  size,
+		Fields:      fields,
+		TrailerSize: soxTrailerSize,
+	}
+}
+
+// lookupDataFile finds a supported data file by name, ignoring case and the
+// extension, so "troopinfo" matches TroopInfo.sox.
+func lookupDataFile(name string) (dataFile, bool) {
+	for _, df := range dataFiles {
+		base := strings.TrimSuffix(df.Name, filepath.Ext(df.Name))
+		if strings.EqualFold(name, df.Name) || strings.EqualFold(name, base) {
+			return df, true
+		}
+	}
+
+	return dataFile{}, false
+}
+
+func runSchema(args []string) error {
+	if len(args) == 0 {
+		return errors.New("expected list, show, check, export or json-schema")
+	}
+
+	sub := args[0]
+
+	fs := newFlagSet("schema " + sub)
+	asJSON := fs.Bool("json", false, "Print the schema as JSON")
+	dir := fs.String("dir", soxDir, "Directory of the data files to check")
+	version := fs.Int("version", soxVersion, "File version to show the layout of")
+	format := fs.String("format", "ksy", "Template format to export: ksy (Kaitai Struct) or bt (010 Editor)")
+	out := fs.String("o", "", "Template or JSON Schema file to write instead of printing it")
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	switch sub {
+	case "list":
+		return listSchemas(*asJSON)
+	case "show":
+		if fs.NArg() != 1 {
+			return errors.New("expected a data file name, e.g. schema show troopinfo")
+		}
+
+		df, ok := lookupDataFile(fs.Arg(0))
+		if !ok {
+			return fmt.Errorf("unsupported data file %q", fs.Arg(0))
+		}
+
+		return showSchema(df.schemaFor(int32(*version)), *asJSON)
+	case "check":
+		return checkLayouts(resolveSOXDir(*dir))
+	case "export":
+		if fs.NArg() != 1 {
+			return errors.New("expected a data file name or schema document, e.g. schema export -format bt troopinfo")
+		}
+
+		return exportSchema(fs.Arg(0), int32(*version), *format, *out)
+	case "json-schema":
+		if fs.NArg() > 1 {
+			return errors.New("expected at most one YAML file kind, e.g. schema json-schema -o TroopInfo.schema.json troopinfo")
+		}
+
+		name := "troopinfo"
+		if fs.NArg() == 1 {
+			name = fs.Arg(0)
+		}
+
+		return exportJSONSchema(name, int32(*version), *out)
+	default:
+		return fmt.Errorf("unknown schema command %q", sub)
+	}
+}
+
+func listSchemas(asJSON bool) error {
+	schemas := make([]fileSchema, len(dataFiles))
+	for i, df := range dataFiles {
+		schemas[i] = df.schema()
+	}
+
+	if asJSON {
+		return printJSON(schemas)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tRECORD SIZE\tFIELDS")
+
+	for _, s := range schemas {
+		fmt.Fprintf(w, "%s\t%d\t%d\n", s.File, s.RecordSize, len(s.Fields))
+	}
+
+	return w.Flush()
+}
+
+func showSchema(s fileSchema, asJSON bool) error {
+	if asJSON {
+		return printJSON(s)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(w, "%s version %d (little-endian)\n\n", s.File, s.Version)
+	fmt.Fprintln(w, "OFFSET\tSIZE\tTYPE\tNAME\tDOC")
+
+	for _, f := range s.Header {
+		fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%s\n", f.Offset, f.Size, f.Type, f.Name, f.Doc)
+	}
+
+	fmt.Fprintf(w, "%d\t%d × count\trecord\trecords\trepeated count times\n", headerSize(s), s.RecordSize)
+	fmt.Fprintf(w, "\t%d\tbytes\ttrailer\tfollows the records, contents unknown\n", s.TrailerSize)
+
+	fmt.Fprintf(w, "\nrecord (%d bytes)\n\n", s.RecordSize)
+	fmt.Fprintln(w, "OFFSET\tSIZE\tTYPE\tNAME\tDOC")
+
+	for _, f := range s.Fields {
+		fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%s%s\n", f.Offset, f.Size, f.Type, f.Name, f.Doc, versionNote(f))
+	}
+
+	return w.Flush()
+}
+
+// versionNote describes the file versions holding f, if not all of them.
+func versionNote(f troopField) string {
+	switch {
+	case f.Since != 0 && f.Until != 0:
+		return fmt.Sprintf(" (versions %d to %d)", f.Since, f.Until)
+	case f.Since != 0:
+		return fmt.Sprintf(" (since version %d)", f.Since)
+	case f.Until != 0:
+		return fmt.Sprintf(" (until version %d)", f.Until)
+	default:
+		return ""
+	}
+}
+
+// headerSize returns the offset of the first record.
+func headerSize(s fileSchema) int {
+	var size int
+	for _, f := range s.Header {
+		size += f.Size
+	}
+
+	return size
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(v)
+}
+
+var errLayoutMismatch = kuftc.ErrLayoutMismatch
+
+// expectedSize returns the size of a file holding count records.
+func (s fileSchema) expectedSize(count int32) int64 {
+	return int64(headerSize(s)) + int64(count)*int64(s.RecordSize) + int64(s.TrailerSize)
+}
+
+// checkLayout compares the size of the file at path with the size its header
+// implies for df. A game version with a different record stride would
+// otherwise decode without error but misalign every field after the first.
+func (df dataFile) checkLayout(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	return df.checkData(path, data)
+}
+
+// checkData is checkLayout for file contents that are already in memory.
+// name is only used in errors.
+func (df dataFile) checkData(name string, data []byte) error {
+	var version, count int32
+
+	if len(data) >= 8 {
+		version = int32(binary.LittleEndian.Uint32(data[0:4]))
+		count = int32(binary.LittleEndian.Uint32(data[4:8]))
+	}
+
+	s := df.schemaFor(version)
+	size := int64(len(data))
+	want := s.expectedSize(count)
+
+	if count < 0 || size != want {
+		msg := fmt.Sprintf("%s: %d bytes, expected %d for version %d with %d records of %d bytes",
+			name, size, want, version, count, s.RecordSize)
+
+		if payload := size - int64(headerSize(s)+s.TrailerSize); count > 0 && payload > 0 && payload%int64(count) == 0 {
+			msg += fmt.Sprintf(" (the file looks like it has %d-byte records)", payload/int64(count))
+		}
+
+		return fmt.Errorf("%w: %s", errLayoutMismatch, msg)
+	}
+
+	return nil
+}
+
+// checkLayouts checks every supported data file present in dir.
+func checkLayouts(dir string) error {
+	var failed bool
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tSTATUS")
+
+	for _, df := range dataFiles {
+		path := filepath.Join(dir, df.Name)
+
+		status := "ok"
+		if err := df.checkLayout(path); errors.Is(err, os.ErrNotExist) {
+			status = "missing"
+		} else if err != nil {
+			status = err.Error()
+			failed = true
+		}
+
+		fmt.Fprintf(w, "%s\t%s\n", df.Name, status)
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if failed {
+		return errLayoutMismatch
+	}
+
+	return nil
+}
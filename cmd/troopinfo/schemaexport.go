@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// kaitaiTypes and binaryTemplateTypes name the schema value types in Kaitai
+// Struct and 010 Editor binary templates.
+var (
+	kaitaiTypes = map[string]string{
+		"int8": "s1", "uint8": "u1", "int16": "s2", "uint16": "u2",
+		"int32": "s4", "uint32": "u4", "int64": "s8", "uint64": "u8",
+		"float32": "f4", "float64": "f8",
+	}
+
+	binaryTemplateTypes = map[string]string{
+		"int8": "byte", "uint8": "ubyte", "int16": "int16", "uint16": "uint16",
+		"int32": "int32", "uint32": "uint32", "int64": "int64", "uint64": "uint64",
+		"float32": "float", "float64": "double",
+	}
+)
+
+var nonIdentifierChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// exportSchema writes the layout of a built-in data file or schema document
+// as a Kaitai Struct (.ksy) or 010 Editor (.bt) template so the files can be
+// inspected in standard reverse engineering tools.
+func exportSchema(name string, version int32, format, out string) error {
+	var s fileSchema
+
+	if ext := strings.ToLower(filepath.Ext(name)); ext == ".yaml" || ext == ".yml" {
+		doc, err := readSchemaDocument(name)
+		if err != nil {
+			return err
+		}
+
+		s = doc.layout(version)
+	} else {
+		df, ok := lookupDataFile(name)
+		if !ok {
+			return fmt.Errorf("unsupported data file %q", name)
+		}
+
+		s = df.schemaFor(version)
+	}
+
+	var data []byte
+
+	switch format {
+	case "ksy":
+		data = kaitaiTemplate(s)
+	case "bt":
+		data = binaryTemplate(s)
+	default:
+		return fmt.Errorf("unknown template format %q, expected ksy or bt", format)
+	}
+
+	if out == "" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+
+	if err := ioutil.WriteFile(out, data, 0644); err != nil {
+		return err
+	}
+
+	log.Info().Msg(tr("Wrote %s", out))
+
+	return nil
+}
+
+// templateID turns a field or file name such as "level_up_data[1].skill_id"
+// into an identifier both template languages accept.
+func templateID(name string) string {
+	id := strings.Trim(nonIdentifierChars.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if id == "" || id[0] >= '0' && id[0] <= '9' {
+		id = "f_" + id
+	}
+
+	return id
+}
+
+// templateTitle describes the file a template was generated for.
+func templateTitle(s fileSchema) string {
+	title := s.File
+	if s.Version != 0 {
+		title += fmt.Sprintf(" version %d", s.Version)
+	}
+
+	return title
+}
+
+func kaitaiTemplate(s fileSchema) []byte {
+	buf := &bytes.Buffer{}
+
+	fmt.Fprintf(buf, "meta:\n  id: %s\n  title: %s\n  file-extension: sox\n  endian: le\n", templateID(strings.TrimSuffix(s.File, filepath.Ext(s.File))), strconv.Quote(templateTitle(s)))
+	fmt.Fprintf(buf, "doc: Generated by troopinfo schema export.\n")
+	fmt.Fprintf(buf, "seq:\n")
+
+	for _, f := range s.Header {
+		kaitaiField(buf, "  ", f)
+	}
+
+	fmt.Fprintf(buf, "  - id: records\n    type: record\n    repeat: expr\n    repeat-expr: count\n")
+	fmt.Fprintf(buf, "  - id: trailer\n    size: %d\n    doc: follows the records, contents unknown\n", s.TrailerSize)
+	fmt.Fprintf(buf, "types:\n  record:\n    seq:\n")
+
+	for _, f := range s.Fields {
+		kaitaiField(buf, "      ", f)
+	}
+
+	return buf.Bytes()
+}
+
+func kaitaiField(buf *bytes.Buffer, indent string, f troopField) {
+	fmt.Fprintf(buf, "%s- id: %s\n%s  type: %s\n", indent, templateID(f.Name), indent, kaitaiTypes[f.Type])
+
+	if f.Doc != "" {
+		fmt.Fprintf(buf, "%s  doc: %s\n", indent, strconv.Quote(f.Doc))
+	}
+}
+
+func binaryTemplate(s fileSchema) []byte {
+	buf := &bytes.Buffer{}
+
+	fmt.Fprintf(buf, "// %s, generated by troopinfo schema export.\n\n", templateTitle(s))
+	fmt.Fprintf(buf, "LittleEndian();\n\ntypedef struct {\n")
+
+	for _, f := range s.Fields {
+		binaryTemplateField(buf, "    ", f)
+	}
+
+	fmt.Fprintf(buf, "} RECORD;\n\n")
+
+	for _, f := range s.Header {
+		binaryTemplateField(buf, "", f)
+	}
+
+	fmt.Fprintf(buf, "RECORD records[count] <optimize=true>;\n")
+	fmt.Fprintf(buf, "ubyte trailer[%d] <comment=\"follows the records, contents unknown\">;\n", s.TrailerSize)
+
+	return buf.Bytes()
+}
+
+func binaryTemplateField(buf *bytes.Buffer, indent string, f troopField) {
+	fmt.Fprintf(buf, "%s%s %s", indent, binaryTemplateTypes[f.Type], templateID(f.Name))
+
+	if f.Doc != "" {
+		fmt.Fprintf(buf, " <comment=%s>", strconv.Quote(f.Doc))
+	}
+
+	fmt.Fprintf(buf, ";\n")
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// schemaDocument describes the record layout of a SOX file the tool has no
+// built-in support for, so the community can decode new files without
+// writing Go code, e.g.
+//
+//	file: UnitInfo.sox
+//	fields:
+//	  - name: unit_id
+//	    type: int32
+//	  - name: scale
+//	    type: float32
+//	  - name: bones
+//	    type: int32
+//	    count: 4
+//	  - name: lod_bias
+//	    type: float32
+//	    since: 100
+//
+// Files start with the int32 version and record count every SOX file has,
+// followed by count records of the fields in order and a trailer of Trailer
+// bytes, 64 if not given. Fields with since or until are only in the records
+// of files of those versions, so one document serves every patch.
+type schemaDocument struct {
+	File    string        `yaml:"file"`
+	Doc     string        `yaml:"doc,omitempty"`
+	Trailer *int          `yaml:"trailer,omitempty"`
+	Fields  []schemaField `yaml:"fields"`
+}
+
+// schemaField is a field of a schema document. Count makes it an array;
+// Since and Until are the first and last file versions holding it, like the
+// since and until tags of built-in records.
+type schemaField struct {
+	Name  string `yaml:"name"`
+	Type  string `yaml:"type"`
+	Count int    `yaml:"count,omitempty"`
+	Since int32  `yaml:"since,omitempty"`
+	Until int32  `yaml:"until,omitempty"`
+	Doc   string `yaml:"doc,omitempty"`
+}
+
+// schemaTypes are the value types of schema fields and their sizes.
+var schemaTypes = map[string]int{
+	"int8":    1,
+	"uint8":   1,
+	"int16":   2,
+	"uint16":  2,
+	"int32":   4,
+	"uint32":  4,
+	"float32": 4,
+	"int64":   8,
+	"uint64":  8,
+	"float64": 8,
+}
+
+// readSchemaDocument reads and validates the schema document at path.
+func readSchemaDocument(path string) (schemaDocument, error) {
+	var s schemaDocument
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return s, err
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+
+	if err := dec.Decode(&s); err != nil {
+		return s, newYAMLError(path, data, err)
+	}
+
+	if err := s.validate(); err != nil {
+		return s, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return s, nil
+}
+
+func (s schemaDocument) validate() error {
+	if len(s.Fields) == 0 {
+		return errors.New("schema has no fields")
+	}
+
+	if s.Trailer != nil && *s.Trailer < 0 {
+		return fmt.Errorf("trailer: %d isn't a size", *s.Trailer)
+	}
+
+	seen := map[string]bool{}
+
+	for i, f := range s.Fields {
+		switch {
+		case f.Name == "":
+			return fmt.Errorf("fields[%d] has no name", i)
+		case seen[f.Name]:
+			return fmt.Errorf("field %s is defined twice", f.Name)
+		case schemaTypes[f.Type] == 0:
+			return fmt.Errorf("field %s: unknown type %q", f.Name, f.Type)
+		case f.Count < 0:
+			return fmt.Errorf("field %s: count %d is negative", f.Name, f.Count)
+		case f.Since != 0 && f.Until != 0 && f.Since > f.Until:
+			return fmt.Errorf("field %s: since %d is after until %d", f.Name, f.Since, f.Until)
+		}
+
+		seen[f.Name] = true
+	}
+
+	return nil
+}
+
+// trailerSize returns the size of the trailer following the records.
+func (s schemaDocument) trailerSize() int {
+	if s.Trailer != nil {
+		return *s.Trailer
+	}
+
+	return soxTrailerSize
+}
+
+// forVersion returns s with only the fields files of the given version hold.
+func (s schemaDocument) forVersion(version int32) schemaDocument {
+	fields := make([]schemaField, 0, len(s.Fields))
+
+	for _, f := range s.Fields {
+		if (f.Since == 0 || version >= f.Since) && (f.Until == 0 || version <= f.Until) {
+			fields = append(fields, f)
+		}
+	}
+
+	s.Fields = fields
+
+	return s
+}
+
+// recordSize returns the size of a record in bytes.
+func (s schemaDocument) recordSize() int {
+	var size int
+
+	for _, f := range s.Fields {
+		size += schemaTypes[f.Type] * f.length()
+	}
+
+	return size
+}
+
+// length returns the number of values of f.
+func (f schemaField) length() int {
+	if f.Count == 0 {
+		return 1
+	}
+
+	return f.Count
+}
+
+// decodeWithSchema decodes data laid out as s into a YAML document holding
+// the header, the records as mappings in field order, and the trailer in hex.
+// Records are read in the layout of the version in the header. name is only
+// used in errors.
+func decodeWithSchema(s schemaDocument, name string, data []byte) (*yaml.Node, error) {
+	if len(data) < 8 {
+		return nil, fmt.Errorf("%s: %w", name, errInvalidSOX)
+	}
+
+	version := int32(binary.LittleEndian.Uint32(data[0:4]))
+	count := int32(binary.LittleEndian.Uint32(data[4:8]))
+
+	s = s.forVersion(version)
+	size := s.recordSize()
+
+	if want := 8 + int64(count)*int64(size) + int64(s.trailerSize()); count < 0 || int64(len(data)) != want {
+		msg := fmt.Sprintf("%s: %d bytes, expected %d for %d records of %d bytes", name, len(data), want, count, size)
+
+		if payload := len(data) - 8 - s.trailerSize(); count > 0 && payload > 0 && payload%int(count) == 0 {
+			msg += fmt.Sprintf(" (the file looks like it has %d-byte records)", payload/int(count))
+		}
+
+		return nil, fmt.Errorf("%w: %s", errLayoutMismatch, msg)
+	}
+
+	records := &yaml.Node{Kind: yaml.SequenceNode}
+	offset := 8
+
+	for i := 0; i < int(count); i++ {
+		record := &yaml.Node{Kind: yaml.MappingNode}
+
+		for _, f := range s.Fields {
+			n := schemaTypes[f.Type]
+
+			var value *yaml.Node
+
+			if f.Count == 0 {
+				value = scalarNode(formatSchemaValue(f.Type, data[offset:offset+n]))
+				offset += n
+			} else {
+				value = &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+
+				for j := 0; j < f.Count; j++ {
+					value.Content = append(value.Content, scalarNode(formatSchemaValue(f.Type, data[offset:offset+n])))
+					offset += n
+				}
+			}
+
+			record.Content = append(record.Content, scalarNode(f.Name), value)
+		}
+
+		records.Content = append(records.Content, record)
+	}
+
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	root.Content = append(root.Content,
+		scalarNode("version"), scalarNode(strconv.Itoa(int(version))),
+		scalarNode("count"), scalarNode(strconv.Itoa(int(count))),
+		scalarNode("records"), records,
+		scalarNode(trailerField), scalarNode(hex.EncodeToString(data[offset:])),
+	)
+
+	return &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{root}}, nil
+}
+
+func scalarNode(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+}
+
+// formatSchemaValue formats the little-endian value of type typ in b.
+func formatSchemaValue(typ string, b []byte) string {
+	switch typ {
+	case "int8":
+		return strconv.FormatInt(int64(int8(b[0])), 10)
+	case "uint8":
+		return strconv.FormatUint(uint64(b[0]), 10)
+	case "int16":
+		return strconv.FormatInt(int64(int16(binary.LittleEndian.Uint16(b))), 10)
+	case "uint16":
+		return strconv.FormatUint(uint64(binary.LittleEndian.Uint16(b)), 10)
+	case "int32":
+		return strconv.FormatInt(int64(int32(binary.LittleEndian.Uint32(b))), 10)
+	case "uint32":
+		return strconv.FormatUint(uint64(binary.LittleEndian.Uint32(b)), 10)
+	case "float32":
+		return strconv.FormatFloat(float64(math.Float32frombits(binary.LittleEndian.Uint32(b))), 'g', -1, 32)
+	case "int64":
+		return strconv.FormatInt(int64(binary.LittleEndian.Uint64(b)), 10)
+	case "uint64":
+		return strconv.FormatUint(binary.LittleEndian.Uint64(b), 10)
+	default:
+		return strconv.FormatFloat(math.Float64frombits(binary.LittleEndian.Uint64(b)), 'g', -1, 64)
+	}
+}
+
+// layout returns s as the layout of a built-in data file in files of the
+// given version, with arrays flattened into one field per value.
+func (s schemaDocument) layout(version int32) fileSchema {
+	s = s.forVersion(version)
+
+	var fields []troopField
+	var offset int
+
+	for _, f := range s.Fields {
+		n := schemaTypes[f.Type]
+
+		for i := 0; i < f.length(); i++ {
+			name := f.Name
+			if f.Count != 0 {
+				name = fmt.Sprintf("%s[%d]", f.Name, i)
+			}
+
+			fields = append(fields, troopField{Name: name, Type: f.Type, Offset: offset, Size: n, Doc: f.Doc})
+			offset += n
+		}
+	}
+
+	return fileSchema{
+		File:        s.File,
+		Version:     version,
+		Header:      soxHeaderFields,
+		RecordSize:  offset,
+		Fields:      fields,
+		TrailerSize: s.trailerSize(),
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestDecodeWithSchemaVersions(t *testing.T) {
+	s := schemaDocument{
+		File: "UnitInfo.sox",
+		Fields: []schemaField{
+			{Name: "id", Type: "int32"},
+			{Name: "scale", Type: "float32", Since: 100},
+			{Name: "legacy", Type: "int16", Until: 99},
+		},
+	}
+
+	if err := s.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		version int32
+		size    int
+		fields  []string
+	}{
+		{99, 6, []string{"id", "legacy"}},
+		{100, 8, []string{"id", "scale"}},
+	} {
+		data := make([]byte, 8+tt.size+soxTrailerSize)
+		binary.LittleEndian.PutUint32(data[0:4], uint32(tt.version))
+		binary.LittleEndian.PutUint32(data[4:8], 1)
+
+		doc, err := decodeWithSchema(s, s.File, data)
+		if err != nil {
+			t.Fatalf("version %d: %v", tt.version, err)
+		}
+
+		record := doc.Content[0].Content[5].Content[0]
+
+		var fields []string
+		for i := 0; i < len(record.Content); i += 2 {
+			fields = append(fields, record.Content[i].Value)
+		}
+
+		if len(fields) != len(tt.fields) || fields[0] != tt.fields[0] || fields[1] != tt.fields[1] {
+			t.Errorf("version %d records have the fields %v, want %v", tt.version, fields, tt.fields)
+		}
+	}
+}
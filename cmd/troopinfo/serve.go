@@ -0,0 +1,253 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// apiMaxAge is how long clients and proxies may cache API responses.
+const apiMaxAge = 300
+
+// troopResource is a troop as served by the API.
+type troopResource struct {
+	Index int    `json:"index"`
+	Name  string `json:"name"`
+	troopInfo
+}
+
+func runServe(args []string) error {
+	fs := newFlagSet("serve")
+	addr := fs.String("addr", "localhost:8080", "Address to listen on")
+	dir := fs.String("dir", soxDir, "Directory or zip archive containing the SOX files to serve")
+	sessions := fs.Bool("sessions", false, "Enable the session editing API, which writes to the served files")
+	allowZero := fs.Bool("allow-zero", false, "Allows sessions to commit troop records that are all zeros")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	st, err := openStorage(*dir)
+	if err != nil {
+		return err
+	}
+
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+
+	log.Info().Msg(tr("Serving %s on http://%s", *dir, *addr))
+
+	handler := newAPIHandler(st)
+	if *sessions {
+		token, err := newSessionToken()
+		if err != nil {
+			return err
+		}
+
+		handler = localOnly(withSessions(handler, st, *allowZero, token), ln.Addr(), *addr)
+
+		log.Info().Msg(tr("Session requests have to carry the header %s: %s", sessionTokenHeader, token))
+	}
+
+	return http.Serve(ln, handler)
+}
+
+// localOnly refuses requests whose Host header isn't the address the
+// server listens on, under any of the names given or the names of the
+// loopback address, and requests from pages of another origin. Together
+// with the token of the session API, this keeps web pages open in the
+// browser from writing through it, whether they post to it directly or
+// point a domain of theirs at the loopback address (DNS rebinding).
+func localOnly(h http.Handler, addr net.Addr, names ...string) http.Handler {
+	_, port, _ := net.SplitHostPort(addr.String())
+
+	hosts := map[string]bool{strings.ToLower(addr.String()): true}
+
+	for _, host := range []string{"localhost", "127.0.0.1", "[::1]"} {
+		hosts[host+":"+port] = true
+	}
+
+	for _, name := range names {
+		if host, _, err := net.SplitHostPort(name); err == nil && host != "" {
+			hosts[strings.ToLower(net.JoinHostPort(host, port))] = true
+		}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !hosts[strings.ToLower(r.Host)] {
+			http.Error(w, fmt.Sprintf("unexpected host %q", r.Host), http.StatusForbidden)
+			return
+		}
+
+		if origin := r.Header.Get("Origin"); origin != "" && !hosts[strings.ToLower(strings.TrimPrefix(origin, "http://"))] {
+			http.Error(w, fmt.Sprintf("requests from %s aren't allowed", origin), http.StatusForbidden)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// newAPIHandler serves the data files in st as read-only JSON; see
+// withSessions for editing:
+//
+//	GET /api/troops               every troop
+//	GET /api/troops/{index|name}  a single troop
+//	GET /api/files                the supported data files
+//	GET /api/files/{name}         every record of a data file
+//
+// Responses carry an ETag derived from their body so clients can revalidate
+// cheaply with If-None-Match.
+func newAPIHandler(st storage) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/api/troops", func(w http.ResponseWriter, r *http.Request) {
+		tis, err := readTroopStorage(st)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+
+		writeJSON(w, r, troopResources(tis))
+	})
+
+	mux.HandleFunc("/api/troops/", func(w http.ResponseWriter, r *http.Request) {
+		tis, err := readTroopStorage(st)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+
+		id := strings.TrimPrefix(r.URL.Path, "/api/troops/")
+
+		i, err := strconv.Atoi(id)
+		if err != nil {
+			i, err = troopIndex(id)
+		}
+
+		if err != nil || i < 0 || i >= len(tis.TroopInfos) {
+			http.NotFound(w, r)
+			return
+		}
+
+		writeJSON(w, r, troopResources(tis)[i])
+	})
+
+	mux.HandleFunc("/api/files", func(w http.ResponseWriter, r *http.Request) {
+		var names []string
+		for _, df := range dataFiles {
+			names = append(names, df.Name)
+		}
+
+		writeJSON(w, r, names)
+	})
+
+	mux.HandleFunc("/api/files/", func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/api/files/")
+
+		for _, df := range dataFiles {
+			if !strings.EqualFold(df.Name, name) {
+				continue
+			}
+
+			records, err := df.readRecords(st)
+			if err != nil {
+				writeAPIError(w, err)
+				return
+			}
+
+			writeJSON(w, r, records)
+
+			return
+		}
+
+		http.NotFound(w, r)
+	})
+
+	return readingRoster(mux)
+}
+
+// readingRoster serves requests with h while holding rosterMu for reading,
+// so a write by a session can't reload the roster under it.
+func readingRoster(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rosterMu.RLock()
+		defer rosterMu.RUnlock()
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+func troopResources(tis troopInfoSOX) []troopResource {
+	resources := make([]troopResource, len(tis.TroopInfos))
+
+	for i, ti := range tis.TroopInfos {
+		resources[i] = troopResource{Index: i, Name: troopName(i), troopInfo: ti}
+	}
+
+	return resources
+}
+
+// writeJSON writes v as JSON with caching headers, answering 304 Not Modified
+// when the client already has the current version.
+func writeJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(apiMaxAge))
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	if match := r.Header.Get("If-None-Match"); match != "" && strings.Contains(match, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	if _, err := w.Write(append(body, '\n')); err != nil {
+		log.Debug().Err(err).Msg("write failed")
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+
+	switch {
+	case os.IsNotExist(err):
+		status = http.StatusNotFound
+	case errors.Is(err, errReadOnly):
+		status = http.StatusForbidden
+	case errors.Is(err, errInvalidData):
+		status = http.StatusUnprocessableEntity
+	}
+
+	http.Error(w, err.Error(), status)
+}
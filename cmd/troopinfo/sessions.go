@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// errStaleSession is returned when committing a session whose file changed
+// since it was checked out.
+var errStaleSession = errors.New("file changed since the session was checked out")
+
+// editSession is a checked out copy of TroopInfo.sox. Edits are applied to
+// the copy and written back on commit, unless another writer changed the file
+// in the meantime.
+type editSession struct {
+	ID    string        `json:"id"`
+	File  string        `json:"file"`
+	Base  string        `json:"base"`
+	Edits []sessionEdit `json:"edits"`
+	Stale bool          `json:"stale"`
+
+	// Findings are the validation problems of the edited data.
+	Findings []finding `json:"findings"`
+
+	tis troopInfoSOX
+}
+
+// sessionEdit sets a field of a troop. Troop is a name or index and Field may
+// be an alias.
+type sessionEdit struct {
+	Troop string `json:"troop"`
+	Field string `json:"field"`
+	Value string `json:"value"`
+}
+
+// sessionTokenHeader is the request header carrying the token of the
+// session API.
+const sessionTokenHeader = "X-Troopinfo-Token"
+
+// sessionStore holds the open sessions of a server.
+type sessionStore struct {
+	st        storage
+	allowZero bool   // see checkComplete
+	token     string // every request has to carry in sessionTokenHeader
+
+	mu       sync.Mutex
+	sessions map[string]*editSession
+}
+
+// withSessions adds the session editing API to api:
+//
+//	POST   /api/sessions             check out TroopInfo.sox
+//	GET    /api/sessions/{id}        the session and its edits
+//	PATCH  /api/sessions/{id}        apply a list of edits
+//	POST   /api/sessions/{id}/commit write the edits back
+//	DELETE /api/sessions/{id}        discard the session
+//
+// A commit is refused with 409 Conflict if the file changed on disk since the
+// session was checked out; the client has to check out again and reapply its
+// edits. Sessions list the validation findings of their data; commits to the
+// installed TroopInfo.sox with errors among them are refused with 422
+// Unprocessable Entity.
+//
+// Every session request has to carry token in the X-Troopinfo-Token header,
+// or it is refused with 403 Forbidden, so other pages open in the browser
+// can't write through the API; see also localOnly.
+func withSessions(api http.Handler, st storage, allowZero bool, token string) http.Handler {
+	s := &sessionStore{st: st, allowZero: allowZero, token: token, sessions: map[string]*editSession{}}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", api)
+	mux.Handle("/api/sessions", s.authorize(http.HandlerFunc(s.handleCheckout)))
+	mux.Handle("/api/sessions/", s.authorize(http.HandlerFunc(s.handleSession)))
+
+	return mux
+}
+
+// authorize refuses requests that don't carry the token of the store.
+func (s *sessionStore) authorize(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(sessionTokenHeader)), []byte(s.token)) != 1 {
+			http.Error(w, "missing or wrong "+sessionTokenHeader+" header", http.StatusForbidden)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (s *sessionStore) handleCheckout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := s.st.ReadFile(troopInfoFile.Name)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	tis, err := readTroopStorage(s.st)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	id, err := newSessionID()
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	sess := &editSession{
+		ID:    id,
+		File:  troopInfoFile.Name,
+		Base:  contentHash(data),
+		Edits: []sessionEdit{},
+		tis:   tis,
+	}
+
+	// Not held with s.mu, which commits take before rosterMu.
+	rosterMu.RLock()
+	sess.validate()
+	rosterMu.RUnlock()
+
+	s.mu.Lock()
+	s.sessions[id] = sess
+	s.mu.Unlock()
+
+	log.Info().Msg(tr("Checked out session %s", id))
+
+	writeSessionJSON(w, http.StatusCreated, sess)
+}
+
+func (s *sessionStore) handleSession(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/sessions/")
+	commit := strings.HasSuffix(id, "/commit")
+	id = strings.TrimSuffix(id, "/commit")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[id]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Commits reload the roster when they write the installed file, and
+	// take rosterMu themselves around the rest.
+	if !commit {
+		rosterMu.RLock()
+		defer rosterMu.RUnlock()
+	}
+
+	switch {
+	case commit && r.Method == http.MethodPost:
+		if err := s.commit(sess); errors.Is(err, errStaleSession) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		} else if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+
+		delete(s.sessions, id)
+
+		log.Info().Msg(tr("Committed session %s", id))
+
+		w.WriteHeader(http.StatusNoContent)
+	case commit:
+		w.Header().Set("Allow", "POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	case r.Method == http.MethodGet:
+		data, err := s.st.ReadFile(sess.File)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+
+		sess.Stale = contentHash(data) != sess.Base
+		sess.validate()
+
+		writeSessionJSON(w, http.StatusOK, sess)
+	case r.Method == http.MethodPatch:
+		var edits []sessionEdit
+
+		if err := json.NewDecoder(r.Body).Decode(&edits); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Apply to a copy so a bad edit leaves the session untouched.
+		tis := sess.tis.Clone()
+
+		for _, e := range edits {
+			if err := e.apply(&tis); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		sess.tis = tis
+		sess.Edits = append(sess.Edits, edits...)
+		sess.validate()
+
+		writeSessionJSON(w, http.StatusOK, sess)
+	case r.Method == http.MethodDelete:
+		delete(s.sessions, id)
+
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, PATCH, DELETE")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+// commit writes the session back to its file if nobody changed the file since
+// checkout. Callers hold s.mu, which serializes commits of this server, but
+// not rosterMu, which writing the installed file takes.
+func (s *sessionStore) commit(sess *editSession) error {
+	data, err := s.st.ReadFile(sess.File)
+	if err != nil {
+		return err
+	}
+
+	if contentHash(data) != sess.Base {
+		return fmt.Errorf("%s: %w", sess.File, errStaleSession)
+	}
+
+	rosterMu.RLock()
+	err = checkComplete(sess.tis, s.allowZero)
+	rosterMu.RUnlock()
+
+	if err != nil {
+		return err
+	}
+
+	base, err := decodeTroopInfoSOX(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	buf := &bytes.Buffer{}
+
+	if err := encodeTroopInfoSOX(buf, sess.tis); err != nil {
+		return err
+	}
+
+	if err := s.st.WriteFile(sess.File, buf.Bytes()); err != nil {
+		return err
+	}
+
+	rosterMu.RLock()
+	changes := diffRecords(troopRecords(base), troopRecords(sess.tis))
+	rosterMu.RUnlock()
+
+	recordHistory("session commit", filepath.Join(s.st.String(), sess.File), changes, buf.Bytes())
+
+	return nil
+}
+
+// validate updates the findings of the session.
+func (sess *editSession) validate() {
+	sess.Findings = validateTroops(sess.tis, newValidationContext())
+	if sess.Findings == nil {
+		sess.Findings = []finding{}
+	}
+}
+
+func (e sessionEdit) apply(tis *troopInfoSOX) error {
+	i, err := strconv.Atoi(e.Troop)
+	if err != nil {
+		i, err = troopIndex(e.Troop)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if i < 0 || i >= len(tis.TroopInfos) {
+		return fmt.Errorf("troop %q out of range", e.Troop)
+	}
+
+	if err := setField(&tis.TroopInfos[i], e.Field, e.Value); err != nil {
+		return fmt.Errorf("%s: %w", troopName(i), err)
+	}
+
+	return nil
+}
+
+func newSessionID() (string, error) {
+	return randomHex(8)
+}
+
+// newSessionToken returns the token for the session API of a server run.
+func newSessionToken() (string, error) {
+	return randomHex(32)
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// writeSessionJSON writes v as uncached JSON; sessions change with every
+// request.
+func writeSessionJSON(w http.ResponseWriter, status int, v interface{}) {
+	body, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+
+	if _, err := w.Write(append(body, '\n')); err != nil {
+		log.Debug().Err(err).Msg("write failed")
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSessionCommitWhileServing(t *testing.T) {
+	newTestGame(t)
+
+	h := withSessions(newAPIHandler(dirStorage(soxDir)), dirStorage(soxDir), false, "token")
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set(sessionTokenHeader, "token")
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		return w
+	}
+
+	var wg sync.WaitGroup
+
+	// Readers use the roster that every commit to the installed file
+	// reloads.
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 20; j++ {
+				serve(http.MethodGet, "/api/troops/Knight", "")
+			}
+		}()
+	}
+
+	for i := 0; i < 5; i++ {
+		w := serve(http.MethodPost, "/api/sessions", "")
+		if w.Code != http.StatusCreated {
+			t.Fatalf("checkout returned %d: %s", w.Code, w.Body)
+		}
+
+		var sess editSession
+		if err := json.Unmarshal(w.Body.Bytes(), &sess); err != nil {
+			t.Fatal(err)
+		}
+
+		serve(http.MethodPatch, "/api/sessions/"+sess.ID, `[{"troop":"Knight","field":"defense","value":"`+strconv.Itoa((i+1)*10)+`"}]`)
+
+		if w := serve(http.MethodPost, "/api/sessions/"+sess.ID+"/commit", ""); w.Code != http.StatusNoContent {
+			t.Fatalf("commit returned %d: %s", w.Code, w.Body)
+		}
+	}
+
+	wg.Wait()
+
+	if got := readInstalled(t).TroopInfos[5].Defense; got != 50 {
+		t.Errorf("Knight has defense %g after the commits, want 50", got)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+)
+
+// runSet changes fields of the workspace TroopInfo.yaml with expressions,
+// e.g. set -where 'job == JOB_INFANTRY' -expr 'move_speed = move_speed * 1.2',
+// for balance changes that would take dozens of hand edits. With a path and
+// a value instead, it changes a single field of the installed TroopInfo.sox;
+// see setFieldPath.
+func runSet(args []string) error {
+	fs := newFlagSet("set")
+	where := fs.String("where", "", "Condition selecting the troops to change, e.g. \"job == JOB_INFANTRY && default_unit_hp < 100\"; every troop without it")
+	expr := fs.String("expr", "", "Assignments separated by semicolons, e.g. \"move_speed = move_speed * 1.2; defense += 5\"")
+	out := fs.String("o", troopInfoYAMLPath, "YAML file to change the fields in")
+	dryRun := fs.Bool("dry-run", false, "Lists the changes without writing anything")
+	sync := fs.Bool("sync", false, "With a path and a value, also changes the field in the YAML file of -o")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 2 && *expr == "" && *where == "" {
+		return setFieldPath(fs.Arg(0), fs.Arg(1), *out, *sync, *dryRun)
+	}
+
+	if *expr == "" || fs.NArg() > 0 {
+		return errors.New("expected -expr with assignments such as \"move_speed = move_speed * 1.2\" and optionally -where, or a path and a value such as troop_infos[Knight].defense 42")
+	}
+
+	var cond exprNode
+
+	if *where != "" {
+		var err error
+
+		if cond, err = parseCondition(*where); err != nil {
+			return err
+		}
+	}
+
+	assignments, err := parseAssignments(*expr)
+	if err != nil {
+		return err
+	}
+
+	base, err := readTroopInfoSOX(troopInfoPath)
+	if err != nil {
+		return err
+	}
+
+	tis := base
+
+	_, statErr := os.Stat(*out)
+	if statErr == nil {
+		if tis, err = readTroopInfoYAML(*out, base); err != nil {
+			return err
+		}
+	}
+
+	after, err := evalTroops(tis, cond, assignments)
+	if err != nil {
+		return err
+	}
+
+	changes := diffRecords(troopRecords(tis), troopRecords(after))
+	printChangeSummary(os.Stdout, changes, true)
+
+	if len(changes) == 0 {
+		log.Info().Msg(tr("Nothing was changed"))
+		return nil
+	}
+
+	if *dryRun {
+		return nil
+	}
+
+	if statErr == nil {
+		err = patchTroopInfoYAML(*out, tis, after)
+	} else {
+		err = writeTroopInfoYAML(*out, after)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	recordHistory("set", *out, changes, nil)
+
+	log.Info().Msg(tr("Wrote %s", *out))
+
+	return nil
+}
+
+// setFieldPath sets a single field of the installed TroopInfo.sox, for quick
+// tweaks without a dump and apply. The value may be an ID name such as
+// JOB_KNIGHT. With sync, the YAML file at yamlPath is changed to match, and
+// if that leaves it in sync with the installed file, status says so.
+func setFieldPath(spec, value, yamlPath string, sync, dryRun bool) error {
+	p, err := parseFieldPath(spec)
+	if err != nil {
+		return err
+	}
+
+	if id, ok := symbolValue(p.Field.Name, value); ok {
+		value = strconv.Itoa(int(id))
+	}
+
+	tis, err := readTroopInfoSOX(troopInfoPath)
+	if err != nil {
+		return err
+	}
+
+	i, err := troopRecord(tis, p.Troop)
+	if err != nil {
+		return err
+	}
+
+	after := tis.Clone()
+
+	if err := p.Field.Parse(&after.TroopInfos[i], value); err != nil {
+		return err
+	}
+
+	changes := diffRecords(troopRecords(tis), troopRecords(after))
+	printChangeSummary(os.Stdout, changes, true)
+
+	if len(changes) == 0 {
+		log.Info().Msg(tr("Nothing was changed"))
+		return nil
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	buf := &bytes.Buffer{}
+
+	if err := encodeTroopInfoSOX(buf, after); err != nil {
+		return err
+	}
+
+	if err := installSOX(buf.Bytes()); err != nil {
+		return err
+	}
+
+	recordHistory("set", troopInfoFile.Name, changes, buf.Bytes())
+
+	log.Info().Msg(tr("Wrote %s", troopInfoPath))
+
+	if !sync {
+		return nil
+	}
+
+	return syncFieldPath(p, i, yamlPath, after)
+}
+
+// syncFieldPath sets the field of the troop at index i in the YAML file at
+// path to its value in installed, the TroopInfo.sox just written.
+func syncFieldPath(p fieldPath, i int, path string, installed troopInfoSOX) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		log.Info().Msg(tr("%s doesn't exist, so there is nothing to sync", path))
+		return nil
+	}
+
+	ours, err := readTroopInfoYAML(path, installed)
+	if err != nil {
+		return err
+	}
+
+	if i >= len(ours.TroopInfos) {
+		return fmt.Errorf("%s has no %s to sync", path, troopName(i))
+	}
+
+	merged := ours.Clone()
+
+	if err := p.Field.Parse(&merged.TroopInfos[i], p.Field.Format(&installed.TroopInfos[i])); err != nil {
+		return err
+	}
+
+	if err := patchTroopInfoYAML(path, ours, merged); err != nil {
+		return err
+	}
+
+	log.Info().Msg(tr("Wrote %s", path))
+
+	if len(diffRecords(troopRecords(merged), troopRecords(installed))) == 0 {
+		if err := recordSync(troopInfoFile.Name); err != nil {
+			log.Warn().Err(err).Msg(tr("Couldn't record the sync state"))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/rdeusser/troopinfo/kuftc"
+	"github.com/rs/zerolog/log"
+)
+
+var errSelfTest = errors.New("self-test failed")
+
+// runSetup walks a new user through the configuration: it finds the game,
+// writes a validated configuration file, prepares the backup chain with a
+// snapshot of the unmodded data, and checks that the tool works with the
+// install. With -check it only validates the existing configuration and runs
+// the self-test.
+func runSetup(args []string) error {
+	fs := newFlagSet("setup")
+	dir := fs.String("dir", "", "Game directory to use instead of asking")
+	check := fs.Bool("check", false, "Only validates the configuration file and runs the self-test")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	if *check {
+		if err := cfg.validate(); err != nil {
+			return err
+		}
+
+		log.Info().Msg(tr("The configuration is valid"))
+
+		return selfTest(os.Stdout)
+	}
+
+	gameDir := *dir
+	if gameDir == "" {
+		gameDir, err = promptGameDir(bufio.NewReader(os.Stdin), os.Stdout, cfg.GameDir)
+		if err != nil {
+			return err
+		}
+	} else if !isGameDir(gameDir) {
+		return fmt.Errorf("%s has no %s", gameDir, troopInfoFile.Name)
+	}
+
+	// The default install needs no setting, which keeps the configuration
+	// portable between machines that use it.
+	cfg.GameDir = gameDir
+	if gameDir != "" {
+		setGameDir(gameDir)
+	}
+
+	if err := saveConfig(cfg); err != nil {
+		return err
+	}
+
+	path, _ := configPath()
+	log.Info().Msg(tr("Wrote %s", path))
+
+	if err := os.MkdirAll(backupsDir, 0700); err != nil {
+		return err
+	}
+
+	if err := snapshotVanilla(); err != nil {
+		return err
+	}
+
+	return selfTest(os.Stdout)
+}
+
+// isGameDir reports whether dir holds the game data, as a game install or a
+// copy of its Data or SOX folder.
+func isGameDir(dir string) bool {
+	_, err := os.Stat(kuftc.FindFold(resolveSOXDir(dir), troopInfoFile.Name))
+	return err == nil
+}
+
+// promptGameDir asks for the game directory, offering the configured one or
+// the default install if it exists. It returns "" for the default install.
+func promptGameDir(in *bufio.Reader, out io.Writer, configured string) (string, error) {
+	found := ""
+
+	if configured != "" && isGameDir(configured) {
+		found = configured
+	} else if _, err := os.Stat(troopInfoPath); err == nil && configured == "" {
+		found = soxDir
+	}
+
+	for {
+		if found != "" {
+			fmt.Fprint(out, tr("Found the game at %s\nPress Enter to use it, or type another game directory: ", found))
+		} else {
+			fmt.Fprint(out, tr("Game directory (the folder holding Data\\SOX): "))
+		}
+
+		line, err := in.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return "", errors.New("no game directory given")
+		}
+
+		answer := strings.TrimSpace(line)
+
+		switch {
+		case answer == "" && found != "":
+			return configured, nil
+		case answer == "":
+		case isGameDir(answer):
+			return answer, nil
+		default:
+			fmt.Fprint(out, tr("%s has no %s\n", answer, troopInfoFile.Name))
+		}
+	}
+}
+
+// snapshotVanilla keeps a copy of the data as it is at setup, which is taken
+// to be unmodded: as the reference backup the highlighting and restore
+// compare against, if there is none yet, and as the "vanilla" snapshot of the
+// backup chain.
+func snapshotVanilla() error {
+	if _, err := os.Stat(troopInfoBackupPath); os.IsNotExist(err) {
+		data, err := ioutil.ReadFile(troopInfoPath)
+		if err != nil {
+			return err
+		}
+
+		if err := writeFileAtomic(troopInfoBackupPath, data, 0600); err != nil {
+			return err
+		}
+
+		log.Info().Msg(tr("Wrote %s", troopInfoBackupPath))
+	}
+
+	if _, err := findBackup("vanilla"); err == nil {
+		return nil
+	}
+
+	b, err := saveBackup(troopInfoPath, "vanilla")
+	if err != nil {
+		return err
+	}
+
+	log.Info().Msg(tr("Saved backup %s", b.ID))
+
+	return nil
+}
+
+// selfTest checks that the install can be read, round-tripped and written
+// to, printing a line per check.
+func selfTest(w io.Writer) error {
+	var failed bool
+
+	for _, t := range []struct {
+		name string
+		run  func() error
+	}{
+		{"layout of " + troopInfoFile.Name, func() error { return troopInfoFile.checkLayout(troopInfoPath) }},
+		{"binary round trip", selfTestBinary},
+		{"YAML round trip", selfTestYAML},
+		{"backup directory writable", func() error { return checkWritable(backupsDir) }},
+		{"configuration directory writable", func() error {
+			dir, err := configDir()
+			if err != nil {
+				return err
+			}
+
+			return checkWritable(dir)
+		}},
+	} {
+		status := "ok"
+		if err := t.run(); err != nil {
+			status = "FAILED: " + err.Error()
+			failed = true
+		}
+
+		fmt.Fprintf(w, "%-34s %s\n", t.name, status)
+	}
+
+	if failed {
+		return errSelfTest
+	}
+
+	return nil
+}
+
+// selfTestBinary decodes and re-encodes TroopInfo.sox, which must give back
+// the same records.
+func selfTestBinary() error {
+	data, err := ioutil.ReadFile(troopInfoPath)
+	if err != nil {
+		return err
+	}
+
+	tis, err := decodeTroopInfoSOX(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	buf := &bytes.Buffer{}
+
+	if err := encodeTroopInfoSOX(buf, tis); err != nil {
+		return err
+	}
+
+	for i := range tis.TroopInfos {
+		a, err := recordBytes(data, i)
+		if err != nil {
+			return err
+		}
+
+		b, err := recordBytes(buf.Bytes(), i)
+		if err != nil {
+			return err
+		}
+
+		if !bytes.Equal(a, b) {
+			return fmt.Errorf("record %d (%s) changed", i, troopName(i))
+		}
+	}
+
+	return nil
+}
+
+// selfTestYAML converts TroopInfo.sox to YAML and back, which must give back
+// the same values.
+func selfTestYAML() error {
+	tis, err := readTroopInfoSOX(troopInfoPath)
+	if err != nil {
+		return err
+	}
+
+	doc, err := troopInfoDocument(tis)
+	if err != nil {
+		return err
+	}
+
+	data, err := encodeYAMLNode(doc)
+	if err != nil {
+		return err
+	}
+
+	back, err := decodeTroopInfoYAML("TroopInfo.yaml", data, troopInfoSOX{})
+	if err != nil {
+		return err
+	}
+
+	if changes := diffRecords(troopRecords(tis), troopRecords(back)); len(changes) > 0 {
+		return fmt.Errorf("%d values changed, e.g. %s.%s", len(changes), changes[0].Record, changes[0].Field)
+	}
+
+	return nil
+}
+
+// checkWritable creates dir if needed and writes a file to it.
+func checkWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	file, err := ioutil.TempFile(dir, ".kuftc-selftest")
+	if err != nil {
+		return err
+	}
+
+	name := file.Name()
+	file.Close()
+
+	return os.Remove(name)
+}
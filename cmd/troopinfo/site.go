@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// siteTemplates render the static fan site. Every page shares the layout.
+var siteTemplates = template.Must(template.New("layout").Funcs(template.FuncMap{
+	"slug": slug,
+}).Parse(`{{define "layout"}}<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; max-width: 960px; margin: 2em auto; padding: 0 1em; }
+table { border-collapse: collapse; }
+td, th { padding: 2px 8px; border-bottom: 1px solid #ddd; text-align: right; }
+td:first-child, th:first-child { text-align: left; }
+.up { color: #080; } .down { color: #c00; }
+</style>
+</head>
+<body>
+<nav><a href="{{.Root}}index.html">Units</a> · <a href="{{.Root}}compare.html">Compare</a> · <a href="{{.Root}}changelog.html">Changelog</a></nav>
+<h1>{{.Title}}</h1>
+{{template "content" .}}
+</body>
+</html>
+{{end}}`))
+
+var (
+	siteIndex = template.Must(template.Must(siteTemplates.Clone()).Parse(`{{define "content"}}<ul>
+{{range .Troops}}<li><a href="troops/{{slug .Name}}.html">{{.Name}}</a></li>
+{{end}}</ul>{{end}}`))
+
+	siteTroop = template.Must(template.Must(siteTemplates.Clone()).Parse(`{{define "content"}}<table>
+<tr><th>Field</th><th>Value</th>{{if .HasVanilla}}<th>Vanilla</th>{{end}}</tr>
+{{range .Fields}}<tr><td>{{.Name}}</td><td class="{{.Class}}">{{.Value}}</td>{{if $.HasVanilla}}<td>{{.Vanilla}}</td>{{end}}</tr>
+{{end}}</table>{{end}}`))
+
+	siteCompare = template.Must(template.Must(siteTemplates.Clone()).Parse(`{{define "content"}}<p>
+<select id="a">{{range .Troops}}<option value="{{.Index}}">{{.Name}}</option>{{end}}</select>
+vs
+<select id="b">{{range .Troops}}<option value="{{.Index}}">{{.Name}}</option>{{end}}</select>
+</p>
+<table id="result"></table>
+<script>
+const troops = {{.JSON}};
+function render() {
+  const a = troops[document.getElementById("a").value];
+  const b = troops[document.getElementById("b").value];
+  let html = "<tr><th>Field</th><th>" + a.name + "</th><th>" + b.name + "</th></tr>";
+  for (const [key, value] of Object.entries(a)) {
+    if (typeof value !== "number" || key === "index") continue;
+    const other = b[key];
+    const cls = other > value ? "up" : other < value ? "down" : "";
+    html += "<tr><td>" + key + "</td><td>" + value + "</td><td class='" + cls + "'>" + other + "</td></tr>";
+  }
+  document.getElementById("result").innerHTML = html;
+}
+document.getElementById("a").onchange = render;
+document.getElementById("b").onchange = render;
+render();
+</script>{{end}}`))
+
+	siteChangelog = template.Must(template.Must(siteTemplates.Clone()).Parse(`{{define "content"}}{{if .Changes}}<table>
+<tr><th>Unit</th><th>Field</th><th>Old</th><th>New</th></tr>
+{{range .Changes}}<tr><td><a href="troops/{{slug .Record}}.html">{{.Record}}</a></td><td>{{.Field}}</td><td>{{.Old}}</td><td>{{.New}}</td></tr>
+{{end}}</table>{{else}}<p>No changes from vanilla.</p>{{end}}{{end}}`))
+)
+
+type sitePage struct {
+	Title      string
+	Root       string
+	Troops     []troopResource
+	JSON       template.JS
+	Fields     []siteField
+	HasVanilla bool
+	Changes    []fieldChange
+}
+
+// sitePageFile is a page and the template that renders it.
+type sitePageFile struct {
+	tmpl *template.Template
+	page sitePage
+}
+
+type siteField struct {
+	Name    string
+	Value   string
+	Vanilla string
+	Class   string
+}
+
+var nonSlug = regexp.MustCompile(`[^a-z0-9]+`)
+
+// slug turns a troop name into a file name.
+func slug(name string) string {
+	return strings.Trim(nonSlug.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+func runSite(args []string) error {
+	if len(args) == 0 || args[0] != "build" {
+		return errors.New("expected site build")
+	}
+
+	fs := newFlagSet("site build")
+	out := fs.String("o", "site", "Directory to write the site to")
+	against := fs.String("against", sourceVanilla, "Data the changelog and unit pages compare with; empty to disable")
+	title := fs.String("title", "KUF Crusaders Unit Database", "Site title")
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	spec := sourceCurrent
+	if fs.NArg() > 0 {
+		spec = fs.Arg(0)
+	}
+
+	tis, err := loadTroopSource(spec)
+	if err != nil {
+		return err
+	}
+
+	var vanilla *troopInfoSOX
+
+	if *against != "" {
+		v, err := loadTroopSource(*against)
+		if err != nil {
+			return err
+		}
+
+		vanilla = &v
+	}
+
+	if err := buildSite(*out, *title, tis, vanilla); err != nil {
+		return err
+	}
+
+	log.Info().Msg(tr("Wrote %s", *out))
+
+	return nil
+}
+
+// buildSite renders the unit pages, comparison tool and changelog into dir.
+// The output is plain files that can be published with GitHub Pages.
+func buildSite(dir, title string, tis troopInfoSOX, vanilla *troopInfoSOX) error {
+	if err := os.MkdirAll(filepath.Join(dir, "troops"), 0755); err != nil {
+		return err
+	}
+
+	troops := troopResources(tis)
+
+	data, err := json.Marshal(troops)
+	if err != nil {
+		return err
+	}
+
+	pages := map[string]sitePageFile{
+		"index.html":   {siteIndex, sitePage{Title: title, Troops: troops}},
+		"compare.html": {siteCompare, sitePage{Title: "Compare units", Troops: troops, JSON: template.JS(data)}},
+	}
+
+	changelog := sitePage{Title: "Changelog"}
+	if vanilla != nil {
+		changelog.Changes = diffRecords(troopRecords(*vanilla), troopRecords(tis))
+	}
+
+	pages["changelog.html"] = sitePageFile{siteChangelog, changelog}
+
+	refs := counterparts(vanilla, tis)
+
+	for i := range tis.TroopInfos {
+		page := sitePage{Title: troopName(i), Root: "../", HasVanilla: vanilla != nil}
+
+		for _, f := range troopFields {
+			sf := siteField{Name: f.Name, Value: f.Format(&tis.TroopInfos[i])}
+
+			if refs[i] != nil {
+				sf.Vanilla = f.Format(refs[i])
+
+				switch value, old := numericValue(f, &tis.TroopInfos[i]), numericValue(f, refs[i]); {
+				case value > old:
+					sf.Class = "up"
+				case value < old:
+					sf.Class = "down"
+				}
+			}
+
+			page.Fields = append(page.Fields, sf)
+		}
+
+		pages[filepath.Join("troops", slug(troopName(i))+".html")] = sitePageFile{siteTroop, page}
+	}
+
+	for name, p := range pages {
+		if err := renderSitePage(filepath.Join(dir, name), p.tmpl, p.page); err != nil {
+			return err
+		}
+	}
+
+	// Keep GitHub Pages from running the site through Jekyll.
+	return ioutil.WriteFile(filepath.Join(dir, ".nojekyll"), nil, 0644)
+}
+
+func renderSitePage(path string, tmpl *template.Template, page sitePage) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := tmpl.ExecuteTemplate(file, "layout", page); err != nil {
+		return err
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Names of the built-in troop data sources.
+const (
+	sourceCurrent = "current"
+	sourceVanilla = "vanilla"
+	sourceStdin   = "-"
+)
+
+// loadTroopSource loads troop data from spec, which is "current" for the
+// installed TroopInfo.sox, "vanilla" for its backup, "-" for SOX or YAML
+// data piped to stdin, or the path of a SOX or YAML file. YAML files are read
+// on top of the installed file.
+//
+// Workspaces, either directories or zip archives such as downloaded mods,
+// are read through loadTroopStorage.
+//
+// Historical states are referenced with a leading @: @current, @vanilla,
+// @backup:<id, date or snapshot name> and @variant:<name>.
+func loadTroopSource(spec string) (troopInfoSOX, error) {
+	if strings.HasPrefix(spec, "@") {
+		return loadTroopRef(spec)
+	}
+
+	switch spec {
+	case sourceCurrent:
+		return readTroopInfoSOX(troopInfoPath)
+	case sourceVanilla:
+		return loadVanilla()
+	case sourceStdin:
+		return readTroopStream("stdin", os.Stdin)
+	}
+
+	if st, ok, err := storageSource(spec); err != nil {
+		return troopInfoSOX{}, err
+	} else if ok {
+		return loadTroopStorage(st)
+	}
+
+	switch strings.ToLower(filepath.Ext(spec)) {
+	case ".yaml", ".yml":
+		base, err := readTroopInfoSOX(troopInfoPath)
+		if err != nil {
+			return troopInfoSOX{}, err
+		}
+
+		return readTroopInfoYAML(spec, base)
+	default:
+		return readTroopInfoSOX(spec)
+	}
+}
+
+func loadTroopRef(ref string) (troopInfoSOX, error) {
+	kind, arg := strings.TrimPrefix(ref, "@"), ""
+	if i := strings.Index(kind, ":"); i >= 0 {
+		kind, arg = kind[:i], kind[i+1:]
+	}
+
+	switch kind {
+	case sourceCurrent, sourceVanilla:
+		if arg == "" {
+			return loadTroopSource(kind)
+		}
+	case "backup":
+		if arg == "" {
+			arg = "latest"
+		}
+
+		b, err := findBackup(arg)
+		if err != nil {
+			return troopInfoSOX{}, err
+		}
+
+		return readTroopInfoSOX(b.Path)
+	case "variant":
+		if arg != "" {
+			return loadTroopSource(variantPath(arg))
+		}
+	}
+
+	return troopInfoSOX{}, fmt.Errorf("unknown reference %q", ref)
+}
+
+// storageSource opens spec as a read-only storage if it names a directory or
+// a zip archive. Sources are only ever read, so copies of other installs are
+// safe to point at.
+func storageSource(spec string) (storage, bool, error) {
+	if fi, err := os.Stat(spec); err != nil || !fi.IsDir() && !strings.EqualFold(filepath.Ext(spec), ".zip") {
+		return nil, false, nil
+	}
+
+	st, err := openStorage(spec)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return readOnlyStorage{st}, true, nil
+}
+
+// readTroopStorage decodes TroopInfo.sox from st.
+func readTroopStorage(st storage) (troopInfoSOX, error) {
+	data, err := st.ReadFile(troopInfoFile.Name)
+	if err != nil {
+		return troopInfoSOX{}, err
+	}
+
+	if err := troopInfoFile.checkData(troopInfoFile.Name, data); err != nil {
+		return troopInfoSOX{}, err
+	}
+
+	return decodeTroopInfoSOX(bytes.NewReader(data))
+}
+
+// loadTroopStorage loads the troop data of a workspace. A TroopInfo.yaml in
+// it is read on top of its TroopInfo.sox, or of the installed file if it only
+// ships the YAML.
+func loadTroopStorage(st storage) (troopInfoSOX, error) {
+	base, err := readTroopStorage(st)
+	if os.IsNotExist(err) {
+		base, err = readTroopInfoSOX(troopInfoPath)
+	}
+
+	if err != nil {
+		return troopInfoSOX{}, err
+	}
+
+	data, err := st.ReadFile("TroopInfo.yaml")
+	if os.IsNotExist(err) {
+		return base, nil
+	}
+
+	if err != nil {
+		return troopInfoSOX{}, err
+	}
+
+	return decodeTroopInfoYAML(st.String()+":"+"TroopInfo.yaml", data, base)
+}
+
+// readTroopStream decodes troop data from a stream that can't be reopened or
+// seeked, such as a pipe: as SOX if it has the layout of TroopInfo.sox, and
+// as YAML on top of the installed file otherwise. name is only used in
+// errors.
+func readTroopStream(name string, r io.Reader) (troopInfoSOX, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return troopInfoSOX{}, err
+	}
+
+	if troopInfoFile.checkData(name, data) == nil {
+		return decodeTroopInfoSOX(bytes.NewReader(data))
+	}
+
+	base, err := readTroopInfoSOX(troopInfoPath)
+	if err != nil {
+		return troopInfoSOX{}, err
+	}
+
+	return decodeTroopInfoYAML(name, data, base)
+}
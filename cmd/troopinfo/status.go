@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// syncStatePath records the hashes of the workspace YAML and the installed
+// SOX file as of the last time one was generated from the other, so status
+// can tell which side changed since.
+var syncStatePath = filepath.Join(soxDir, ".kuftc-sync.yaml")
+
+// Workspace states reported by status.
+const (
+	stateClean     = "clean"
+	stateModified  = "modified-uncommitted"
+	stateStale     = "installed-but-stale"
+	stateDiverged  = "diverged"
+	stateNoWorking = "no-workspace"
+)
+
+// syncEntry holds the hashes of one workspace file and its installed file.
+type syncEntry struct {
+	Workspace string `yaml:"workspace"`
+	Installed string `yaml:"installed"`
+}
+
+// workspaceFile pairs a workspace YAML file with the game file it's written
+// into.
+type workspaceFile struct {
+	Name      string
+	YAML      string
+	Installed string
+	Vanilla   string
+}
+
+// workspaceFiles returns the workspace files of the current game directory.
+func workspaceFiles() []workspaceFile {
+	return []workspaceFile{
+		{
+			Name:      "TroopInfo.sox",
+			YAML:      troopInfoYAMLPath,
+			Installed: troopInfoPath,
+			Vanilla:   vanillaPath(),
+		},
+	}
+}
+
+func readSyncState() (map[string]syncEntry, error) {
+	state := map[string]syncEntry{}
+
+	data, err := ioutil.ReadFile(syncStatePath)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := yaml.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// recordSync notes that the workspace and installed copies of the named file
+// are in sync.
+func recordSync(name string) error {
+	for _, wf := range workspaceFiles() {
+		if wf.Name != name {
+			continue
+		}
+
+		state, err := readSyncState()
+		if err != nil {
+			return err
+		}
+
+		workspace, _, err := hashFile(wf.YAML)
+		if err != nil {
+			return err
+		}
+
+		installed, _, err := hashFile(wf.Installed)
+		if err != nil {
+			return err
+		}
+
+		state[name] = syncEntry{Workspace: workspace, Installed: installed}
+
+		data, err := yaml.Marshal(state)
+		if err != nil {
+			return err
+		}
+
+		return ioutil.WriteFile(syncStatePath, data, 0600)
+	}
+
+	return fmt.Errorf("unknown workspace file %q", name)
+}
+
+func runStatus(args []string) error {
+	fs := newFlagSet("status")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	state, err := readSyncState()
+	if err != nil {
+		return err
+	}
+
+	for _, wf := range workspaceFiles() {
+		status, detail, err := workspaceStatus(wf, state[wf.Name])
+		if err != nil {
+			return fmt.Errorf("%s: %w", wf.Name, err)
+		}
+
+		fmt.Printf("%-24s %-22s %s\n", wf.Name, status, detail)
+	}
+
+	return nil
+}
+
+// workspaceStatus compares the workspace, installed and vanilla copies of wf.
+func workspaceStatus(wf workspaceFile, last syncEntry) (string, string, error) {
+	installed, err := readTroopInfoSOX(wf.Installed)
+	if err != nil {
+		return "", "", err
+	}
+
+	var detail string
+
+	if vanilla, err := readTroopInfoSOX(wf.Vanilla); err == nil {
+		detail = fmt.Sprintf("installed differs from vanilla in %d fields", len(diffRecords(troopRecords(vanilla), troopRecords(installed))))
+	}
+
+	workspace, err := readTroopInfoYAML(wf.YAML, installed)
+	if os.IsNotExist(err) {
+		return stateNoWorking, detail, nil
+	}
+
+	if err != nil {
+		return "", "", err
+	}
+
+	changes := diffRecords(troopRecords(installed), troopRecords(workspace))
+	if len(changes) == 0 {
+		return stateClean, detail, nil
+	}
+
+	detail = joinDetail(fmt.Sprintf("workspace differs from installed in %d fields", len(changes)), detail)
+
+	workspaceHash, _, err := hashFile(wf.YAML)
+	if err != nil {
+		return "", "", err
+	}
+
+	installedHash, _, err := hashFile(wf.Installed)
+	if err != nil {
+		return "", "", err
+	}
+
+	workspaceChanged := last.Workspace == "" || workspaceHash != last.Workspace
+	installedChanged := last.Installed != "" && installedHash != last.Installed
+
+	switch {
+	case workspaceChanged && installedChanged:
+		return stateDiverged, detail, nil
+	case installedChanged:
+		return stateStale, detail, nil
+	default:
+		return stateModified, detail, nil
+	}
+}
+
+func joinDetail(a, b string) string {
+	if b == "" {
+		return a
+	}
+
+	return a + "; " + b
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// steamInstallDir is the installdir of the game in its Steam app manifest.
+const steamInstallDir = "KUF Crusader"
+
+// vdfEntry is a key of a Valve KeyValues (VDF) document, the format of
+// Steam's libraryfolders.vdf and appmanifest_*.acf files. Blocks hold
+// Children, anything else a Value.
+type vdfEntry struct {
+	Key      string
+	Value    string
+	Children []vdfEntry
+	Block    bool
+}
+
+// child returns the first child named key; keys are case-insensitive.
+func (e vdfEntry) child(key string) (vdfEntry, bool) {
+	for _, c := range e.Children {
+		if strings.EqualFold(c.Key, key) {
+			return c, true
+		}
+	}
+
+	return vdfEntry{}, false
+}
+
+var errVDFSyntax = errors.New("invalid VDF")
+
+// parseVDF parses a KeyValues document into its top-level entries. Platform
+// conditionals such as [$WIN32] are skipped.
+func parseVDF(data []byte) ([]vdfEntry, error) {
+	tokens, err := vdfTokens(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	entries, rest, err := parseVDFEntries(tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("%w: unexpected %q", errVDFSyntax, rest[0].text)
+	}
+
+	return entries, nil
+}
+
+type vdfToken struct {
+	text   string
+	quoted bool
+}
+
+func parseVDFEntries(tokens []vdfToken) ([]vdfEntry, []vdfToken, error) {
+	var entries []vdfEntry
+
+	for len(tokens) > 0 {
+		if tokens[0].text == "}" && !tokens[0].quoted {
+			return entries, tokens, nil
+		}
+
+		if len(tokens) < 2 {
+			return nil, nil, fmt.Errorf("%w: %q has no value", errVDFSyntax, tokens[0].text)
+		}
+
+		e := vdfEntry{Key: tokens[0].text}
+
+		if tokens[1].text == "{" && !tokens[1].quoted {
+			children, rest, err := parseVDFEntries(tokens[2:])
+			if err != nil {
+				return nil, nil, err
+			}
+
+			if len(rest) == 0 {
+				return nil, nil, fmt.Errorf("%w: %q isn't closed", errVDFSyntax, e.Key)
+			}
+
+			e.Children, e.Block, tokens = children, true, rest[1:]
+		} else {
+			e.Value, tokens = tokens[1].text, tokens[2:]
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, nil, nil
+}
+
+func vdfTokens(s string) ([]vdfToken, error) {
+	var tokens []vdfToken
+
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case strings.HasPrefix(s[i:], "//"):
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+		case c == '{' || c == '}':
+			tokens = append(tokens, vdfToken{text: string(c)})
+			i++
+		case c == '[':
+			end := strings.IndexByte(s[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("%w: unterminated conditional", errVDFSyntax)
+			}
+
+			i += end + 1
+		case c == '"':
+			var b strings.Builder
+
+			i++
+
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+
+					switch s[i] {
+					case 'n':
+						b.WriteByte('\n')
+					case 't':
+						b.WriteByte('\t')
+					default:
+						b.WriteByte(s[i])
+					}
+
+					continue
+				}
+
+				b.WriteByte(s[i])
+			}
+
+			if i == len(s) {
+				return nil, fmt.Errorf("%w: unterminated string", errVDFSyntax)
+			}
+
+			tokens = append(tokens, vdfToken{text: b.String(), quoted: true})
+			i++
+		default:
+			start := i
+			for i < len(s) && !strings.ContainsRune(" \t\r\n{}\"", rune(s[i])) {
+				i++
+			}
+
+			tokens = append(tokens, vdfToken{text: s[start:i]})
+		}
+	}
+
+	return tokens, nil
+}
+
+// defaultGameDir returns where Steam installs the game by default on this
+// platform.
+func defaultGameDir() string {
+	if runtime.GOOS == "windows" {
+		return `C:\Program Files (x86)\Steam\steamapps\common\` + steamInstallDir
+	}
+
+	home, _ := os.UserHomeDir()
+
+	return filepath.Join(home, ".steam", "steam", "steamapps", "common", steamInstallDir)
+}
+
+// steamRoots returns the directories Steam is usually installed in on this
+// platform. On Linux these are the native and Flatpak installs, which run
+// the game through Proton, and Windows Steam installs inside Wine prefixes.
+func steamRoots() []string {
+	var roots []string
+
+	switch runtime.GOOS {
+	case "windows":
+		for _, env := range []string{"ProgramFiles(x86)", "ProgramFiles"} {
+			if dir := os.Getenv(env); dir != "" {
+				roots = append(roots, filepath.Join(dir, "Steam"))
+			}
+		}
+
+		roots = append(roots, `C:\Program Files (x86)\Steam`)
+	case "darwin":
+		if home, err := os.UserHomeDir(); err == nil {
+			roots = append(roots, filepath.Join(home, "Library", "Application Support", "Steam"))
+		}
+	default:
+		home, err := os.UserHomeDir()
+		if err != nil {
+			break
+		}
+
+		if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+			roots = append(roots, filepath.Join(dir, "Steam"))
+		}
+
+		roots = append(roots,
+			filepath.Join(home, ".steam", "steam"),
+			filepath.Join(home, ".steam", "root"),
+			filepath.Join(home, ".local", "share", "Steam"),
+			filepath.Join(home, ".var", "app", "com.valvesoftware.Steam", ".local", "share", "Steam"),
+		)
+
+		prefixes := []string{os.Getenv("WINEPREFIX"), filepath.Join(home, ".wine")}
+		for _, root := range roots {
+			pfx, _ := filepath.Glob(filepath.Join(root, "steamapps", "compatdata", "*", "pfx"))
+			prefixes = append(prefixes, pfx...)
+		}
+
+		for _, pfx := range prefixes {
+			if pfx != "" {
+				roots = append(roots, filepath.Join(pfx, "drive_c", "Program Files (x86)", "Steam"), filepath.Join(pfx, "drive_c", "Program Files", "Steam"))
+			}
+		}
+	}
+
+	return roots
+}
+
+// steamLibraries returns the library folders of the Steam install in root,
+// starting with root itself, from its libraryfolders.vdf. Both the current
+// layout, where each library is a block with a path, and the older one,
+// where numbered keys hold the paths, are read.
+func steamLibraries(root string) []string {
+	libraries := []string{root}
+
+	for _, name := range []string{filepath.Join("steamapps", "libraryfolders.vdf"), filepath.Join("config", "libraryfolders.vdf")} {
+		data, err := ioutil.ReadFile(filepath.Join(root, name))
+		if err != nil {
+			continue
+		}
+
+		entries, err := parseVDF(data)
+		if err != nil || len(entries) == 0 {
+			continue
+		}
+
+		for _, e := range entries[0].Children {
+			path := e.Value
+			if p, ok := e.child("path"); ok {
+				path = p.Value
+			}
+
+			if path == "" || strings.Trim(e.Key, "0123456789") != "" {
+				continue
+			}
+
+			libraries = append(libraries, winePath(root, path))
+		}
+	}
+
+	return dedupePaths(libraries)
+}
+
+// winePath maps the Windows path of a library of a Steam install inside a
+// Wine or Proton prefix, e.g. D:\SteamLibrary, to the prefix's drive
+// mapping. Other paths are returned as they are.
+func winePath(root, path string) string {
+	if runtime.GOOS == "windows" || len(path) < 3 || path[1] != ':' || (path[2] != '\\' && path[2] != '/') {
+		return path
+	}
+
+	i := strings.Index(root, string(filepath.Separator)+"drive_c"+string(filepath.Separator))
+	if i < 0 {
+		return path
+	}
+
+	rest := strings.ReplaceAll(path[3:], `\`, "/")
+
+	return filepath.Join(root[:i], "dosdevices", strings.ToLower(path[:2]), filepath.FromSlash(rest))
+}
+
+// findSteamGame returns the game installs in the given Steam libraries: the
+// install directories of app manifests whose installdir is the game's, and
+// the default install directory of libraries without a manifest for it.
+func findSteamGame(libraries []string) []string {
+	var found []string
+
+	for _, lib := range libraries {
+		apps := filepath.Join(lib, "steamapps")
+		dirs := []string{filepath.Join(apps, "common", steamInstallDir)}
+
+		manifests, _ := filepath.Glob(filepath.Join(apps, "appmanifest_*.acf"))
+		sort.Strings(manifests)
+
+		for _, m := range manifests {
+			data, err := ioutil.ReadFile(m)
+			if err != nil {
+				continue
+			}
+
+			entries, err := parseVDF(data)
+			if err != nil || len(entries) == 0 {
+				continue
+			}
+
+			if dir, ok := entries[0].child("installdir"); ok && strings.EqualFold(dir.Value, steamInstallDir) {
+				dirs = append([]string{filepath.Join(apps, "common", dir.Value)}, dirs...)
+			}
+		}
+
+		for _, dir := range dirs {
+			if isGameDir(dir) {
+				found = append(found, dir)
+			}
+		}
+	}
+
+	return dedupePaths(found)
+}
+
+// detectGameDirs returns the game installs found in the Steam libraries of
+// the usual Steam install directories.
+func detectGameDirs() []string {
+	var libraries []string
+
+	for _, root := range steamRoots() {
+		if fi, err := os.Stat(root); err == nil && fi.IsDir() {
+			libraries = append(libraries, steamLibraries(root)...)
+		}
+	}
+
+	return findSteamGame(dedupePaths(libraries))
+}
+
+// dedupePaths removes repeated paths, keeping the first of each. Paths
+// reaching the same directory through links, such as Wine drive mappings,
+// count as repeated.
+func dedupePaths(paths []string) []string {
+	seen := map[string]bool{}
+
+	var out []string
+
+	for _, p := range paths {
+		key := filepath.Clean(p)
+		if resolved, err := filepath.EvalSymlinks(p); err == nil {
+			key = resolved
+		}
+
+		if runtime.GOOS == "windows" {
+			key = strings.ToLower(key)
+		}
+
+		if !seen[key] {
+			seen[key] = true
+			out = append(out, p)
+		}
+	}
+
+	return out
+}
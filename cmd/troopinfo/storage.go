@@ -0,0 +1,198 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rdeusser/troopinfo/kuftc"
+)
+
+var errReadOnly = errors.New("storage is read-only")
+
+// errSteamBackup is returned for backups made with Steam's Backup and Restore
+// Games, which store files in Steam's compressed depot chunks rather than as
+// plain files.
+var errSteamBackup = errors.New("Steam backups can't be read directly; restore the backup with Steam, or copy the game's Data folder instead")
+
+// storage holds the files of a workspace or game install, addressed by file
+// name.
+type storage interface {
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte) error
+	List() ([]string, error)
+	String() string
+}
+
+// openStorage opens path as a zip archive if it ends in .zip, or as a
+// directory otherwise. Game installs are resolved to their SOX directory.
+func openStorage(path string) (storage, error) {
+	var st storage
+
+	if strings.EqualFold(filepath.Ext(path), ".zip") {
+		z, err := openZipStorage(path)
+		if err != nil {
+			return nil, err
+		}
+
+		st = z
+	} else {
+		st = dirStorage(resolveSOXDir(path))
+	}
+
+	names, err := st.List()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if isSteamBackup(names) {
+		return nil, fmt.Errorf("%s: %w", path, errSteamBackup)
+	}
+
+	return st, nil
+}
+
+// isSteamBackup reports whether names look like the top level of a Steam
+// backup, which holds an sku.sis description and depot chunk files.
+func isSteamBackup(names []string) bool {
+	for _, name := range names {
+		switch strings.ToLower(filepath.Ext(name)) {
+		case ".sis", ".csd", ".csm":
+			return true
+		}
+	}
+
+	return false
+}
+
+// readOnlyStorage wraps a storage so it can't be written to, for sources
+// that are only analyzed, such as copies of other installs.
+type readOnlyStorage struct {
+	storage
+}
+
+func (r readOnlyStorage) WriteFile(name string, data []byte) error {
+	return &os.PathError{Op: "write", Path: filepath.Join(r.String(), name), Err: errReadOnly}
+}
+
+// dirStorage is a directory on disk. Files are matched ignoring case if
+// there is no exact match, like on Windows, so copies of the game on other
+// systems work whatever case their files ended up in.
+type dirStorage string
+
+func (d dirStorage) ReadFile(name string) ([]byte, error) {
+	return ioutil.ReadFile(kuftc.FindFold(string(d), name))
+}
+
+func (d dirStorage) WriteFile(name string, data []byte) error {
+	path := kuftc.FindFold(string(d), name)
+
+	// Writes to the installed file, by whatever path, are backed up like
+	// every other.
+	return writeSOX(path, data)
+}
+
+func (d dirStorage) List() ([]string, error) {
+	entries, err := ioutil.ReadDir(string(d))
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+
+	for _, e := range entries {
+		if !e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+
+	return names, nil
+}
+
+func (d dirStorage) String() string {
+	return string(d)
+}
+
+// zipStorage is a read-only zip archive, such as a downloaded mod. Files are
+// found by name wherever they are in the archive, ignoring case, so it
+// doesn't matter whether the mod was packed from its SOX directory or from
+// a folder around it.
+type zipStorage struct {
+	path  string
+	files map[string][]byte // keyed by lowercased base name
+	names []string
+}
+
+func openZipStorage(archive string) (*zipStorage, error) {
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	z := &zipStorage{path: archive, files: map[string][]byte{}}
+
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+
+		if err != nil {
+			return nil, err
+		}
+
+		// Zip files written on Windows may separate directories with
+		// backslashes, which path.Base doesn't know about.
+		name := path.Base(strings.ReplaceAll(f.Name, "\\", "/"))
+		if name == "." || name == ".." || name == "/" {
+			continue
+		}
+
+		key := strings.ToLower(name)
+
+		if _, ok := z.files[key]; !ok {
+			z.names = append(z.names, name)
+		}
+
+		z.files[key] = data
+	}
+
+	sort.Strings(z.names)
+
+	return z, nil
+}
+
+func (z *zipStorage) ReadFile(name string) ([]byte, error) {
+	data, ok := z.files[strings.ToLower(name)]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: z.path + ":" + name, Err: os.ErrNotExist}
+	}
+
+	return append([]byte(nil), data...), nil
+}
+
+func (z *zipStorage) WriteFile(name string, data []byte) error {
+	return &os.PathError{Op: "write", Path: z.path + ":" + name, Err: errReadOnly}
+}
+
+func (z *zipStorage) List() ([]string, error) {
+	return z.names, nil
+}
+
+func (z *zipStorage) String() string {
+	return z.path
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDirStorageInstallsByAnyPath(t *testing.T) {
+	dir := newTestGame(t)
+
+	link := filepath.Join(dir, "sox")
+	if err := os.Symlink(soxDir, link); err != nil {
+		t.Skip(err)
+	}
+
+	tis := readInstalled(t)
+	tis.TroopInfos[0].Defense = float32(math.NaN())
+
+	buf := &bytes.Buffer{}
+
+	if err := encodeTroopInfoSOX(buf, tis); err != nil {
+		t.Fatal(err)
+	}
+
+	// Validation only runs on writes to the installed file, so refusing the
+	// NaN shows the write was routed to it.
+	for _, d := range []string{link, link + string(filepath.Separator), filepath.Join(soxDir, ".")} {
+		err := dirStorage(d).WriteFile(troopInfoFile.Name, buf.Bytes())
+		if !errors.Is(err, errInvalidData) {
+			t.Errorf("writing TroopInfo.sox through %s returned %v, want %v", d, err, errInvalidData)
+		}
+	}
+
+	if got := readInstalled(t).TroopInfos[0].Defense; got != 10 {
+		t.Errorf("installed defense is %g after the refused writes, want 10", got)
+	}
+}
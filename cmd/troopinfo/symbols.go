@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rdeusser/troopinfo/kuftc"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// symbolTable names the values of an ID field, so TroopInfo.yaml can say
+// "job: JOB_CAVALRY" instead of "job: 7". IDs without a name stay numbers,
+// and numbers are accepted for every ID.
+type symbolTable struct {
+	Field  string // field name, * matches any part of it
+	names  map[int32]string
+	values map[string]int32 // by upper case name
+}
+
+func newSymbolTable(field string) *symbolTable {
+	return &symbolTable{Field: field, names: map[int32]string{}, values: map[string]int32{}}
+}
+
+func (t *symbolTable) add(id int32, name string) {
+	t.names[id] = name
+	t.values[strings.ToUpper(name)] = id
+}
+
+// Names returns the names of the table, ordered by ID.
+func (t *symbolTable) Names() []string {
+	ids := make([]int, 0, len(t.names))
+	for id := range t.names {
+		ids = append(ids, int(id))
+	}
+
+	sort.Ints(ids)
+
+	names := make([]string, len(ids))
+	for i, id := range ids {
+		names[i] = t.names[int32(id)]
+	}
+
+	return names
+}
+
+var (
+	jobSymbols   = newSymbolTable("job")
+	typeSymbols  = newSymbolTable("type_id")
+	skillSymbols = newSymbolTable("level_up_data[*].skill_id")
+)
+
+// symbolTables are the ID fields with names. Skills have no built-in names
+// until SkillInfo.sox is decoded; the configuration can name them.
+var symbolTables = []*symbolTable{jobSymbols, typeSymbols, skillSymbols}
+
+// numericIDs turns the names off, for tools that expect numbers in
+// TroopInfo.yaml. It is set by numeric_ids in the configuration.
+var numericIDs bool
+
+func init() {
+	for id, name := range kuftc.JobNames {
+		jobSymbols.add(int32(id), name)
+	}
+
+	for i := range kuftc.TroopNames {
+		typeSymbols.add(int32(i), kuftc.TroopTypeName(int32(i)))
+	}
+}
+
+// loadSymbolSettings reads the skill names and numeric_ids of the
+// configuration file.
+func loadSymbolSettings() {
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Debug().
+			Err(err).
+			Msg(tr("Ignoring the ID names in the configuration"))
+		return
+	}
+
+	numericIDs = cfg.NumericIDs
+
+	for name, id := range cfg.SkillNames {
+		if _, err := strconv.Atoi(name); err == nil {
+			log.Warn().Msg(tr("Ignoring skill name %q, which is a number", name))
+			continue
+		}
+
+		skillSymbols.add(id, name)
+	}
+}
+
+// lookupSymbolTable returns the table of the field, if it has one.
+func lookupSymbolTable(field string) (*symbolTable, bool) {
+	for _, t := range symbolTables {
+		if matchPattern(t.Field, field) {
+			return t, true
+		}
+	}
+
+	return nil, false
+}
+
+// symbolName returns the name of the value of field, as formatted by
+// troopField.Format, or the value itself if it has no name.
+func symbolName(field, value string) string {
+	t, ok := lookupSymbolTable(field)
+	if !ok || numericIDs {
+		return value
+	}
+
+	id, err := strconv.ParseInt(value, 10, 32)
+	if err != nil {
+		return value
+	}
+
+	if name, ok := t.names[int32(id)]; ok {
+		return name
+	}
+
+	return value
+}
+
+// symbolValue returns the ID a name of field stands for, ignoring case.
+func symbolValue(field, name string) (int32, bool) {
+	t, ok := lookupSymbolTable(field)
+	if !ok {
+		return 0, false
+	}
+
+	id, ok := t.values[strings.ToUpper(strings.TrimSpace(name))]
+
+	return id, ok
+}
+
+// nameSymbols replaces the IDs in the YAML of a troop with their names, and
+// notes the display names of troop types in comments.
+func nameSymbols(troop *yaml.Node) {
+	for _, f := range troopFields {
+		if _, ok := lookupSymbolTable(f.Name); !ok {
+			continue
+		}
+
+		if node := findFieldNode(troop, f.Name); node != nil {
+			if name := valueName(f.Name, node.Value); name != "" {
+				node.LineComment = name
+			}
+
+			node.Value = symbolName(f.Name, node.Value)
+			node.Tag = ""
+		}
+	}
+}
+
+// resolveSymbols rewrites the ID names in the troops of doc to numbers.
+// Unknown names are errors listing the known ones.
+func resolveSymbols(path string, source []byte, doc *yaml.Node) error {
+	nodes, err := troopNodes(path, source, doc)
+	if err != nil {
+		return err
+	}
+
+	for _, n := range nodes {
+		for _, f := range troopFields {
+			t, ok := lookupSymbolTable(f.Name)
+			if !ok {
+				continue
+			}
+
+			node := findFieldNode(n.Value, f.Name)
+			if node == nil {
+				continue
+			}
+
+			if _, err := strconv.ParseFloat(node.Value, 64); err == nil {
+				continue
+			}
+
+			id, ok := symbolValue(f.Name, node.Value)
+			if !ok {
+				expected := "a number"
+				if names := t.Names(); len(names) > 0 {
+					expected = fmt.Sprintf("a number or one of %s", strings.Join(names, ", "))
+				}
+
+				return &yamlError{
+					Path:     path,
+					Line:     node.Line,
+					Column:   node.Column,
+					Msg:      fmt.Sprintf("unknown name in %s.%s", troopName(n.Index), f.Name),
+					Value:    node.Value,
+					Expected: expected,
+					source:   source,
+				}
+			}
+
+			node.Value = strconv.Itoa(int(id))
+			node.Tag = ""
+			node.Style = 0
+		}
+	}
+
+	return nil
+}
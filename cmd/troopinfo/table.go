@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ANSI colors used for table cells.
+const (
+	colorNone  = ""
+	colorRed   = "\x1b[31m"
+	colorGreen = "\x1b[32m"
+	colorBold  = "\x1b[1m"
+	colorReset = "\x1b[0m"
+)
+
+// defaultWidth is used when the terminal width cannot be detected.
+const defaultWidth = 120
+
+// termStyle controls how tables are rendered.
+type termStyle struct {
+	color bool
+	width int
+}
+
+// detectTermStyle enables color only when stdout is a terminal and neither
+// noColor nor the NO_COLOR environment variable are set.
+func detectTermStyle(noColor bool) termStyle {
+	style := termStyle{
+		color: !noColor && os.Getenv("NO_COLOR") == "" && isTerminal(os.Stdout),
+		width: terminalWidth(os.Stdout),
+	}
+
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		style.width = columns
+	}
+
+	if style.width <= 0 {
+		style.width = defaultWidth
+	}
+
+	return style
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+type cell struct {
+	text  string
+	color string
+}
+
+// table renders rows of cells as aligned columns. The leading label columns
+// are left-aligned and repeated when the table is too wide and has to be
+// split; the value columns are right-aligned.
+type table struct {
+	header []cell
+	rows   [][]cell
+	labels int
+}
+
+func newTable(header ...string) *table {
+	t := &table{labels: 1}
+
+	for _, h := range header {
+		t.header = append(t.header, cell{text: h, color: colorBold})
+	}
+
+	return t
+}
+
+func (t *table) addRow(cells ...cell) {
+	t.rows = append(t.rows, cells)
+}
+
+func (t *table) render(w io.Writer, style termStyle) {
+	widths := make([]int, len(t.header))
+
+	for _, row := range append([][]cell{t.header}, t.rows...) {
+		for i, c := range row {
+			if n := utf8.RuneCountInString(c.text); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	labels := makeRange(0, t.labels)
+
+	used := -2
+	for _, col := range labels {
+		used += 2 + widths[col]
+	}
+
+	// Split the value columns into chunks that fit the terminal width.
+	for start := t.labels; start < len(t.header); {
+		end, width := start, used
+		for end < len(t.header) && (end == start || width+2+widths[end] <= style.width) {
+			width += 2 + widths[end]
+			end++
+		}
+
+		if start > t.labels {
+			fmt.Fprintln(w)
+		}
+
+		columns := append(labels, makeRange(start, end)...)
+
+		for _, row := range append([][]cell{t.header}, t.rows...) {
+			var line strings.Builder
+
+			for j, col := range columns {
+				if j > 0 {
+					line.WriteString("  ")
+				}
+
+				c := cell{}
+				if col < len(row) {
+					c = row[col]
+				}
+
+				line.WriteString(c.pad(widths[col], col >= t.labels, style.color))
+			}
+
+			fmt.Fprintln(w, strings.TrimRight(line.String(), " "))
+		}
+
+		start = end
+	}
+}
+
+// pad returns the cell text padded to width, right-aligned if requested.
+func (c cell) pad(width int, right, color bool) string {
+	padding := strings.Repeat(" ", width-utf8.RuneCountInString(c.text))
+
+	text := c.text
+	if color && c.color != colorNone {
+		text = c.color + text + colorReset
+	}
+
+	if right {
+		return padding + text
+	}
+
+	return text + padding
+}
+
+func makeRange(start, end int) []int {
+	r := make([]int, 0, end-start)
+	for i := start; i < end; i++ {
+		r = append(r, i)
+	}
+
+	return r
+}
@@ -0,0 +1,12 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package main
+
+import "os"
+
+// terminalWidth is not implemented on this platform; the COLUMNS environment
+// variable or the default width is used instead.
+func terminalWidth(f *os.File) int {
+	return 0
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// tierMetrics are the troop qualities a tier list is scored on.
+var tierMetrics = map[string]func(ti troopInfo) float64{
+	// Damage of the whole troop per attack with its best attack.
+	"dps": func(ti troopInfo) float64 {
+		return math.Max(float64(ti.DirectAttack), float64(ti.IndirectAttack)) * float64(troopUnits(ti))
+	},
+	// HP of the whole troop, scaled up by defense and average resistance.
+	"ehp": func(ti troopInfo) float64 {
+		resist := math.Min(averageResist(ti), 0.95)
+
+		return float64(ti.DefaultUnitHP) * float64(troopUnits(ti)) * (1 + float64(ti.Defense)/100) / (1 - resist)
+	},
+	"speed": func(ti troopInfo) float64 {
+		return float64(ti.MoveSpeed)
+	},
+	"range": func(ti troopInfo) float64 {
+		return math.Max(float64(ti.AttackRangeMax), float64(ti.AttackFrontRange))
+	},
+}
+
+// defaultTierWeights weight survivability and damage over mobility.
+const defaultTierWeights = "dps=1,ehp=1,speed=0.5,range=0.5"
+
+// tiers and the share of troops that fall into each, best first.
+var tiers = []struct {
+	name  string
+	share float64
+}{
+	{"S", 0.1},
+	{"A", 0.2},
+	{"B", 0.4},
+	{"C", 0.2},
+	{"D", 0.1},
+}
+
+func troopUnits(ti troopInfo) int32 {
+	return ti.DefaultUnitNumX * ti.DefaultUnitNumY
+}
+
+func averageResist(ti troopInfo) float64 {
+	resists := []float32{
+		ti.ResistMelee, ti.ResistRanged, ti.ResistFrontal, ti.ResistExplosion, ti.ResistFire,
+		ti.ResistIce, ti.ResistLightning, ti.ResistHoly, ti.ResistCurse, ti.ResistPoison,
+	}
+
+	var sum float64
+	for _, r := range resists {
+		sum += float64(r)
+	}
+
+	return sum / float64(len(resists))
+}
+
+// parseTierWeights parses "metric=weight" pairs separated by commas.
+func parseTierWeights(s string) (map[string]float64, error) {
+	weights := map[string]float64{}
+
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid weight %q, want metric=weight", pair)
+		}
+
+		if _, ok := tierMetrics[kv[0]]; !ok {
+			return nil, fmt.Errorf("unknown metric %q", kv[0])
+		}
+
+		w, err := strconv.ParseFloat(kv[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", kv[0], err)
+		}
+
+		weights[kv[0]] = w
+	}
+
+	return weights, nil
+}
+
+// tierEntry is a troop's place in a tier list.
+type tierEntry struct {
+	Troop int
+	Score float64
+	Rank  int
+	Tier  string
+}
+
+// rankTroops scores every troop as the weighted sum of its metrics, each
+// normalized to the best troop, and sorts them into tiers. The result is
+// indexed by troop.
+func rankTroops(tis troopInfoSOX, weights map[string]float64) []tierEntry {
+	entries := make([]tierEntry, len(tis.TroopInfos))
+
+	for metric, w := range weights {
+		values := make([]float64, len(tis.TroopInfos))
+
+		var best float64
+		for i, ti := range tis.TroopInfos {
+			values[i] = tierMetrics[metric](ti)
+			best = math.Max(best, values[i])
+		}
+
+		if best == 0 {
+			continue
+		}
+
+		for i := range entries {
+			entries[i].Score += w * values[i] / best
+		}
+	}
+
+	order := make([]int, len(entries))
+	for i := range order {
+		entries[i].Troop = i
+		order[i] = i
+	}
+
+	sort.SliceStable(order, func(a, b int) bool {
+		return entries[order[a]].Score > entries[order[b]].Score
+	})
+
+	var cumulative float64
+
+	t := 0
+	for rank, i := range order {
+		for t < len(tiers)-1 && float64(rank) >= (cumulative+tiers[t].share)*float64(len(order)) {
+			cumulative += tiers[t].share
+			t++
+		}
+
+		entries[i].Rank = rank + 1
+		entries[i].Tier = tiers[t].name
+	}
+
+	return entries
+}
+
+func runTierList(args []string) error {
+	fs := newFlagSet("tierlist")
+	weightsFlag := fs.String("weights", defaultTierWeights, "Comma-separated metric=weight pairs; metrics are dps, ehp, speed and range")
+	against := fs.String("against", "", "Also rank this data (e.g. vanilla) and show how each troop moved")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	weights, err := parseTierWeights(*weightsFlag)
+	if err != nil {
+		return err
+	}
+
+	spec := sourceCurrent
+	if fs.NArg() > 0 {
+		spec = fs.Arg(0)
+	}
+
+	tis, err := loadTroopSource(spec)
+	if err != nil {
+		return err
+	}
+
+	entries := rankTroops(tis, weights)
+
+	var before []tierEntry
+
+	if *against != "" {
+		other, err := loadTroopSource(*against)
+		if err != nil {
+			return err
+		}
+
+		before = rankTroops(other, weights)
+	}
+
+	for _, tier := range tiers {
+		var names []string
+
+		for _, e := range sortedByRank(entries) {
+			if e.Tier != tier.name {
+				continue
+			}
+
+			name := troopName(e.Troop)
+			if before != nil && before[e.Troop].Tier != e.Tier {
+				name += fmt.Sprintf(" (%s→%s)", before[e.Troop].Tier, e.Tier)
+			}
+
+			names = append(names, name)
+		}
+
+		fmt.Printf("%s: %s\n", tier.name, strings.Join(names, ", "))
+	}
+
+	return nil
+}
+
+func sortedByRank(entries []tierEntry) []tierEntry {
+	sorted := append([]tierEntry(nil), entries...)
+
+	sort.Slice(sorted, func(a, b int) bool {
+		return sorted[a].Rank < sorted[b].Rank
+	})
+
+	return sorted
+}
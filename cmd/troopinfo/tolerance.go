@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// floatTolerance is the relative difference below which diffs report two
+// float values as equivalent rather than changed, so files re-encoded
+// through spreadsheets don't flood diffs with last-bit noise. 0 compares
+// exactly. It is set by float_tolerance in the configuration file and the
+// -tolerance flag of the diff commands.
+var floatTolerance float64
+
+// equivalent reports whether c only changes a float field by less than tol
+// relative to the larger value.
+func equivalent(c fieldChange, tol float64) bool {
+	if tol <= 0 {
+		return false
+	}
+
+	if f, ok := lookupFieldName(c.Field); !ok || !f.isFloat() {
+		return false
+	}
+
+	a, errA := strconv.ParseFloat(c.Old, 64)
+	b, errB := strconv.ParseFloat(c.New, 64)
+
+	if errA != nil || errB != nil {
+		return false
+	}
+
+	return math.Abs(a-b) <= tol*math.Max(math.Abs(a), math.Abs(b))
+}
+
+// filterEquivalent splits changes into real changes and the number of
+// equivalent ones.
+func filterEquivalent(changes []fieldChange, tol float64) ([]fieldChange, int) {
+	var kept []fieldChange
+
+	for _, c := range changes {
+		if !equivalent(c, tol) {
+			kept = append(kept, c)
+		}
+	}
+
+	return kept, len(changes) - len(kept)
+}
+
+func printEquivalentNote(n int, tol float64) {
+	if n == 1 {
+		fmt.Println(tr("1 float value is equivalent within a tolerance of %g (-tolerance 0 lists it)", tol))
+	} else if n > 1 {
+		fmt.Println(tr("%d float values are equivalent within a tolerance of %g (-tolerance 0 lists them)", n, tol))
+	}
+}
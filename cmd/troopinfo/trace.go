@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// patchStep is the state of a data file after applying the first Rule
+// rules of a patch document; step 0 is the unpatched file.
+type patchStep struct {
+	Rule    int
+	Records []record
+}
+
+// patchSteps applies rules one at a time, decoding the data file after each.
+func patchSteps(df dataFile, data []byte, rules []patchRule) ([]patchStep, error) {
+	records, err := df.decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	steps := []patchStep{{Records: records}}
+
+	for i, r := range rules {
+		if data, err = patchDataFile(df, data, []patchRule{r}); err != nil {
+			return nil, err
+		}
+
+		if records, err = df.decode(bytes.NewReader(data)); err != nil {
+			return nil, err
+		}
+
+		steps = append(steps, patchStep{Rule: i + 1, Records: records})
+	}
+
+	return steps, nil
+}
+
+// printPatchTrace prints how each traced value evolves rule by rule. Values
+// no rule changes are left out.
+func printPatchTrace(w io.Writer, df dataFile, data []byte, rules []patchRule, fields []string, recordPattern string) error {
+	steps, err := patchSteps(df, data, rules)
+	if err != nil {
+		return err
+	}
+
+	for i, rec := range steps[0].Records {
+		if !matchPattern(recordPattern, rec.Name) {
+			continue
+		}
+
+		for j, f := range rec.Fields {
+			if !matchAny(trimAll(fields), f.Name) {
+				continue
+			}
+
+			if !changedAtAnyStep(steps, i, j) {
+				continue
+			}
+
+			fmt.Fprintf(w, "%s.%s\n", rec.Name, f.Name)
+
+			tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+			fmt.Fprintf(tw, "  0\t%s\t%s\n", tr("start"), f.Value)
+
+			prev := f.Value
+
+			for _, s := range steps[1:] {
+				value := s.Records[i].Fields[j].Value
+
+				mark := ""
+				if value != prev {
+					mark = "*"
+				}
+
+				fmt.Fprintf(tw, "  %d\t%s\t%s\t%s\n", s.Rule, rules[s.Rule-1], value, mark)
+				prev = value
+			}
+
+			if err := tw.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// changedAtAnyStep reports whether field j of record i changes at any step,
+// even if a later rule changes it back.
+func changedAtAnyStep(steps []patchStep, i, j int) bool {
+	for _, s := range steps[1:] {
+		if s.Records[i].Fields[j].Value != steps[0].Records[i].Fields[j].Value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func trimAll(values []string) []string {
+	out := make([]string, len(values))
+	for i, v := range values {
+		out[i] = strings.TrimSpace(v)
+	}
+
+	return out
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+func runTroop(args []string) error {
+	if len(args) == 0 {
+		return errors.New("expected add")
+	}
+
+	switch args[0] {
+	case "add":
+		return runTroopAdd(args[1:])
+	default:
+		return fmt.Errorf("unknown troop command %q", args[0])
+	}
+}
+
+// runTroopAdd appends a copy of an existing troop record under a new name to
+// the installed TroopInfo.sox and the workspace TroopInfo.yaml.
+func runTroopAdd(args []string) error {
+	fs := newFlagSet("troop add")
+	clone := fs.String("clone", "", "Name of the troop whose record the new troop starts as")
+	name := fs.String("name", "", "Name of the new troop")
+	typeID := fs.Int("type-id", -1, "Type ID of the new troop (defaults to its index)")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *clone == "" || *name == "" {
+		return errors.New("-clone and -name are required, e.g. troop add -clone Knight -name \"Royal Knight\"")
+	}
+
+	if _, err := troopIndex(*name); err == nil {
+		return fmt.Errorf("there already is a troop named %q", *name)
+	}
+
+	data, err := ioutil.ReadFile(troopInfoPath)
+	if err != nil {
+		return err
+	}
+
+	tis, err := decodeTroopInfoSOX(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	from, err := troopRecord(tis, *clone)
+	if err != nil {
+		return err
+	}
+
+	i := len(tis.TroopInfos)
+	if i >= maxTroopRecords {
+		return fmt.Errorf("cannot add a troop to %d existing ones (max %d)", i, maxTroopRecords)
+	}
+
+	if *typeID < 0 {
+		*typeID = i
+	}
+
+	record := tis.TroopInfos[from]
+	record.TypeID = int32(*typeID)
+
+	appended, err := appendTroopRecords(data, i, []troopInfo{record})
+	if err != nil {
+		return err
+	}
+
+	log.Warn().Msg(tr("The game only knows the %d retail troop types; appended records may be ignored or crash missions", len(defaultTroopNames)))
+	log.Warn().Msg(tr("Type IDs must match a troop type the engine defines (K2TroopDef.h)"))
+
+	if err := installSOX(appended); err != nil {
+		return err
+	}
+
+	// The name is only recorded once the record exists, so a refused write
+	// leaves no name behind that a retry would collide with.
+	if err := addCustomTroopName(soxDir, i, *name); err != nil {
+		return err
+	}
+
+	after, err := decodeTroopInfoSOX(bytes.NewReader(appended))
+	if err != nil {
+		return err
+	}
+
+	if err := addTroopToYAML(troopInfoYAMLPath, after, i); err != nil {
+		return err
+	}
+
+	if err := recordSync(troopInfoFile.Name); err != nil {
+		log.Warn().Err(err).Msg(tr("Couldn't record the sync state"))
+	}
+
+	recordHistory("troop add", troopInfoFile.Name, diffRecords(troopRecords(tis), troopRecords(after)), appended)
+
+	log.Info().Msg(tr("Added %s as troop %d, a copy of %s", *name, i, troopName(from)))
+
+	return nil
+}
+
+// addTroopToYAML adds the troop at index i of tis to the TroopInfo.yaml at
+// path and updates its count, keeping the rest of the file and its comments
+// as they are. Without a workspace file, one is written from tis.
+func addTroopToYAML(path string, tis troopInfoSOX, i int) error {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return writeTroopInfoYAML(path, tis)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	var doc yaml.Node
+
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return newYAMLError(path, data, err)
+	}
+
+	root := documentRoot(&doc)
+
+	troops := mappingValue(root, troopsKey)
+	if troops == nil || troops.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s doesn't use the keyed troops layout; run dump to rewrite it", path)
+	}
+
+	if count := mappingValue(root, "count"); count != nil {
+		count.Value = strconv.Itoa(len(tis.TroopInfos))
+	}
+
+	value, err := valueNode(tis.TroopInfos[i])
+	if err != nil {
+		return err
+	}
+
+	nameSymbols(value)
+
+	troops.Content = append(troops.Content, &yaml.Node{
+		Kind:        yaml.ScalarNode,
+		Value:       troopKey(i),
+		HeadComment: fmt.Sprintf("%d -- %s", i, troopName(i)),
+	}, value)
+
+	out, err := encodeYAMLNode(&doc)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, out, 0600)
+}
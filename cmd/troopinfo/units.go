@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// unitConversion converts values annotated with a unit, such as
+// "move_speed: 12 m/s", to engine units by multiplying them with Factor. The
+// conversion only applies to the fields matching one of Fields, or to every
+// field if Fields is empty.
+type unitConversion struct {
+	Factor float64  `yaml:"factor"`
+	Fields []string `yaml:"fields"`
+}
+
+// defaultUnitConversions only cover units whose engine equivalent is known:
+// resistances are fractions of the damage taken. Users add their own, e.g. for
+// speeds and distances, in the units section of the configuration file.
+var defaultUnitConversions = map[string]unitConversion{
+	"%": {Factor: 0.01, Fields: []string{"resist_*"}},
+}
+
+// unitConversions are the conversions in effect, keyed by unit.
+var unitConversions = copyUnitConversions(defaultUnitConversions)
+
+// annotatedValue splits a YAML value into a number and a unit.
+var annotatedValue = regexp.MustCompile(`^\s*([-+]?(?:[0-9]+\.?[0-9]*|\.[0-9]+)(?:[eE][-+]?[0-9]+)?)\s*([^\s0-9].*?)\s*$`)
+
+// loadUnitConversions adds the conversions of the configuration file to
+// unitConversions.
+func loadUnitConversions() {
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Debug().
+			Err(err).
+			Msg(tr("Ignoring unit conversions in the configuration"))
+		return
+	}
+
+	for unit, c := range cfg.Units {
+		if c.Factor == 0 {
+			log.Warn().Msg(tr("Ignoring unit %q without a factor", unit))
+			continue
+		}
+
+		unitConversions[unit] = c
+	}
+}
+
+func copyUnitConversions(conversions map[string]unitConversion) map[string]unitConversion {
+	out := make(map[string]unitConversion, len(conversions))
+	for unit, c := range conversions {
+		out[unit] = c
+	}
+
+	return out
+}
+
+// convertUnits rewrites the unit-annotated troop fields of doc to plain
+// numbers in engine units. Integer fields are rounded.
+func convertUnits(path string, source []byte, doc *yaml.Node) error {
+	nodes, err := troopNodes(path, source, doc)
+	if err != nil {
+		return err
+	}
+
+	for _, n := range nodes {
+		for _, f := range troopFields {
+			node := findFieldNode(n.Value, f.Name)
+			if node == nil {
+				continue
+			}
+
+			if _, err := strconv.ParseFloat(node.Value, 64); err == nil {
+				continue
+			}
+
+			m := annotatedValue.FindStringSubmatch(node.Value)
+			if m == nil {
+				continue
+			}
+
+			yamlErr := func(msg, expected string) error {
+				return &yamlError{
+					Path:     path,
+					Line:     node.Line,
+					Column:   node.Column,
+					Msg:      fmt.Sprintf("%s %s.%s", msg, troopName(n.Index), f.Name),
+					Value:    node.Value,
+					Expected: expected,
+					source:   source,
+				}
+			}
+
+			c, ok := unitConversions[m[2]]
+			if !ok {
+				return yamlErr("unknown unit in", "one of "+strings.Join(knownUnits(), ", ")+", or a unit from the configuration file")
+			}
+
+			if !c.appliesTo(f.Name) {
+				return yamlErr(fmt.Sprintf("unit %q doesn't apply to", m[2]), "a plain number")
+			}
+
+			v, err := strconv.ParseFloat(m[1], 64)
+			if err != nil {
+				return yamlErr("invalid", expectedValue(f))
+			}
+
+			v *= c.Factor
+
+			if f.isFloat() {
+				node.Value = strconv.FormatFloat(float64(float32(v)), 'g', -1, 32)
+			} else {
+				node.Value = strconv.FormatInt(int64(math.Round(v)), 10)
+			}
+
+			node.Tag = ""
+			node.Style = 0
+		}
+	}
+
+	return nil
+}
+
+func (c unitConversion) appliesTo(field string) bool {
+	if len(c.Fields) == 0 {
+		return true
+	}
+
+	for _, pattern := range c.Fields {
+		if matchPattern(resolveFieldName(pattern), field) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func knownUnits() []string {
+	units := make([]string, 0, len(unitConversions))
+	for unit := range unitConversions {
+		units = append(units, strconv.Quote(unit))
+	}
+
+	sort.Strings(units)
+
+	return units
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Severities of validation rules. Errors stop writes to the game files,
+// warnings are only reported, and rules that are off aren't checked.
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+	severityOff     = "off"
+)
+
+var errInvalidData = errors.New("the troop data is invalid")
+
+// finding is a problem a validation rule found with a troop.
+type finding struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Troop    string `json:"troop"`
+	Msg      string `json:"msg"`
+}
+
+func (f finding) String() string {
+	return fmt.Sprintf("%s: %s [%s]", f.Troop, f.Msg, f.Rule)
+}
+
+// validationContext is what rules check troops against.
+type validationContext struct {
+	caps   unitCaps
+	skills map[int32]bool // skill IDs of the retail troops, nil if unknown
+}
+
+// validationRule checks a single troop and returns a message per problem.
+type validationRule struct {
+	Name     string
+	Doc      string
+	Severity string
+	check    func(ti troopInfo, ctx validationContext) []string
+}
+
+// validationRules are the checks of validate, in the order they are
+// reported. Severities can be changed per rule under validation in the
+// configuration file.
+var validationRules = []validationRule{
+	{
+		Name:     "finite",
+		Doc:      "floats must be numbers; NaN and infinities slip past every range check",
+		Severity: severityError,
+		check: func(ti troopInfo, ctx validationContext) []string {
+			var msgs []string
+
+			for _, f := range troopFields {
+				if f.Type != "float32" {
+					continue
+				}
+
+				if v := f.value(&ti).Float(); math.IsNaN(v) || math.IsInf(v, 0) {
+					msgs = append(msgs, fmt.Sprintf("%s is %s", f.Name, f.Format(&ti)))
+				}
+			}
+
+			return msgs
+		},
+	},
+	{
+		Name:     "resist_range",
+		Doc:      "resistances are fractions of the damage taken, between 0 and 1",
+		Severity: severityError,
+		check: func(ti troopInfo, ctx validationContext) []string {
+			var msgs []string
+
+			for _, f := range troopFields {
+				if !strings.HasPrefix(f.Name, "resist_") {
+					continue
+				}
+
+				if v := f.value(&ti).Float(); v < 0 || v > 1 {
+					msgs = append(msgs, fmt.Sprintf("%s %s is outside 0 to 1", f.Name, f.Format(&ti)))
+				}
+			}
+
+			return msgs
+		},
+	},
+	{
+		Name:     "hp_positive",
+		Doc:      "units need HP to exist",
+		Severity: severityError,
+		check: func(ti troopInfo, ctx validationContext) []string {
+			if ti.DefaultUnitHP <= 0 {
+				return []string{fmt.Sprintf("default_unit_hp %g isn't positive", ti.DefaultUnitHP)}
+			}
+
+			return nil
+		},
+	},
+	{
+		Name:     "unit_caps",
+		Doc:      "formations the engine may not render, see unit_caps in the configuration",
+		Severity: severityWarning,
+		check: func(ti troopInfo, ctx validationContext) []string {
+			var msgs []string
+
+			for _, w := range checkUnitCaps(troopInfoSOX{TroopInfos: []troopInfo{ti}}, ctx.caps) {
+				msgs = append(msgs, w.Msg)
+			}
+
+			return msgs
+		},
+	},
+	{
+		Name:     "skill_id",
+		Doc:      "level up skills must be skills some retail troop has",
+		Severity: severityError,
+		check: func(ti troopInfo, ctx validationContext) []string {
+			var msgs []string
+
+			for i, l := range ti.LevelUpData {
+				switch {
+				case l.SkillID < 0:
+					msgs = append(msgs, fmt.Sprintf("level_up_data[%d].skill_id %d is negative", i, l.SkillID))
+				case ctx.skills != nil && !ctx.skills[l.SkillID]:
+					msgs = append(msgs, fmt.Sprintf("level_up_data[%d].skill_id %d isn't a skill of any retail troop", i, l.SkillID))
+				}
+			}
+
+			return msgs
+		},
+	},
+}
+
+// validationSeverities are the configured severities of the rules, by name.
+var validationSeverities map[string]string
+
+// loadValidationSettings reads the rule severities of the configuration
+// file. Severities that aren't valid keep the default of their rule.
+func loadValidationSettings() {
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Debug().
+			Err(err).
+			Msg(tr("Ignoring the validation settings in the configuration"))
+		return
+	}
+
+	validationSeverities = map[string]string{}
+
+	for rule, severity := range cfg.Validation {
+		if !validSeverity(severity) {
+			log.Warn().Msg(tr("Ignoring severity %q of validation rule %s; expected error, warning or off", severity, rule))
+			continue
+		}
+
+		validationSeverities[rule] = severity
+	}
+}
+
+func lookupValidationRule(name string) (validationRule, bool) {
+	for _, r := range validationRules {
+		if r.Name == name {
+			return r, true
+		}
+	}
+
+	return validationRule{}, false
+}
+
+// validSeverity reports whether s is a severity a rule can be set to.
+func validSeverity(s string) bool {
+	return s == severityError || s == severityWarning || s == severityOff
+}
+
+// newValidationContext returns the caps and skills of the retail data, and
+// the caps of the configuration.
+func newValidationContext() validationContext {
+	var ctx validationContext
+
+	if vanilla := readVanilla(); vanilla != nil {
+		ctx.caps = retailUnitCaps(*vanilla)
+		ctx.skills = map[int32]bool{}
+
+		for _, ti := range vanilla.TroopInfos {
+			for _, l := range ti.LevelUpData {
+				ctx.skills[l.SkillID] = true
+			}
+		}
+	}
+
+	if cfg, err := loadConfig(); err == nil {
+		ctx.caps = ctx.caps.merge(cfg.UnitCaps)
+	}
+
+	return ctx
+}
+
+// validateTroops runs the rules that aren't off on every troop of tis.
+func validateTroops(tis troopInfoSOX, ctx validationContext) []finding {
+	var findings []finding
+
+	for _, r := range validationRules {
+		severity := r.Severity
+		if s, ok := validationSeverities[r.Name]; ok {
+			severity = s
+		}
+
+		if severity == severityOff {
+			continue
+		}
+
+		for i, ti := range tis.TroopInfos {
+			for _, msg := range r.check(ti, ctx) {
+				findings = append(findings, finding{Rule: r.Name, Severity: severity, Troop: troopName(i), Msg: msg})
+			}
+		}
+	}
+
+	return findings
+}
+
+// reportFindings logs the findings of the rules for tis and returns the
+// number of errors.
+func reportFindings(tis troopInfoSOX) int {
+	var errs int
+
+	for _, f := range validateTroops(tis, newValidationContext()) {
+		if f.Severity == severityError {
+			errs++
+			log.Error().Msg(f.String())
+		} else {
+			log.Warn().Msg(f.String())
+		}
+	}
+
+	return errs
+}
+
+// checkValid validates the SOX data about to be written to the game files.
+// Warnings are logged; errors fail the write unless -force was given.
+func checkValid(data []byte) error {
+	tis, err := decodeTroopInfoSOX(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	errs := reportFindings(tis)
+	if errs == 0 {
+		return nil
+	}
+
+	if forceWrite {
+		log.Warn().Msg(tr("Writing despite %d validation errors, since -force was given", errs))
+		return nil
+	}
+
+	return fmt.Errorf("%w; fix the errors above, change the severity of their rules under validation in the configuration, or write anyway with troopinfo -force <command>", errInvalidData)
+}
+
+func runValidate(args []string) error {
+	fs := newFlagSet("validate")
+	from := fs.String("from", troopInfoYAMLPath, "Data to check: a YAML or SOX file, a workspace, current, or a reference such as @variant:hard")
+	rules := fs.Bool("rules", false, "Lists the rules and their severities instead of validating")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *rules {
+		return printValidationRules()
+	}
+
+	tis, err := loadTroopSource(*from)
+	if err != nil {
+		return err
+	}
+
+	var errs int
+
+	for _, f := range validateTroops(tis, newValidationContext()) {
+		fmt.Printf("%s: %s\n", f.Severity, f)
+
+		if f.Severity == severityError {
+			errs++
+		}
+	}
+
+	if errs > 0 {
+		return fmt.Errorf("%w; see the errors above", errInvalidData)
+	}
+
+	log.Info().Msg(tr("No validation errors"))
+
+	return nil
+}
+
+func printValidationRules() error {
+	names := make([]string, 0, len(validationRules))
+	for _, r := range validationRules {
+		names = append(names, r.Name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		r, _ := lookupValidationRule(name)
+
+		severity := r.Severity
+		if s, ok := validationSeverities[r.Name]; ok {
+			severity = s
+		}
+
+		if _, err := fmt.Fprintf(os.Stdout, "%s (%s): %s\n", r.Name, severity, r.Doc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
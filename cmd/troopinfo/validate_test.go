@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestInstallRefusesNaN(t *testing.T) {
+	newTestGame(t)
+
+	for _, v := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		tis := readInstalled(t)
+		tis.TroopInfos[3].ResistMelee = float32(v)
+
+		buf := &bytes.Buffer{}
+
+		if err := encodeTroopInfoSOX(buf, tis); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := installSOX(buf.Bytes()); !errors.Is(err, errInvalidData) {
+			t.Errorf("installing resist_melee %g returned %v, want %v", v, err, errInvalidData)
+		}
+
+		if got := readInstalled(t).TroopInfos[3].ResistMelee; got != 0.5 {
+			t.Errorf("installed resist_melee is %g after the refused write, want 0.5", got)
+		}
+	}
+}
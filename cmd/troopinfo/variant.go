@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// variantsDir holds one directory per named variant of the YAML workspace,
+// e.g. easy, normal and hard.
+var variantsDir = filepath.Join(soxDir, "variants")
+
+// activeVariantFile records which variant was installed last.
+const activeVariantFile = "active"
+
+var errNoVariant = errors.New("no such variant")
+
+func runVariant(args []string) error {
+	fs := newFlagSet("variant")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		return errors.New("expected list, save, switch or delete")
+	}
+
+	name := fs.Arg(1)
+	if fs.Arg(0) != "list" && name == "" {
+		return fmt.Errorf("%s needs a variant name", fs.Arg(0))
+	}
+
+	switch fs.Arg(0) {
+	case "list":
+		return listVariants()
+	case "save":
+		return saveVariant(name)
+	case "switch":
+		return switchVariant(name)
+	case "delete":
+		return deleteVariant(name)
+	default:
+		return fmt.Errorf("unknown variant command %q", fs.Arg(0))
+	}
+}
+
+func variantPath(name string) string {
+	return filepath.Join(variantsDir, name, "TroopInfo.yaml")
+}
+
+func activeVariant() string {
+	data, _ := ioutil.ReadFile(filepath.Join(variantsDir, activeVariantFile))
+
+	return strings.TrimSpace(string(data))
+}
+
+func listVariants() error {
+	entries, err := ioutil.ReadDir(variantsDir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	active := activeVariant()
+
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+
+		marker := " "
+		if e.Name() == active {
+			marker = "*"
+		}
+
+		fmt.Printf("%s %s\n", marker, e.Name())
+	}
+
+	return nil
+}
+
+// saveVariant copies the current YAML workspace into the named variant.
+func saveVariant(name string) error {
+	data, err := ioutil.ReadFile(troopInfoYAMLPath)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(variantPath(name)), 0700); err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(variantPath(name), data, 0600); err != nil {
+		return err
+	}
+
+	log.Info().Msg(tr("Saved variant %s", name))
+
+	return nil
+}
+
+// switchVariant makes the named variant the YAML workspace and installs it
+// into TroopInfo.sox.
+func switchVariant(name string) error {
+	data, err := ioutil.ReadFile(variantPath(name))
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%w: %s", errNoVariant, name)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	base, err := readTroopInfoSOX(troopInfoPath)
+	if err != nil {
+		return err
+	}
+
+	tis, err := readTroopInfoYAML(variantPath(name), base)
+	if err != nil {
+		return err
+	}
+
+	changes := diffRecords(troopRecords(base), troopRecords(tis))
+
+	buf := &bytes.Buffer{}
+
+	if err := encodeTroopInfoSOX(buf, tis); err != nil {
+		return err
+	}
+
+	if err := installSOX(buf.Bytes()); err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(troopInfoYAMLPath, data, 0600); err != nil {
+		return err
+	}
+
+	if err := recordSync("TroopInfo.sox"); err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(variantsDir, activeVariantFile), []byte(name+"\n"), 0600); err != nil {
+		return err
+	}
+
+	recordHistory("variant switch "+name, "TroopInfo.sox", changes, buf.Bytes())
+
+	log.Info().Msg(tr("Installed variant %s", name))
+
+	return nil
+}
+
+func deleteVariant(name string) error {
+	if _, err := os.Stat(variantPath(name)); os.IsNotExist(err) {
+		return fmt.Errorf("%w: %s", errNoVariant, name)
+	}
+
+	if activeVariant() == name {
+		if err := os.Remove(filepath.Join(variantsDir, activeVariantFile)); err != nil {
+			return err
+		}
+	}
+
+	return os.RemoveAll(filepath.Join(variantsDir, name))
+}
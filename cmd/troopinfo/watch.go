@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog/log"
+)
+
+// watchRetry is how often watch checks again whether the game has exited
+// when a write has to wait for it.
+const watchRetry = 2 * time.Second
+
+// runWatch applies TroopInfo.yaml to the installed TroopInfo.sox every time
+// it is saved, so testing a change takes a save and a restart of the game.
+// Files that don't decode or fail validation are reported and left for the
+// next save to fix; writes while the game is running wait for it to exit.
+func runWatch(args []string) error {
+	fs := newFlagSet("watch")
+	from := fs.String("from", troopInfoYAMLPath, "YAML file to watch and apply")
+	details := fs.Bool("details", false, "Lists every changed value instead of a per-troop summary")
+	delay := fs.Duration("delay", 300*time.Millisecond, "How long to wait for further changes after a save before applying it, since editors save in several steps")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() > 0 {
+		return errors.New("watch takes no arguments; use -from to watch another file")
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	defer watcher.Close()
+
+	// Editors often save by replacing the file, which ends a watch on the
+	// file itself, so its directory is watched instead.
+	if err := watcher.Add(filepath.Dir(*from)); err != nil {
+		return err
+	}
+
+	log.Info().Msg(tr("Watching %s; press Ctrl+C to stop", *from))
+
+	var (
+		saved   = time.NewTimer(*delay)
+		retry   <-chan time.Time
+		waiting bool // for the game to exit
+	)
+
+	apply := func() {
+		retry = nil
+
+		err := applyWatched(*from, *details)
+
+		switch {
+		case errors.Is(err, errGameRunning):
+			if !waiting {
+				log.Warn().Msg(tr("The game is running; %s will be written once it exits", troopInfoFile.Name))
+			}
+
+			waiting = true
+			retry = time.After(watchRetry)
+
+			return
+		case err != nil:
+			log.Error().Err(err).Msg(tr("Not applied; fix %s and save it again", *from))
+
+			var ye *yamlError
+			if errors.As(err, &ye) {
+				fmt.Fprint(os.Stderr, ye.Context())
+			}
+		}
+
+		waiting = false
+	}
+
+	// The timer only runs once the file is saved; the file is applied at
+	// start right away.
+	stopTimer(saved)
+	apply()
+
+	for {
+		select {
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+
+			if filepath.Clean(ev.Name) == filepath.Clean(*from) && ev.Op&(fsnotify.Write|fsnotify.Create) != 0 {
+				// A tick that fired but wasn't received yet is dropped, or
+				// the save would be applied at once instead of after delay.
+				stopTimer(saved)
+				saved.Reset(*delay)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+
+			log.Warn().Err(err).Msg(tr("Watching %s failed", *from))
+		case <-saved.C:
+			apply()
+		case <-retry:
+			if err := checkGameNotRunning(); errors.Is(err, errGameRunning) {
+				retry = time.After(watchRetry)
+				continue
+			}
+
+			apply()
+		}
+	}
+}
+
+// stopTimer stops t and drains the tick it fired if nobody received it, so
+// t can be reset without firing early.
+func stopTimer(t *time.Timer) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+}
+
+// applyWatched encodes the YAML file at path into the installed
+// TroopInfo.sox if it changes anything, as apply does.
+func applyWatched(path string, details bool) error {
+	installed, err := readTroopInfoSOX(troopInfoPath)
+	if err != nil {
+		return err
+	}
+
+	data, err := binaryData(path, installed)
+	if err != nil {
+		return err
+	}
+
+	tis, err := decodeTroopInfoSOX(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	if err := checkComplete(tis, false); err != nil {
+		return err
+	}
+
+	changes := diffRecords(troopRecords(installed), troopRecords(tis))
+	if len(changes) == 0 {
+		log.Info().Msg(tr("%s matches the installed %s", path, troopInfoFile.Name))
+		return nil
+	}
+
+	printChangeSummary(os.Stdout, changes, details)
+
+	if err := installSOX(data); err != nil {
+		return err
+	}
+
+	if path == troopInfoYAMLPath {
+		if err := recordSync(troopInfoFile.Name); err != nil {
+			log.Warn().Err(err).Msg(tr("Couldn't record the sync state"))
+		}
+	}
+
+	recordHistory("watch", troopInfoFile.Name, changes, data)
+
+	log.Info().Msg(tr("Wrote %s", troopInfoPath))
+
+	return nil
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rdeusser/troopinfo/kuftc"
+	"github.com/rs/zerolog/log"
+)
+
+// The workspace commands move troop data between the installed
+// TroopInfo.sox and the workspace TroopInfo.yaml: dump decodes the installed
+// file, apply encodes the workspace into it, restore brings back the backup
+// taken before modding and show prints the installed data.
+
+func runDump(args []string) error {
+	fs := newFlagSet("dump")
+	out := fs.String("o", troopInfoYAMLPath, "YAML or JSON file to write")
+	format := fs.String("format", "", "Format to write: yaml or json (defaults to the extension of -o, or yaml)")
+	schema := fs.String("schema", "", "Schema document describing the layout of a SOX file without built-in support; decodes that file instead, e.g. dump -schema unitinfo.schema.yaml [file.sox]")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	outSet := false
+	fs.Visit(func(f *flag.Flag) { outSet = outSet || f.Name == "o" })
+
+	if *schema != "" {
+		if fs.NArg() > 1 {
+			return errors.New("expected at most one SOX file")
+		}
+
+		if *format != "" {
+			return errors.New("-format isn't supported with -schema")
+		}
+
+		if !outSet {
+			*out = ""
+		}
+
+		return dumpWithSchema(*schema, fs.Arg(0), *out)
+	}
+
+	f, err := dataFormat(*format, *out)
+	if err != nil {
+		return err
+	}
+
+	if f == formatJSON && !outSet {
+		*out = troopInfoJSONPath
+	}
+
+	tis, err := readTroopInfoSOX(troopInfoPath)
+	if err != nil {
+		return err
+	}
+
+	write := writeTroopInfoYAML
+	if f == formatJSON {
+		write = writeTroopInfoJSON
+	}
+
+	if err := write(*out, tis); err != nil {
+		return err
+	}
+
+	if *out == troopInfoYAMLPath {
+		if err := recordSync(troopInfoFile.Name); err != nil {
+			log.Warn().Err(err).Msg(tr("Couldn't record the sync state"))
+		}
+	}
+
+	recordHistory("dump", *out, nil, nil)
+
+	log.Info().Msg(tr("Wrote %s", *out))
+
+	return nil
+}
+
+// dumpWithSchema decodes file, by default the schema's file in the game
+// directory, with the schema document at schemaPath and writes the YAML to
+// out, by default next to file.
+func dumpWithSchema(schemaPath, file, out string) error {
+	s, err := readSchemaDocument(schemaPath)
+	if err != nil {
+		return err
+	}
+
+	if file == "" {
+		if s.File == "" {
+			return fmt.Errorf("%s names no file; pass the SOX file to decode", schemaPath)
+		}
+
+		file = kuftc.FindFold(soxDir, s.File)
+	}
+
+	if out == "" {
+		out = strings.TrimSuffix(file, filepath.Ext(file)) + ".yaml"
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	doc, err := decodeWithSchema(s, file, data)
+	if err != nil {
+		return err
+	}
+
+	encoded, err := encodeYAMLNode(doc)
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(out, encoded, 0600); err != nil {
+		return err
+	}
+
+	log.Info().Msg(tr("Wrote %s", out))
+
+	return nil
+}
+
+func runShow(args []string) error {
+	fs := newFlagSet("show")
+	noColor := fs.Bool("no-color", false, "Disables colored output")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	tis, err := readTroopInfoSOX(troopInfoPath)
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(tr("version: %d, count: %d\n\n", tis.Version, tis.Count))
+	writeTroopTable(os.Stdout, tis, readVanilla(), detectTermStyle(*noColor))
+
+	return nil
+}
+
+func runApply(args []string) error {
+	fs := newFlagSet("apply")
+	from := fs.String("from", troopInfoYAMLPath, "YAML or JSON file to encode into the installed TroopInfo.sox")
+	format := fs.String("format", "", "Format of -from: yaml or json (defaults to its extension, or yaml)")
+	details := fs.Bool("details", false, "Lists every changed value instead of a per-troop summary")
+	allowZero := fs.Bool("allow-zero", false, "Allows writing troop records that are all zeros")
+	dryRun := fs.Bool("dry-run", false, "Prints the changes without writing them")
+	strategy := fs.String("strategy", "error", "With several files, how to resolve fields a later file changes to another value than an earlier one: error, last-wins or interactive")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	fromSet := false
+	fs.Visit(func(f *flag.Flag) { fromSet = fromSet || f.Name == "from" })
+
+	installed, err := readTroopInfoSOX(troopInfoPath)
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+
+	if fs.NArg() > 0 {
+		if fromSet {
+			return errors.New("-from can't be combined with a list of files")
+		}
+
+		if data, err = layeredData(installed, fs.Args(), *format, *strategy); err != nil {
+			return err
+		}
+	} else {
+		f, err := dataFormat(*format, *from)
+		if err != nil {
+			return err
+		}
+
+		if f == formatJSON {
+			if !fromSet {
+				*from = troopInfoJSONPath
+			}
+
+			if err := checkJSONFile(*from); err != nil {
+				return err
+			}
+		}
+
+		if data, err = binaryData(*from, installed); err != nil {
+			return err
+		}
+	}
+
+	tis, err := decodeTroopInfoSOX(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	if err := checkComplete(tis, *allowZero); err != nil {
+		return err
+	}
+
+	changes := diffRecords(troopRecords(installed), troopRecords(tis))
+
+	printChangeSummary(os.Stdout, changes, *details)
+
+	if *dryRun {
+		reportFindings(tis)
+		return nil
+	}
+
+	if err := installSOX(data); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 && *from == troopInfoYAMLPath {
+		if err := recordSync(troopInfoFile.Name); err != nil {
+			log.Warn().Err(err).Msg(tr("Couldn't record the sync state"))
+		}
+	}
+
+	recordHistory("apply", troopInfoFile.Name, changes, data)
+
+	log.Info().Msg(tr("Wrote %s", troopInfoPath))
+
+	return nil
+}
+
+// layeredData encodes the YAML or JSON files at paths, applied on top of
+// installed one after another, resolving conflicts between them with the
+// named strategy.
+func layeredData(installed troopInfoSOX, paths []string, format, strategy string) ([]byte, error) {
+	name, ok := layerStrategies[strategy]
+	if !ok {
+		return nil, fmt.Errorf("unknown conflict strategy %q, expected error, last-wins or interactive", strategy)
+	}
+
+	resolve, err := newResolver(name, os.Stdin, os.Stdout)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only prompts need to say which files are ours and theirs.
+	var out io.Writer = ioutil.Discard
+
+	switch name {
+	case resolvePrompt:
+		out = os.Stdout
+	case resolveTheirs:
+		resolve = func(c conflict) (string, error) {
+			log.Warn().Msg(tr("%s: %s of an earlier file is overridden with %s", c, c.Ours, c.Their))
+			return c.Their, nil
+		}
+	}
+
+	tis, err := mergeLayers(installed, paths, format, resolve, out)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+
+	if err := encodeTroopInfoSOX(buf, tis); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func runRestore(args []string) error {
+	fs := newFlagSet("restore")
+	from := fs.String("from", vanillaPath(), "Backup of TroopInfo.sox to restore")
+	at := fs.String("at", "", "Backup chain entry to restore: a timestamp prefix such as 2024-05-01T13, a snapshot name, or latest")
+	list := fs.Bool("list", false, "Lists the backups that can be restored and how much each differs from the installed file")
+	details := fs.Bool("details", false, "With -list, also lists the fields each backup differs in")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *list {
+		return listRestorable(*details)
+	}
+
+	if *at != "" {
+		fromSet := false
+		fs.Visit(func(f *flag.Flag) { fromSet = fromSet || f.Name == "from" })
+
+		if fromSet {
+			return errors.New("-at and -from can't be combined")
+		}
+
+		b, err := findBackup(*at)
+		if err != nil {
+			return err
+		}
+
+		*from = b.Path
+	}
+
+	if err := troopInfoFile.checkLayout(*from); err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(*from)
+	if err != nil {
+		return err
+	}
+
+	tis, err := decodeTroopInfoSOX(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	// A damaged install is what restoring is for, so its changes are only
+	// recorded when it can still be read.
+	var changes []fieldChange
+	if installed, err := readTroopInfoSOX(troopInfoPath); err == nil {
+		changes = diffRecords(troopRecords(installed), troopRecords(tis))
+	}
+
+	if err := installSOX(data); err != nil {
+		return err
+	}
+
+	recordHistory("restore", troopInfoFile.Name, changes, data)
+
+	log.Info().Msg(tr("Restored %s from %s", troopInfoPath, *from))
+
+	return nil
+}
+
+// listRestorable prints TroopInfo.sox.bak and the backup chain, newest first,
+// with the number of fields each differs from the installed file in.
+func listRestorable(details bool) error {
+	installed, err := readTroopInfoSOX(troopInfoPath)
+	if err != nil {
+		return err
+	}
+
+	backups, err := listBackups()
+	if err != nil {
+		return err
+	}
+
+	type candidate struct {
+		ref, path string
+	}
+
+	var candidates []candidate
+
+	for i := len(backups) - 1; i >= 0; i-- {
+		candidates = append(candidates, candidate{backups[i].ID, backups[i].Path})
+	}
+
+	if _, err := os.Stat(troopInfoBackupPath); err == nil {
+		candidates = append(candidates, candidate{filepath.Base(troopInfoBackupPath), troopInfoBackupPath})
+	}
+
+	if len(candidates) == 0 {
+		fmt.Println(tr("No backups to restore"))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	for _, c := range candidates {
+		tis, err := readTroopInfoSOX(c.path)
+		if err != nil {
+			fmt.Fprintf(w, "%s\t%s\n", c.ref, tr("unreadable: %v", err))
+			continue
+		}
+
+		changes := diffRecords(troopRecords(installed), troopRecords(tis))
+
+		switch len(changes) {
+		case 0:
+			fmt.Fprintf(w, "%s\t%s\n", c.ref, tr("same as installed"))
+		case 1:
+			fmt.Fprintf(w, "%s\t%s\n", c.ref, tr("1 field differs"))
+		default:
+			fmt.Fprintf(w, "%s\t%s\n", c.ref, tr("%d fields differ", len(changes)))
+		}
+
+		if details && len(changes) > 0 {
+			if err := w.Flush(); err != nil {
+				return err
+			}
+
+			printChangeSummary(os.Stdout, changes, true)
+			fmt.Println()
+		}
+	}
+
+	return w.Flush()
+}
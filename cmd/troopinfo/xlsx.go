@@ -0,0 +1,364 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// formatXLSX is the workbook format export writes with one sheet per
+// supported data file, and import reads edits back from.
+const formatXLSX = "xlsx"
+
+// sheet is a worksheet of a workbook: its name and its rows of cells.
+type sheet struct {
+	Name string
+	Rows [][]string
+}
+
+// sheetName returns the worksheet name of a data file, e.g. TroopInfo.
+func sheetName(file string) string {
+	return strings.TrimSuffix(file, path.Ext(file))
+}
+
+// workbookSheets returns a sheet for every supported data file: troop data
+// from tis, the others from the SOX directory. Each sheet has a record per
+// row under a header row of field names, like a rows layout CSV export.
+func workbookSheets(tis troopInfoSOX) ([]sheet, error) {
+	var sheets []sheet
+
+	for _, df := range dataFiles {
+		records := troopRecords(tis)
+
+		if df.Name != troopInfoFile.Name {
+			var err error
+
+			records, err = df.readRecords(dirStorage(soxDir))
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		s := sheet{Name: sheetName(df.Name)}
+
+		for i, r := range records {
+			if i == 0 {
+				header := []string{rowsHeader}
+				for _, f := range r.Fields {
+					header = append(header, f.Name)
+				}
+
+				s.Rows = append(s.Rows, header)
+			}
+
+			row := []string{r.Name}
+			for _, f := range r.Fields {
+				row = append(row, f.Value)
+			}
+
+			s.Rows = append(s.Rows, row)
+		}
+
+		sheets = append(sheets, s)
+	}
+
+	return sheets, nil
+}
+
+// writeXLSX writes sheets to path as a workbook. The header row and the
+// first column of every sheet are frozen so names stay visible while
+// scrolling, and cells holding numbers are stored as numbers so spreadsheet
+// formulas work on them.
+func writeXLSX(path string, sheets []sheet) error {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+
+	var types, sheetList, rels strings.Builder
+
+	for i, s := range sheets {
+		n := i + 1
+
+		fmt.Fprintf(&types, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, n)
+		fmt.Fprintf(&sheetList, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlEscape(s.Name), n, n)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, n, n)
+	}
+
+	parts := []struct {
+		name, content string
+	}{
+		{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			types.String() + `</Types>`},
+		{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets>` + sheetList.String() + `</sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			rels.String() + `</Relationships>`},
+	}
+
+	for i, s := range sheets {
+		parts = append(parts, struct{ name, content string }{fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), worksheetXML(s)})
+	}
+
+	for _, p := range parts {
+		w, err := zw.Create(p.name)
+		if err != nil {
+			return err
+		}
+
+		if _, err := io.WriteString(w, p.content); err != nil {
+			return err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, buf.Bytes(), 0600)
+}
+
+func worksheetXML(s sheet) string {
+	var b strings.Builder
+
+	b.WriteString(xml.Header)
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	b.WriteString(`<sheetViews><sheetView workbookViewId="0">`)
+	b.WriteString(`<pane xSplit="1" ySplit="1" topLeftCell="B2" activePane="bottomRight" state="frozen"/>`)
+	b.WriteString(`</sheetView></sheetViews><sheetData>`)
+
+	for i, row := range s.Rows {
+		fmt.Fprintf(&b, `<row r="%d">`, i+1)
+
+		for j, value := range row {
+			ref := cellRef(j, i)
+
+			if _, err := strconv.ParseFloat(value, 64); err == nil && i > 0 && j > 0 {
+				fmt.Fprintf(&b, `<c r="%s"><v>%s</v></c>`, ref, value)
+			} else {
+				fmt.Fprintf(&b, `<c r="%s" t="inlineStr"><is><t>%s</t></is></c>`, ref, xmlEscape(value))
+			}
+		}
+
+		b.WriteString(`</row>`)
+	}
+
+	b.WriteString(`</sheetData></worksheet>`)
+
+	return b.String()
+}
+
+// cellRef returns the A1-style reference of the cell in column col and row
+// row, both counted from 0.
+func cellRef(col, row int) string {
+	name := ""
+
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = string(rune('A'+(col-1)%26)) + name
+	}
+
+	return name + strconv.Itoa(row+1)
+}
+
+// cellColumn returns the column, counted from 0, of an A1-style reference.
+func cellColumn(ref string) int {
+	col := 0
+
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+
+		col = col*26 + int(r-'A') + 1
+	}
+
+	return col - 1
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+
+	return b.String()
+}
+
+// readXLSX reads the sheets of the workbook file, as written by
+// writeXLSX or saved by a spreadsheet application.
+func readXLSX(file string) ([]sheet, error) {
+	zr, err := zip.OpenReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+			ID   string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+
+	if err := readXMLPart(files, "xl/workbook.xml", &workbook); err != nil {
+		return nil, err
+	}
+
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+
+	if err := readXMLPart(files, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, err
+	}
+
+	var sst struct {
+		Items []sharedString `xml:"si"`
+	}
+
+	if _, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := readXMLPart(files, "xl/sharedStrings.xml", &sst); err != nil {
+			return nil, err
+		}
+	}
+
+	var sheets []sheet
+
+	for _, ws := range workbook.Sheets {
+		var target string
+		for _, r := range rels.Relationships {
+			if r.ID == ws.ID {
+				target = r.Target
+			}
+		}
+
+		if strings.HasPrefix(target, "/") {
+			target = strings.TrimPrefix(target, "/")
+		} else {
+			target = path.Join("xl", target)
+		}
+
+		var data struct {
+			Rows []struct {
+				Cells []struct {
+					Ref    string       `xml:"r,attr"`
+					Type   string       `xml:"t,attr"`
+					Value  string       `xml:"v"`
+					Inline sharedString `xml:"is"`
+				} `xml:"c"`
+			} `xml:"sheetData>row"`
+		}
+
+		if err := readXMLPart(files, target, &data); err != nil {
+			return nil, err
+		}
+
+		s := sheet{Name: ws.Name}
+
+		for _, row := range data.Rows {
+			var cells []string
+
+			for _, c := range row.Cells {
+				value := c.Value
+
+				switch c.Type {
+				case "s":
+					i, err := strconv.Atoi(c.Value)
+					if err != nil || i < 0 || i >= len(sst.Items) {
+						return nil, fmt.Errorf("%s: sheet %s, cell %s: bad shared string %q", file, ws.Name, c.Ref, c.Value)
+					}
+
+					value = sst.Items[i].String()
+				case "inlineStr":
+					value = c.Inline.String()
+				}
+
+				if col := cellColumn(c.Ref); col > len(cells) {
+					cells = append(cells, make([]string, col-len(cells))...)
+				}
+
+				cells = append(cells, value)
+			}
+
+			s.Rows = append(s.Rows, cells)
+		}
+
+		sheets = append(sheets, s)
+	}
+
+	return sheets, nil
+}
+
+// sharedString is a string item of a workbook: plain text, or rich text made
+// of runs.
+type sharedString struct {
+	Text string   `xml:"t"`
+	Runs []string `xml:"r>t"`
+}
+
+func (s sharedString) String() string {
+	return s.Text + strings.Join(s.Runs, "")
+}
+
+func readXMLPart(files map[string]*zip.File, name string, v interface{}) error {
+	f, ok := files[name]
+	if !ok {
+		return fmt.Errorf("%s is missing from the workbook", name)
+	}
+
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if err := xml.NewDecoder(r).Decode(v); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	return nil
+}
+
+// readXLSXFile overlays the troop sheet of the workbook at path onto tis.
+// Sheets of data files that can't be imported yet are skipped.
+func readXLSXFile(path string, tis *troopInfoSOX, layout string) error {
+	sheets, err := readXLSX(path)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range sheets {
+		if s.Name != sheetName(troopInfoFile.Name) {
+			continue
+		}
+
+		if err := overlaySheet(s.Rows, tis, layout, pointFormat); err != nil {
+			return fmt.Errorf("%s: sheet %s: %w", path, s.Name, err)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("%s: no %s sheet", path, sheetName(troopInfoFile.Name))
+}
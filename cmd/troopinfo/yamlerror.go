@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlContextLines is how many lines are shown around a YAML error.
+const yamlContextLines = 2
+
+// yamlError is a problem at a specific place in a YAML file.
+type yamlError struct {
+	Path     string
+	Line     int // 1-based, 0 if unknown
+	Column   int // 1-based, 0 if unknown
+	Value    string
+	Expected string
+	Msg      string
+
+	source []byte
+}
+
+func (e *yamlError) Error() string {
+	var b strings.Builder
+
+	b.WriteString(e.Path)
+
+	if e.Line > 0 {
+		fmt.Fprintf(&b, ":%d", e.Line)
+	}
+
+	if e.Column > 0 {
+		fmt.Fprintf(&b, ":%d", e.Column)
+	}
+
+	b.WriteString(": " + e.Msg)
+
+	if e.Value != "" {
+		fmt.Fprintf(&b, ": %q", e.Value)
+	}
+
+	if e.Expected != "" {
+		b.WriteString(", expected " + e.Expected)
+	}
+
+	return b.String()
+}
+
+// Context returns the lines surrounding the error with the offending column
+// marked, or "" if the position is unknown.
+func (e *yamlError) Context() string {
+	if e.Line <= 0 {
+		return ""
+	}
+
+	lines := strings.Split(string(e.source), "\n")
+
+	first, last := e.Line-yamlContextLines, e.Line+yamlContextLines
+	if first < 1 {
+		first = 1
+	}
+
+	if last > len(lines) {
+		last = len(lines)
+	}
+
+	width := len(strconv.Itoa(last))
+
+	var b strings.Builder
+
+	for n := first; n <= last; n++ {
+		marker := " "
+		if n == e.Line {
+			marker = ">"
+		}
+
+		fmt.Fprintf(&b, "%s %*d | %s\n", marker, width, n, strings.TrimRight(lines[n-1], "\r"))
+
+		if n == e.Line && e.Column > 0 {
+			fmt.Fprintf(&b, "  %*s | %s^\n", width, "", strings.Repeat(" ", e.Column-1))
+		}
+	}
+
+	return b.String()
+}
+
+// yamlLinePrefix matches the position yaml.v3 puts in its error messages.
+var yamlLinePrefix = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// newYAMLError converts an error returned by yaml.v3 into a yamlError.
+func newYAMLError(path string, source []byte, err error) error {
+	msg := err.Error()
+
+	var te *yaml.TypeError
+	if errors.As(err, &te) && len(te.Errors) > 0 {
+		msg = te.Errors[0]
+	}
+
+	ye := &yamlError{Path: path, Msg: strings.TrimPrefix(msg, "yaml: "), source: source}
+
+	if m := yamlLinePrefix.FindStringSubmatch(msg); m != nil {
+		ye.Line, _ = strconv.Atoi(m[1])
+		ye.Msg = m[2]
+	}
+
+	return ye
+}
+
+// checkTroopInfoYAML checks every troop field present in doc against the type
+// of the field, so a bad value is reported where it is rather than as a bare
+// decoding error.
+func checkTroopInfoYAML(path string, source []byte, doc *yaml.Node) error {
+	nodes, err := troopNodes(path, source, doc)
+	if err != nil {
+		return err
+	}
+
+	var scratch troopInfo
+
+	levelUps := len(scratch.LevelUpData)
+
+	for _, n := range nodes {
+		i := n.Index
+
+		// Arrays only decode from exactly as many elements as the record
+		// holds, and the game reads that many.
+		if l := mappingValue(n.Value, "level_up_data"); l != nil && l.Kind == yaml.SequenceNode && len(l.Content) != levelUps {
+			return &yamlError{
+				Path:     path,
+				Line:     l.Line,
+				Column:   l.Column,
+				Msg:      fmt.Sprintf("%s.level_up_data has %d entries", troopName(i), len(l.Content)),
+				Expected: fmt.Sprintf("exactly %d entries of skill_id and skill_per_level", levelUps),
+				source:   source,
+			}
+		}
+
+		for _, f := range troopFields {
+			node := findFieldNode(n.Value, f.Name)
+			if node == nil {
+				continue
+			}
+
+			if err := f.Parse(&scratch, node.Value); err != nil {
+				return &yamlError{
+					Path:     path,
+					Line:     node.Line,
+					Column:   node.Column,
+					Msg:      fmt.Sprintf("invalid %s.%s", troopName(i), f.Name),
+					Value:    node.Value,
+					Expected: expectedValue(f),
+					source:   source,
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// expectedValue describes the values f accepts.
+func expectedValue(f troopField) string {
+	if f.isFloat() {
+		return "a float32 number between -3.4e38 and 3.4e38"
+	}
+
+	return "a whole int32 number between -2147483648 and 2147483647"
+}
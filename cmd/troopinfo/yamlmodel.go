@@ -0,0 +1,434 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rdeusser/troopinfo/kuftc"
+	"gopkg.in/yaml.v3"
+)
+
+// TroopInfo.yaml keeps the troops in a mapping keyed by a stable identifier,
+// so partial files, merges and diffs don't depend on the order of the
+// records. The record index is derived from the key. Files written before
+// the keyed layout hold a troop_infos list instead, which is still read.
+const (
+	troopsKey       = "troops"
+	legacyTroopsKey = "troop_infos"
+)
+
+// partialKey marks a TroopInfo.yaml that leaves troops out on purpose, e.g.
+// partial: true above a handful of troops, so the troops it leaves out keep
+// their installed values instead of failing checkYAMLComplete.
+const partialKey = "partial"
+
+// troopRoster identifies the records of a TroopInfo.sox by their troop type
+// rather than their position, so a troop keeps its key and name when its
+// record moves, e.g. with reorder. The first record of each retail type is
+// keyed after the type; every other record, such as those added with troop
+// add, by its index.
+//
+// That the retail types are numbered like the retail records, so type i
+// is named by defaultTroopNames[i], hasn't been checked against a retail
+// file. Files whose types aren't the numbers 0 to n-1, each used at least
+// once, are keyed by position instead, as if record i were of type i.
+type troopRoster struct {
+	types []int32       // of each record; nil to take record i to be of type i
+	first map[int32]int // index of the first record of each type
+	count int           // number of records if types is nil, 0 if unknown
+}
+
+// installedRoster is the roster of the installed TroopInfo.sox, which troop
+// keys and names refer to wherever no other file is at hand.
+var installedRoster troopRoster
+
+// rosterMu guards installedRoster and customTroopNames, which installSOX
+// reloads after every write, against the handlers of serve and gui reading
+// them at the same time. Handlers hold it for reading while they use troop
+// keys or names; it is never taken while already held.
+var rosterMu sync.RWMutex
+
+func newTroopRoster(tis troopInfoSOX) troopRoster {
+	r := troopRoster{types: make([]int32, len(tis.TroopInfos)), first: map[int32]int{}}
+
+	for i, ti := range tis.TroopInfos {
+		r.types[i] = ti.TypeID
+
+		if _, ok := r.first[ti.TypeID]; !ok {
+			r.first[ti.TypeID] = i
+		}
+	}
+
+	for t := range r.first {
+		if t < 0 || int(t) >= len(r.first) {
+			return troopRoster{count: len(tis.TroopInfos)}
+		}
+	}
+
+	return r
+}
+
+// grow returns r with records of no type of their own added up to n
+// records, for documents whose count adds troops to the file.
+func (r troopRoster) grow(n int) troopRoster {
+	if r.types == nil {
+		if n > r.len() {
+			r.count = n
+		}
+
+		return r
+	}
+
+	if n <= len(r.types) {
+		return r
+	}
+
+	types := make([]int32, n)
+	copy(types, r.types)
+
+	for i := len(r.types); i < n; i++ {
+		types[i] = -1
+	}
+
+	r.types = types
+
+	return r
+}
+
+// loadTroopRoster reads installedRoster from the installed TroopInfo.sox.
+// Without one, records are taken to be in retail order.
+func loadTroopRoster() {
+	tis, err := readTroopInfoSOX(troopInfoPath)
+	if err != nil {
+		installedRoster = troopRoster{}
+		return
+	}
+
+	installedRoster = newTroopRoster(tis)
+}
+
+// ownType returns the type of record i if it is the first record of that
+// type, which the type then stands for.
+func (r troopRoster) ownType(i int) (int, bool) {
+	if r.types == nil {
+		return i, i >= 0
+	}
+
+	if i < 0 || i >= len(r.types) || r.first[r.types[i]] != i {
+		return 0, false
+	}
+
+	return int(r.types[i]), r.types[i] >= 0
+}
+
+// record returns the index of the record standing for type t.
+func (r troopRoster) record(t int) (int, bool) {
+	if r.types == nil {
+		return t, true
+	}
+
+	i, ok := r.first[int32(t)]
+
+	return i, ok
+}
+
+// key returns the stable identifier of record i: the retail English name of
+// its type in snake case, which doesn't change with the language of the
+// install or the position of the record, or troop_<i> for records without a
+// retail type of their own.
+func (r troopRoster) key(i int) string {
+	if t, ok := r.ownType(i); ok && t < len(defaultTroopNames) {
+		return kuftc.TroopKey(t)
+	}
+
+	return fmt.Sprintf("troop_%d", i)
+}
+
+// index returns the index of the record identified by key: a troop key, a
+// record index with or without the troop_ prefix, or a display name. Plain
+// indexes, as in the troop_infos[0] paths of dump, must be records of r.
+func (r troopRoster) index(key string) (int, error) {
+	key = strings.TrimSpace(key)
+
+	if i, err := strconv.Atoi(key); err == nil {
+		return i, r.checkIndex(i)
+	}
+
+	if s := strings.TrimPrefix(key, "troop_"); s != key {
+		if i, err := strconv.Atoi(s); err == nil {
+			return i, r.checkIndex(i)
+		}
+	}
+
+	for t := range defaultTroopNames {
+		if kuftc.TroopKey(t) != key {
+			continue
+		}
+
+		if i, ok := r.record(t); ok {
+			return i, nil
+		}
+
+		return 0, fmt.Errorf("no record is of troop type %s", kuftc.TroopTypeName(int32(t)))
+	}
+
+	return troopIndex(key)
+}
+
+// len returns the number of records of r.
+func (r troopRoster) len() int {
+	switch {
+	case r.types != nil:
+		return len(r.types)
+	case r.count != 0:
+		return r.count
+	default:
+		return len(defaultTroopNames)
+	}
+}
+
+// checkIndex fails unless r has a record at index i.
+func (r troopRoster) checkIndex(i int) error {
+	if i < 0 || i >= r.len() {
+		return fmt.Errorf("troop index %d is out of range, expected 0 to %d", i, r.len()-1)
+	}
+
+	return nil
+}
+
+// troopKey returns the stable identifier of the troop at index i of the
+// installed TroopInfo.sox; see troopRoster.key.
+func troopKey(i int) string {
+	return installedRoster.key(i)
+}
+
+// troopKeyIndex returns the index of the troop identified by key in the
+// installed TroopInfo.sox; see troopRoster.index.
+func troopKeyIndex(key string) (int, error) {
+	return installedRoster.index(key)
+}
+
+// matchRecords returns, for each record of b, the index of the record of a
+// holding the same troop, or -1 if a has none. Records are paired by their
+// keys, as in TroopInfo.yaml, so a troop whose record moved, e.g. with
+// reorder, is still compared with itself.
+func matchRecords(a, b troopInfoSOX) []int {
+	ra, rb := newTroopRoster(a), newTroopRoster(b)
+
+	index := map[string]int{}
+	for i := range a.TroopInfos {
+		index[ra.key(i)] = i
+	}
+
+	match := make([]int, len(b.TroopInfos))
+
+	for i := range b.TroopInfos {
+		j, ok := index[rb.key(i)]
+		if !ok {
+			j = -1
+		}
+
+		match[i] = j
+	}
+
+	return match
+}
+
+// counterparts returns, for each record of tis, the record of ref holding the
+// same troop (see matchRecords), or nil if ref is nil or has none.
+func counterparts(ref *troopInfoSOX, tis troopInfoSOX) []*troopInfo {
+	records := make([]*troopInfo, len(tis.TroopInfos))
+	if ref == nil {
+		return records
+	}
+
+	for i, j := range matchRecords(*ref, tis) {
+		if j >= 0 {
+			records[i] = &ref.TroopInfos[j]
+		}
+	}
+
+	return records
+}
+
+// troopNode is the YAML of one troop in a TroopInfo.yaml document.
+type troopNode struct {
+	Index int
+	Key   *yaml.Node // nil in the legacy list layout
+	Value *yaml.Node
+}
+
+// troopNodes returns the troops of doc in document order, in either layout,
+// with their keys resolved against the installed TroopInfo.sox. A document
+// without troops has none.
+func troopNodes(path string, source []byte, doc *yaml.Node) ([]troopNode, error) {
+	return troopNodesIn(path, source, doc, installedRoster)
+}
+
+// troopNodesIn is troopNodes with the keys resolved against roster. Troops
+// past its records are accepted up to the count of the document, which adds
+// them.
+func troopNodesIn(path string, source []byte, doc *yaml.Node, roster troopRoster) ([]troopNode, error) {
+	root := documentRoot(doc)
+
+	if count := mappingValue(root, "count"); count != nil {
+		if n, err := strconv.Atoi(count.Value); err == nil && n <= maxTroopRecords {
+			roster = roster.grow(n)
+		}
+	}
+
+	if troops := mappingValue(root, troopsKey); troops != nil {
+		if troops.Kind != yaml.MappingNode {
+			return nil, &yamlError{Path: path, Line: troops.Line, Column: troops.Column, Msg: troopsKey + " is not a mapping of troop names", source: source}
+		}
+
+		nodes := make([]troopNode, 0, len(troops.Content)/2)
+		seen := map[int]bool{}
+
+		for j := 0; j+1 < len(troops.Content); j += 2 {
+			key := troops.Content[j]
+
+			i, err := roster.index(key.Value)
+			if err != nil {
+				return nil, &yamlError{Path: path, Line: key.Line, Column: key.Column, Msg: "unknown troop", Value: key.Value, Expected: err.Error(), source: source}
+			}
+
+			if seen[i] {
+				return nil, &yamlError{Path: path, Line: key.Line, Column: key.Column, Msg: "duplicate troop", Value: key.Value, source: source}
+			}
+
+			seen[i] = true
+
+			nodes = append(nodes, troopNode{Index: i, Key: key, Value: troops.Content[j+1]})
+		}
+
+		return nodes, nil
+	}
+
+	troops := mappingValue(root, legacyTroopsKey)
+	if troops == nil {
+		return nil, nil
+	}
+
+	if troops.Kind != yaml.SequenceNode {
+		return nil, &yamlError{Path: path, Line: troops.Line, Column: troops.Column, Msg: legacyTroopsKey + " is not a list", source: source}
+	}
+
+	if n := len(troops.Content); n > maxTroopRecords {
+		item := troops.Content[maxTroopRecords]
+
+		return nil, &yamlError{
+			Path:     path,
+			Line:     item.Line,
+			Column:   item.Column,
+			Msg:      fmt.Sprintf("too many troops (%d)", n),
+			Expected: fmt.Sprintf("at most %d", maxTroopRecords),
+			source:   source,
+		}
+	}
+
+	nodes := make([]troopNode, len(troops.Content))
+	for i, item := range troops.Content {
+		nodes[i] = troopNode{Index: i, Value: item}
+	}
+
+	return nodes, nil
+}
+
+// findTroopNode returns the YAML of the troop at index i, or nil if doc
+// doesn't have it.
+func findTroopNode(doc *yaml.Node, i int) *yaml.Node {
+	nodes, err := troopNodes("", nil, doc)
+	if err != nil {
+		return nil
+	}
+
+	for _, n := range nodes {
+		if n.Index == i {
+			return n.Value
+		}
+	}
+
+	return nil
+}
+
+// troopInfoDocument returns tis as a TroopInfo.yaml document in the keyed
+// layout. Each troop is preceded by a comment with its index and display
+// name.
+func troopInfoDocument(tis troopInfoSOX) (*yaml.Node, error) {
+	troops := &yaml.Node{Kind: yaml.MappingNode}
+	roster := newTroopRoster(tis)
+
+	for i := range tis.TroopInfos {
+		value, err := valueNode(tis.TroopInfos[i])
+		if err != nil {
+			return nil, err
+		}
+
+		nameSymbols(value)
+
+		key := &yaml.Node{
+			Kind:        yaml.ScalarNode,
+			Value:       roster.key(i),
+			HeadComment: fmt.Sprintf("%d -- %s", i, troopName(i)),
+		}
+
+		troops.Content = append(troops.Content, key, value)
+	}
+
+	root := &yaml.Node{Kind: yaml.MappingNode}
+
+	for _, kv := range []struct {
+		key   string
+		value int32
+	}{
+		{"version", tis.Version},
+		{"count", tis.Count},
+	} {
+		root.Content = append(root.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: kv.key},
+			&yaml.Node{Kind: yaml.ScalarNode, Value: strconv.Itoa(int(kv.value))},
+		)
+	}
+
+	root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: troopsKey}, troops)
+
+	return &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{root}}, nil
+}
+
+// decodeTroopNodes decodes the troops of doc onto the records of tis, first
+// resizing them to the count in its header. Records added that way start out
+// zeroed. Keys name the records of tis, whatever their order.
+func decodeTroopNodes(path string, source []byte, doc *yaml.Node, tis *troopInfoSOX) error {
+	nodes, err := troopNodesIn(path, source, doc, newTroopRoster(*tis))
+	if err != nil {
+		return err
+	}
+
+	if tis.Count < 0 || tis.Count > maxTroopRecords {
+		return &yamlError{Path: path, Msg: fmt.Sprintf("count %d is out of range", tis.Count), Expected: fmt.Sprintf("0 to %d", maxTroopRecords), source: source}
+	}
+
+	records := make([]troopInfo, tis.Count)
+	copy(records, tis.TroopInfos)
+	tis.TroopInfos = records
+
+	for _, n := range nodes {
+		if n.Index >= len(tis.TroopInfos) {
+			line, column := n.Value.Line, n.Value.Column
+			if n.Key != nil {
+				line, column = n.Key.Line, n.Key.Column
+			}
+
+			return &yamlError{Path: path, Line: line, Column: column, Msg: fmt.Sprintf("troop %d is beyond the count of %d", n.Index, tis.Count), Value: troopKey(n.Index), source: source}
+		}
+
+		if err := n.Value.Decode(&tis.TroopInfos[n.Index]); err != nil {
+			return newYAMLError(path, source, err)
+		}
+	}
+
+	return nil
+}
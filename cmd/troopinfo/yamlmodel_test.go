@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/rdeusser/troopinfo/kuftc"
+)
+
+func TestTroopRosterKeys(t *testing.T) {
+	newTestGame(t)
+
+	tis := readInstalled(t)
+	tis.TroopInfos[0], tis.TroopInfos[5] = tis.TroopInfos[5], tis.TroopInfos[0]
+
+	if got := newTroopRoster(tis).key(0); got != kuftc.TroopKey(5) {
+		t.Errorf("record 0 of type 5 is keyed %s, want %s", got, kuftc.TroopKey(5))
+	}
+
+	// Types that aren't numbered like the records say nothing about which
+	// troop a record is, so records are keyed by position.
+	for i := range tis.TroopInfos {
+		tis.TroopInfos[i].TypeID = int32(100 + i)
+	}
+
+	r := newTroopRoster(tis)
+
+	for _, i := range []int{0, 5} {
+		if got := r.key(i); got != kuftc.TroopKey(i) {
+			t.Errorf("record %d of type %d is keyed %s, want %s", i, 100+i, got, kuftc.TroopKey(i))
+		}
+	}
+
+	for _, key := range []string{"troop_43", "troop_200", "-1", "43"} {
+		if i, err := r.index(key); err == nil {
+			t.Errorf("%s names record %d of a file with %d records", key, i, len(tis.TroopInfos))
+		}
+	}
+
+	if i, err := r.grow(45).index("troop_44"); err != nil || i != 44 {
+		t.Errorf("troop_44 of a document adding two troops is %d, %v, want 44", i, err)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlIndent matches the indentation yaml.Marshal uses for files written by
+// writeTroopInfoYAML.
+const yamlIndent = 4
+
+// patchTroopInfoYAML rewrites only the values that differ between ours, the
+// current contents of the YAML file at path, and merged. Comments and the
+// layout of the rest of the file are preserved, and troops and fields a
+// partial file leaves out are added.
+func patchTroopInfoYAML(path string, ours, merged troopInfoSOX) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var doc yaml.Node
+
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	for i := range merged.TroopInfos {
+		for _, f := range troopFields {
+			value := f.Format(&merged.TroopInfos[i])
+			if i < len(ours.TroopInfos) && value == f.Format(&ours.TroopInfos[i]) {
+				continue
+			}
+
+			node, err := findTroopFieldNode(&doc, i, f.Name)
+			if err != nil {
+				node = addTroopFieldNode(&doc, i, f.Name)
+			}
+
+			if node == nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+
+			node.Value = symbolName(f.Name, value)
+			node.Tag = ""
+			node.Style = 0
+
+			// The comment of an ID names its value, which just changed.
+			if _, ok := lookupSymbolTable(f.Name); ok {
+				node.LineComment = valueName(f.Name, value)
+			}
+		}
+	}
+
+	out, err := encodeYAMLNode(&doc)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, out, 0600)
+}
+
+// encodeYAMLNode encodes doc, including its comments, the way
+// writeTroopInfoYAML formats files.
+func encodeYAMLNode(doc *yaml.Node) ([]byte, error) {
+	buf := &bytes.Buffer{}
+
+	enc := yaml.NewEncoder(buf)
+	enc.SetIndent(yamlIndent)
+
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// documentRoot returns the top-level node of a parsed YAML document.
+func documentRoot(doc *yaml.Node) *yaml.Node {
+	if doc.Kind == yaml.DocumentNode && len(doc.Content) > 0 {
+		return doc.Content[0]
+	}
+
+	return doc
+}
+
+// findTroopFieldNode returns the scalar node holding the named field of the
+// troop at index i, e.g. "level_up_data[1].skill_id".
+func findTroopFieldNode(doc *yaml.Node, i int, name string) (*yaml.Node, error) {
+	node := findFieldNode(findTroopNode(doc, i), name)
+	if node == nil {
+		return nil, fmt.Errorf("%s.%s not found", troopName(i), name)
+	}
+
+	return node, nil
+}
+
+// addTroopFieldNode adds the named field of the troop at index i to a keyed
+// document, adding the troop if needed, and returns its empty scalar node.
+// Fields inside lists and legacy documents can't be added and return nil.
+func addTroopFieldNode(doc *yaml.Node, i int, name string) *yaml.Node {
+	troops := mappingValue(documentRoot(doc), troopsKey)
+	if troops == nil || troops.Kind != yaml.MappingNode || strings.ContainsAny(name, ".[") {
+		return nil
+	}
+
+	troop := findTroopNode(doc, i)
+	if troop == nil {
+		troop = &yaml.Node{Kind: yaml.MappingNode}
+
+		troops.Content = append(troops.Content, &yaml.Node{
+			Kind:        yaml.ScalarNode,
+			Value:       troopKey(i),
+			HeadComment: fmt.Sprintf("%d -- %s", i, troopName(i)),
+		}, troop)
+	}
+
+	if troop.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	value := &yaml.Node{Kind: yaml.ScalarNode}
+	troop.Content = append(troop.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: name}, value)
+
+	return value
+}
+
+// findFieldNode returns the scalar node holding the named field of the troop
+// mapping node, or nil if it has none.
+func findFieldNode(node *yaml.Node, name string) *yaml.Node {
+	for _, part := range strings.Split(name, ".") {
+		key, index := part, -1
+
+		if j := strings.IndexByte(part, '['); j >= 0 {
+			key = part[:j]
+
+			n, err := strconv.Atoi(strings.TrimSuffix(part[j+1:], "]"))
+			if err != nil {
+				return nil
+			}
+
+			index = n
+		}
+
+		node = mappingValue(node, key)
+		if index >= 0 {
+			node = sequenceItem(node, index)
+		}
+	}
+
+	if node == nil || node.Kind != yaml.ScalarNode {
+		return nil
+	}
+
+	return node
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+
+	return nil
+}
+
+func sequenceItem(node *yaml.Node, i int) *yaml.Node {
+	if node == nil || node.Kind != yaml.SequenceNode || i >= len(node.Content) {
+		return nil
+	}
+
+	return node.Content[i]
+}
@@ -3,11 +3,14 @@ module github.com/rdeusser/troopinfo
 go 1.14
 
 require (
-	github.com/davecgh/go-spew v1.1.1
-	github.com/google/go-cmp v0.4.0
+	github.com/fsnotify/fsnotify v1.4.9
+	github.com/gdamore/tcell v1.4.0
 	github.com/kr/text v0.2.0 // indirect
+	github.com/mattn/go-runewidth v0.0.7
 	github.com/niemeyer/pretty v0.0.0-20200227124842-a10e7caefd8e // indirect
 	github.com/rs/zerolog v1.18.0
+	golang.org/x/image v0.0.0-20200430140353-33d19683fad8
+	golang.org/x/text v0.3.3
 	gopkg.in/check.v1 v1.0.0-20200227125254-8fa46927fb4f // indirect
 	gopkg.in/yaml.v3 v3.0.0-20200506231410-2ff61e1afc86
 )
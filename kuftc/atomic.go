@@ -0,0 +1,61 @@
+package kuftc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// ErrWriteVerify is returned when a file written by WriteFileAtomic doesn't
+// read back as written.
+var ErrWriteVerify = errors.New("file doesn't read back as written")
+
+// WriteFileAtomic replaces the file at path with data so that it is never
+// left half written: data goes to a temporary file next to it, is synced to
+// disk and renamed over path, and the result is read back and compared with
+// data.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	// Removing fails once the rename succeeded, which is fine.
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	written, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(written, data) {
+		return fmt.Errorf("%s: %w (%d bytes written, %d read back)", path, ErrWriteVerify, len(data), len(written))
+	}
+
+	return nil
+}
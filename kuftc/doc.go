@@ -0,0 +1,47 @@
+// Package kuftc reads, patches and verifies the troop data of Kingdom Under
+// Fire: The Crusaders, for tools such as launchers and mod managers that
+// would otherwise shell out to the troopinfo command. Its functions are the
+// supported API: their behavior follows the command's and doesn't change
+// between minor versions. The checks the command makes before writing the
+// game files, such as refusing while the game runs, are left to the caller;
+// see SaveTroopInfo.
+//
+// Load the troop data of an install:
+//
+//	tif, err := kuftc.LoadTroopInfo(`C:\Games\KUF Crusader`)
+//	if err != nil {
+//		return err
+//	}
+//
+//	fmt.Println(tif.TroopInfos[0].DefaultUnitHP)
+//
+// Apply a patch document, the same format the troopinfo patch command takes,
+// and write the result back, keeping a backup of the original:
+//
+//	p, err := kuftc.ReadPatch(strings.NewReader(`
+//	rules:
+//	  - record: "Orc *"
+//	    field: defense
+//	    add: 5
+//	`))
+//	if err != nil {
+//		return err
+//	}
+//
+//	if err := kuftc.ApplyPatch(&tif, p); err != nil {
+//		return err
+//	}
+//
+//	if err := kuftc.SaveTroopInfo(gameDir, tif); err != nil {
+//		return err
+//	}
+//
+// Check that an install's troop data is intact before launching the game:
+//
+//	if err := kuftc.Verify(gameDir); err != nil {
+//		return err
+//	}
+//
+// Game directories may be a game install, a copy of its Data folder, or a
+// copy of the SOX directory itself.
+package kuftc
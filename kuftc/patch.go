@@ -0,0 +1,257 @@
+package kuftc
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Patch is a set of rules applied to the game data, e.g.
+//
+//	rules:
+//	  # 10% more HP in every table
+//	  - file: "*"
+//	    field: "*_hp*"
+//	    multiply: 1.1
+//	  - file: TroopInfo
+//	    record: "Orc *"
+//	    field: defense
+//	    add: 5
+//
+// It is the document format of the troopinfo patch command.
+type Patch struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// Rule changes every field matched by its file, record and field patterns.
+// * matches anything and empty patterns match everything. Exactly one of Set,
+// Add and Multiply is given.
+type Rule struct {
+	File     string   `yaml:"file"`
+	Record   string   `yaml:"record"`
+	Field    string   `yaml:"field"`
+	Set      *float64 `yaml:"set"`
+	Add      *float64 `yaml:"add"`
+	Multiply *float64 `yaml:"multiply"`
+}
+
+// ReadPatch decodes a patch document from r and validates its rules.
+func ReadPatch(r io.Reader) (Patch, error) {
+	var p Patch
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return p, err
+	}
+
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return p, err
+	}
+
+	for _, r := range p.Rules {
+		if err := r.Validate(); err != nil {
+			return p, err
+		}
+	}
+
+	return p, nil
+}
+
+// Validate checks that r has exactly one operation.
+func (r Rule) Validate() error {
+	var ops int
+
+	for _, op := range []*float64{r.Set, r.Add, r.Multiply} {
+		if op != nil {
+			ops++
+		}
+	}
+
+	if ops != 1 {
+		return fmt.Errorf("rule for %q needs exactly one of set, add or multiply", r.Field)
+	}
+
+	return nil
+}
+
+// Apply returns v changed by the operation of r.
+func (r Rule) Apply(v float64) float64 {
+	switch {
+	case r.Set != nil:
+		return *r.Set
+	case r.Add != nil:
+		return v + *r.Add
+	default:
+		return v * *r.Multiply
+	}
+}
+
+// MatchesFile reports whether r targets the data file with the given name,
+// e.g. TroopInfo.sox. File patterns ignore case and the extension.
+func (r Rule) MatchesFile(name string) bool {
+	pattern := strings.ToLower(r.File)
+	name = strings.ToLower(name)
+
+	return Match(pattern, name) || Match(pattern, strings.TrimSuffix(name, filepath.Ext(name)))
+}
+
+// Match reports whether name matches pattern, in which * matches any run of
+// characters and everything else is literal.
+func Match(pattern, name string) bool {
+	if pattern == "" {
+		return true
+	}
+
+	expr := strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*")
+	ok, _ := regexp.MatchString("^"+expr+"$", name)
+
+	return ok
+}
+
+// ApplyPatch applies the rules of p that target TroopInfo.sox to tif. Record
+// patterns match the English troop name or its key, e.g. "Orc *" or
+// "orc_*", and field patterns match field names such as "resist_*" or
+// "level_up_data[0].skill_id". Integer results are rounded to the nearest
+// whole number. Field aliases of the troopinfo configuration don't apply.
+func ApplyPatch(tif *TroopInfoFile, p Patch) error {
+	for _, r := range p.Rules {
+		if err := r.Validate(); err != nil {
+			return err
+		}
+
+		if !r.MatchesFile(TroopInfoName) {
+			continue
+		}
+
+		for i := range tif.TroopInfos {
+			if !Match(r.Record, TroopName(i)) && !Match(r.Record, TroopKey(i)) {
+				continue
+			}
+
+			eachField(reflect.ValueOf(&tif.TroopInfos[i]).Elem(), tif.Version, "", func(name string, v reflect.Value) {
+				if !Match(r.Field, name) {
+					return
+				}
+
+				if v.Kind() == reflect.Float32 {
+					v.SetFloat(float64(float32(r.Apply(v.Float()))))
+				} else {
+					v.SetInt(int64(int32(math.Round(r.Apply(float64(v.Int()))))))
+				}
+			})
+		}
+	}
+
+	return nil
+}
+
+// TroopName returns the English name of the troop at index i.
+func TroopName(i int) string {
+	if i >= 0 && i < len(TroopNames) {
+		return TroopNames[i]
+	}
+
+	return fmt.Sprintf("Troop %d", i)
+}
+
+// TroopTypeName returns the name this package assigns to the troop type id,
+// e.g. TROOP_KNIGHT, or "" for types the retail game doesn't define. It is
+// built from TroopKey, so it keeps the spelling of the retail names, as in
+// TROOP_CALVARY, and isn't the identifier of the engine headers. Troop types
+// are numbered like the retail records.
+func TroopTypeName(id int32) string {
+	if id < 0 || int(id) >= len(TroopNames) {
+		return ""
+	}
+
+	return "TROOP_" + strings.ToUpper(TroopKey(int(id)))
+}
+
+// TroopKey returns the stable identifier of the troop at index i: its retail
+// English name in snake case, which doesn't change with the language of the
+// install.
+func TroopKey(i int) string {
+	if i < 0 || i >= len(TroopNames) {
+		return fmt.Sprintf("troop_%d", i)
+	}
+
+	var b strings.Builder
+
+	sep := false
+
+	for _, r := range strings.ToLower(TroopNames[i]) {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			sep = b.Len() > 0
+			continue
+		}
+
+		if sep {
+			b.WriteByte('_')
+			sep = false
+		}
+
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// eachField calls fn with the name and value of every scalar field of v that
+// files of the given version hold, in file order. Names are paths like
+// "level_up_data[1].skill_id". Version 0 includes every field.
+func eachField(v reflect.Value, version int32, prefix string, fn func(name string, v reflect.Value)) {
+	eachFieldIn(v, version, prefix, 0, 0, fn)
+}
+
+// eachFieldIn is eachField for a value whose enclosing fields are tagged with
+// the since and until versions; tags on a field override them.
+func eachFieldIn(v reflect.Value, version int32, prefix string, since, until int64, fn func(name string, v reflect.Value)) {
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+
+			name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+
+			if prefix != "" {
+				name = prefix + "." + name
+			}
+
+			s, u := since, until
+
+			if n, err := strconv.ParseInt(f.Tag.Get("since"), 10, 32); err == nil {
+				s = n
+			}
+
+			if n, err := strconv.ParseInt(f.Tag.Get("until"), 10, 32); err == nil {
+				u = n
+			}
+
+			eachFieldIn(v.Field(i), version, name, s, u, fn)
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			eachFieldIn(v.Index(i), version, prefix+"["+strconv.Itoa(i)+"]", since, until, fn)
+		}
+	default:
+		if version != 0 && ((since != 0 && int64(version) < since) || (until != 0 && int64(version) > until)) {
+			return
+		}
+
+		fn(prefix, v)
+	}
+}
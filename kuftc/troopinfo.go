@@ -0,0 +1,327 @@
+package kuftc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rdeusser/troopinfo/pkg/sox"
+)
+
+// TroopInfoName is the name of the troop data file in the SOX directory.
+const TroopInfoName = "TroopInfo.sox"
+
+// Version is the file version of the current retail SOX files, which new
+// files are written in.
+const Version = 100
+
+// Versions are the TroopInfo.sox file versions the codec reads, oldest
+// first. Version 99 is the older layout, whose records end before
+// DamageDistribution; no other field is known to differ.
+var Versions = []int32{99, Version}
+
+// TroopCount is the number of troops in the retail TroopInfo.sox. Modded
+// files may have more or fewer.
+const TroopCount = 43
+
+// MaxTroopCount is a sanity cap on the number of troop records; the engine's
+// real limit is unknown and probably much lower.
+const MaxTroopCount = 255
+
+// ErrInvalidSOX is returned for data that isn't a TroopInfo.sox file.
+var ErrInvalidSOX = errors.New("not a valid SOX file")
+
+// LevelUp is a skill a troop gains on level up.
+type LevelUp struct {
+	SkillID       int32   `json:"skill_id" yaml:"skill_id" doc:"skill granted per level (SkillInfo ID)"`
+	SkillPerLevel float32 `json:"skill_per_level" yaml:"skill_per_level" doc:"skill points gained per level"`
+}
+
+// TroopInfo is a single TroopInfo.sox record. Fields that only exist in some
+// file versions are tagged since:"<version>" and/or until:"<version>"; the
+// codec leaves them out of other versions.
+type TroopInfo struct {
+	Job    int32 `json:"job" yaml:"job" doc:"troop Job type (defined in K2JobDef.h)"`
+	TypeID int32 `json:"type_id" yaml:"type_id" doc:"troop type ID (defined in K2TroopDef.h)"`
+
+	MoveSpeed        float32 `json:"move_speed" yaml:"move_speed" doc:"max move speed"`
+	RotateRate       float32 `json:"rotate_rate" yaml:"rotate_rate" doc:"max rotate rate"`
+	MoveAcceleration float32 `json:"move_acceleration" yaml:"move_acceleration" doc:"move acceleration"`
+	MoveDeceleration float32 `json:"move_deceleration" yaml:"move_deceleration" doc:"move deceleration"`
+
+	SightRange float32 `json:"sight_range" yaml:"sight_range" doc:"visible range"`
+
+	AttackRangeMax   float32 `json:"attack_range_max" yaml:"attack_range_max" doc:"maximum attack range"`
+	AttackRangeMin   float32 `json:"attack_range_min" yaml:"attack_range_min" doc:"ranged attack range (0 if troop lacks ranged attack)"`
+	AttackFrontRange float32 `json:"attack_front_range" yaml:"attack_front_range" doc:"frontal attack range (0 if troop lacks frontal attack)"`
+
+	DirectAttack   float32 `json:"direct_attack" yaml:"direct_attack" doc:"direct attack strength (melee/frontal)"`
+	IndirectAttack float32 `json:"indirect_attack" yaml:"indirect_attack" doc:"indirect attack strength (ranged)"`
+	Defense        float32 `json:"defense" yaml:"defense" doc:"defense strength"`
+
+	BaseWidth float32 `json:"base_width" yaml:"base_width" doc:"base troop size"`
+
+	// resistance to attack types, as a fraction of the damage taken
+	ResistMelee     float32 `json:"resist_melee" yaml:"resist_melee" doc:"resistance to melee attacks"`
+	ResistRanged    float32 `json:"resist_ranged" yaml:"resist_ranged" doc:"resistance to ranged attacks"`
+	ResistFrontal   float32 `json:"resist_frontal" yaml:"resist_frontal" doc:"resistance to frontal attacks"`
+	ResistExplosion float32 `json:"resist_explosion" yaml:"resist_explosion" doc:"resistance to explosions"`
+	ResistFire      float32 `json:"resist_fire" yaml:"resist_fire" doc:"resistance to fire"`
+	ResistIce       float32 `json:"resist_ice" yaml:"resist_ice" doc:"resistance to ice"`
+	ResistLightning float32 `json:"resist_lightning" yaml:"resist_lightning" doc:"resistance to lightning"`
+	ResistHoly      float32 `json:"resist_holy" yaml:"resist_holy" doc:"resistance to holy attacks"`
+	ResistCurse     float32 `json:"resist_curse" yaml:"resist_curse" doc:"resistance to curses"`
+	ResistPoison    float32 `json:"resist_poison" yaml:"resist_poison" doc:"resistance to poison"`
+
+	MaxUnitSpeedMultiplier float32 `json:"max_unit_speed_multiplier" yaml:"max_unit_speed_multiplier" doc:"maximum speed multiplier of individual units"`
+	DefaultUnitHP          float32 `json:"default_unit_hp" yaml:"default_unit_hp" doc:"HP of each unit"`
+	FormationRandom        int32   `json:"formation_random" yaml:"formation_random" doc:"randomness of unit positions in formation"`
+	DefaultUnitNumX        int32   `json:"default_unit_num_x" yaml:"default_unit_num_x" doc:"units per row"`
+	DefaultUnitNumY        int32   `json:"default_unit_num_y" yaml:"default_unit_num_y" doc:"units per column"`
+
+	UnitHPLevUp float32 `json:"unit_hp_lev_up" yaml:"unit_hp_lev_up" doc:"unit HP gained per level"`
+
+	LevelUpData [3]LevelUp `json:"level_up_data" yaml:"level_up_data" doc:"skills gained on level up; always exactly 3 entries"`
+
+	DamageDistribution float32 `json:"damage_distribution" yaml:"damage_distribution" doc:"how damage is spread across units" since:"100"`
+}
+
+// TroopInfoFile is the contents of TroopInfo.sox.
+type TroopInfoFile struct {
+	Version int32 `json:"version" yaml:"version" doc:"file format version"`
+	Count   int32 `json:"count" yaml:"count" doc:"number of records"`
+
+	// TroopInfos are indexed like TroopNames, with one record per Count.
+	// Records past the retail troops are those added by mods. The troopinfo
+	// command keys them by troop in YAML.
+	TroopInfos []TroopInfo `json:"troop_infos" yaml:"-"`
+
+	TheEnd [64]byte `json:"-" yaml:"-"`
+}
+
+// TroopNames are the English troop names of the retail game, indexed like
+// TroopInfos.
+var TroopNames = []string{
+	"Archer",
+	"Longbows",
+	"Infantry",
+	"Spearman",
+	"Heavy Infantry",
+	"Knight",
+	"Paladin",
+	"Calvary",
+	"Heavy Calvary",
+	"Storm Riders",
+	"Sappers",
+	"Pyro Techs",
+	"Bomber Wings",
+	"Mortar",
+	"Ballista",
+	"Harpoon",
+	"Catapult",
+	"Battaloon",
+	"Dark Elves Archer",
+	"Dark Elves Calvary Archers",
+	"Dark Elves Infantry",
+	"Dark Elves Knights",
+	"Dark Elves Calvary",
+	"Orc Infantry",
+	"Orc Riders",
+	"Orc Heavy Riders",
+	"Orc Axe Man",
+	"Orc Heavy Infantry",
+	"Orc Sappers",
+	"Orc Scorpion",
+	"Orc Swamp Mammoth",
+	"Orc Dirigible",
+	"Orc Black Wyverns",
+	"Orc Ghouls",
+	"Orc Bone Dragon",
+	"Wall Archers (Humans)",
+	"Scouts",
+	"Ghoul Selfdestruct",
+	"Encablossa Monster (Melee)",
+	"Encablossa Flying Monster",
+	"Encablossa Monster (Ranged)",
+	"Wall Archers (Elves)",
+	"Encablossa Main",
+}
+
+// JobNames are names this package assigns to the troop jobs, indexed by
+// TroopInfo.Job. Jobs are the classes troops level in, shared by troops of
+// the same role across the races. The names follow the style of the engine
+// headers but aren't taken from them, which this package doesn't have.
+var JobNames = []string{
+	"JOB_ARCHER",
+	"JOB_LONGBOW",
+	"JOB_INFANTRY",
+	"JOB_SPEARMAN",
+	"JOB_HEAVY_INFANTRY",
+	"JOB_KNIGHT",
+	"JOB_PALADIN",
+	"JOB_CAVALRY",
+	"JOB_HEAVY_CAVALRY",
+	"JOB_STORM_RIDER",
+	"JOB_SAPPER",
+	"JOB_PYRO_TECH",
+}
+
+// SOXDir returns the SOX directory of dir, which may be a game install, a
+// copy of its Data folder, or a copy of the SOX directory itself. Names are
+// matched ignoring case, as copies made on Windows may have any case.
+func SOXDir(dir string) string {
+	for _, sox := range []string{FindFold(FindFold(dir, "Data"), "SOX"), FindFold(dir, "SOX")} {
+		if fi, err := os.Stat(sox); err == nil && fi.IsDir() {
+			return sox
+		}
+	}
+
+	return dir
+}
+
+// FindFold returns the path of name in dir. If dir has no entry with exactly
+// that name, an entry whose name only differs in case is used, so that data
+// copied from Windows, where names are case-insensitive, is found on other
+// systems. Without either, the exact path is returned.
+func FindFold(dir, name string) string {
+	path := filepath.Join(dir, name)
+	if _, err := os.Stat(path); err == nil {
+		return path
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return path
+	}
+
+	for _, e := range entries {
+		if strings.EqualFold(e.Name(), name) {
+			return filepath.Join(dir, e.Name())
+		}
+	}
+
+	return path
+}
+
+// LoadTroopInfo decodes the TroopInfo.sox file of the game in gameDir.
+func LoadTroopInfo(gameDir string) (TroopInfoFile, error) {
+	file, err := os.Open(FindFold(SOXDir(gameDir), TroopInfoName))
+	if err != nil {
+		return TroopInfoFile{}, err
+	}
+	defer file.Close()
+
+	return Decode(file)
+}
+
+// SaveTroopInfo encodes tif into the TroopInfo.sox file of the game in
+// gameDir. The installed file is first copied to TroopInfo.sox.bak unless a
+// backup already exists, so the original data stays restorable. Both are
+// written with WriteFileAtomic, so a failed write leaves the previous file.
+//
+// Unlike the troopinfo command, SaveTroopInfo only checks the header of tif:
+// it doesn't refuse to write while the game is running, and doesn't run the
+// command's validation rules, which depend on its configuration. Callers
+// should close the game first and check values they didn't set themselves.
+func SaveTroopInfo(gameDir string, tif TroopInfoFile) error {
+	if !ValidHeader(tif.Version, int32(len(tif.TroopInfos))) {
+		return ErrInvalidSOX
+	}
+
+	buf := &bytes.Buffer{}
+
+	if err := Encode(buf, tif); err != nil {
+		return err
+	}
+
+	path := FindFold(SOXDir(gameDir), TroopInfoName)
+
+	if _, err := os.Stat(path + ".bak"); os.IsNotExist(err) {
+		data, err := ioutil.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		if err == nil {
+			if err := WriteFileAtomic(path+".bak", data, 0600); err != nil {
+				return err
+			}
+		}
+	}
+
+	return WriteFileAtomic(path, buf.Bytes(), 0600)
+}
+
+// Decode decodes TroopInfo.sox data from r. The data is buffered in full
+// first, so pipes, network streams and archive readers, which may return
+// short reads, decode the same way files do.
+func Decode(r io.Reader) (TroopInfoFile, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return TroopInfoFile{}, err
+	}
+
+	file := bytes.NewReader(data)
+
+	var tif TroopInfoFile
+
+	if err := sox.Decode(file, &struct{ Version, Count *int32 }{&tif.Version, &tif.Count}); err != nil {
+		return TroopInfoFile{}, ErrInvalidSOX
+	}
+
+	if !ValidHeader(tif.Version, tif.Count) {
+		return TroopInfoFile{}, ErrInvalidSOX
+	}
+
+	// Records are read in the layout of the file's version, as many as the
+	// header says there are.
+	tif.TroopInfos = make([]TroopInfo, tif.Count)
+
+	if err := sox.DecodeVersion(file, &tif.TroopInfos, tif.Version); err != nil {
+		return TroopInfoFile{}, fmt.Errorf("%w: %v", ErrInvalidSOX, err)
+	}
+
+	// The rest of the file is the trailer.
+	copy(tif.TheEnd[:], data[len(data)-file.Len():])
+
+	return tif, nil
+}
+
+// Encode writes tif to w in the layout of its version. The count in the
+// header is that of tif.TroopInfos, so records can be added or removed by
+// changing the slice.
+func Encode(w io.Writer, tif TroopInfoFile) error {
+	tif.Count = int32(len(tif.TroopInfos))
+
+	return sox.EncodeVersion(w, tif, tif.Version)
+}
+
+// ValidHeader reports whether a TroopInfo.sox header with the given version
+// and record count is one the codec can read.
+func ValidHeader(version, count int32) bool {
+	return KnownVersion(version) && count > 0 && count <= MaxTroopCount
+}
+
+// KnownVersion reports whether version is one of Versions.
+func KnownVersion(version int32) bool {
+	for _, v := range Versions {
+		if v == version {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Clone returns a copy of tif that shares no records with it, so either can
+// be edited without affecting the other.
+func (tif TroopInfoFile) Clone() TroopInfoFile {
+	tif.TroopInfos = append([]TroopInfo(nil), tif.TroopInfos...)
+
+	return tif
+}
@@ -0,0 +1,112 @@
+package kuftc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDecodeOlderVersion(t *testing.T) {
+	tif := TroopInfoFile{Version: 99}
+
+	for i := 0; i < 3; i++ {
+		tif.TroopInfos = append(tif.TroopInfos, TroopInfo{
+			TypeID:             int32(i),
+			Defense:            float32(10 + i),
+			DamageDistribution: 0.5,
+		})
+	}
+
+	buf := &bytes.Buffer{}
+
+	if err := Encode(buf, tif); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := 8 + 3*RecordSize(99) + len(tif.TheEnd); buf.Len() != want {
+		t.Fatalf("version 99 file is %d bytes, want %d", buf.Len(), want)
+	}
+
+	if RecordSize(99) != RecordSize(Version)-4 {
+		t.Errorf("version 99 records are %d bytes, want %d, those of version %d without damage_distribution", RecordSize(99), RecordSize(Version)-4, Version)
+	}
+
+	if err := VerifyData("TroopInfo.sox", buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Version != 99 || got.Count != 3 {
+		t.Fatalf("decoded version %d with %d records, want version 99 with 3", got.Version, got.Count)
+	}
+
+	for i, ti := range got.TroopInfos {
+		if ti.TypeID != int32(i) || ti.Defense != float32(10+i) {
+			t.Errorf("record %d has type %d and defense %g, want %d and %d", i, ti.TypeID, ti.Defense, i, 10+i)
+		}
+
+		if ti.DamageDistribution != 0 {
+			t.Errorf("record %d has damage_distribution %g, which version 99 doesn't hold", i, ti.DamageDistribution)
+		}
+	}
+}
+
+func TestDecodeUnknownVersion(t *testing.T) {
+	buf := &bytes.Buffer{}
+
+	if err := Encode(buf, TroopInfoFile{Version: Version, TroopInfos: make([]TroopInfo, 1)}); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buf.Bytes()
+	binary.LittleEndian.PutUint32(data[0:4], 98)
+
+	if _, err := Decode(bytes.NewReader(data)); !errors.Is(err, ErrInvalidSOX) {
+		t.Errorf("decoding version 98 returned %v, want %v", err, ErrInvalidSOX)
+	}
+}
+
+func TestSaveTroopInfo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kuftc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, TroopInfoName)
+
+	if err := ioutil.WriteFile(path, []byte("original"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tif := TroopInfoFile{Version: Version, TroopInfos: make([]TroopInfo, 2)}
+
+	if err := SaveTroopInfo(dir, tif); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := LoadTroopInfo(dir); err != nil || len(got.TroopInfos) != 2 {
+		t.Errorf("loading the saved file returned %d records and %v, want 2 records", len(got.TroopInfos), err)
+	}
+
+	if data, err := ioutil.ReadFile(path + ".bak"); err != nil || string(data) != "original" {
+		t.Errorf("backup holds %q and %v, want the original file", data, err)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 2 {
+		t.Errorf("the directory holds %d files after saving, want TroopInfo.sox and its backup", len(files))
+	}
+}
@@ -0,0 +1,78 @@
+package kuftc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/rdeusser/troopinfo/pkg/sox"
+)
+
+// ErrLayoutMismatch is returned for data files whose size doesn't match the
+// layout of their version.
+var ErrLayoutMismatch = errors.New("file size doesn't match the known layout")
+
+// ErrNotCanonical is returned for data files that don't encode back to the
+// same bytes, which means they hold data the codec doesn't understand.
+var ErrNotCanonical = errors.New("file doesn't round-trip through the codec")
+
+// RecordSize returns the size in bytes of a TroopInfo.sox record of the
+// given version.
+func RecordSize(version int32) int {
+	return sox.Size(TroopInfo{}, version)
+}
+
+// Verify checks the TroopInfo.sox file of the game in gameDir: its header,
+// that its size matches the layout of its version, and that it decodes and
+// encodes back to the same bytes. It returns nil if the file is intact, or an
+// error wrapping ErrInvalidSOX, ErrLayoutMismatch or ErrNotCanonical.
+func Verify(gameDir string) error {
+	path := FindFold(SOXDir(gameDir), TroopInfoName)
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	return VerifyData(path, data)
+}
+
+// VerifyData is Verify for TroopInfo.sox contents that are already in
+// memory. name is only used in errors.
+func VerifyData(name string, data []byte) error {
+	if len(data) < 8 {
+		return fmt.Errorf("%s: %w", name, ErrInvalidSOX)
+	}
+
+	version := int32(binary.LittleEndian.Uint32(data[0:4]))
+	count := int32(binary.LittleEndian.Uint32(data[4:8]))
+
+	if !ValidHeader(version, count) {
+		return fmt.Errorf("%s: %w: version %d with %d records, expected one of versions %v with 1 to %d records",
+			name, ErrInvalidSOX, version, count, Versions, MaxTroopCount)
+	}
+
+	want := 8 + int(count)*RecordSize(version) + len(TroopInfoFile{}.TheEnd)
+	if len(data) != want {
+		return fmt.Errorf("%s: %w: %d bytes, expected %d", name, ErrLayoutMismatch, len(data), want)
+	}
+
+	tif, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	buf := &bytes.Buffer{}
+
+	if err := Encode(buf, tif); err != nil {
+		return err
+	}
+
+	if !bytes.Equal(buf.Bytes(), data) {
+		return fmt.Errorf("%s: %w", name, ErrNotCanonical)
+	}
+
+	return nil
+}
@@ -0,0 +1,238 @@
+// Package sox reads and writes the binary layout of the game's SOX data
+// files. Values are mapped onto Go structs field by field in declaration
+// order, little-endian and without padding, e.g.
+//
+//	var header struct {
+//		Version int32
+//		Count   int32
+//	}
+//
+//	if err := sox.Decode(r, &header); err != nil {
+//		return err
+//	}
+//
+// Fixed-size integers, floats, arrays, slices and nested structs are
+// supported, and strings tagged with their size and text encoding, see
+// LookupEncoding. Slices are encoded whole and decoded at their current length, so
+// size them from the file's header first. Struct fields tagged sox:"-" are
+// left out. Fields that only exist in some file versions are tagged
+// since:"<version>" and/or until:"<version>"; the Version functions leave
+// them out of other versions, and tags on a struct or array field apply to
+// everything inside it unless overridden.
+package sox
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+// Decode reads v, a pointer, from r in the layout of the newest version.
+func Decode(r io.Reader, v interface{}) error {
+	return DecodeVersion(r, v, 0)
+}
+
+// DecodeVersion reads v, a pointer, from r in the layout of the given file
+// version. Version 0 includes every field.
+func DecodeVersion(r io.Reader, v interface{}, version int32) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("sox: Decode needs a non-nil pointer, not %T", v)
+	}
+
+	buf := make([]byte, 8)
+
+	return walk(rv.Elem(), version, fieldTags{}, func(v reflect.Value, tags fieldTags) error {
+		var b []byte
+		if v.Kind() == reflect.String {
+			b = make([]byte, tags.size)
+		} else {
+			b = buf[:v.Type().Size()]
+		}
+
+		if _, err := io.ReadFull(r, b); err != nil {
+			return err
+		}
+
+		switch v.Kind() {
+		case reflect.String:
+			return decodeTextField(v, b, tags)
+		case reflect.Int8:
+			v.SetInt(int64(int8(b[0])))
+		case reflect.Int16:
+			v.SetInt(int64(int16(binary.LittleEndian.Uint16(b))))
+		case reflect.Int32:
+			v.SetInt(int64(int32(binary.LittleEndian.Uint32(b))))
+		case reflect.Int64:
+			v.SetInt(int64(binary.LittleEndian.Uint64(b)))
+		case reflect.Uint8:
+			v.SetUint(uint64(b[0]))
+		case reflect.Uint16:
+			v.SetUint(uint64(binary.LittleEndian.Uint16(b)))
+		case reflect.Uint32:
+			v.SetUint(uint64(binary.LittleEndian.Uint32(b)))
+		case reflect.Uint64:
+			v.SetUint(binary.LittleEndian.Uint64(b))
+		case reflect.Float32:
+			v.SetFloat(float64(math.Float32frombits(binary.LittleEndian.Uint32(b))))
+		case reflect.Float64:
+			v.SetFloat(math.Float64frombits(binary.LittleEndian.Uint64(b)))
+		}
+
+		return nil
+	})
+}
+
+// Encode writes v to w in the layout of the newest version.
+func Encode(w io.Writer, v interface{}) error {
+	return EncodeVersion(w, v, 0)
+}
+
+// EncodeVersion writes v to w in the layout of the given file version.
+// Version 0 includes every field.
+func EncodeVersion(w io.Writer, v interface{}, version int32) error {
+	buf := make([]byte, 8)
+
+	return walk(reflect.ValueOf(v), version, fieldTags{}, func(v reflect.Value, tags fieldTags) error {
+		var b []byte
+		if v.Kind() == reflect.String {
+			b = make([]byte, tags.size)
+		} else {
+			b = buf[:v.Type().Size()]
+		}
+
+		switch v.Kind() {
+		case reflect.String:
+			if err := encodeTextField(v, b, tags); err != nil {
+				return err
+			}
+		case reflect.Int8:
+			b[0] = byte(v.Int())
+		case reflect.Int16:
+			binary.LittleEndian.PutUint16(b, uint16(v.Int()))
+		case reflect.Int32:
+			binary.LittleEndian.PutUint32(b, uint32(v.Int()))
+		case reflect.Int64:
+			binary.LittleEndian.PutUint64(b, uint64(v.Int()))
+		case reflect.Uint8:
+			b[0] = byte(v.Uint())
+		case reflect.Uint16:
+			binary.LittleEndian.PutUint16(b, uint16(v.Uint()))
+		case reflect.Uint32:
+			binary.LittleEndian.PutUint32(b, uint32(v.Uint()))
+		case reflect.Uint64:
+			binary.LittleEndian.PutUint64(b, v.Uint())
+		case reflect.Float32:
+			binary.LittleEndian.PutUint32(b, math.Float32bits(float32(v.Float())))
+		case reflect.Float64:
+			binary.LittleEndian.PutUint64(b, math.Float64bits(v.Float()))
+		}
+
+		_, err := w.Write(b)
+
+		return err
+	})
+}
+
+// Size returns the number of bytes v takes in the layout of the given file
+// version, or -1 if v holds types the codec doesn't support.
+func Size(v interface{}, version int32) int {
+	var n int
+
+	err := walk(reflect.ValueOf(v), version, fieldTags{}, func(v reflect.Value, tags fieldTags) error {
+		n += scalarSize(v, tags)
+		return nil
+	})
+	if err != nil {
+		return -1
+	}
+
+	return n
+}
+
+// fieldTags are the tags of a field that apply to the values inside it.
+type fieldTags struct {
+	since, until int64
+	size         int    // of strings, in bytes
+	encoding     string // of strings
+}
+
+// scalarSize returns the number of bytes the scalar v takes in a file.
+func scalarSize(v reflect.Value, tags fieldTags) int {
+	if v.Kind() == reflect.String {
+		return tags.size
+	}
+
+	return int(v.Type().Size())
+}
+
+// walk calls fn with every scalar inside v that files of the given version
+// hold, in file order. Tags are inherited from enclosing fields.
+func walk(v reflect.Value, version int32, tags fieldTags, fn func(reflect.Value, fieldTags) error) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return fmt.Errorf("sox: nil %s", v.Type())
+		}
+
+		return walk(v.Elem(), version, tags, fn)
+	case reflect.Struct:
+		t := v.Type()
+
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.Tag.Get("sox") == "-" {
+				continue
+			}
+
+			t := tags
+
+			if n, err := strconv.ParseInt(f.Tag.Get("since"), 10, 32); err == nil {
+				t.since = n
+			}
+
+			if n, err := strconv.ParseInt(f.Tag.Get("until"), 10, 32); err == nil {
+				t.until = n
+			}
+
+			if n, err := strconv.Atoi(f.Tag.Get("size")); err == nil {
+				t.size = n
+			}
+
+			if enc := f.Tag.Get("encoding"); enc != "" {
+				t.encoding = enc
+			}
+
+			if err := walk(v.Field(i), version, t, fn); err != nil {
+				return fmt.Errorf("%s: %w", f.Name, err)
+			}
+		}
+
+		return nil
+	case reflect.Array, reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := walk(v.Index(i), version, tags, fn); err != nil {
+				return fmt.Errorf("[%d]: %w", i, err)
+			}
+		}
+
+		return nil
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.String:
+		if version != 0 && ((tags.since != 0 && int64(version) < tags.since) || (tags.until != 0 && int64(version) > tags.until)) {
+			return nil
+		}
+
+		if v.Kind() == reflect.String && (tags.size <= 0 || tags.encoding == "") {
+			return fmt.Errorf("sox: strings need size and encoding tags")
+		}
+
+		return fn(v, tags)
+	default:
+		return fmt.Errorf("sox: unsupported type %s", v.Type())
+	}
+}
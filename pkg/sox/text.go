@@ -0,0 +1,139 @@
+package sox
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// Text in SOX files may be in a legacy encoding such as EUC-KR (as extended
+// by Windows code page 949), in UTF-16 or in UTF-8, so string fields name
+// their encoding along with their size in bytes, e.g.
+//
+//	Name string `size:"32" encoding:"euc-kr"`
+//
+// Strings are terminated by a NUL character and padded with NULs to the size
+// of the field.
+var encodings = map[string]encoding.Encoding{
+	"utf-8":    unicode.UTF8,
+	"euc-kr":   korean.EUCKR,
+	"cp949":    korean.EUCKR,
+	"utf-16":   utf16LE,
+	"utf-16le": utf16LE,
+}
+
+var utf16LE = unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+
+// LookupEncoding returns the text encoding of the given name, ignoring case:
+// utf-8, euc-kr (or cp949) or utf-16le (or utf-16).
+func LookupEncoding(name string) (encoding.Encoding, error) {
+	enc, ok := encodings[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("sox: unknown text encoding %q, expected utf-8, euc-kr or utf-16le", name)
+	}
+
+	return enc, nil
+}
+
+// DecodeText decodes b, which may be NUL-terminated and padded, from enc.
+func DecodeText(b []byte, enc encoding.Encoding) (string, error) {
+	if enc == utf16LE {
+		for i := 0; i+1 < len(b); i += 2 {
+			if b[i] == 0 && b[i+1] == 0 {
+				b = b[:i]
+				break
+			}
+		}
+	} else if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+
+	out, err := enc.NewDecoder().Bytes(b)
+	if err != nil {
+		return "", err
+	}
+
+	return string(out), nil
+}
+
+// EncodeText encodes s in enc. Characters enc can't represent are errors,
+// so text never changes silently on the way back into a file.
+func EncodeText(s string, enc encoding.Encoding) ([]byte, error) {
+	if strings.ContainsRune(s, 0) {
+		return nil, fmt.Errorf("sox: %q holds a NUL character, which ends strings in SOX files", s)
+	}
+
+	out, err := enc.NewEncoder().Bytes([]byte(s))
+	if err != nil {
+		return nil, fmt.Errorf("sox: %q can't be encoded as %s: %w", s, encodingName(enc), err)
+	}
+
+	return out, nil
+}
+
+// terminatorSize returns the size of the NUL character ending strings in enc.
+func terminatorSize(enc encoding.Encoding) int {
+	if enc == utf16LE {
+		return 2
+	}
+
+	return 1
+}
+
+// decodeTextField decodes a string field of a file from b.
+func decodeTextField(v reflect.Value, b []byte, tags fieldTags) error {
+	enc, err := LookupEncoding(tags.encoding)
+	if err != nil {
+		return err
+	}
+
+	s, err := DecodeText(b, enc)
+	if err != nil {
+		return err
+	}
+
+	v.SetString(s)
+
+	return nil
+}
+
+// encodeTextField encodes a string field into b, which is the size of the
+// field, padding it with NULs.
+func encodeTextField(v reflect.Value, b []byte, tags fieldTags) error {
+	enc, err := LookupEncoding(tags.encoding)
+	if err != nil {
+		return err
+	}
+
+	out, err := EncodeText(v.String(), enc)
+	if err != nil {
+		return err
+	}
+
+	if len(out)+terminatorSize(enc) > len(b) {
+		return fmt.Errorf("sox: %q takes %d bytes in %s, the field holds %d including the terminating NUL", v.String(), len(out), tags.encoding, len(b))
+	}
+
+	for i := range b {
+		b[i] = 0
+	}
+
+	copy(b, out)
+
+	return nil
+}
+
+func encodingName(enc encoding.Encoding) string {
+	for _, name := range []string{"utf-8", "euc-kr", "utf-16le"} {
+		if encodings[name] == enc {
+			return name
+		}
+	}
+
+	return fmt.Sprint(enc)
+}